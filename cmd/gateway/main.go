@@ -13,9 +13,11 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	_ "github.com/traffic-tacos/gateway-api/docs" // Swagger docs
 	"github.com/traffic-tacos/gateway-api/internal/config"
+	"github.com/traffic-tacos/gateway-api/internal/leader"
 	"github.com/traffic-tacos/gateway-api/internal/logging"
 	"github.com/traffic-tacos/gateway-api/internal/metrics"
 	"github.com/traffic-tacos/gateway-api/internal/middleware"
+	"github.com/traffic-tacos/gateway-api/internal/queue"
 	"github.com/traffic-tacos/gateway-api/internal/routes"
 
 	"github.com/gofiber/contrib/otelfiber"
@@ -135,7 +137,7 @@ func main() {
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     cfg.CORS.AllowOrigins,
 		AllowMethods:     "GET,POST,HEAD,PUT,DELETE,PATCH,OPTIONS",
-		AllowHeaders:     "Origin,Content-Type,Accept,Authorization,X-Requested-With,Idempotency-Key,X-Trace-Id,X-Dev-Mode",
+		AllowHeaders:     "Origin,Content-Type,Accept,Authorization,X-Requested-With,Idempotency-Key,X-Trace-Id",
 		AllowCredentials: true,
 		MaxAge:           86400,
 	}))
@@ -160,8 +162,102 @@ func main() {
 		logger.WithError(err).Fatal("Failed to initialize DynamoDB client")
 	}
 
+	// Per-event queue policies and pause/drain/close state, shared by the
+	// handlers and the wave scheduler so admin updates invalidate every cache
+	policyStore := queue.NewPolicyStore(middlewareManager.RedisClient, logger)
+	controlStore := queue.NewControlStore(middlewareManager.RedisClient, logger)
+
 	// Setup routes
-	routes.Setup(app, cfg, logger, middlewareManager, dynamoClient)
+	routes.Setup(app, cfg, logger, middlewareManager, dynamoClient, policyStore, controlStore)
+
+	// Singleton background workers run only on the elected leader
+	elector := leader.NewElector(middlewareManager.RedisClient, cfg.Leader.Election, cfg.Leader.LeaseTTL, logger)
+	workers := leader.NewRegistry(elector, logger)
+
+	// Self-issued token signing key rotation. Not fenced: a key is only created
+	// when no current one is stored, so a deposed leader still rotating adds no second key.
+	workers.Register("signing-key-rotator", func(ctx context.Context, _ int64) {
+		middlewareManager.SigningKeys.Run(ctx)
+	})
+
+	if cfg.Queue.JanitorEnabled {
+		janitorConfig := queue.DefaultJanitorConfig()
+		janitorConfig.Interval = cfg.Queue.JanitorInterval
+		janitorConfig.StreamMaxAge = cfg.Queue.JanitorStreamMaxAge
+		janitor := queue.NewJanitor(middlewareManager.RedisClient, janitorConfig, logger)
+		// Not fenced: each token and grant is expired by a script that re-checks it,
+		// so sweeps overlapping during a failover record every expiry once
+		workers.Register("queue-janitor", func(ctx context.Context, _ int64) {
+			janitor.Run(ctx)
+		})
+	}
+
+	if cfg.Queue.WaveSchedulerEnabled {
+		waveScheduler := queue.NewWaveScheduler(
+			middlewareManager.RedisClient,
+			policyStore,
+			controlStore,
+			cfg.Queue.WaveSchedulerTick,
+			logger,
+		)
+		workers.Register("wave-scheduler", waveScheduler.Run)
+	}
+
+	if cfg.Queue.LobbyOpenerEnabled {
+		lobbyOpener := queue.NewLobbyOpener(middlewareManager.RedisClient, policyStore, cfg.Queue.LobbyOpenerInterval, logger)
+		// Not fenced: an opening takes a lock and the open script shuffles each
+		// lobby once, so an overlapping opener finds the lobby already opened
+		workers.Register("lobby-opener", func(ctx context.Context, _ int64) {
+			lobbyOpener.Run(ctx)
+		})
+	}
+
+	if cfg.Queue.HoldSweeperEnabled {
+		holdSweeper := queue.NewHoldSweeper(middlewareManager.RedisClient, cfg.Queue.HoldSweeperInterval, logger)
+		// Not fenced: the release script re-checks each seat's hold, so a seat
+		// released by one sweeper is skipped by the other
+		workers.Register("seat-hold-sweeper", func(ctx context.Context, _ int64) {
+			holdSweeper.Run(ctx)
+		})
+	}
+
+	if cfg.Queue.AnalyticsSamplerEnabled {
+		sampler := queue.NewAnalyticsSampler(middlewareManager.RedisClient, logger)
+		// Not fenced: an overlapping sampler only adds a second sample to the same
+		// resolution bucket, which the series reads as one
+		workers.Register("queue-analytics-sampler", func(ctx context.Context, _ int64) {
+			sampler.Run(ctx)
+		})
+	}
+
+	if cfg.Queue.LifecycleExportEnabled {
+		var sink queue.LifecycleSink
+		switch {
+		case cfg.Queue.LifecycleExportURL != "":
+			sink = queue.NewHTTPSink(cfg.Queue.LifecycleExportURL, cfg.Queue.LifecycleExportToken, cfg.Queue.LifecycleExportTimeout)
+		case cfg.Queue.LifecycleExportDir != "":
+			fileSink, err := queue.NewFileSink(cfg.Queue.LifecycleExportDir)
+			if err != nil {
+				logger.WithError(err).Fatal("Failed to initialize lifecycle export directory")
+			}
+			sink = fileSink
+		default:
+			logger.Fatal("QUEUE_LIFECYCLE_EXPORT_ENABLED requires QUEUE_LIFECYCLE_EXPORT_URL or QUEUE_LIFECYCLE_EXPORT_DIR")
+		}
+
+		exporterConfig := queue.DefaultLifecycleExporterConfig()
+		exporterConfig.Interval = cfg.Queue.LifecycleExportInterval
+		exporter := queue.NewLifecycleExporter(middlewareManager.RedisClient, sink, exporterConfig, logger)
+		// Not fenced: export is at least once, so entries a deposed exporter writes
+		// again reach the sink with the same id and are deduplicated there
+		workers.Register("queue-lifecycle-exporter", func(ctx context.Context, _ int64) {
+			exporter.Run(ctx)
+		})
+	}
+
+	if workers.Len() > 0 {
+		workers.Start()
+	}
 
 	// Graceful shutdown
 	c := make(chan os.Signal, 1)
@@ -170,6 +266,7 @@ func main() {
 	go func() {
 		<-c
 		logger.Info("Gracefully shutting down...")
+		workers.Stop()
 		if err := app.Shutdown(); err != nil {
 			logger.WithError(err).Error("Server shutdown failed")
 		}
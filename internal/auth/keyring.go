@@ -0,0 +1,470 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	_ "embed"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+//go:embed lua/create_signing_key.lua
+var createSigningKeyScript string
+
+// SigningKeysKey is the HASH of the self-issued token signing keys, by key ID
+const SigningKeysKey = "auth:signing_keys"
+
+const (
+	// keyPublishLead publishes a new key this long before it signs, so verifiers
+	// caching the JWKS (JWT_CACHE_TTL, 10m by default) know it in time
+	keyPublishLead = 10 * time.Minute
+
+	// keyRefreshInterval bounds how stale a pod's copy of the keys gets
+	keyRefreshInterval = 30 * time.Second
+
+	// keyMissRefreshInterval rate-limits reloads for unknown key IDs
+	keyMissRefreshInterval = 5 * time.Second
+
+	// keyRotationCheckInterval is how often the leader checks for rotation
+	keyRotationCheckInterval = time.Minute
+)
+
+// ErrNoSigningKey is returned when no signing key could be loaded or created
+var ErrNoSigningKey = errors.New("no signing key available")
+
+// storedKey is a signing key as kept in SigningKeysKey
+type storedKey struct {
+	ID         string `json:"kid"`
+	Algorithm  string `json:"alg"`
+	PrivateKey string `json:"private_key"` // PKCS#8, AES-GCM sealed, base64
+	CreatedAt  int64  `json:"created_at"`
+}
+
+type signingKey struct {
+	id         string
+	method     jwt.SigningMethod
+	privateKey crypto.Signer
+	createdAt  time.Time
+}
+
+// KeyRing holds the key pairs self-issued tokens are signed with. The keys are
+// shared by all pods through Redis; the leader rotates them (Run), and every
+// pod reloads them periodically. A new key is published for keyPublishLead
+// before it signs, and an old one until the tokens it signed have expired.
+type KeyRing struct {
+	redisClient     redis.UniversalClient
+	algorithm       string
+	rotation        time.Duration
+	accessTTL       time.Duration
+	aead            cipher.AEAD
+	createKeyScript *redis.Script
+	logger          *logrus.Logger
+
+	mu         sync.RWMutex
+	keys       []*signingKey // Newest first
+	publicKeys jwk.Set
+	loadedAt   time.Time
+}
+
+// NewKeyRing creates a key ring with the algorithm and rotation of cfg. Keys
+// are loaded on first use.
+func NewKeyRing(redisClient redis.UniversalClient, cfg *config.JWTConfig, logger *logrus.Logger) (*KeyRing, error) {
+	encryptionKey := cfg.SigningKeyEncryptionKey
+	if encryptionKey == "" {
+		encryptionKey = "signing-keys:" + cfg.Secret
+	}
+	kek := sha256.Sum256([]byte(encryptionKey))
+	block, err := aes.NewCipher(kek[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to create key cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create key cipher: %w", err)
+	}
+
+	return &KeyRing{
+		redisClient:     redisClient,
+		algorithm:       cfg.SigningAlgorithm,
+		rotation:        cfg.SigningKeyRotation,
+		accessTTL:       cfg.AccessTokenTTL,
+		aead:            aead,
+		createKeyScript: redis.NewScript(createSigningKeyScript),
+		logger:          logger,
+		publicKeys:      jwk.NewSet(),
+	}, nil
+}
+
+// Sign signs claims with the current key, naming it in the "kid" header
+func (k *KeyRing) Sign(ctx context.Context, claims jwt.MapClaims) (string, error) {
+	key, err := k.signingKey(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.id
+	return token.SignedString(key.privateKey)
+}
+
+// PublicKeys returns the JWK set of the keys tokens may currently be signed with
+func (k *KeyRing) PublicKeys(ctx context.Context) (jwk.Set, error) {
+	if err := k.refreshIfStale(ctx, keyRefreshInterval); err != nil {
+		return nil, err
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.publicKeys, nil
+}
+
+// LookupKeyID finds a published key, reloading once when the ID is unknown
+// (a key another pod just created)
+func (k *KeyRing) LookupKeyID(ctx context.Context, keyID string) (jwk.Key, bool) {
+	set, err := k.PublicKeys(ctx)
+	if err != nil {
+		k.logger.WithError(err).Warn("Failed to load signing keys")
+		return nil, false
+	}
+	if key, found := set.LookupKeyID(keyID); found {
+		return key, true
+	}
+
+	if err := k.refreshIfStale(ctx, keyMissRefreshInterval); err != nil {
+		return nil, false
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.publicKeys.LookupKeyID(keyID)
+}
+
+// Refresh reloads the keys from Redis, creating the first key if there is none
+func (k *KeyRing) Refresh(ctx context.Context) error {
+	return k.refreshIfStale(ctx, 0)
+}
+
+// Rotate creates the next key once the newest one is due for rotation, and
+// deletes keys no unexpired token can be signed with. Reports whether a key was created.
+func (k *KeyRing) Rotate(ctx context.Context) (bool, error) {
+	if err := k.Refresh(ctx); err != nil {
+		return false, err
+	}
+
+	k.mu.RLock()
+	keys := k.keys
+	k.mu.RUnlock()
+
+	now := time.Now()
+	current := selectSigningKey(keys, now)
+
+	var expired []string
+	retention := k.rotation + k.accessTTL + 2*keyPublishLead
+	for _, key := range keys {
+		if key != current && now.Sub(key.createdAt) > retention {
+			expired = append(expired, key.id)
+		}
+	}
+	if len(expired) > 0 {
+		if err := k.redisClient.HDel(ctx, SigningKeysKey, expired...).Err(); err != nil {
+			return false, fmt.Errorf("failed to delete expired signing keys: %w", err)
+		}
+		k.logger.WithField("key_ids", expired).Info("Deleted expired signing keys")
+	}
+
+	rotated, reload := false, len(expired) > 0
+	if due := now.Add(-(k.rotation - keyPublishLead)); len(keys) == 0 || !keys[0].createdAt.After(due) {
+		keyID, created, err := k.createKey(ctx, due)
+		if err != nil {
+			return false, err
+		}
+		if created {
+			k.logger.WithFields(logrus.Fields{
+				"key_id":    keyID,
+				"algorithm": k.algorithm,
+			}).Info("Created signing key, signing with it after the publish lead")
+		} else {
+			k.logger.Info("Signing key was already rotated by another instance")
+		}
+		rotated, reload = created, true
+	}
+
+	if reload {
+		return rotated, k.Refresh(ctx)
+	}
+	return false, nil
+}
+
+// Run rotates keys until ctx is cancelled. Runs as a leader worker.
+func (k *KeyRing) Run(ctx context.Context) {
+	ticker := time.NewTicker(keyRotationCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := k.Rotate(ctx); err != nil && ctx.Err() == nil {
+			k.logger.WithError(err).Error("Signing key rotation failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (k *KeyRing) signingKey(ctx context.Context) (*signingKey, error) {
+	if err := k.refreshIfStale(ctx, keyRefreshInterval); err != nil {
+		return nil, err
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if key := selectSigningKey(k.keys, time.Now()); key != nil {
+		return key, nil
+	}
+	return nil, ErrNoSigningKey
+}
+
+// selectSigningKey picks the newest key published for keyPublishLead. Right
+// after the first keys were created, it picks the oldest, which all pods agree on.
+func selectSigningKey(keys []*signingKey, now time.Time) *signingKey {
+	for _, key := range keys {
+		if now.Sub(key.createdAt) >= keyPublishLead {
+			return key
+		}
+	}
+	if len(keys) > 0 {
+		return keys[len(keys)-1]
+	}
+	return nil
+}
+
+func (k *KeyRing) refreshIfStale(ctx context.Context, maxAge time.Duration) error {
+	k.mu.RLock()
+	fresh := !k.loadedAt.IsZero() && time.Since(k.loadedAt) < maxAge
+	k.mu.RUnlock()
+	if fresh {
+		return nil
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if !k.loadedAt.IsZero() && time.Since(k.loadedAt) < maxAge {
+		return nil
+	}
+
+	keys, err := k.load(ctx)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		// Another pod may be creating the first key too; keys that only another
+		// encryption key opens are older and do not stop this one
+		if _, _, err := k.createKey(ctx, time.Now().Add(-keyPublishLead)); err != nil {
+			return err
+		}
+		if keys, err = k.load(ctx); err != nil {
+			return err
+		}
+	}
+	if len(keys) == 0 {
+		return ErrNoSigningKey
+	}
+
+	publicKeys := jwk.NewSet()
+	for _, key := range keys {
+		publicKey, err := publicJWK(key)
+		if err != nil {
+			return err
+		}
+		if err := publicKeys.AddKey(publicKey); err != nil {
+			return fmt.Errorf("failed to add public key: %w", err)
+		}
+	}
+
+	k.keys = keys
+	k.publicKeys = publicKeys
+	k.loadedAt = time.Now()
+	return nil
+}
+
+// load reads and decrypts the stored keys, newest first. Keys that do not
+// decrypt (another encryption key) are skipped.
+func (k *KeyRing) load(ctx context.Context) ([]*signingKey, error) {
+	stored, err := k.redisClient.HGetAll(ctx, SigningKeysKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signing keys: %w", err)
+	}
+
+	keys := make([]*signingKey, 0, len(stored))
+	for keyID, raw := range stored {
+		key, err := k.open(raw)
+		if err != nil {
+			k.logger.WithError(err).WithField("key_id", keyID).Warn("Skipping unreadable signing key")
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].createdAt.Equal(keys[j].createdAt) {
+			return keys[i].id > keys[j].id
+		}
+		return keys[i].createdAt.After(keys[j].createdAt)
+	})
+	return keys, nil
+}
+
+// createKey generates a key pair with the configured algorithm and stores it,
+// unless a key created after cutoff is already stored. Reports whether it stored the key.
+func (k *KeyRing) createKey(ctx context.Context, cutoff time.Time) (string, bool, error) {
+	privateKey, err := generateSigningKey(k.algorithm)
+	if err != nil {
+		return "", false, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to encode signing key: %w", err)
+	}
+
+	now := time.Now()
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", false, fmt.Errorf("failed to generate key ID: %w", err)
+	}
+	keyID := now.UTC().Format("20060102T150405") + "-" + hex.EncodeToString(suffix)
+
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", false, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := k.aead.Seal(nonce, nonce, der, []byte(keyID))
+
+	raw, err := json.Marshal(storedKey{
+		ID:         keyID,
+		Algorithm:  k.algorithm,
+		PrivateKey: base64.StdEncoding.EncodeToString(sealed),
+		CreatedAt:  now.Unix(),
+	})
+	if err != nil {
+		return "", false, fmt.Errorf("failed to encode signing key: %w", err)
+	}
+	created, err := k.createKeyScript.Run(ctx, k.redisClient, []string{SigningKeysKey}, keyID, raw, cutoff.Unix()).Int()
+	if err != nil {
+		return "", false, fmt.Errorf("failed to store signing key: %w", err)
+	}
+	return keyID, created == 1, nil
+}
+
+// open decrypts a stored key
+func (k *KeyRing) open(raw string) (*signingKey, error) {
+	var stored storedKey
+	if err := json.Unmarshal([]byte(raw), &stored); err != nil {
+		return nil, fmt.Errorf("invalid signing key: %w", err)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(stored.PrivateKey)
+	if err != nil || len(sealed) < k.aead.NonceSize() {
+		return nil, fmt.Errorf("invalid signing key encoding")
+	}
+	nonce, ciphertext := sealed[:k.aead.NonceSize()], sealed[k.aead.NonceSize():]
+	der, err := k.aead.Open(nil, nonce, ciphertext, []byte(stored.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt signing key: %w", err)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %w", err)
+	}
+	privateKey, method, err := signerFor(parsed)
+	if err != nil {
+		return nil, err
+	}
+	if method.Alg() != stored.Algorithm {
+		return nil, fmt.Errorf("signing key algorithm mismatch: %s, stored as %s", method.Alg(), stored.Algorithm)
+	}
+
+	return &signingKey{
+		id:         stored.ID,
+		method:     method,
+		privateKey: privateKey,
+		createdAt:  time.Unix(stored.CreatedAt, 0),
+	}, nil
+}
+
+func generateSigningKey(algorithm string) (crypto.Signer, error) {
+	var key crypto.Signer
+	var err error
+	switch algorithm {
+	case "RS256":
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "ES256":
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "EdDSA":
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", algorithm)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	return key, nil
+}
+
+// signerFor picks the signing method of a private key: RS256 for RSA, ES256
+// for EC P-256, EdDSA for Ed25519
+func signerFor(key interface{}) (crypto.Signer, jwt.SigningMethod, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return k, jwt.SigningMethodRS256, nil
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, nil, fmt.Errorf("unsupported EC curve %s, want P-256", k.Curve.Params().Name)
+		}
+		return k, jwt.SigningMethodES256, nil
+	case ed25519.PrivateKey:
+		return k, jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported signing key type %T", key)
+	}
+}
+
+// publicJWK returns the public half of key as a JWK with its ID and algorithm
+func publicJWK(key *signingKey) (jwk.Key, error) {
+	publicKey, err := jwk.FromRaw(key.privateKey.Public())
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert public key: %w", err)
+	}
+	if err := publicKey.Set(jwk.KeyIDKey, key.id); err != nil {
+		return nil, err
+	}
+	if err := publicKey.Set(jwk.AlgorithmKey, jwa.SignatureAlgorithm(key.method.Alg())); err != nil {
+		return nil, err
+	}
+	if err := publicKey.Set(jwk.KeyUsageKey, jwk.ForSignature); err != nil {
+		return nil, err
+	}
+	return publicKey, nil
+}
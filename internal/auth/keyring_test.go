@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/config"
+	"github.com/traffic-tacos/gateway-api/internal/testutil"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestKeyRing(t *testing.T, algorithm, secret string) (*KeyRing, redis.UniversalClient) {
+	redisClient := testutil.NewRedisClient(t)
+
+	keyRing, err := NewKeyRing(redisClient, &config.JWTConfig{
+		Secret:             secret,
+		SigningAlgorithm:   algorithm,
+		SigningKeyRotation: time.Hour,
+		AccessTokenTTL:     15 * time.Minute,
+	}, logrus.New())
+	require.NoError(t, err)
+	return keyRing, redisClient
+}
+
+func cleanupSigningKeys(t *testing.T, redisClient redis.UniversalClient) {
+	redisClient.Del(context.Background(), SigningKeysKey)
+	t.Cleanup(func() { redisClient.Del(context.Background(), SigningKeysKey) })
+}
+
+// ageSigningKey moves a stored key's creation time back by age
+func ageSigningKey(t *testing.T, redisClient redis.UniversalClient, keyID string, age time.Duration) {
+	ctx := context.Background()
+	raw, err := redisClient.HGet(ctx, SigningKeysKey, keyID).Result()
+	require.NoError(t, err)
+
+	var stored storedKey
+	require.NoError(t, json.Unmarshal([]byte(raw), &stored))
+	stored.CreatedAt -= int64(age.Seconds())
+	updated, err := json.Marshal(stored)
+	require.NoError(t, err)
+	require.NoError(t, redisClient.HSet(ctx, SigningKeysKey, keyID, updated).Err())
+}
+
+// verifyWithKeyRing verifies a token the way AuthMiddleware does: by its kid in the JWK set
+func verifyWithKeyRing(t *testing.T, keyRing *KeyRing, tokenString string) *jwt.Token {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		keyID, _ := token.Header["kid"].(string)
+		key, found := keyRing.LookupKeyID(context.Background(), keyID)
+		require.True(t, found)
+		assert.Equal(t, token.Method.Alg(), key.Algorithm().String())
+
+		var verifyKey interface{}
+		require.NoError(t, key.Raw(&verifyKey))
+		return verifyKey, nil
+	})
+	require.NoError(t, err)
+	return token
+}
+
+func TestKeyRing_SignAndVerify(t *testing.T) {
+	for _, algorithm := range []string{"RS256", "ES256", "EdDSA"} {
+		t.Run(algorithm, func(t *testing.T) {
+			keyRing, redisClient := newTestKeyRing(t, algorithm, "secret")
+			cleanupSigningKeys(t, redisClient)
+			ctx := context.Background()
+
+			tokenString, err := keyRing.Sign(ctx, jwt.MapClaims{"sub": "user-1"})
+			require.NoError(t, err)
+
+			// Another pod with the same secret verifies it through the stored keys
+			otherPod, _ := newTestKeyRing(t, algorithm, "secret")
+			token := verifyWithKeyRing(t, otherPod, tokenString)
+			assert.Equal(t, algorithm, token.Method.Alg())
+			assert.Equal(t, "user-1", token.Claims.(jwt.MapClaims)["sub"])
+
+			// Private keys are sealed: a pod with another secret cannot read them
+			stranger, _ := newTestKeyRing(t, algorithm, "another-secret")
+			keys, err := stranger.load(ctx)
+			require.NoError(t, err)
+			assert.Empty(t, keys)
+		})
+	}
+}
+
+func TestKeyRing_Rotate(t *testing.T) {
+	keyRing, redisClient := newTestKeyRing(t, "ES256", "secret")
+	cleanupSigningKeys(t, redisClient)
+	ctx := context.Background()
+
+	firstToken, err := keyRing.Sign(ctx, jwt.MapClaims{"sub": "user-1"})
+	require.NoError(t, err)
+	firstKeyID, _ := verifyWithKeyRing(t, keyRing, firstToken).Header["kid"].(string)
+
+	// Not due yet
+	rotated, err := keyRing.Rotate(ctx)
+	require.NoError(t, err)
+	assert.False(t, rotated)
+
+	// Due: the next key is published but does not sign until the publish lead passed
+	ageSigningKey(t, redisClient, firstKeyID, time.Hour)
+	rotated, err = keyRing.Rotate(ctx)
+	require.NoError(t, err)
+	assert.True(t, rotated)
+
+	set, err := keyRing.PublicKeys(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, set.Len())
+
+	token, err := keyRing.Sign(ctx, jwt.MapClaims{"sub": "user-1"})
+	require.NoError(t, err)
+	assert.Equal(t, firstKeyID, verifyWithKeyRing(t, keyRing, token).Header["kid"])
+
+	var secondKeyID string
+	for i := 0; i < set.Len(); i++ {
+		if key, _ := set.Key(i); key.KeyID() != firstKeyID {
+			secondKeyID = key.KeyID()
+		}
+	}
+	ageSigningKey(t, redisClient, secondKeyID, keyPublishLead)
+	require.NoError(t, keyRing.Refresh(ctx))
+
+	token, err = keyRing.Sign(ctx, jwt.MapClaims{"sub": "user-1"})
+	require.NoError(t, err)
+	assert.Equal(t, secondKeyID, verifyWithKeyRing(t, keyRing, token).Header["kid"])
+
+	// Tokens of the retired key still verify until they expire, then it is deleted
+	verifyWithKeyRing(t, keyRing, firstToken)
+	ageSigningKey(t, redisClient, firstKeyID, 15*time.Minute+2*keyPublishLead+time.Minute)
+	_, err = keyRing.Rotate(ctx)
+	require.NoError(t, err)
+
+	set, err = keyRing.PublicKeys(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, set.Len())
+	_, found := set.LookupKeyID(firstKeyID)
+	assert.False(t, found)
+}
+
+func TestKeyRing_RotateOnce(t *testing.T) {
+	keyRing, redisClient := newTestKeyRing(t, "ES256", "secret")
+	cleanupSigningKeys(t, redisClient)
+	ctx := context.Background()
+
+	require.NoError(t, keyRing.Refresh(ctx))
+	keys, err := keyRing.load(ctx)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	ageSigningKey(t, redisClient, keys[0].id, time.Hour)
+
+	// A deposed leader and the new one both found the rotation due
+	otherPod, _ := newTestKeyRing(t, "ES256", "secret")
+	due := time.Now().Add(-(time.Hour - keyPublishLead))
+	_, created, err := keyRing.createKey(ctx, due)
+	require.NoError(t, err)
+	assert.True(t, created)
+	_, created, err = otherPod.createKey(ctx, due)
+	require.NoError(t, err)
+	assert.False(t, created, "A current key is already stored")
+
+	rotated, err := otherPod.Rotate(ctx)
+	require.NoError(t, err)
+	assert.False(t, rotated)
+	assert.Equal(t, int64(2), redisClient.HLen(ctx, SigningKeysKey).Val())
+
+	// Keys another encryption key sealed do not stop a pod creating its first key
+	keys, err = keyRing.load(ctx)
+	require.NoError(t, err)
+	for _, key := range keys {
+		ageSigningKey(t, redisClient, key.id, keyPublishLead)
+	}
+	stranger, _ := newTestKeyRing(t, "ES256", "another-secret")
+	_, err = stranger.Sign(ctx, jwt.MapClaims{"sub": "user-1"})
+	require.NoError(t, err)
+}
@@ -0,0 +1,237 @@
+package auth
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/config"
+	"github.com/traffic-tacos/gateway-api/internal/metrics"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+//go:embed lua/record_login_failure.lua
+var recordLoginFailureScript string
+
+// LoginEventsKey is the Redis stream login lockouts and unlocks are recorded in
+const LoginEventsKey = "audit:login"
+
+// loginEventsMaxLen approximately bounds the login events stream
+const loginEventsMaxLen = 100000
+
+// Subjects failed logins are counted for
+const (
+	LoginSubjectUser = "user"
+	LoginSubjectIP   = "ip"
+)
+
+// loginFailuresKey returns the failure counter HASH of a username or client IP
+func loginFailuresKey(subject, value string) string {
+	return fmt.Sprintf("auth:login_failures:%s:%s", subject, value)
+}
+
+// LoginDecision tells whether a login attempt may proceed
+type LoginDecision struct {
+	Allowed    bool
+	Locked     bool          // Locked out, rather than backing off
+	Subject    string        // LoginSubjectUser or LoginSubjectIP, when not allowed
+	RetryAfter time.Duration // Until the next attempt is allowed
+}
+
+// loginLimits are the backoff and lockout settings of one subject
+type loginLimits struct {
+	freeAttempts     int
+	lockoutThreshold int
+}
+
+// LoginGuard throttles password guessing. Failed logins are counted per
+// username and per client IP; each failure past the free attempts doubles the
+// wait before the next attempt, and the lockout threshold locks the subject
+// for a while. Lockouts and unlocks are logged, counted and appended to the
+// login events stream.
+type LoginGuard struct {
+	redisClient   redis.UniversalClient
+	failureScript *redis.Script
+	config        *config.LoginConfig
+	limits        map[string]loginLimits
+	logger        *logrus.Logger
+}
+
+// NewLoginGuard creates a new login guard with the limits of cfg
+func NewLoginGuard(redisClient redis.UniversalClient, cfg *config.LoginConfig, logger *logrus.Logger) *LoginGuard {
+	return &LoginGuard{
+		redisClient:   redisClient,
+		failureScript: redis.NewScript(recordLoginFailureScript),
+		config:        cfg,
+		limits: map[string]loginLimits{
+			LoginSubjectUser: {freeAttempts: cfg.FreeAttempts, lockoutThreshold: cfg.LockoutThreshold},
+			LoginSubjectIP:   {freeAttempts: cfg.IPFreeAttempts, lockoutThreshold: cfg.IPLockoutThreshold},
+		},
+		logger: logger,
+	}
+}
+
+// Check decides whether a login for username from clientIP may be attempted.
+// Fails open: a Redis error allows the attempt.
+func (g *LoginGuard) Check(ctx context.Context, username, clientIP string) LoginDecision {
+	subjects := [][2]string{{LoginSubjectUser, normalizeUsername(username)}, {LoginSubjectIP, clientIP}}
+
+	pipe := g.redisClient.Pipeline()
+	cmds := make([]*redis.SliceCmd, len(subjects))
+	for i, subject := range subjects {
+		cmds[i] = pipe.HMGet(ctx, loginFailuresKey(subject[0], subject[1]), "blocked_until", "locked_until")
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		g.logger.WithError(err).Warn("Login throttle check failed")
+		return LoginDecision{Allowed: true}
+	}
+
+	now := time.Now().UnixMilli()
+	decision := LoginDecision{Allowed: true}
+	for i, cmd := range cmds {
+		values := cmd.Val()
+		if len(values) < 2 {
+			continue
+		}
+		blockedUntil := parseMillis(values[0])
+		if blockedUntil <= now {
+			continue
+		}
+
+		retryAfter := time.Duration(blockedUntil-now) * time.Millisecond
+		if decision.Allowed || retryAfter > decision.RetryAfter {
+			decision = LoginDecision{
+				Allowed:    false,
+				Locked:     parseMillis(values[1]) > now,
+				Subject:    subjects[i][0],
+				RetryAfter: retryAfter,
+			}
+		}
+	}
+
+	if !decision.Allowed {
+		reason := "backoff"
+		if decision.Locked {
+			reason = "locked"
+		}
+		metrics.RecordLoginThrottled(decision.Subject, reason)
+	}
+	return decision
+}
+
+// RecordFailure counts a failed login for username and clientIP, locking
+// either out when it reaches its threshold
+func (g *LoginGuard) RecordFailure(ctx context.Context, username, clientIP string) {
+	g.recordFailure(ctx, LoginSubjectUser, normalizeUsername(username), username, clientIP)
+	g.recordFailure(ctx, LoginSubjectIP, clientIP, username, clientIP)
+}
+
+func (g *LoginGuard) recordFailure(ctx context.Context, subject, value, username, clientIP string) {
+	limits := g.limits[subject]
+	result, err := g.failureScript.Run(
+		ctx,
+		g.redisClient,
+		[]string{loginFailuresKey(subject, value)},
+		time.Now().UnixMilli(),
+		limits.freeAttempts,
+		g.config.BackoffBase.Milliseconds(),
+		g.config.BackoffMax.Milliseconds(),
+		limits.lockoutThreshold,
+		g.config.LockoutDuration.Milliseconds(),
+		g.config.FailureWindow.Milliseconds(),
+	).Int64Slice()
+	if err != nil {
+		g.logger.WithError(err).WithField("subject", subject).Warn("Failed to record login failure")
+		return
+	}
+	if len(result) < 3 || result[2] != 1 {
+		return
+	}
+
+	lockedUntil := time.UnixMilli(result[1])
+	g.logger.WithFields(logrus.Fields{
+		"subject":      subject,
+		"username":     username,
+		"client_ip":    clientIP,
+		"failures":     result[0],
+		"locked_until": lockedUntil.UTC().Format(time.RFC3339),
+	}).Warn("Login locked out after repeated failures")
+	metrics.RecordLoginLockout(subject)
+	g.recordEvent(ctx, map[string]interface{}{
+		"type":         "locked",
+		"subject":      subject,
+		"value":        value,
+		"username":     username,
+		"client_ip":    clientIP,
+		"failures":     result[0],
+		"locked_until": lockedUntil.Unix(),
+	})
+}
+
+// RecordSuccess clears the failures of username. The client IP keeps its
+// failures, so logging into an own account does not reset a guessing run.
+func (g *LoginGuard) RecordSuccess(ctx context.Context, username string) {
+	if err := g.redisClient.Del(ctx, loginFailuresKey(LoginSubjectUser, normalizeUsername(username))).Err(); err != nil {
+		g.logger.WithError(err).Warn("Failed to clear login failures")
+	}
+}
+
+// Unlock clears the failures, backoff and lockout of username. Returns
+// whether the account was locked.
+func (g *LoginGuard) Unlock(ctx context.Context, username, unlockedBy string) (bool, error) {
+	key := loginFailuresKey(LoginSubjectUser, normalizeUsername(username))
+
+	lockedUntil, err := g.redisClient.HGet(ctx, key, "locked_until").Result()
+	if err != nil && err != redis.Nil {
+		return false, fmt.Errorf("failed to read lockout: %w", err)
+	}
+	if err := g.redisClient.Del(ctx, key).Err(); err != nil {
+		return false, fmt.Errorf("failed to unlock: %w", err)
+	}
+
+	wasLocked := parseMillis(lockedUntil) > time.Now().UnixMilli()
+	g.logger.WithFields(logrus.Fields{
+		"username":    username,
+		"unlocked_by": unlockedBy,
+		"was_locked":  wasLocked,
+	}).Info("Login unlocked")
+	metrics.RecordLoginUnlock()
+	g.recordEvent(ctx, map[string]interface{}{
+		"type":        "unlocked",
+		"subject":     LoginSubjectUser,
+		"value":       normalizeUsername(username),
+		"username":    username,
+		"unlocked_by": unlockedBy,
+		"was_locked":  wasLocked,
+	})
+	return wasLocked, nil
+}
+
+func (g *LoginGuard) recordEvent(ctx context.Context, values map[string]interface{}) {
+	values["timestamp"] = time.Now().Unix()
+	if err := g.redisClient.XAdd(ctx, &redis.XAddArgs{
+		Stream: LoginEventsKey,
+		MaxLen: loginEventsMaxLen,
+		Approx: true,
+		Values: values,
+	}).Err(); err != nil {
+		g.logger.WithError(err).Error("Failed to record login event")
+	}
+}
+
+// normalizeUsername folds case, so "Alice" and "alice" share a counter
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// parseMillis parses a Unix milliseconds hash field, 0 when missing
+func parseMillis(value interface{}) int64 {
+	s, _ := value.(string)
+	millis, _ := strconv.ParseInt(s, 10, 64)
+	return millis
+}
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/config"
+	"github.com/traffic-tacos/gateway-api/internal/testutil"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLoginGuard(t *testing.T) (*LoginGuard, redis.UniversalClient) {
+	redisClient := testutil.NewRedisClient(t)
+
+	guard := NewLoginGuard(redisClient, &config.LoginConfig{
+		FreeAttempts:       2,
+		IPFreeAttempts:     10,
+		BackoffBase:        time.Second,
+		BackoffMax:         4 * time.Second,
+		LockoutThreshold:   5,
+		IPLockoutThreshold: 6,
+		LockoutDuration:    10 * time.Minute,
+		FailureWindow:      time.Minute,
+	}, logrus.New())
+	return guard, redisClient
+}
+
+// loginEventsSince returns the login events recorded after start, removing them afterwards
+func loginEventsSince(t *testing.T, redisClient redis.UniversalClient, start string) []redis.XMessage {
+	ctx := context.Background()
+	messages, err := redisClient.XRange(ctx, LoginEventsKey, "("+start, "+").Result()
+	require.NoError(t, err)
+	for _, message := range messages {
+		redisClient.XDel(ctx, LoginEventsKey, message.ID)
+	}
+	return messages
+}
+
+func TestLoginGuard_BackoffAndLockout(t *testing.T) {
+	guard, redisClient := newTestLoginGuard(t)
+	ctx := context.Background()
+	clientIP := "203.0.113.7"
+	keys := []string{
+		loginFailuresKey(LoginSubjectUser, "guard-test-alice"),
+		loginFailuresKey(LoginSubjectUser, "guard-test-bob"),
+		loginFailuresKey(LoginSubjectIP, clientIP),
+	}
+	redisClient.Del(ctx, keys...)
+	t.Cleanup(func() { redisClient.Del(ctx, keys...) })
+	start := strconv.FormatInt(time.Now().UnixMilli(), 10)
+
+	// Free attempts
+	for i := 0; i < 2; i++ {
+		guard.RecordFailure(ctx, "guard-test-alice", clientIP)
+		assert.True(t, guard.Check(ctx, "guard-test-alice", clientIP).Allowed)
+	}
+
+	// Then each failure doubles the wait, up to the max
+	guard.RecordFailure(ctx, "Guard-Test-Alice", clientIP)
+	decision := guard.Check(ctx, "guard-test-alice", clientIP)
+	assert.False(t, decision.Allowed)
+	assert.False(t, decision.Locked)
+	assert.Equal(t, LoginSubjectUser, decision.Subject)
+	assert.InDelta(t, time.Second, decision.RetryAfter, float64(100*time.Millisecond))
+
+	guard.RecordFailure(ctx, "guard-test-alice", clientIP)
+	assert.InDelta(t, 2*time.Second, guard.Check(ctx, "guard-test-alice", clientIP).RetryAfter, float64(100*time.Millisecond))
+
+	// The threshold locks the account, not other users on the same IP
+	guard.RecordFailure(ctx, "guard-test-alice", clientIP)
+	decision = guard.Check(ctx, "guard-test-alice", clientIP)
+	assert.False(t, decision.Allowed)
+	assert.True(t, decision.Locked)
+	assert.InDelta(t, 10*time.Minute, decision.RetryAfter, float64(time.Second))
+	assert.True(t, guard.Check(ctx, "guard-test-bob", clientIP).Allowed)
+
+	// The IP locks at its own threshold
+	guard.RecordFailure(ctx, "guard-test-bob", clientIP)
+	decision = guard.Check(ctx, "guard-test-carol", clientIP)
+	assert.False(t, decision.Allowed)
+	assert.True(t, decision.Locked)
+	assert.Equal(t, LoginSubjectIP, decision.Subject)
+
+	// Admin unlock clears the account only
+	wasLocked, err := guard.Unlock(ctx, "guard-test-alice", "admin-1")
+	require.NoError(t, err)
+	assert.True(t, wasLocked)
+	assert.True(t, guard.Check(ctx, "guard-test-alice", "198.51.100.1").Allowed)
+	assert.False(t, guard.Check(ctx, "guard-test-alice", clientIP).Allowed)
+
+	events := loginEventsSince(t, redisClient, start)
+	require.Len(t, events, 3)
+	assert.Equal(t, "locked", events[0].Values["type"])
+	assert.Equal(t, LoginSubjectUser, events[0].Values["subject"])
+	assert.Equal(t, "5", events[0].Values["failures"])
+	assert.Equal(t, "locked", events[1].Values["type"])
+	assert.Equal(t, LoginSubjectIP, events[1].Values["subject"])
+	assert.Equal(t, "unlocked", events[2].Values["type"])
+	assert.Equal(t, "admin-1", events[2].Values["unlocked_by"])
+}
+
+func TestLoginGuard_SuccessResetsUser(t *testing.T) {
+	guard, redisClient := newTestLoginGuard(t)
+	ctx := context.Background()
+	clientIP := "203.0.113.8"
+	keys := []string{
+		loginFailuresKey(LoginSubjectUser, "guard-test-dave"),
+		loginFailuresKey(LoginSubjectIP, clientIP),
+	}
+	redisClient.Del(ctx, keys...)
+	t.Cleanup(func() { redisClient.Del(ctx, keys...) })
+
+	for i := 0; i < 3; i++ {
+		guard.RecordFailure(ctx, "guard-test-dave", clientIP)
+	}
+	guard.RecordSuccess(ctx, "guard-test-dave")
+
+	exists, err := redisClient.Exists(ctx, keys[0]).Result()
+	require.NoError(t, err)
+	assert.Zero(t, exists)
+
+	// The IP keeps its count
+	failures, err := redisClient.HGet(ctx, keys[1], "failures").Int()
+	require.NoError(t, err)
+	assert.Equal(t, 3, failures)
+}
@@ -0,0 +1,24 @@
+-- create_signing_key.lua
+-- Store a new signing key unless one was created after the cutoff
+--
+-- KEYS[1]: signing keys hash, key ID -> stored key JSON (e.g., "auth:signing_keys")
+--
+-- ARGV[1]: key ID
+-- ARGV[2]: stored key JSON
+-- ARGV[3]: cutoff (Unix seconds): a key created after it is still current
+--
+-- Two instances that both found a rotation due (a leader that lost its lease
+-- and the next one, or two pods creating the first key) create one key between them.
+--
+-- Returns: 1 when the key was stored, 0 when a current key already exists
+
+local cutoff = tonumber(ARGV[3])
+for _, raw in ipairs(redis.call('HVALS', KEYS[1])) do
+    local ok, stored = pcall(cjson.decode, raw)
+    if ok and tonumber(stored['created_at'] or 0) > cutoff then
+        return 0
+    end
+end
+
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+return 1
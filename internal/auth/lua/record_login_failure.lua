@@ -0,0 +1,39 @@
+-- record_login_failure.lua
+-- Count a failed login for one subject (a username or a client IP) and block
+-- further attempts: exponential backoff past the free attempts, lockout at the threshold
+--
+-- KEYS[1]: failure counter hash (e.g., "auth:login_failures:user:alice")
+--
+-- ARGV[1]: now (Unix milliseconds)
+-- ARGV[2]: free attempts (failures without backoff)
+-- ARGV[3]: backoff base (ms)
+-- ARGV[4]: backoff max (ms)
+-- ARGV[5]: lockout threshold (0 = never lock)
+-- ARGV[6]: lockout duration (ms)
+-- ARGV[7]: failure window (ms): the counter resets after this long without failures
+--
+-- Hash fields: failures, blocked_until (ms), locked_until (ms)
+--
+-- Returns: {failures, blocked_until, locked (1 when this failure locked the subject)}
+
+local now = tonumber(ARGV[1])
+local free_attempts = tonumber(ARGV[2])
+local threshold = tonumber(ARGV[5])
+
+local failures = redis.call('HINCRBY', KEYS[1], 'failures', 1)
+local blocked_until = 0
+local locked = 0
+
+if threshold > 0 and failures >= threshold then
+    blocked_until = now + tonumber(ARGV[6])
+    locked = 1
+    redis.call('HSET', KEYS[1], 'locked_until', blocked_until)
+elseif failures > free_attempts then
+    local delay = tonumber(ARGV[3]) * math.pow(2, failures - free_attempts - 1)
+    blocked_until = now + math.min(delay, tonumber(ARGV[4]))
+end
+redis.call('HSET', KEYS[1], 'blocked_until', blocked_until)
+
+redis.call('PEXPIRE', KEYS[1], math.max(tonumber(ARGV[7]), blocked_until - now))
+
+return {failures, blocked_until, locked}
@@ -0,0 +1,56 @@
+-- rotate_refresh_token.lua
+-- Atomically swap a session's refresh token for a new one, detecting reuse
+--
+-- KEYS[1]: session hash (e.g., "auth:session:sessionID")
+--
+-- ARGV[1]: sha256 of the presented refresh token
+-- ARGV[2]: sha256 of the new refresh token
+-- ARGV[3]: now (Unix seconds)
+-- ARGV[4]: grace period for the token just rotated away (seconds)
+-- ARGV[5]: number of rotated-away token hashes kept for reuse detection
+--
+-- Presenting a token that was already rotated away means it was copied: the
+-- session is deleted so neither copy can refresh again. Within the grace
+-- period the previous token is only refused, so a client retrying a refresh
+-- whose response it lost is not logged out. Only hashes of tokens this session
+-- issued count as reuse: the session ID is no secret, so any other token for
+-- it is just invalid and must not end the session.
+--
+-- Returns:
+--   {1, session fields (HGETALL)} on success
+--   {0, "NOT_FOUND"} session missing, expired or revoked, or token unknown
+--   {0, "STALE"} previous token presented within the grace period
+--   {0, "REUSED", user_id} reuse detected, session revoked
+
+local fields = redis.call('HMGET', KEYS[1], 'token_hash', 'previous_hash', 'rotated_at', 'user_id', 'issued_hashes')
+local current, previous, rotated_at, user_id = fields[1], fields[2], fields[3], fields[4]
+local issued = fields[5] or ''
+if not current then
+    return {0, 'NOT_FOUND'}
+end
+
+if current ~= ARGV[1] then
+    if previous == ARGV[1] and tonumber(ARGV[3]) - tonumber(rotated_at) <= tonumber(ARGV[4]) then
+        return {0, 'STALE'}
+    end
+    if previous == ARGV[1] or string.find(' ' .. issued .. ' ', ' ' .. ARGV[1] .. ' ', 1, true) then
+        redis.call('DEL', KEYS[1])
+        return {0, 'REUSED', user_id}
+    end
+    return {0, 'NOT_FOUND'}
+end
+
+-- Remember the token rotated away, newest first, up to ARGV[5] hashes
+local history = {ARGV[1]}
+for hash in string.gmatch(issued, '%S+') do
+    if #history >= tonumber(ARGV[5]) then
+        break
+    end
+    table.insert(history, hash)
+end
+
+redis.call('HSET', KEYS[1], 'token_hash', ARGV[2], 'previous_hash', ARGV[1], 'rotated_at', ARGV[3],
+    'issued_hashes', table.concat(history, ' '))
+redis.call('HINCRBY', KEYS[1], 'generation', 1)
+
+return {1, redis.call('HGETALL', KEYS[1])}
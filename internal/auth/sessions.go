@@ -0,0 +1,318 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+//go:embed lua/rotate_refresh_token.lua
+var rotateRefreshTokenScript string
+
+// Refresh failures
+var (
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid or expired")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used")
+)
+
+const (
+	// refreshGracePeriod lets a client retry a refresh whose response it lost
+	// without the retry counting as reuse
+	refreshGracePeriod = 10 * time.Second
+
+	// refreshTokenHistory bounds the rotated-away refresh tokens a session
+	// remembers; presenting one of them is reuse, any other token is invalid
+	refreshTokenHistory = 32
+
+	// revokedBeforeTTL keeps a logout-all cutoff longer than any access token
+	// lives, including the 24h tokens issued before refresh tokens existed
+	revokedBeforeTTL = 24 * time.Hour
+)
+
+// sessionKey returns the hash of a login session: its user and the hash of
+// its current refresh token
+func sessionKey(sessionID string) string {
+	return fmt.Sprintf("auth:session:%s", sessionID)
+}
+
+// userSessionsKey returns the SET of a user's session IDs, for logout-all
+func userSessionsKey(userID string) string {
+	return fmt.Sprintf("auth:user_sessions:%s", userID)
+}
+
+// Revocation keys share the user hash tag, so one MGET checks a token
+func revokedTokenKey(userID, tokenID string) string {
+	return fmt.Sprintf("auth:revoked:{%s}:jti:%s", userID, tokenID)
+}
+
+func revokedSessionKey(userID, sessionID string) string {
+	return fmt.Sprintf("auth:revoked:{%s}:sid:%s", userID, sessionID)
+}
+
+func revokedBeforeKey(userID string) string {
+	return fmt.Sprintf("auth:revoked:{%s}:before", userID)
+}
+
+// Session is a login session. Each refresh rotates its refresh token; the
+// access tokens issued for it carry its ID in the "sid" claim.
+type Session struct {
+	ID          string
+	UserID      string
+	Username    string
+	DisplayName string
+	Role        string
+	CreatedAt   time.Time
+	Generation  int // Refreshes so far
+}
+
+// SessionStore keeps login sessions and revocations in Redis. Refresh tokens
+// are stored as SHA-256 hashes only.
+type SessionStore struct {
+	redisClient  redis.UniversalClient
+	accessTTL    time.Duration
+	refreshTTL   time.Duration
+	rotateScript *redis.Script
+	logger       *logrus.Logger
+}
+
+// NewSessionStore creates a new session store with the token lifetimes of cfg
+func NewSessionStore(redisClient redis.UniversalClient, cfg *config.JWTConfig, logger *logrus.Logger) *SessionStore {
+	return &SessionStore{
+		redisClient:  redisClient,
+		accessTTL:    cfg.AccessTokenTTL,
+		refreshTTL:   cfg.RefreshTokenTTL,
+		rotateScript: redis.NewScript(rotateRefreshTokenScript),
+		logger:       logger,
+	}
+}
+
+// AccessTTL returns the lifetime of access tokens
+func (s *SessionStore) AccessTTL() time.Duration {
+	return s.accessTTL
+}
+
+// RefreshTTL returns the lifetime of a session and its refresh tokens
+func (s *SessionStore) RefreshTTL() time.Duration {
+	return s.refreshTTL
+}
+
+// Create starts a session for a user who just logged in. Returns the session
+// with its ID set and the first refresh token.
+func (s *SessionStore) Create(ctx context.Context, session Session) (*Session, string, error) {
+	session.ID = uuid.New().String()
+	session.CreatedAt = time.Now()
+	session.Generation = 0
+
+	refreshToken, err := newRefreshToken(session.ID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	key := sessionKey(session.ID)
+	pipe := s.redisClient.Pipeline()
+	pipe.HSet(ctx, key,
+		"user_id", session.UserID,
+		"username", session.Username,
+		"display_name", session.DisplayName,
+		"role", session.Role,
+		"created_at", session.CreatedAt.Unix(),
+		"generation", 0,
+		"token_hash", hashRefreshToken(refreshToken),
+	)
+	pipe.Expire(ctx, key, s.refreshTTL)
+	pipe.SAdd(ctx, userSessionsKey(session.UserID), session.ID)
+	pipe.Expire(ctx, userSessionsKey(session.UserID), s.refreshTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, "", fmt.Errorf("failed to store session: %w", err)
+	}
+
+	return &session, refreshToken, nil
+}
+
+// Rotate exchanges a refresh token for a new one. A token of the session that
+// was already rotated away revokes the whole session (ErrRefreshTokenReused);
+// a token the session never issued is only invalid.
+func (s *SessionStore) Rotate(ctx context.Context, refreshToken string) (*Session, string, error) {
+	sessionID, _, ok := strings.Cut(refreshToken, ".")
+	if !ok || sessionID == "" {
+		return nil, "", ErrRefreshTokenInvalid
+	}
+
+	next, err := newRefreshToken(sessionID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	result, err := s.rotateScript.Run(
+		ctx,
+		s.redisClient,
+		[]string{sessionKey(sessionID)},
+		hashRefreshToken(refreshToken), hashRefreshToken(next), time.Now().Unix(), int(refreshGracePeriod.Seconds()), refreshTokenHistory,
+	).Slice()
+	if err != nil {
+		return nil, "", fmt.Errorf("lua script failed: %w", err)
+	}
+	if len(result) < 2 {
+		return nil, "", fmt.Errorf("invalid result array length: %d", len(result))
+	}
+
+	if status, _ := result[0].(int64); status == 0 {
+		if reason, _ := result[1].(string); reason == "REUSED" && len(result) > 2 {
+			userID, _ := result[2].(string)
+			s.logger.WithFields(logrus.Fields{
+				"user_id":    userID,
+				"session_id": sessionID,
+			}).Warn("Refresh token reuse detected, session revoked")
+
+			if err := s.Revoke(ctx, userID, sessionID); err != nil {
+				return nil, "", err
+			}
+			return nil, "", ErrRefreshTokenReused
+		}
+		return nil, "", ErrRefreshTokenInvalid
+	}
+
+	fields, _ := result[1].([]interface{})
+	session := parseSession(sessionID, fields)
+	return session, next, nil
+}
+
+// Revoke ends a session: it can no longer refresh, and access tokens already
+// issued for it are rejected until they expire
+func (s *SessionStore) Revoke(ctx context.Context, userID, sessionID string) error {
+	if err := s.redisClient.Del(ctx, sessionKey(sessionID)).Err(); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	if userID == "" {
+		return nil
+	}
+
+	pipe := s.redisClient.Pipeline()
+	pipe.SRem(ctx, userSessionsKey(userID), sessionID)
+	pipe.Set(ctx, revokedSessionKey(userID, sessionID), "1", s.accessTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	return nil
+}
+
+// RevokeToken rejects one access token (by its "jti") until it expires
+func (s *SessionStore) RevokeToken(ctx context.Context, userID, tokenID string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if tokenID == "" || ttl <= 0 {
+		return nil
+	}
+	if err := s.redisClient.Set(ctx, revokedTokenKey(userID, tokenID), "1", ttl).Err(); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	return nil
+}
+
+// RevokeAll ends every session of a user and rejects every access token issued
+// to them so far, including tokens without a session. Returns the number of
+// sessions ended.
+func (s *SessionStore) RevokeAll(ctx context.Context, userID string) (int, error) {
+	if err := s.redisClient.Set(ctx, revokedBeforeKey(userID), time.Now().Unix(), revokedBeforeTTL).Err(); err != nil {
+		return 0, fmt.Errorf("failed to revoke tokens: %w", err)
+	}
+
+	sessionIDs, err := s.redisClient.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	for i, sessionID := range sessionIDs {
+		if err := s.Revoke(ctx, userID, sessionID); err != nil {
+			return i, err
+		}
+	}
+	return len(sessionIDs), nil
+}
+
+// IsRevoked reports whether the access token with claims was revoked: by its
+// "jti", its session ("sid") or a logout-all after it was issued ("iat")
+func (s *SessionStore) IsRevoked(ctx context.Context, claims jwt.MapClaims) (bool, error) {
+	userID, _ := claims["sub"].(string)
+	if userID == "" {
+		return false, nil
+	}
+
+	keys := []string{revokedBeforeKey(userID)}
+	if tokenID, _ := claims["jti"].(string); tokenID != "" {
+		keys = append(keys, revokedTokenKey(userID, tokenID))
+	}
+	if sessionID, _ := claims["sid"].(string); sessionID != "" {
+		keys = append(keys, revokedSessionKey(userID, sessionID))
+	}
+
+	values, err := s.redisClient.MGet(ctx, keys...).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check revocation: %w", err)
+	}
+
+	for _, value := range values[1:] {
+		if value != nil {
+			return true, nil
+		}
+	}
+	if before, ok := values[0].(string); ok {
+		cutoff, _ := strconv.ParseInt(before, 10, 64)
+		issuedAt, _ := claims["iat"].(float64)
+		if int64(issuedAt) < cutoff {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// newRefreshToken returns "<sessionID>.<random>"; the session ID locates the
+// session, the random part proves possession
+func newRefreshToken(sessionID string) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	return sessionID + "." + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashRefreshToken(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(sum[:])
+}
+
+// parseSession converts a session hash (HGETALL reply)
+func parseSession(sessionID string, fields []interface{}) *Session {
+	values := make(map[string]string, len(fields)/2)
+	for i := 0; i+1 < len(fields); i += 2 {
+		name, _ := fields[i].(string)
+		value, _ := fields[i+1].(string)
+		values[name] = value
+	}
+
+	session := &Session{
+		ID:          sessionID,
+		UserID:      values["user_id"],
+		Username:    values["username"],
+		DisplayName: values["display_name"],
+		Role:        values["role"],
+	}
+	if createdAt, err := strconv.ParseInt(values["created_at"], 10, 64); err == nil {
+		session.CreatedAt = time.Unix(createdAt, 0)
+	}
+	session.Generation, _ = strconv.Atoi(values["generation"])
+	return session
+}
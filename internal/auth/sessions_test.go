@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/config"
+	"github.com/traffic-tacos/gateway-api/internal/testutil"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSessionStore(t *testing.T) (*SessionStore, redis.UniversalClient) {
+	redisClient := testutil.NewRedisClient(t)
+
+	store := NewSessionStore(redisClient, &config.JWTConfig{
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: time.Hour,
+	}, logrus.New())
+	return store, redisClient
+}
+
+func cleanupUser(t *testing.T, redisClient redis.UniversalClient, userID string) {
+	ctx := context.Background()
+	cleanup := func() {
+		sessionIDs, _ := redisClient.SMembers(ctx, userSessionsKey(userID)).Result()
+		for _, sessionID := range sessionIDs {
+			redisClient.Del(ctx, sessionKey(sessionID), revokedSessionKey(userID, sessionID))
+		}
+		redisClient.Del(ctx, userSessionsKey(userID), revokedBeforeKey(userID))
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+}
+
+func TestSessionStore_RotateDetectsReuse(t *testing.T) {
+	store, redisClient := newTestSessionStore(t)
+	ctx := context.Background()
+	userID := "test-session-user-1"
+	cleanupUser(t, redisClient, userID)
+
+	session, first, err := store.Create(ctx, Session{UserID: userID, Username: "user01", Role: "user"})
+	require.NoError(t, err)
+
+	rotated, second, err := store.Rotate(ctx, first)
+	require.NoError(t, err)
+	assert.Equal(t, session.ID, rotated.ID)
+	assert.Equal(t, userID, rotated.UserID)
+	assert.Equal(t, "user01", rotated.Username)
+	assert.Equal(t, 1, rotated.Generation)
+	assert.NotEqual(t, first, second)
+
+	// A retry with the token just rotated away is refused without revoking
+	_, _, err = store.Rotate(ctx, first)
+	assert.ErrorIs(t, err, ErrRefreshTokenInvalid)
+
+	_, third, err := store.Rotate(ctx, second)
+	require.NoError(t, err)
+
+	// Outside the grace period the old token is a copy: the session is revoked
+	require.NoError(t, redisClient.HSet(ctx, sessionKey(session.ID), "rotated_at", time.Now().Add(-time.Minute).Unix()).Err())
+	_, _, err = store.Rotate(ctx, second)
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+
+	_, _, err = store.Rotate(ctx, third)
+	assert.ErrorIs(t, err, ErrRefreshTokenInvalid)
+
+	revoked, err := store.IsRevoked(ctx, jwt.MapClaims{"sub": userID, "sid": session.ID, "iat": float64(time.Now().Unix())})
+	require.NoError(t, err)
+	assert.True(t, revoked)
+
+	_, _, err = store.Rotate(ctx, "not-a-token")
+	assert.ErrorIs(t, err, ErrRefreshTokenInvalid)
+}
+
+func TestSessionStore_RotateIgnoresUnknownTokens(t *testing.T) {
+	store, redisClient := newTestSessionStore(t)
+	ctx := context.Background()
+	userID := "test-session-user-3"
+	cleanupUser(t, redisClient, userID)
+
+	session, first, err := store.Create(ctx, Session{UserID: userID, Username: "user03", Role: "user"})
+	require.NoError(t, err)
+	_, second, err := store.Rotate(ctx, first)
+	require.NoError(t, err)
+
+	// The session ID is in every access token; a made-up token for it must not log the session out
+	_, _, err = store.Rotate(ctx, session.ID+".garbage")
+	assert.ErrorIs(t, err, ErrRefreshTokenInvalid)
+
+	_, third, err := store.Rotate(ctx, second)
+	require.NoError(t, err, "The session survived the garbage token")
+
+	// A token the session issued earlier than the previous one is still reuse
+	_, _, err = store.Rotate(ctx, first)
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+
+	_, _, err = store.Rotate(ctx, third)
+	assert.ErrorIs(t, err, ErrRefreshTokenInvalid)
+}
+
+func TestSessionStore_Revocation(t *testing.T) {
+	store, redisClient := newTestSessionStore(t)
+	ctx := context.Background()
+	userID := "test-session-user-2"
+	cleanupUser(t, redisClient, userID)
+	t.Cleanup(func() { redisClient.Del(ctx, revokedTokenKey(userID, "jti-1")) })
+
+	first, _, err := store.Create(ctx, Session{UserID: userID})
+	require.NoError(t, err)
+	second, secondRefresh, err := store.Create(ctx, Session{UserID: userID})
+	require.NoError(t, err)
+
+	issuedAt := float64(time.Now().Add(-time.Second).Unix())
+	claims := func(tokenID, sessionID string) jwt.MapClaims {
+		return jwt.MapClaims{"sub": userID, "jti": tokenID, "sid": sessionID, "iat": issuedAt}
+	}
+
+	revoked, err := store.IsRevoked(ctx, claims("jti-1", first.ID))
+	require.NoError(t, err)
+	assert.False(t, revoked)
+
+	// Logout: the token and its session, not the user's other session
+	require.NoError(t, store.RevokeToken(ctx, userID, "jti-1", time.Now().Add(time.Minute)))
+	require.NoError(t, store.Revoke(ctx, userID, first.ID))
+
+	revoked, err = store.IsRevoked(ctx, claims("jti-1", ""))
+	require.NoError(t, err)
+	assert.True(t, revoked)
+	revoked, err = store.IsRevoked(ctx, claims("jti-2", first.ID))
+	require.NoError(t, err)
+	assert.True(t, revoked)
+	revoked, err = store.IsRevoked(ctx, claims("jti-3", second.ID))
+	require.NoError(t, err)
+	assert.False(t, revoked)
+
+	// Logout-all: every remaining session, and tokens issued before it
+	ended, err := store.RevokeAll(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, ended)
+
+	_, _, err = store.Rotate(ctx, secondRefresh)
+	assert.ErrorIs(t, err, ErrRefreshTokenInvalid)
+
+	revoked, err = store.IsRevoked(ctx, jwt.MapClaims{"sub": userID, "iat": issuedAt})
+	require.NoError(t, err)
+	assert.True(t, revoked)
+
+	// Logging in again afterwards works
+	revoked, err = store.IsRevoked(ctx, jwt.MapClaims{"sub": userID, "iat": float64(time.Now().Add(time.Second).Unix())})
+	require.NoError(t, err)
+	assert.False(t, revoked)
+}
@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Test token requests outside the configured limits
+var (
+	ErrTestSubjectNotAllowed = errors.New("subject is not allowed")
+	ErrTestRoleNotAllowed    = errors.New("role is not allowed")
+	ErrTestUserIDRange       = errors.New("user IDs are outside the configured range")
+)
+
+// Defaults for the claims the gateway does not validate (JWT_ISSUER and
+// JWT_AUDIENCE unset)
+const (
+	testIdentityIssuer   = "traffic-tacos-test-identity"
+	testIdentityAudience = "traffic-tacos-api"
+)
+
+// KeySource resolves the "kid" header of a token to the key verifying it
+type KeySource interface {
+	VerificationKey(keyID string) (crypto.PublicKey, bool)
+}
+
+// TestToken is a token minted by the test identity provider
+type TestToken struct {
+	Token     string    `json:"token"`
+	Subject   string    `json:"subject"`
+	Role      string    `json:"role"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// TestIdentityProvider mints tokens signed with a configured keypair for
+// development and load tests. The tokens carry its key ID, so they go through
+// the same validation as tokens of an external identity provider.
+type TestIdentityProvider struct {
+	keyID      string
+	method     jwt.SigningMethod
+	privateKey crypto.Signer
+	issuer     string
+	audience   string
+	ttl        time.Duration
+
+	subjects     map[string]bool
+	roles        map[string]bool
+	userIDPrefix string
+	userIDMin    int
+	userIDMax    int
+}
+
+// NewTestIdentityProvider loads the signing key of cfg. Tokens are issued for
+// the issuer and audience the gateway validates (jwtCfg), when configured.
+func NewTestIdentityProvider(cfg *config.TestIdentityConfig, jwtCfg *config.JWTConfig) (*TestIdentityProvider, error) {
+	keyPEM, err := os.ReadFile(cfg.PrivateKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read test identity key: %w", err)
+	}
+	privateKey, method, err := parseSigningKey(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &TestIdentityProvider{
+		keyID:        cfg.KeyID,
+		method:       method,
+		privateKey:   privateKey,
+		issuer:       jwtCfg.Issuer,
+		audience:     jwtCfg.Audience,
+		ttl:          cfg.TokenTTL,
+		subjects:     make(map[string]bool, len(cfg.Subjects)),
+		roles:        make(map[string]bool, len(cfg.Roles)),
+		userIDPrefix: cfg.UserIDPrefix,
+		userIDMin:    cfg.UserIDMin,
+		userIDMax:    cfg.UserIDMax,
+	}
+	if p.issuer == "" {
+		p.issuer = testIdentityIssuer
+	}
+	if p.audience == "" {
+		p.audience = testIdentityAudience
+	}
+	for _, subject := range cfg.Subjects {
+		p.subjects[subject] = true
+	}
+	for _, role := range cfg.Roles {
+		p.roles[role] = true
+	}
+	return p, nil
+}
+
+// KeyID returns the "kid" of the tokens the provider mints
+func (p *TestIdentityProvider) KeyID() string {
+	return p.keyID
+}
+
+// VerificationKey returns the public key for the provider's key ID
+func (p *TestIdentityProvider) VerificationKey(keyID string) (crypto.PublicKey, bool) {
+	if keyID != p.keyID {
+		return nil, false
+	}
+	return p.privateKey.Public(), true
+}
+
+// Mint issues a token for one of the configured subjects
+func (p *TestIdentityProvider) Mint(subject, role string) (*TestToken, error) {
+	if !p.subjects[subject] {
+		return nil, ErrTestSubjectNotAllowed
+	}
+	return p.mint(subject, role)
+}
+
+// MintRange issues tokens for count consecutive user IDs starting at from
+func (p *TestIdentityProvider) MintRange(from, count int, role string) ([]TestToken, error) {
+	if count < 1 || from < p.userIDMin || from+count-1 > p.userIDMax {
+		return nil, ErrTestUserIDRange
+	}
+
+	tokens := make([]TestToken, 0, count)
+	for n := from; n < from+count; n++ {
+		token, err := p.mint(fmt.Sprintf("%s%d", p.userIDPrefix, n), role)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *token)
+	}
+	return tokens, nil
+}
+
+func (p *TestIdentityProvider) mint(subject, role string) (*TestToken, error) {
+	if !p.roles[role] {
+		return nil, ErrTestRoleNotAllowed
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(p.ttl)
+	token := jwt.NewWithClaims(p.method, jwt.MapClaims{
+		"sub":  subject,
+		"role": role,
+		"iss":  p.issuer,
+		"aud":  p.audience,
+		"iat":  now.Unix(),
+		"exp":  expiresAt.Unix(),
+		"jti":  uuid.New().String(),
+	})
+	token.Header["kid"] = p.keyID
+
+	tokenString, err := token.SignedString(p.privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign test token: %w", err)
+	}
+	return &TestToken{
+		Token:     tokenString,
+		Subject:   subject,
+		Role:      role,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// parseSigningKey parses a PEM private key (PKCS#8, PKCS#1 or SEC 1)
+func parseSigningKey(keyPEM []byte) (crypto.Signer, jwt.SigningMethod, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, nil, fmt.Errorf("signing key is not PEM encoded")
+	}
+
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse signing key: %w", err)
+	}
+	return signerFor(key)
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestKey(t *testing.T, key crypto.Signer) string {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "test-identity.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+	return path
+}
+
+func newTestIdentityProvider(t *testing.T, key crypto.Signer) *TestIdentityProvider {
+	provider, err := NewTestIdentityProvider(&config.TestIdentityConfig{
+		PrivateKeyFile: writeTestKey(t, key),
+		KeyID:          "test-identity",
+		TokenTTL:       time.Hour,
+		Subjects:       []string{"dev-user-123"},
+		UserIDPrefix:   "load-test-user-",
+		UserIDMin:      0,
+		UserIDMax:      99,
+		Roles:          []string{"user", "admin"},
+	}, &config.JWTConfig{Audience: "gateway-api"})
+	require.NoError(t, err)
+	return provider
+}
+
+func parseTestToken(t *testing.T, provider *TestIdentityProvider, tokenString string) jwt.MapClaims {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		keyID, _ := token.Header["kid"].(string)
+		key, found := provider.VerificationKey(keyID)
+		require.True(t, found)
+		return key, nil
+	}, jwt.WithValidMethods([]string{"RS256", "ES256"}))
+	require.NoError(t, err)
+	return token.Claims.(jwt.MapClaims)
+}
+
+func TestTestIdentityProvider_Mint(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	for name, key := range map[string]crypto.Signer{"ES256": ecKey, "RS256": rsaKey} {
+		t.Run(name, func(t *testing.T) {
+			provider := newTestIdentityProvider(t, key)
+
+			token, err := provider.Mint("dev-user-123", "admin")
+			require.NoError(t, err)
+			claims := parseTestToken(t, provider, token.Token)
+			assert.Equal(t, "dev-user-123", claims["sub"])
+			assert.Equal(t, "admin", claims["role"])
+			assert.Equal(t, "gateway-api", claims["aud"])
+			assert.Equal(t, testIdentityIssuer, claims["iss"])
+			assert.NotEmpty(t, claims["jti"])
+
+			_, found := provider.VerificationKey("another-key")
+			assert.False(t, found)
+		})
+	}
+}
+
+func TestTestIdentityProvider_Limits(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	provider := newTestIdentityProvider(t, key)
+
+	tokens, err := provider.MintRange(97, 3, "user")
+	require.NoError(t, err)
+	require.Len(t, tokens, 3)
+	for i, token := range tokens {
+		claims := parseTestToken(t, provider, token.Token)
+		assert.Equal(t, []string{"load-test-user-97", "load-test-user-98", "load-test-user-99"}[i], claims["sub"])
+	}
+
+	_, err = provider.MintRange(98, 3, "user")
+	assert.ErrorIs(t, err, ErrTestUserIDRange)
+	_, err = provider.MintRange(-1, 1, "user")
+	assert.ErrorIs(t, err, ErrTestUserIDRange)
+	_, err = provider.MintRange(0, 1, "developer")
+	assert.ErrorIs(t, err, ErrTestRoleNotAllowed)
+	_, err = provider.Mint("someone-else", "user")
+	assert.ErrorIs(t, err, ErrTestSubjectNotAllowed)
+}
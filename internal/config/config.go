@@ -21,6 +21,89 @@ type Config struct {
 	CORS          CORSConfig          `envconfig:"CORS"`
 	Log           LogConfig           `envconfig:"LOG"`
 	AWS           AWSConfig           `envconfig:"AWS"`
+	Queue         QueueConfig         `envconfig:"QUEUE"`
+	Leader        LeaderConfig        `envconfig:"LEADER"`
+	TestIdentity  TestIdentityConfig  `envconfig:"TEST_IDENTITY"`
+	Login         LoginConfig         `envconfig:"LOGIN"`
+}
+
+// LoginConfig controls login brute-force protection. Failures are counted per
+// username and per client IP: past the free attempts each failure doubles the
+// wait before the next attempt, and the lockout threshold locks for
+// LockoutDuration (0 = never lock). Counters reset after FailureWindow without
+// failures, or on a successful login (username only).
+type LoginConfig struct {
+	FreeAttempts       int           `envconfig:"FREE_ATTEMPTS" default:"3"`
+	IPFreeAttempts     int           `envconfig:"IP_FREE_ATTEMPTS" default:"20"` // Higher: users share IPs behind NAT
+	BackoffBase        time.Duration `envconfig:"BACKOFF_BASE" default:"1s"`
+	BackoffMax         time.Duration `envconfig:"BACKOFF_MAX" default:"5m"`
+	LockoutThreshold   int           `envconfig:"LOCKOUT_THRESHOLD" default:"10"`
+	IPLockoutThreshold int           `envconfig:"IP_LOCKOUT_THRESHOLD" default:"100"`
+	LockoutDuration    time.Duration `envconfig:"LOCKOUT_DURATION" default:"15m"`
+	FailureWindow      time.Duration `envconfig:"FAILURE_WINDOW" default:"15m"`
+}
+
+// TestIdentityConfig controls the test identity provider, which mints signed
+// tokens for local development and load tests. It is refused outside the
+// development and loadtest environments.
+type TestIdentityConfig struct {
+	Enabled        bool          `envconfig:"ENABLED" default:"false"`
+	PrivateKeyFile string        `envconfig:"PRIVATE_KEY_FILE" default:""` // PEM RSA, EC P-256 or Ed25519 key
+	KeyID          string        `envconfig:"KEY_ID" default:"test-identity"`
+	TokenTTL       time.Duration `envconfig:"TOKEN_TTL" default:"1h"`
+
+	// Tokens may be minted for these subjects, or for user IDs
+	// "<UserIDPrefix><n>" with n in [UserIDMin, UserIDMax], with these roles
+	Subjects     []string `envconfig:"SUBJECTS" default:"dev-user-123"`
+	UserIDPrefix string   `envconfig:"USER_ID_PREFIX" default:"load-test-user-"`
+	UserIDMin    int      `envconfig:"USER_ID_MIN" default:"0"`
+	UserIDMax    int      `envconfig:"USER_ID_MAX" default:"29999"`
+	Roles        []string `envconfig:"ROLES" default:"user"`
+}
+
+// LeaderConfig controls the Redis leader election that runs singleton workers
+// (queue janitor, wave scheduler, seat hold sweeper, analytics sampler) on one pod at a time
+type LeaderConfig struct {
+	Election string        `envconfig:"ELECTION" default:"gateway"`
+	LeaseTTL time.Duration `envconfig:"LEASE_TTL" default:"15s"` // Failover time after a leader crashes
+}
+
+type QueueConfig struct {
+	// Waiting token HMAC keys as "kid:secret,kid:secret". The first key signs,
+	// the rest only verify (for rotation). Empty = derive a key from JWT_SECRET.
+	TokenSigningKeys string `envconfig:"TOKEN_SIGNING_KEYS" default:""`
+
+	// HMAC key of the anonymous session cookie. Empty = derive a key from JWT_SECRET.
+	SessionSigningKey string `envconfig:"SESSION_SIGNING_KEY" default:""`
+
+	// Background janitor removing abandoned waiters (leader worker)
+	JanitorEnabled      bool          `envconfig:"JANITOR_ENABLED" default:"true"`
+	JanitorInterval     time.Duration `envconfig:"JANITOR_INTERVAL" default:"15s"`
+	JanitorStreamMaxAge time.Duration `envconfig:"JANITOR_STREAM_MAX_AGE" default:"1h"`
+
+	// Wave admission scheduler for events whose policy enables waves (leader worker)
+	WaveSchedulerEnabled bool          `envconfig:"WAVE_SCHEDULER_ENABLED" default:"true"`
+	WaveSchedulerTick    time.Duration `envconfig:"WAVE_SCHEDULER_TICK" default:"1s"`
+
+	// Opener shuffling pre-sale lobbies into the queue once opens_at passes (leader worker)
+	LobbyOpenerEnabled  bool          `envconfig:"LOBBY_OPENER_ENABLED" default:"true"`
+	LobbyOpenerInterval time.Duration `envconfig:"LOBBY_OPENER_INTERVAL" default:"1s"`
+
+	// Sweeper returning seats whose hold lapsed to inventory (leader worker)
+	HoldSweeperEnabled  bool          `envconfig:"HOLD_SWEEPER_ENABLED" default:"true"`
+	HoldSweeperInterval time.Duration `envconfig:"HOLD_SWEEPER_INTERVAL" default:"5s"`
+
+	// Sampler recording queue depth every 10s for the admin analytics series (leader worker)
+	AnalyticsSamplerEnabled bool `envconfig:"ANALYTICS_SAMPLER_ENABLED" default:"true"`
+
+	// Exporter of queue lifecycle events (leader worker). Posts NDJSON to
+	// LIFECYCLE_EXPORT_URL when set, otherwise appends to files in LIFECYCLE_EXPORT_DIR.
+	LifecycleExportEnabled  bool          `envconfig:"LIFECYCLE_EXPORT_ENABLED" default:"false"`
+	LifecycleExportDir      string        `envconfig:"LIFECYCLE_EXPORT_DIR" default:""`
+	LifecycleExportURL      string        `envconfig:"LIFECYCLE_EXPORT_URL" default:""`
+	LifecycleExportToken    string        `envconfig:"LIFECYCLE_EXPORT_TOKEN" default:""` // Bearer token for the URL
+	LifecycleExportInterval time.Duration `envconfig:"LIFECYCLE_EXPORT_INTERVAL" default:"1s"`
+	LifecycleExportTimeout  time.Duration `envconfig:"LIFECYCLE_EXPORT_TIMEOUT" default:"5s"`
 }
 
 type AWSConfig struct {
@@ -62,7 +145,24 @@ type JWTConfig struct {
 	CacheTTL     time.Duration `envconfig:"CACHE_TTL" default:"10m"`
 	Issuer       string        `envconfig:"ISSUER" required:"false"`                  // Optional for custom auth
 	Audience     string        `envconfig:"AUDIENCE" required:"false"`                // Optional for custom auth
-	Secret       string        `envconfig:"SECRET" default:"change-me-in-production"` // For self-issued JWT
+	Secret       string        `envconfig:"SECRET" default:"change-me-in-production"` // Verifies legacy HS256 tokens, derives default keys
+
+	// Self-issued tokens are signed with a key pair (RS256, ES256 or EdDSA) that
+	// rotates every SigningKeyRotation, published at /.well-known/jwks.json.
+	// Private keys are kept in Redis encrypted with SigningKeyEncryptionKey
+	// (empty = derive a key from Secret).
+	SelfIssuer              string        `envconfig:"SELF_ISSUER" default:"traffic-tacos-gateway"` // "iss" of self-issued tokens
+	SigningAlgorithm        string        `envconfig:"SIGNING_ALGORITHM" default:"ES256"`
+	SigningKeyRotation      time.Duration `envconfig:"SIGNING_KEY_ROTATION" default:"24h"`
+	SigningKeyEncryptionKey string        `envconfig:"SIGNING_KEY_ENCRYPTION_KEY" default:""`
+
+	// Accept HS256 tokens signed with Secret (no "kid") during the move to key pairs
+	HMACVerification bool `envconfig:"HMAC_VERIFICATION" default:"false"`
+
+	// Self-issued access tokens are short-lived; clients renew them with a
+	// rotating refresh token, valid for RefreshTokenTTL after login
+	AccessTokenTTL  time.Duration `envconfig:"ACCESS_TOKEN_TTL" default:"15m"`
+	RefreshTokenTTL time.Duration `envconfig:"REFRESH_TOKEN_TTL" default:"720h"`
 }
 
 type DynamoDBConfig struct {
@@ -145,6 +245,57 @@ func validateConfig(cfg *Config) error {
 		return fmt.Errorf("invalid server port: %s", cfg.Server.Port)
 	}
 
+	// Validate token lifetimes
+	if cfg.JWT.AccessTokenTTL <= 0 || cfg.JWT.RefreshTokenTTL < cfg.JWT.AccessTokenTTL {
+		return fmt.Errorf("invalid token lifetimes: access %s, refresh %s", cfg.JWT.AccessTokenTTL, cfg.JWT.RefreshTokenTTL)
+	}
+
+	// Validate login protection
+	if cfg.Login.BackoffBase <= 0 || cfg.Login.BackoffMax < cfg.Login.BackoffBase || cfg.Login.FailureWindow <= 0 {
+		return fmt.Errorf("invalid login backoff: base %s, max %s, window %s", cfg.Login.BackoffBase, cfg.Login.BackoffMax, cfg.Login.FailureWindow)
+	}
+
+	// Validate self-issued token signing
+	switch cfg.JWT.SigningAlgorithm {
+	case "RS256", "ES256", "EdDSA":
+	default:
+		return fmt.Errorf("invalid JWT signing algorithm: %s (want RS256, ES256 or EdDSA)", cfg.JWT.SigningAlgorithm)
+	}
+	if cfg.JWT.SigningKeyRotation < time.Hour {
+		return fmt.Errorf("JWT signing key rotation must be at least 1h: %s", cfg.JWT.SigningKeyRotation)
+	}
+
+	// The default secret is public: anyone could forge HS256 tokens, open the
+	// signing keys sealed with a key derived from it, or forge waiting tokens
+	// and queue sessions signed with keys derived from it
+	if cfg.JWT.Secret == defaultJWTSecret && !isDevelopment(cfg.Server.Environment) {
+		if cfg.JWT.HMACVerification {
+			return fmt.Errorf("JWT_HMAC_VERIFICATION requires JWT_SECRET to be set in the %q environment", cfg.Server.Environment)
+		}
+		if cfg.JWT.SigningKeyEncryptionKey == "" {
+			return fmt.Errorf("JWT_SIGNING_KEY_ENCRYPTION_KEY or JWT_SECRET must be set in the %q environment", cfg.Server.Environment)
+		}
+		if cfg.Queue.TokenSigningKeys == "" {
+			return fmt.Errorf("QUEUE_TOKEN_SIGNING_KEYS or JWT_SECRET must be set in the %q environment", cfg.Server.Environment)
+		}
+		if cfg.Queue.SessionSigningKey == "" {
+			return fmt.Errorf("QUEUE_SESSION_SIGNING_KEY or JWT_SECRET must be set in the %q environment", cfg.Server.Environment)
+		}
+	}
+
+	// The test identity provider mints tokens for anyone who asks: never in production
+	if cfg.TestIdentity.Enabled {
+		if !isDevelopment(cfg.Server.Environment) {
+			return fmt.Errorf("test identity provider cannot be enabled in the %q environment", cfg.Server.Environment)
+		}
+		if cfg.TestIdentity.PrivateKeyFile == "" {
+			return fmt.Errorf("test identity provider requires TEST_IDENTITY_PRIVATE_KEY_FILE")
+		}
+		if cfg.TestIdentity.UserIDMin < 0 || cfg.TestIdentity.UserIDMax < cfg.TestIdentity.UserIDMin {
+			return fmt.Errorf("invalid test identity user ID range: %d-%d", cfg.TestIdentity.UserIDMin, cfg.TestIdentity.UserIDMax)
+		}
+	}
+
 	// Validate sample rate
 	if cfg.Observability.SampleRate < 0 || cfg.Observability.SampleRate > 1 {
 		return fmt.Errorf("invalid tracing sample rate: %f", cfg.Observability.SampleRate)
@@ -152,3 +303,18 @@ func validateConfig(cfg *Config) error {
 
 	return nil
 }
+
+// defaultJWTSecret is JWTConfig.Secret's default, only fit for development
+const defaultJWTSecret = "change-me-in-production"
+
+// isDevelopment reports whether environment allows development shortcuts:
+// test identities, the default JWT secret and cookies sent over plain HTTP
+func isDevelopment(environment string) bool {
+	return environment == "development" || environment == "loadtest"
+}
+
+// IsDevelopment reports whether the server runs in an environment that allows
+// development shortcuts, such as plain HTTP
+func (c ServerConfig) IsDevelopment() bool {
+	return isDevelopment(c.Environment)
+}
@@ -0,0 +1,251 @@
+package leader
+
+import (
+	"context"
+	"crypto/rand"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/metrics"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+//go:embed lua/lease_acquire.lua
+var leaseAcquireScript string
+
+//go:embed lua/lease_renew.lua
+var leaseRenewScript string
+
+//go:embed lua/lease_release.lua
+var leaseReleaseScript string
+
+// DefaultLeaseTTL is used when no lease TTL is configured
+const DefaultLeaseTTL = 15 * time.Second
+
+// Elector holds a Redis lease for one election name. Every acquisition issues a
+// new fencing token (strictly increasing per name), so writes made by a holder
+// that lost the lease without noticing can be rejected by comparing tokens.
+type Elector struct {
+	redisClient   redis.UniversalClient
+	name          string
+	holderID      string
+	leaseTTL      time.Duration
+	acquireScript *redis.Script
+	renewScript   *redis.Script
+	releaseScript *redis.Script
+	logger        *logrus.Logger
+
+	mu        sync.RWMutex
+	leader    bool
+	fence     int64
+	renewedAt time.Time
+	onElected []func(fence int64)
+	onLost    []func()
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+}
+
+// NewElector creates a new elector. leaseTTL bounds how long a crashed leader
+// blocks the others; the lease is renewed every third of it.
+func NewElector(redisClient redis.UniversalClient, name string, leaseTTL time.Duration, logger *logrus.Logger) *Elector {
+	if leaseTTL <= 0 {
+		leaseTTL = DefaultLeaseTTL
+	}
+
+	return &Elector{
+		redisClient:   redisClient,
+		name:          name,
+		holderID:      newHolderID(),
+		leaseTTL:      leaseTTL,
+		acquireScript: redis.NewScript(leaseAcquireScript),
+		renewScript:   redis.NewScript(leaseRenewScript),
+		releaseScript: redis.NewScript(leaseReleaseScript),
+		logger:        logger,
+	}
+}
+
+func newHolderID() string {
+	hostname, _ := os.Hostname()
+	buf := make([]byte, 4)
+	_, _ = rand.Read(buf)
+	return hostname + "-" + hex.EncodeToString(buf)
+}
+
+func leaseKey(name string) string {
+	return fmt.Sprintf("leader:{%s}:lease", name)
+}
+
+func fenceKey(name string) string {
+	return fmt.Sprintf("leader:{%s}:fence", name)
+}
+
+// OnElected registers a callback run when this instance becomes leader.
+// Callbacks run on the election loop and must not block.
+func (e *Elector) OnElected(fn func(fence int64)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onElected = append(e.onElected, fn)
+}
+
+// OnLost registers a callback run when this instance stops being leader, including
+// on Stop. It runs before the lease is released, so it may wait for work to finish.
+func (e *Elector) OnLost(fn func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onLost = append(e.onLost, fn)
+}
+
+// IsLeader reports whether this instance currently holds the lease
+func (e *Elector) IsLeader() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.leader
+}
+
+// Fence returns the fencing token of the current leadership (0 when not leader)
+func (e *Elector) Fence() int64 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if !e.leader {
+		return 0
+	}
+	return e.fence
+}
+
+// HolderID identifies this instance in the lease
+func (e *Elector) HolderID() string {
+	return e.holderID
+}
+
+// Start runs the election loop in the background until Stop is called
+func (e *Elector) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+	e.done = make(chan struct{})
+
+	go func() {
+		defer close(e.done)
+
+		ticker := time.NewTicker(e.leaseTTL / 3)
+		defer ticker.Stop()
+
+		for {
+			e.Campaign(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	e.logger.WithFields(logrus.Fields{
+		"election":  e.name,
+		"holder_id": e.holderID,
+		"lease_ttl": e.leaseTTL.String(),
+	}).Info("Leader election started")
+}
+
+// Stop ends the loop, runs the loss callbacks and releases the lease so another
+// instance can take over immediately
+func (e *Elector) Stop() {
+	e.once.Do(func() {
+		if e.cancel == nil {
+			return
+		}
+		e.cancel()
+		<-e.done
+
+		if e.IsLeader() {
+			e.setLeader(false, 0)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			if err := e.releaseScript.Run(ctx, e.redisClient, []string{leaseKey(e.name)}, e.holderID).Err(); err != nil {
+				e.logger.WithError(err).WithField("election", e.name).Warn("Failed to release leader lease")
+			}
+		}
+		e.logger.WithField("election", e.name).Info("Leader election stopped")
+	})
+}
+
+// Campaign renews the lease if held, otherwise tries to take it. It is called by
+// the election loop; calling it directly runs one round.
+func (e *Elector) Campaign(ctx context.Context) bool {
+	if e.IsLeader() {
+		renewed, err := e.renewScript.Run(ctx, e.redisClient, []string{leaseKey(e.name)}, e.holderID, e.leaseTTL.Milliseconds()).Int()
+		if err == nil && renewed == 1 {
+			e.mu.Lock()
+			e.renewedAt = time.Now()
+			e.mu.Unlock()
+			return true
+		}
+
+		if err != nil {
+			e.mu.RLock()
+			renewedAt := e.renewedAt
+			e.mu.RUnlock()
+
+			// Keep leading through short Redis blips, but never past the lease we last saw
+			if time.Since(renewedAt) < e.leaseTTL-e.leaseTTL/3 {
+				e.logger.WithError(err).WithField("election", e.name).Warn("Failed to renew leader lease")
+				return true
+			}
+		}
+
+		e.logger.WithFields(logrus.Fields{
+			"election":  e.name,
+			"holder_id": e.holderID,
+		}).Warn("Leader lease lost")
+		e.setLeader(false, 0)
+	}
+
+	fence, err := e.acquireScript.Run(ctx, e.redisClient, []string{leaseKey(e.name), fenceKey(e.name)}, e.holderID, e.leaseTTL.Milliseconds()).Int64()
+	if err != nil {
+		if ctx.Err() == nil {
+			e.logger.WithError(err).WithField("election", e.name).Warn("Failed to acquire leader lease")
+		}
+		return false
+	}
+	if fence == 0 {
+		return false
+	}
+
+	e.logger.WithFields(logrus.Fields{
+		"election":  e.name,
+		"holder_id": e.holderID,
+		"fence":     fence,
+	}).Info("Leader lease acquired")
+	e.setLeader(true, fence)
+	return true
+}
+
+func (e *Elector) setLeader(leader bool, fence int64) {
+	e.mu.Lock()
+	e.leader = leader
+	e.fence = fence
+	e.renewedAt = time.Now()
+	elected, lost := e.onElected, e.onLost
+	e.mu.Unlock()
+
+	metrics.SetLeader(e.name, leader)
+
+	if leader {
+		for _, fn := range elected {
+			fn(fence)
+		}
+		return
+	}
+	for _, fn := range lost {
+		fn()
+	}
+}
@@ -0,0 +1,82 @@
+package leader
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/testutil"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestElector_Campaign(t *testing.T) {
+	redisClient := testutil.NewRedisClient(t)
+
+	ctx := context.Background()
+	name := "test-election"
+	redisClient.Del(ctx, leaseKey(name), fenceKey(name))
+	defer redisClient.Del(ctx, leaseKey(name), fenceKey(name))
+
+	first := NewElector(redisClient, name, 3*time.Second, logrus.New())
+	second := NewElector(redisClient, name, 3*time.Second, logrus.New())
+
+	var lost int32
+	first.OnLost(func() { atomic.AddInt32(&lost, 1) })
+
+	assert.True(t, first.Campaign(ctx))
+	assert.Equal(t, int64(1), first.Fence())
+
+	assert.False(t, second.Campaign(ctx), "Only one instance may hold the lease")
+	assert.Equal(t, int64(0), second.Fence())
+
+	// Renewal keeps the lease and the fence
+	assert.True(t, first.Campaign(ctx))
+	assert.Equal(t, int64(1), first.Fence())
+
+	// Another holder took over (e.g. the lease expired during a pause)
+	require.NoError(t, redisClient.Set(ctx, leaseKey(name), second.HolderID(), time.Minute).Err())
+	assert.False(t, first.Campaign(ctx))
+	assert.False(t, first.IsLeader())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&lost))
+
+	// The next leadership gets a higher fence
+	require.NoError(t, redisClient.Del(ctx, leaseKey(name)).Err())
+	assert.True(t, second.Campaign(ctx))
+	assert.Equal(t, int64(2), second.Fence())
+}
+
+func TestRegistry_Workers(t *testing.T) {
+	redisClient := testutil.NewRedisClient(t)
+
+	ctx := context.Background()
+	name := "test-registry"
+	redisClient.Del(ctx, leaseKey(name), fenceKey(name))
+	defer redisClient.Del(ctx, leaseKey(name), fenceKey(name))
+
+	elector := NewElector(redisClient, name, 3*time.Second, logrus.New())
+	registry := NewRegistry(elector, logrus.New())
+
+	var running, fence int64
+	registry.Register("test-worker", func(ctx context.Context, f int64) {
+		atomic.StoreInt64(&fence, f)
+		atomic.AddInt64(&running, 1)
+		<-ctx.Done()
+		atomic.AddInt64(&running, -1)
+	})
+
+	registry.Start()
+	assert.Eventually(t, func() bool { return atomic.LoadInt64(&running) == 1 }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(1), atomic.LoadInt64(&fence))
+
+	// Stop waits for the workers and releases the lease for the next instance
+	registry.Stop()
+	assert.Equal(t, int64(0), atomic.LoadInt64(&running))
+
+	exists, err := redisClient.Exists(ctx, leaseKey(name)).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), exists)
+}
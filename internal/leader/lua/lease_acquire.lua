@@ -0,0 +1,18 @@
+-- lease_acquire.lua
+-- Take a free lease and issue the next fencing token
+--
+-- KEYS[1]: lease key (e.g., "leader:{gateway}:lease")
+-- KEYS[2]: fencing counter (e.g., "leader:{gateway}:fence")
+--
+-- ARGV[1]: holder id
+-- ARGV[2]: lease ttl (milliseconds)
+--
+-- Returns:
+--   the new fencing token (> 0) when the lease was taken
+--   0 when someone else holds it
+
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+    return redis.call('INCR', KEYS[2])
+end
+
+return 0
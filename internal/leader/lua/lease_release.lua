@@ -0,0 +1,16 @@
+-- lease_release.lua
+-- Release a lease only if it is still held by the caller
+--
+-- KEYS[1]: lease key (e.g., "leader:{gateway}:lease")
+--
+-- ARGV[1]: holder id
+--
+-- Returns:
+--   1 when the lease was released
+--   0 when it was not held by the caller
+
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+    return redis.call('DEL', KEYS[1])
+end
+
+return 0
@@ -0,0 +1,17 @@
+-- lease_renew.lua
+-- Extend a lease only if it is still held by the caller
+--
+-- KEYS[1]: lease key (e.g., "leader:{gateway}:lease")
+--
+-- ARGV[1]: holder id
+-- ARGV[2]: lease ttl (milliseconds)
+--
+-- Returns:
+--   1 when the lease was extended
+--   0 when the lease expired or is held by someone else
+
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+    return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+
+return 0
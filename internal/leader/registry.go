@@ -0,0 +1,107 @@
+package leader
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// WorkerFunc is a background job that must run on one instance at a time.
+// It runs until ctx is cancelled, which happens when leadership is lost or the
+// registry stops. fence identifies the leadership it runs under.
+type WorkerFunc func(ctx context.Context, fence int64)
+
+type worker struct {
+	name string
+	run  WorkerFunc
+}
+
+// Registry starts its workers when the elector wins and stops them when it loses
+type Registry struct {
+	elector *Elector
+	logger  *logrus.Logger
+
+	mu      sync.Mutex
+	workers []worker
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewRegistry creates a worker registry driven by the elector
+func NewRegistry(elector *Elector, logger *logrus.Logger) *Registry {
+	r := &Registry{
+		elector: elector,
+		logger:  logger,
+	}
+	elector.OnElected(r.startWorkers)
+	elector.OnLost(r.stopWorkers)
+	return r
+}
+
+// Register adds a worker. Workers must be registered before Start.
+func (r *Registry) Register(name string, run WorkerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.workers = append(r.workers, worker{name: name, run: run})
+}
+
+// Len returns the number of registered workers
+func (r *Registry) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.workers)
+}
+
+// Start begins campaigning for leadership
+func (r *Registry) Start() {
+	r.elector.Start()
+}
+
+// Stop stops the workers, waits for them to return and releases leadership
+func (r *Registry) Stop() {
+	r.elector.Stop()
+}
+
+func (r *Registry) startWorkers(fence int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+
+	for _, w := range r.workers {
+		r.wg.Add(1)
+		go func(w worker) {
+			defer r.wg.Done()
+			defer func() {
+				if rec := recover(); rec != nil {
+					r.logger.WithFields(logrus.Fields{
+						"worker": w.name,
+						"panic":  rec,
+					}).Error("Leader worker panicked")
+				}
+			}()
+
+			r.logger.WithFields(logrus.Fields{
+				"worker": w.name,
+				"fence":  fence,
+			}).Info("Leader worker started")
+			w.run(ctx, fence)
+			r.logger.WithField("worker", w.name).Info("Leader worker stopped")
+		}(w)
+	}
+}
+
+func (r *Registry) stopWorkers() {
+	r.mu.Lock()
+	cancel := r.cancel
+	r.cancel = nil
+	r.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	r.wg.Wait()
+}
@@ -85,6 +85,115 @@ var (
 		[]string{"event_id"},
 	)
 
+	// Queue janitor metrics
+	queueJanitorRemovedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "queue_janitor_removed_total",
+			Help: "Total number of stale queue entries removed by the janitor",
+		},
+		[]string{"kind"}, // waiting/position_index/stream_entries/admission_metrics/grants/inactive_events
+	)
+
+	queueJanitorRunsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "queue_janitor_runs_total",
+			Help: "Total number of queue janitor sweeps",
+		},
+		[]string{"status"}, // success/failure
+	)
+
+	queueJanitorRunDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "queue_janitor_run_duration_seconds",
+			Help:    "Queue janitor sweep duration in seconds",
+			Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1.0, 2.5, 5.0, 10.0, 30.0},
+		},
+	)
+
+	// Wave admission metrics
+	queueWaveRunsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "queue_wave_runs_total",
+			Help: "Total number of admission waves",
+		},
+		[]string{"status"}, // success/failure
+	)
+
+	queueWaveTokensTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "queue_wave_tokens_total",
+			Help: "Total number of waiting tokens marked ready or skipped by admission waves",
+		},
+		[]string{"result"}, // marked/missed
+	)
+
+	// Seat hold metrics
+	seatHoldsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "seat_holds_total",
+			Help: "Total number of seat hold operations",
+		},
+		[]string{"result"}, // held/released/expired/rejected
+	)
+
+	lifecycleEventsExported = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "queue_lifecycle_events_exported_total",
+			Help: "Total number of queue lifecycle events handed to the export sink",
+		},
+		[]string{"result"}, // success/failure
+	)
+
+	// Leader election metrics
+	leaderElected = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "leader_elected",
+			Help: "1 if this instance holds the leader lease",
+		},
+		[]string{"election"},
+	)
+
+	leaderTransitionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "leader_transitions_total",
+			Help: "Total number of leadership changes on this instance",
+		},
+		[]string{"election", "transition"}, // elected/lost
+	)
+
+	// Authorization metrics
+	authorizationDeniedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "authorization_denied_total",
+			Help: "Total number of requests denied by a route access policy",
+		},
+		[]string{"policy", "reason"}, // policy path, unauthenticated/role/scope
+	)
+
+	// Login protection metrics
+	loginThrottledTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "login_throttled_total",
+			Help: "Total number of login attempts refused by backoff or lockout",
+		},
+		[]string{"subject", "reason"}, // user/ip, backoff/locked
+	)
+
+	loginLockoutsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "login_lockouts_total",
+			Help: "Total number of lockouts after repeated login failures",
+		},
+		[]string{"subject"}, // user/ip
+	)
+
+	loginUnlocksTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "login_unlocks_total",
+			Help: "Total number of accounts unlocked by an admin",
+		},
+	)
+
 	// Redis metrics
 	redisOperationsTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
@@ -115,6 +224,19 @@ func Init() error {
 		idempotencyHitsTotal,
 		queueOperationsTotal,
 		queueWaitTime,
+		queueJanitorRemovedTotal,
+		queueJanitorRunsTotal,
+		queueJanitorRunDuration,
+		queueWaveRunsTotal,
+		queueWaveTokensTotal,
+		seatHoldsTotal,
+		lifecycleEventsExported,
+		leaderElected,
+		leaderTransitionsTotal,
+		authorizationDeniedTotal,
+		loginThrottledTotal,
+		loginLockoutsTotal,
+		loginUnlocksTotal,
 		redisOperationsTotal,
 		redisOperationDuration,
 	)
@@ -218,6 +340,75 @@ func RecordQueueWaitTime(eventID string, waitTime time.Duration) {
 	queueWaitTime.WithLabelValues(eventID).Observe(waitTime.Seconds())
 }
 
+// RecordJanitorRemoved records stale entries removed by the queue janitor
+func RecordJanitorRemoved(kind string, count int) {
+	if count > 0 {
+		queueJanitorRemovedTotal.WithLabelValues(kind).Add(float64(count))
+	}
+}
+
+// RecordJanitorRun records a queue janitor sweep
+func RecordJanitorRun(status string, duration time.Duration) {
+	queueJanitorRunsTotal.WithLabelValues(status).Inc()
+	queueJanitorRunDuration.Observe(duration.Seconds())
+}
+
+// RecordWave records an admission wave
+func RecordWave(status string, marked, missed int) {
+	queueWaveRunsTotal.WithLabelValues(status).Inc()
+	if marked > 0 {
+		queueWaveTokensTotal.WithLabelValues("marked").Add(float64(marked))
+	}
+	if missed > 0 {
+		queueWaveTokensTotal.WithLabelValues("missed").Add(float64(missed))
+	}
+}
+
+// RecordSeatHolds records seat holds placed, released, expired or rejected
+func RecordSeatHolds(result string, count int) {
+	if count > 0 {
+		seatHoldsTotal.WithLabelValues(result).Add(float64(count))
+	}
+}
+
+// RecordLifecycleExport records lifecycle events written to the export sink or left for a retry
+func RecordLifecycleExport(result string, count int) {
+	if count > 0 {
+		lifecycleEventsExported.WithLabelValues(result).Add(float64(count))
+	}
+}
+
+// RecordAuthorizationDenied records a request denied by a route access policy
+func RecordAuthorizationDenied(policy, reason string) {
+	authorizationDeniedTotal.WithLabelValues(policy, reason).Inc()
+}
+
+// RecordLoginThrottled records a login attempt refused by backoff or lockout
+func RecordLoginThrottled(subject, reason string) {
+	loginThrottledTotal.WithLabelValues(subject, reason).Inc()
+}
+
+// RecordLoginLockout records a user or IP locked out after repeated login failures
+func RecordLoginLockout(subject string) {
+	loginLockoutsTotal.WithLabelValues(subject).Inc()
+}
+
+// RecordLoginUnlock records an account unlocked by an admin
+func RecordLoginUnlock() {
+	loginUnlocksTotal.Inc()
+}
+
+// SetLeader reports a leadership change of this instance
+func SetLeader(election string, leader bool) {
+	if leader {
+		leaderElected.WithLabelValues(election).Set(1)
+		leaderTransitionsTotal.WithLabelValues(election, "elected").Inc()
+	} else {
+		leaderElected.WithLabelValues(election).Set(0)
+		leaderTransitionsTotal.WithLabelValues(election, "lost").Inc()
+	}
+}
+
 // RecordRedisOperation records Redis operations
 func RecordRedisOperation(operation, status string, duration time.Duration) {
 	redisOperationsTotal.WithLabelValues(operation, status).Inc()
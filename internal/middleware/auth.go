@@ -2,10 +2,12 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
+	"github.com/traffic-tacos/gateway-api/internal/auth"
 	"github.com/traffic-tacos/gateway-api/internal/config"
 
 	"github.com/gofiber/fiber/v2"
@@ -20,10 +22,16 @@ type AuthMiddleware struct {
 	redisClient redis.UniversalClient // 🔴 Changed to UniversalClient for Cluster support
 	logger      *logrus.Logger
 	jwkCache    *jwk.Cache
-	jwtSecret   string // For self-issued JWT validation
+	jwtSecret   string             // Legacy HS256 self-issued tokens (transition period)
+	signingKeys *auth.KeyRing      // Self-issued token keys, resolved like the JWKS endpoint's
+	sessions    *auth.SessionStore // Revoked tokens and sessions
+	keySources  []auth.KeySource   // Keys resolved by kid before the JWKS endpoint
 }
 
-func NewAuthMiddleware(cfg *config.JWTConfig, redisClient redis.UniversalClient, logger *logrus.Logger) (*AuthMiddleware, error) {
+// errTokenRevoked is returned by validateToken for tokens revoked by a logout
+var errTokenRevoked = errors.New("token has been revoked")
+
+func NewAuthMiddleware(cfg *config.JWTConfig, redisClient redis.UniversalClient, signingKeys *auth.KeyRing, logger *logrus.Logger) (*AuthMiddleware, error) {
 	var cache *jwk.Cache
 
 	// Only initialize JWKS if endpoint is configured
@@ -51,9 +59,16 @@ func NewAuthMiddleware(cfg *config.JWTConfig, redisClient redis.UniversalClient,
 		logger:      logger,
 		jwkCache:    cache,
 		jwtSecret:   cfg.Secret,
+		signingKeys: signingKeys,
+		sessions:    auth.NewSessionStore(redisClient, cfg, logger),
 	}, nil
 }
 
+// AddKeySource trusts the keys of source for tokens carrying their kid
+func (a *AuthMiddleware) AddKeySource(source auth.KeySource) {
+	a.keySources = append(a.keySources, source)
+}
+
 // JWT authentication middleware
 func (a *AuthMiddleware) Authenticate(exemptPaths []string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
@@ -82,50 +97,11 @@ func (a *AuthMiddleware) Authenticate(exemptPaths []string) fiber.Handler {
 			return a.unauthorizedError(c, "MISSING_TOKEN", "Token is required")
 		}
 
-		// Check for dev mode bypass token
-		if tokenString == "dev-super-key-local-testing" {
-			devModeHeader := c.Get("X-Dev-Mode")
-			if devModeHeader == "true" {
-				a.logger.WithField("path", path).Info("Dev mode authentication bypass activated")
-
-				// Set mock user context for dev mode
-				mockClaims := jwt.MapClaims{
-					"sub":  "dev-user-123",
-					"aud":  a.config.Audience,
-					"iss":  a.config.Issuer,
-					"exp":  float64(time.Now().Add(24 * time.Hour).Unix()),
-					"role": "developer",
-				}
-				c.Locals("user_claims", mockClaims)
-				c.Locals("user_id", "dev-user-123")
-
-				return c.Next()
-			}
-		}
-
-		// Check for load test bypass token
-		if tokenString == "load-test-bypass-token" {
-			loadTestHeader := c.Get("X-Load-Test")
-			if loadTestHeader == "true" {
-				// Load test mode - generate random user ID
-				userID := fmt.Sprintf("load-test-user-%d", time.Now().UnixNano()%30000)
-
-				mockClaims := jwt.MapClaims{
-					"sub":  userID,
-					"aud":  a.config.Audience,
-					"iss":  a.config.Issuer,
-					"exp":  float64(time.Now().Add(1 * time.Hour).Unix()),
-					"role": "user",
-				}
-				c.Locals("user_claims", mockClaims)
-				c.Locals("user_id", userID)
-
-				return c.Next()
-			}
-		}
-
 		// Validate JWT token
 		claims, err := a.validateToken(c.Context(), tokenString)
+		if errors.Is(err, errTokenRevoked) {
+			return a.unauthorizedError(c, "TOKEN_REVOKED", "Token has been revoked")
+		}
 		if err != nil {
 			a.logger.WithError(err).WithField("path", path).Debug("Token validation failed")
 			return a.unauthorizedError(c, "INVALID_TOKEN", "Token validation failed")
@@ -141,46 +117,37 @@ func (a *AuthMiddleware) Authenticate(exemptPaths []string) fiber.Handler {
 	}
 }
 
+// OptionalAuthenticate sets the user context when an Authorization header is present
+// and lets anonymous requests through. A present but invalid token is still rejected.
+func (a *AuthMiddleware) OptionalAuthenticate() fiber.Handler {
+	authenticate := a.Authenticate(nil)
+	return func(c *fiber.Ctx) error {
+		if c.Get("Authorization") == "" {
+			return c.Next()
+		}
+		return authenticate(c)
+	}
+}
+
 // validateToken validates JWT token using JWKS
 func (a *AuthMiddleware) validateToken(ctx context.Context, tokenString string) (jwt.MapClaims, error) {
 	// Parse token without verification to get the key ID
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Check if this is a self-issued token (no kid header)
+		// Legacy self-issued token (no kid header): HMAC secret, while accepted
 		keyID, hasKid := token.Header["kid"].(string)
 
 		if !hasKid {
-			// Self-issued JWT: validate with HMAC secret
+			if !a.config.HMACVerification {
+				return nil, fmt.Errorf("token has no kid and HMAC verification is disabled")
+			}
 			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 			}
 			return []byte(a.jwtSecret), nil
 		}
 
-		// External JWT: validate with JWKS
-		if a.jwkCache == nil {
-			return nil, fmt.Errorf("JWKS not configured, but token has kid header")
-		}
-
-		// Get JWK set from cache
-		set, err := a.jwkCache.Get(ctx, a.config.JWKSEndpoint)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get JWK set: %w", err)
-		}
-
-		// Find the key with matching kid
-		key, found := set.LookupKeyID(keyID)
-		if !found {
-			return nil, fmt.Errorf("key with ID %s not found", keyID)
-		}
-
-		// Convert JWK to verification key
-		var verifyKey interface{}
-		if err := key.Raw(&verifyKey); err != nil {
-			return nil, fmt.Errorf("failed to get raw key: %w", err)
-		}
-
-		return verifyKey, nil
-	}, jwt.WithValidMethods([]string{"RS256", "ES256", "HS256"}))
+		return a.lookupKey(ctx, token, keyID)
+	}, jwt.WithValidMethods([]string{"RS256", "ES256", "EdDSA", "HS256"}))
 
 	if err != nil {
 		return nil, fmt.Errorf("token parsing failed: %w", err)
@@ -202,9 +169,75 @@ func (a *AuthMiddleware) validateToken(ctx context.Context, tokenString string)
 		return nil, fmt.Errorf("claims validation failed: %w", err)
 	}
 
+	// Check the denylist: logout revokes the token's jti and session, logout-all
+	// every token of the user. Fails open like the rate limiter, so a Redis
+	// outage does not log everyone out.
+	revoked, err := a.sessions.IsRevoked(ctx, claims)
+	if err != nil {
+		a.logger.WithError(err).Warn("Token revocation check failed")
+	} else if revoked {
+		return nil, errTokenRevoked
+	}
+
 	return claims, nil
 }
 
+// lookupKey resolves a kid to its verification key: keys of key sources (the
+// test identity provider), then the gateway's own signing keys, then the JWKS
+// endpoint. Own and external keys go through the same JWK lookup.
+func (a *AuthMiddleware) lookupKey(ctx context.Context, token *jwt.Token, keyID string) (interface{}, error) {
+	for _, source := range a.keySources {
+		if key, found := source.VerificationKey(keyID); found {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+			return key, nil
+		}
+	}
+
+	// Own signing keys (reloaded from Redis at most every few seconds on a miss)
+	if a.signingKeys != nil {
+		if key, found := a.signingKeys.LookupKeyID(ctx, keyID); found {
+			return verificationKey(token, key)
+		}
+	}
+
+	// External JWT: validate with JWKS
+	if a.jwkCache == nil {
+		return nil, fmt.Errorf("key with ID %s not found and JWKS not configured", keyID)
+	}
+
+	// Get JWK set from cache
+	set, err := a.jwkCache.Get(ctx, a.config.JWKSEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get JWK set: %w", err)
+	}
+
+	// Find the key with matching kid
+	key, found := set.LookupKeyID(keyID)
+	if !found {
+		return nil, fmt.Errorf("key with ID %s not found", keyID)
+	}
+
+	return verificationKey(token, key)
+}
+
+// verificationKey converts a JWK to the key verifying token
+func verificationKey(token *jwt.Token, key jwk.Key) (interface{}, error) {
+	// The token must use the algorithm the key is published for
+	if alg := key.Algorithm().String(); alg != "" && alg != token.Method.Alg() {
+		return nil, fmt.Errorf("token algorithm %s does not match key algorithm %s", token.Method.Alg(), alg)
+	}
+
+	// Convert JWK to verification key
+	var verifyKey interface{}
+	if err := key.Raw(&verifyKey); err != nil {
+		return nil, fmt.Errorf("failed to get raw key: %w", err)
+	}
+
+	return verifyKey, nil
+}
+
 // validateClaims validates JWT standard claims
 func (a *AuthMiddleware) validateClaims(claims jwt.MapClaims) error {
 	// Validate expiration
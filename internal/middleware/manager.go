@@ -1,8 +1,12 @@
 package middleware
 
 import (
+	"context"
+	"crypto/sha256"
 	"fmt"
+	"time"
 
+	"github.com/traffic-tacos/gateway-api/internal/auth"
 	"github.com/traffic-tacos/gateway-api/internal/config"
 
 	"github.com/redis/go-redis/v9"
@@ -11,13 +15,17 @@ import (
 
 // Manager holds all middleware instances
 type Manager struct {
-	Auth        *AuthMiddleware
-	Idempotency *IdempotencyMiddleware
-	RateLimit   *RateLimitMiddleware
-	ErrorLogger *ErrorLoggerMiddleware
-	RedisClient redis.UniversalClient // 🔴 Changed to UniversalClient for Cluster support
-	Config      *config.Config
-	Logger      *logrus.Logger
+	Auth         *AuthMiddleware
+	Idempotency  *IdempotencyMiddleware
+	RateLimit    *RateLimitMiddleware
+	ErrorLogger  *ErrorLoggerMiddleware
+	Session      *SessionMiddleware
+	RBAC         *RBACMiddleware
+	TestIdentity *auth.TestIdentityProvider // nil unless TEST_IDENTITY_ENABLED
+	SigningKeys  *auth.KeyRing              // Signs self-issued tokens, published as JWKS
+	RedisClient  redis.UniversalClient      // 🔴 Changed to UniversalClient for Cluster support
+	Config       *config.Config
+	Logger       *logrus.Logger
 }
 
 // NewManager creates a new middleware manager with all middleware initialized
@@ -28,12 +36,37 @@ func NewManager(cfg *config.Config, logger *logrus.Logger) (*Manager, error) {
 		return nil, fmt.Errorf("failed to create Redis client: %w", err)
 	}
 
+	// Initialize self-issued token signing keys (shared through Redis, rotated by the leader)
+	signingKeys, err := auth.NewKeyRing(redisClient, &cfg.JWT, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create signing key ring: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := signingKeys.Refresh(ctx); err != nil {
+		logger.WithError(err).Warn("Failed to load signing keys, will try during first request")
+	}
+
 	// Initialize authentication middleware
-	authMiddleware, err := NewAuthMiddleware(&cfg.JWT, redisClient, logger)
+	authMiddleware, err := NewAuthMiddleware(&cfg.JWT, redisClient, signingKeys, logger)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create auth middleware: %w", err)
 	}
 
+	// Initialize the test identity provider (development and loadtest only, see config)
+	var testIdentity *auth.TestIdentityProvider
+	if cfg.TestIdentity.Enabled {
+		testIdentity, err = auth.NewTestIdentityProvider(&cfg.TestIdentity, &cfg.JWT)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create test identity provider: %w", err)
+		}
+		authMiddleware.AddKeySource(testIdentity)
+		logger.WithFields(logrus.Fields{
+			"environment": cfg.Server.Environment,
+			"key_id":      testIdentity.KeyID(),
+		}).Warn("Test identity provider enabled: tokens can be minted at /api/v1/auth/test-tokens")
+	}
+
 	// Initialize idempotency middleware
 	idempotencyMiddleware := NewIdempotencyMiddleware(redisClient, logger)
 
@@ -43,14 +76,29 @@ func NewManager(cfg *config.Config, logger *logrus.Logger) (*Manager, error) {
 	// Initialize error logger middleware
 	errorLoggerMiddleware := NewErrorLoggerMiddleware(logger)
 
+	// Initialize anonymous session middleware (key derived from the JWT secret unless configured)
+	sessionKey := []byte(cfg.Queue.SessionSigningKey)
+	if len(sessionKey) == 0 {
+		derived := sha256.Sum256([]byte("queue-session:" + cfg.JWT.Secret))
+		sessionKey = derived[:]
+	}
+	sessionMiddleware := NewSessionMiddleware(sessionKey, !cfg.Server.IsDevelopment(), logger)
+
+	// Initialize role-based access control middleware
+	rbacMiddleware := NewRBACMiddleware(redisClient, logger)
+
 	return &Manager{
-		Auth:        authMiddleware,
-		Idempotency: idempotencyMiddleware,
-		RateLimit:   rateLimitMiddleware,
-		ErrorLogger: errorLoggerMiddleware,
-		RedisClient: redisClient,
-		Config:      cfg,
-		Logger:      logger,
+		Auth:         authMiddleware,
+		Idempotency:  idempotencyMiddleware,
+		RateLimit:    rateLimitMiddleware,
+		ErrorLogger:  errorLoggerMiddleware,
+		Session:      sessionMiddleware,
+		RBAC:         rbacMiddleware,
+		TestIdentity: testIdentity,
+		SigningKeys:  signingKeys,
+		RedisClient:  redisClient,
+		Config:       cfg,
+		Logger:       logger,
 	}, nil
 }
 
@@ -85,15 +85,28 @@ func (r *RateLimitMiddleware) Handle() fiber.Handler {
 			}
 		}
 
-		// Generate rate limit key
-		key := r.generateKey(c)
-
-		// Check rate limit
-		allowed, remaining, resetTime, err := r.checkRateLimit(c.Context(), key)
-		if err != nil {
-			r.logger.WithError(err).Error("Rate limit check failed")
-			// Allow request on Redis failure to avoid blocking traffic
-			return c.Next()
+		// Draw from every bucket the caller counts against; the tightest one
+		// decides and sets the headers
+		var (
+			allowed   = true
+			remaining = -1
+			resetTime time.Time
+			limitedBy string
+		)
+		for _, key := range r.generateKeys(c) {
+			keyAllowed, keyRemaining, keyResetTime, err := r.checkRateLimit(c.Context(), key)
+			if err != nil {
+				r.logger.WithError(err).Error("Rate limit check failed")
+				// Allow request on Redis failure to avoid blocking traffic
+				return c.Next()
+			}
+			if remaining < 0 || keyRemaining < remaining {
+				remaining, resetTime = keyRemaining, keyResetTime
+			}
+			if !keyAllowed {
+				allowed, limitedBy = false, key
+				break
+			}
 		}
 
 		// Set rate limit headers
@@ -101,7 +114,7 @@ func (r *RateLimitMiddleware) Handle() fiber.Handler {
 
 		if !allowed {
 			r.logger.WithFields(logrus.Fields{
-				"key":       key,
+				"key":       limitedBy,
 				"path":      path,
 				"method":    c.Method(),
 				"user_id":   GetUserID(c),
@@ -115,16 +128,24 @@ func (r *RateLimitMiddleware) Handle() fiber.Handler {
 	}
 }
 
-// generateKey creates a rate limit key based on user and IP
-func (r *RateLimitMiddleware) generateKey(c *fiber.Ctx) string {
+// generateKeys returns the rate limit buckets of a request: the user's, or for
+// anonymous callers their IP's and their session's. The IP bucket applies to
+// sessions too, so minting sessions does not multiply an address's limit.
+func (r *RateLimitMiddleware) generateKeys(c *fiber.Ctx) []string {
 	// Try to use user ID if available (more specific)
 	if userID := GetUserID(c); userID != "" {
-		return fmt.Sprintf("ratelimit:user:%s", userID)
+		return []string{fmt.Sprintf("ratelimit:user:%s", userID)}
 	}
 
-	// Fall back to IP address
 	ip := r.getClientIP(c)
-	return fmt.Sprintf("ratelimit:ip:%s", ip)
+	keys := []string{fmt.Sprintf("ratelimit:ip:%s", ip)}
+
+	// And the anonymous session, unless this request minted it: clients
+	// dropping the cookie would otherwise get a fresh bucket every request
+	if sessionID := GetSessionID(c); sessionID != "" && !IsNewSession(c) {
+		keys = append(keys, fmt.Sprintf("ratelimit:session:%s", sessionID))
+	}
+	return keys
 }
 
 // getClientIP extracts the real client IP
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/config"
+	"github.com/traffic-tacos/gateway-api/internal/testutil"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitMiddleware_SessionAndIPBuckets(t *testing.T) {
+	redisClient := testutil.NewRedisClient(t)
+	ctx := context.Background()
+
+	sessions := NewSessionMiddleware([]byte("ratelimit-test-secret"), false, logrus.New())
+	rateLimit := NewRateLimitMiddleware(&config.RateLimitConfig{
+		RPS:        1,
+		Burst:      2,
+		WindowSize: time.Hour, // No refill during the test
+		Enabled:    true,
+	}, redisClient, logrus.New())
+
+	app := fiber.New()
+	app.Use(sessions.Handle())
+	app.Use(rateLimit.Handle())
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	// Sessions minted ahead of time, as a client harvesting them would
+	sessionIDs := []string{newSessionID(), newSessionID(), newSessionID()}
+	harvested := make([]string, len(sessionIDs))
+	for i, id := range sessionIDs {
+		harvested[i] = sessions.sign(id, userAgentFingerprint(""))
+	}
+
+	keys := []string{"ratelimit:ip:198.51.100.10", "ratelimit:ip:198.51.100.11", "ratelimit:ip:198.51.100.12"}
+	for _, id := range sessionIDs {
+		keys = append(keys, "ratelimit:session:"+id)
+	}
+	redisClient.Del(ctx, keys...)
+	t.Cleanup(func() { redisClient.Del(ctx, keys...) })
+
+	request := func(ip, session string) int {
+		req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+		req.Header.Set("X-Forwarded-For", ip)
+		if session != "" {
+			req.Header.Set(SessionHeader, session)
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp.StatusCode
+	}
+
+	// A fresh session per request does not lift the IP's limit
+	assert.Equal(t, fiber.StatusOK, request("198.51.100.10", harvested[0]))
+	assert.Equal(t, fiber.StatusOK, request("198.51.100.10", harvested[1]))
+	assert.Equal(t, fiber.StatusTooManyRequests, request("198.51.100.10", harvested[2]))
+	assert.Equal(t, fiber.StatusTooManyRequests, request("198.51.100.10", ""))
+
+	// Nor does moving one session between IPs lift the session's limit
+	assert.Equal(t, fiber.StatusOK, request("198.51.100.11", harvested[2]))
+	assert.Equal(t, fiber.StatusOK, request("198.51.100.11", harvested[2]))
+	assert.Equal(t, fiber.StatusTooManyRequests, request("198.51.100.12", harvested[2]))
+}
@@ -0,0 +1,250 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/metrics"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// AuditStreamKey is the Redis stream authorization denials are recorded in
+const AuditStreamKey = "audit:authz"
+
+// auditMaxLen approximately bounds the audit stream
+const auditMaxLen = 100000
+
+// Roles carried in the "role" claim (models.User.Role for self-issued tokens)
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+// RoutePolicy names the roles and scopes the routes matching Method and Path require
+type RoutePolicy struct {
+	Method string   // HTTP method, "" for any
+	Path   string   // Route pattern: ":param" matches one segment, a trailing "*" the rest
+	Roles  []string // Any one of these roles ("role" or "roles" claim)
+	Scopes []string // All of these scopes ("scope" or "scp" claim)
+}
+
+// Matches reports whether the policy covers a request. Segments compare
+// case-insensitively, as Fiber routes them.
+func (p *RoutePolicy) Matches(method, path string) bool {
+	if p.Method != "" && !strings.EqualFold(p.Method, method) {
+		return false
+	}
+
+	patternSegments := splitPath(p.Path)
+	pathSegments := splitPath(path)
+	for i, segment := range patternSegments {
+		if segment == "*" && i == len(patternSegments)-1 {
+			return true
+		}
+		if i >= len(pathSegments) {
+			return false
+		}
+		if strings.HasPrefix(segment, ":") {
+			if pathSegments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if !strings.EqualFold(segment, pathSegments[i]) {
+			return false
+		}
+	}
+	return len(patternSegments) == len(pathSegments)
+}
+
+// Covers reports whether path lies under the policy's group: the static
+// segments of Path before its first parameter or wildcard
+func (p *RoutePolicy) Covers(path string) bool {
+	pathSegments := splitPath(path)
+	for i, segment := range splitPath(p.Path) {
+		if segment == "*" || strings.HasPrefix(segment, ":") {
+			return true
+		}
+		if i >= len(pathSegments) || !strings.EqualFold(segment, pathSegments[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+// RBACMiddleware checks the caller's role and scope claims. It runs after
+// Authenticate; every denial is logged and appended to the audit stream.
+type RBACMiddleware struct {
+	redisClient redis.UniversalClient
+	logger      *logrus.Logger
+}
+
+// NewRBACMiddleware creates a new RBAC middleware
+func NewRBACMiddleware(redisClient redis.UniversalClient, logger *logrus.Logger) *RBACMiddleware {
+	return &RBACMiddleware{
+		redisClient: redisClient,
+		logger:      logger,
+	}
+}
+
+// RequireRole lets through callers holding any of roles
+func (r *RBACMiddleware) RequireRole(roles ...string) fiber.Handler {
+	policy := &RoutePolicy{Roles: roles}
+	return func(c *fiber.Ctx) error {
+		return r.check(c, policy)
+	}
+}
+
+// RequireScope lets through callers holding all of scopes
+func (r *RBACMiddleware) RequireScope(scopes ...string) fiber.Handler {
+	policy := &RoutePolicy{Scopes: scopes}
+	return func(c *fiber.Ctx) error {
+		return r.check(c, policy)
+	}
+}
+
+// Authorize enforces the first policy matching each request. Requests under
+// a policy's group that no policy matches (e.g. another method) are denied;
+// other requests pass through.
+func (r *RBACMiddleware) Authorize(policies []RoutePolicy) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		for i := range policies {
+			if policies[i].Matches(c.Method(), c.Path()) {
+				return r.check(c, &policies[i])
+			}
+		}
+		for i := range policies {
+			if policies[i].Covers(c.Path()) {
+				r.audit(c, &policies[i], "no_policy")
+				return r.forbiddenError(c, "ACCESS_DENIED", "No access policy covers this route")
+			}
+		}
+		return c.Next()
+	}
+}
+
+func (r *RBACMiddleware) check(c *fiber.Ctx, policy *RoutePolicy) error {
+	claims := GetUserClaims(c)
+	if claims == nil {
+		r.audit(c, policy, "unauthenticated")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":     "MISSING_AUTHORIZATION",
+				"message":  "Authentication is required",
+				"trace_id": c.Get("X-Request-ID"),
+			},
+		})
+	}
+
+	if len(policy.Roles) > 0 && !containsAny(claimValues(claims, "role", "roles"), policy.Roles) {
+		r.audit(c, policy, "role")
+		return r.forbiddenError(c, "INSUFFICIENT_ROLE", "Requires role: "+strings.Join(policy.Roles, " or "))
+	}
+
+	if len(policy.Scopes) > 0 && !containsAll(claimValues(claims, "scope", "scp"), policy.Scopes) {
+		r.audit(c, policy, "scope")
+		return r.forbiddenError(c, "INSUFFICIENT_SCOPE", "Requires scope: "+strings.Join(policy.Scopes, " "))
+	}
+
+	return c.Next()
+}
+
+// audit records a denial with the subject and route in the log and the audit stream
+func (r *RBACMiddleware) audit(c *fiber.Ctx, policy *RoutePolicy, reason string) {
+	subject := GetUserID(c)
+	if subject == "" {
+		subject = "anonymous"
+	}
+	policyPath := policy.Path
+	if policyPath == "" {
+		policyPath = c.Route().Path
+	}
+
+	fields := map[string]interface{}{
+		"subject":   subject,
+		"method":    c.Method(),
+		"route":     c.Path(),
+		"policy":    policyPath,
+		"reason":    reason,
+		"roles":     strings.Join(policy.Roles, ","),
+		"scopes":    strings.Join(policy.Scopes, ","),
+		"client_ip": c.IP(),
+		"trace_id":  c.Get("X-Request-ID"),
+	}
+	r.logger.WithFields(logrus.Fields(fields)).Warn("Authorization denied")
+	metrics.RecordAuthorizationDenied(policyPath, reason)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := r.redisClient.XAdd(ctx, &redis.XAddArgs{
+		Stream: AuditStreamKey,
+		MaxLen: auditMaxLen,
+		Approx: true,
+		Values: fields,
+	}).Err(); err != nil {
+		r.logger.WithError(err).Error("Failed to record authorization denial in audit stream")
+	}
+}
+
+func (r *RBACMiddleware) forbiddenError(c *fiber.Ctx, code, message string) error {
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":     code,
+			"message":  message,
+			"trace_id": c.Get("X-Request-ID"),
+		},
+	})
+}
+
+// claimValues collects the values of claims holding a string or an array
+// (e.g. "scp", "roles"). Only the OAuth "scope" claim is space-separated; a
+// "role" of "user admin" is one role, not two.
+func claimValues(claims jwt.MapClaims, names ...string) []string {
+	var values []string
+	for _, name := range names {
+		switch v := claims[name].(type) {
+		case string:
+			if name == "scope" {
+				values = append(values, strings.Fields(v)...)
+			} else {
+				values = append(values, v)
+			}
+		case []interface{}:
+			for _, item := range v {
+				if s, ok := item.(string); ok {
+					values = append(values, s)
+				}
+			}
+		}
+	}
+	return values
+}
+
+func containsAny(values, wanted []string) bool {
+	for _, w := range wanted {
+		for _, v := range values {
+			if v == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsAll(values, wanted []string) bool {
+	for _, w := range wanted {
+		if !containsAny(values, []string{w}) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/traffic-tacos/gateway-api/internal/testutil"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testAccessPolicies = []RoutePolicy{
+	{Path: "/api/v1/admin/*", Roles: []string{RoleAdmin}},
+	{Method: fiber.MethodPost, Path: "/api/v1/reports/:id/publish", Scopes: []string{"reports:write"}},
+}
+
+// newTestRBACApp serves the policies above behind a stand-in for Authenticate
+// that takes the caller's claims from the test request
+func newTestRBACApp(t *testing.T) *fiber.App {
+	rbac := NewRBACMiddleware(testutil.NewRedisClient(t), logrus.New())
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if claims, ok := testClaims[c.Get("X-Test-Caller")]; ok {
+			c.Locals("user_id", claims["sub"])
+			c.Locals("user_claims", claims)
+		}
+		return c.Next()
+	})
+	app.Use(rbac.Authorize(testAccessPolicies))
+
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) }
+	app.Post("/api/v1/admin/flush-test-data", ok)
+	app.Get("/api/v1/admin/stats", ok)
+	app.Get("/api/v1/reports/:id", ok)
+	app.Post("/api/v1/reports/:id/publish", ok)
+	app.Get("/api/v1/reports/:id/publish", ok)
+	app.Get("/api/v1/reservations/:id", ok)
+	return app
+}
+
+var testClaims = map[string]jwt.MapClaims{
+	"admin":          {"sub": "admin-1", "role": "admin"},
+	"user":           {"sub": "user-1", "role": "user"},
+	"spaced-role":    {"sub": "user-2", "role": "user admin"},
+	"roles-array":    {"sub": "user-3", "roles": []interface{}{"user", "admin"}},
+	"spaced-scopes":  {"sub": "client-1", "scope": "reports:read reports:write"},
+	"missing-scopes": {"sub": "client-2", "scope": "reports:read"},
+}
+
+func TestRBAC_Authorize(t *testing.T) {
+	app := newTestRBACApp(t)
+
+	tests := []struct {
+		name   string
+		caller string
+		method string
+		path   string
+		want   int
+	}{
+		{"admin route as admin", "admin", fiber.MethodPost, "/api/v1/admin/flush-test-data", fiber.StatusOK},
+		{"admin route as user", "user", fiber.MethodPost, "/api/v1/admin/flush-test-data", fiber.StatusForbidden},
+		{"admin route anonymously", "", fiber.MethodGet, "/api/v1/admin/stats", fiber.StatusUnauthorized},
+		{"mixed-case admin route as user", "user", fiber.MethodPost, "/api/v1/Admin/flush-test-data", fiber.StatusForbidden},
+		{"upper-case admin route as user", "user", fiber.MethodGet, "/API/V1/ADMIN/STATS", fiber.StatusForbidden},
+		{"trailing slash admin route as user", "user", fiber.MethodGet, "/api/v1/admin/stats/", fiber.StatusForbidden},
+		{"mixed-case admin route as admin", "admin", fiber.MethodGet, "/api/v1/ADMIN/stats", fiber.StatusOK},
+		{"space-separated role claim", "spaced-role", fiber.MethodGet, "/api/v1/admin/stats", fiber.StatusForbidden},
+		{"roles array claim", "roles-array", fiber.MethodGet, "/api/v1/admin/stats", fiber.StatusOK},
+		{"space-separated scope claim", "spaced-scopes", fiber.MethodPost, "/api/v1/reports/r1/publish", fiber.StatusOK},
+		{"missing scope", "missing-scopes", fiber.MethodPost, "/api/v1/reports/r1/publish", fiber.StatusForbidden},
+		{"unmatched method under a policy's group", "spaced-scopes", fiber.MethodGet, "/api/v1/reports/r1/publish", fiber.StatusForbidden},
+		{"unmatched route under a policy's group", "user", fiber.MethodGet, "/api/v1/reports/r1", fiber.StatusForbidden},
+		{"route outside any policy's group", "user", fiber.MethodGet, "/api/v1/reservations/r1", fiber.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("X-Test-Caller", tt.caller)
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, resp.StatusCode)
+		})
+	}
+}
+
+func TestRoutePolicy_Matches(t *testing.T) {
+	policy := RoutePolicy{Method: fiber.MethodPost, Path: "/api/v1/events/:id/queue/:action"}
+
+	assert.True(t, policy.Matches("POST", "/api/v1/events/e1/queue/pause"))
+	assert.True(t, policy.Matches("post", "/API/v1/Events/e1/queue/pause/"))
+	assert.False(t, policy.Matches("GET", "/api/v1/events/e1/queue/pause"))
+	assert.False(t, policy.Matches("POST", "/api/v1/events/e1/queue"))
+	assert.False(t, policy.Matches("POST", "/api/v1/events//queue/pause"))
+
+	assert.True(t, policy.Covers("/api/v1/events"))
+	assert.True(t, policy.Covers("/api/v1/Events/e1/seats"))
+	assert.False(t, policy.Covers("/api/v1/reservations/r1"))
+}
@@ -0,0 +1,171 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// SessionCookie carries the gateway-issued anonymous session. Non-browser
+	// clients may send the same value in SessionHeader instead.
+	SessionCookie = "queue_session"
+	SessionHeader = "X-Queue-Session"
+
+	// AnonymousIDPrefix marks anonymous identities so they never collide with user IDs
+	AnonymousIDPrefix = "anon:"
+
+	sessionTTL = 24 * time.Hour
+)
+
+// SessionMiddleware gives every caller a signed anonymous session, minted on
+// first contact. The session value is "<id>.<fingerprint>.<signature>": the
+// fingerprint hashes the browser and platform the User-Agent names, so a
+// session copied to another browser does not verify there and that browser gets
+// a session of its own.
+type SessionMiddleware struct {
+	secret       []byte
+	secureCookie bool // Only send the cookie over HTTPS
+	logger       *logrus.Logger
+}
+
+// NewSessionMiddleware creates a new session middleware signing with secret.
+// secureCookie marks the session cookie Secure, for every environment served over HTTPS.
+func NewSessionMiddleware(secret []byte, secureCookie bool, logger *logrus.Logger) *SessionMiddleware {
+	return &SessionMiddleware{
+		secret:       secret,
+		secureCookie: secureCookie,
+		logger:       logger,
+	}
+}
+
+// Handle resolves the caller's anonymous session, minting a new one (cookie +
+// response header) when none or an invalid one was presented
+func (s *SessionMiddleware) Handle() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		fingerprint := deviceFingerprint(c)
+
+		presented := c.Get(SessionHeader)
+		if presented == "" {
+			presented = c.Cookies(SessionCookie)
+		}
+
+		id, ok := s.verify(presented, fingerprint)
+		if !ok {
+			if presented != "" {
+				s.logger.WithFields(logrus.Fields{
+					"client_ip": c.IP(),
+					"path":      c.Path(),
+				}).Debug("Replacing invalid anonymous session")
+			}
+
+			id = newSessionID()
+			value := s.sign(id, fingerprint)
+			c.Cookie(&fiber.Cookie{
+				Name:     SessionCookie,
+				Value:    value,
+				Path:     "/",
+				Expires:  time.Now().Add(sessionTTL),
+				HTTPOnly: true,
+				Secure:   s.secureCookie,
+				SameSite: fiber.CookieSameSiteLaxMode,
+			})
+			c.Set(SessionHeader, value)
+			c.Locals("session_new", true)
+		}
+
+		c.Locals("session_id", id)
+		return c.Next()
+	}
+}
+
+// sign returns the session value for id on the device with fingerprint
+func (s *SessionMiddleware) sign(id, fingerprint string) string {
+	payload := id + "." + fingerprint
+	return payload + "." + s.signature(payload)
+}
+
+// verify checks the signature and that the session was issued to this device.
+// Returns the session id.
+func (s *SessionMiddleware) verify(value, fingerprint string) (string, bool) {
+	parts := strings.Split(value, ".")
+	if len(parts) != 3 || parts[0] == "" {
+		return "", false
+	}
+
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(s.signature(payload))) {
+		return "", false
+	}
+	if subtle.ConstantTimeCompare([]byte(parts[1]), []byte(fingerprint)) != 1 {
+		return "", false
+	}
+	return parts[0], true
+}
+
+func (s *SessionMiddleware) signature(payload string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte("session:" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func newSessionID() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// userAgentVersion matches the version numbers in a User-Agent
+var userAgentVersion = regexp.MustCompile(`[0-9][0-9._]*`)
+
+// deviceFingerprint hashes the User-Agent without its version numbers, so
+// browser and OS updates keep the session (and the caller's waiting slot)
+func deviceFingerprint(c *fiber.Ctx) string {
+	return userAgentFingerprint(c.Get(fiber.HeaderUserAgent))
+}
+
+func userAgentFingerprint(userAgent string) string {
+	sum := sha256.Sum256([]byte(userAgentVersion.ReplaceAllString(userAgent, "")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// GetSessionID extracts the anonymous session id from context
+func GetSessionID(c *fiber.Ctx) string {
+	if sessionID, ok := c.Locals("session_id").(string); ok {
+		return sessionID
+	}
+	return ""
+}
+
+// IsNewSession reports whether the session was minted by this request
+func IsNewSession(c *fiber.Ctx) bool {
+	isNew, _ := c.Locals("session_new").(bool)
+	return isNew
+}
+
+// GetAnonymousID returns the caller's anonymous identity ("anon:<session id>"),
+// or "" when no session was resolved
+func GetAnonymousID(c *fiber.Ctx) string {
+	if sessionID := GetSessionID(c); sessionID != "" {
+		return AnonymousIDPrefix + sessionID
+	}
+	return ""
+}
+
+// GetIdentity returns the authenticated user ID, falling back to the caller's
+// anonymous identity
+func GetIdentity(c *fiber.Ctx) string {
+	if userID := GetUserID(c); userID != "" {
+		return userID
+	}
+	return GetAnonymousID(c)
+}
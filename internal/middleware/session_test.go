@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	chromeUserAgent        = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+	updatedChromeUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.6167.85 Safari/537.36"
+	firefoxUserAgent       = "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:121.0) Gecko/20100101 Firefox/121.0"
+)
+
+func newTestSessionApp(secureCookie bool) *fiber.App {
+	sessions := NewSessionMiddleware([]byte("session-test-secret"), secureCookie, logrus.New())
+
+	app := fiber.New()
+	app.Use(sessions.Handle())
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(GetSessionID(c))
+	})
+	return app
+}
+
+// sessionRequest returns the session the app resolved and the value it issued, if any
+func sessionRequest(t *testing.T, app *fiber.App, session, userAgent, language string) (string, string) {
+	req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+	req.Header.Set(fiber.HeaderUserAgent, userAgent)
+	req.Header.Set(fiber.HeaderAcceptLanguage, language)
+	if session != "" {
+		req.Header.Set(SessionHeader, session)
+	}
+
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body), resp.Header.Get(SessionHeader)
+}
+
+func TestSessionMiddleware_Handle(t *testing.T) {
+	app := newTestSessionApp(false)
+
+	sessionID, session := sessionRequest(t, app, "", chromeUserAgent, "ko-KR")
+	require.NotEmpty(t, sessionID)
+	require.NotEmpty(t, session)
+
+	t.Run("same browser keeps the session", func(t *testing.T) {
+		id, issued := sessionRequest(t, app, session, chromeUserAgent, "ko-KR")
+		assert.Equal(t, sessionID, id)
+		assert.Empty(t, issued)
+	})
+
+	t.Run("browser update keeps the session", func(t *testing.T) {
+		id, issued := sessionRequest(t, app, session, updatedChromeUserAgent, "ko-KR")
+		assert.Equal(t, sessionID, id)
+		assert.Empty(t, issued)
+	})
+
+	t.Run("language change keeps the session", func(t *testing.T) {
+		id, issued := sessionRequest(t, app, session, chromeUserAgent, "en-US,en;q=0.9")
+		assert.Equal(t, sessionID, id)
+		assert.Empty(t, issued)
+	})
+
+	t.Run("another browser gets its own session", func(t *testing.T) {
+		id, issued := sessionRequest(t, app, session, firefoxUserAgent, "ko-KR")
+		assert.NotEqual(t, sessionID, id)
+		assert.NotEmpty(t, issued)
+	})
+
+	t.Run("tampered session is replaced", func(t *testing.T) {
+		id, issued := sessionRequest(t, app, "someone-else"+session[len(sessionID):], chromeUserAgent, "ko-KR")
+		assert.NotEqual(t, sessionID, id)
+		assert.NotEqual(t, "someone-else", id)
+		assert.NotEmpty(t, issued)
+	})
+}
+
+func TestSessionMiddleware_SecureCookie(t *testing.T) {
+	for _, secure := range []bool{false, true} {
+		req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+		req.Header.Set(fiber.HeaderUserAgent, chromeUserAgent)
+		resp, err := newTestSessionApp(secure).Test(req)
+		require.NoError(t, err)
+
+		cookies := resp.Cookies()
+		require.Len(t, cookies, 1)
+		assert.Equal(t, SessionCookie, cookies[0].Name)
+		assert.Equal(t, secure, cookies[0].Secure)
+		assert.True(t, cookies[0].HttpOnly)
+	}
+}
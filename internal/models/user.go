@@ -28,12 +28,28 @@ type RegisterRequest struct {
 	DisplayName string `json:"display_name" validate:"required"`
 }
 
+// RefreshRequest represents token refresh request payload
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// TestTokenRequest represents a test identity token request: one token for
+// Subject, or Count tokens for the user IDs starting at From
+type TestTokenRequest struct {
+	Subject string `json:"subject"`
+	Role    string `json:"role"`
+	From    int    `json:"from"`
+	Count   int    `json:"count"`
+}
+
 // AuthResponse represents authentication response
 type AuthResponse struct {
-	Token       string `json:"token"`
-	UserID      string `json:"user_id"`
-	Username    string `json:"username"`
-	DisplayName string `json:"display_name"`
-	Role        string `json:"role"`
-	ExpiresIn   int    `json:"expires_in"` // seconds
+	Token            string `json:"token"`
+	RefreshToken     string `json:"refresh_token"` // Single use: each refresh returns a new one
+	UserID           string `json:"user_id"`
+	Username         string `json:"username"`
+	DisplayName      string `json:"display_name"`
+	Role             string `json:"role"`
+	ExpiresIn        int    `json:"expires_in"`         // seconds
+	RefreshExpiresIn int    `json:"refresh_expires_in"` // seconds until the session ends
 }
@@ -55,15 +55,18 @@ func (m *AdmissionMetrics) GetAdmissionRate(ctx context.Context) (float64, error
 	return rate, nil
 }
 
-// RecordAdmission records an admission event for metrics tracking
-func (m *AdmissionMetrics) RecordAdmission(ctx context.Context, userID string) error {
+// RecordAdmission records an admission event for metrics tracking.
+// member must be unique per admission (e.g. the reservation token it issued):
+// one identity can be admitted several times, and re-adding a member only
+// moves its timestamp.
+func (m *AdmissionMetrics) RecordAdmission(ctx context.Context, member string) error {
 	key := fmt.Sprintf("metrics:admission:%s", m.eventID)
 
 	// Add to sorted set with current timestamp as score
 	now := time.Now().Unix()
 	err := m.redisClient.ZAdd(ctx, key, redis.Z{
 		Score:  float64(now),
-		Member: userID,
+		Member: member,
 	}).Err()
 
 	if err != nil {
@@ -185,6 +188,47 @@ func (t *TokenBucketAdmission) TryAdmit(ctx context.Context, userID string) (boo
 	return admitted, nil
 }
 
+// Token Bucket refund script: returns a token taken by TryAdmit, up to capacity.
+// A missing bucket is already full.
+var tokenBucketRefundLuaScript = `
+local key = KEYS[1]
+local capacity = tonumber(ARGV[1])
+local refunded = tonumber(ARGV[2])
+
+local tokens = tonumber(redis.call('HGET', key, 'tokens'))
+if tokens == nil then
+    return 0
+end
+
+tokens = tokens + refunded
+if tokens > capacity then
+    tokens = capacity
+end
+redis.call('HSET', key, 'tokens', tokens)
+return 1
+`
+
+// Refund returns the token taken by a TryAdmit whose admission then failed,
+// so that failed grants do not drain the bucket
+func (t *TokenBucketAdmission) Refund(ctx context.Context, userID string) error {
+	key := fmt.Sprintf("admission:bucket:%s", t.eventID)
+
+	if err := t.redisClient.Eval(ctx, tokenBucketRefundLuaScript,
+		[]string{key},
+		t.capacity,
+		1, // Refund 1 token
+	).Err(); err != nil {
+		return err
+	}
+
+	t.logger.WithFields(logrus.Fields{
+		"event_id": t.eventID,
+		"user_id":  userID,
+	}).Debug("Token bucket admission refunded")
+
+	return nil
+}
+
 // SetCapacity updates the bucket capacity
 func (t *TokenBucketAdmission) SetCapacity(capacity int) {
 	t.capacity = capacity
@@ -0,0 +1,51 @@
+package queue
+
+import (
+	"context"
+	"testing"
+
+	"github.com/traffic-tacos/gateway-api/internal/testutil"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenBucketAdmission_Refund(t *testing.T) {
+	redisClient := testutil.NewRedisClient(t)
+	ctx := context.Background()
+
+	eventID := "test-bucket-refund-evt"
+	key := "admission:bucket:" + eventID
+	redisClient.Del(ctx, key)
+	t.Cleanup(func() { redisClient.Del(ctx, key) })
+
+	bucket := NewTokenBucketAdmission(redisClient, eventID, logrus.New())
+	bucket.SetCapacity(2)
+	bucket.SetRefillRate(0.0001)
+
+	// Nothing to return to a bucket that was never used
+	require.NoError(t, bucket.Refund(ctx, "user-1"))
+	assert.Equal(t, int64(0), redisClient.Exists(ctx, key).Val())
+
+	for i := 0; i < 2; i++ {
+		admitted, err := bucket.TryAdmit(ctx, "user-1")
+		require.NoError(t, err)
+		require.True(t, admitted)
+	}
+	admitted, err := bucket.TryAdmit(ctx, "user-1")
+	require.NoError(t, err)
+	assert.False(t, admitted, "Bucket is empty")
+
+	// A refunded token admits the next caller
+	require.NoError(t, bucket.Refund(ctx, "user-1"))
+	admitted, err = bucket.TryAdmit(ctx, "user-2")
+	require.NoError(t, err)
+	assert.True(t, admitted)
+
+	// Refunds never fill the bucket beyond its capacity
+	for i := 0; i < 3; i++ {
+		require.NoError(t, bucket.Refund(ctx, "user-2"))
+	}
+	assert.Equal(t, "2", redisClient.HGet(ctx, key, "tokens").Val())
+}
@@ -0,0 +1,256 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// AnalyticsResolution is the bucket size of the queue analytics time series
+	AnalyticsResolution = 10 * time.Second
+
+	// AnalyticsHistory is how far back the time series goes
+	AnalyticsHistory = 1 * time.Hour
+
+	analyticsSamples = int64(AnalyticsHistory / AnalyticsResolution)
+)
+
+// AnalyticsSeriesKey returns the list of queue samples recorded by the AnalyticsSampler
+func AnalyticsSeriesKey(eventID string) string {
+	return fmt.Sprintf("queue:analytics:{%s}", eventID)
+}
+
+// QueueAnalytics is a live view of an event queue for operators
+type QueueAnalytics struct {
+	EventID           string           `json:"event_id"`
+	Depth             int64            `json:"depth"`                          // Tokens waiting in the queue (all lanes)
+	Lanes             map[string]int64 `json:"lanes,omitempty"`                // Depth per lane ("" = default lane)
+	HeartbeatExpired  int64            `json:"heartbeat_expired"`              // Queued tokens whose heartbeat expired, not yet swept
+	OldestWaitSeconds int64            `json:"oldest_wait_sec"`                // Age of the longest-waiting token
+	OutstandingTokens int64            `json:"outstanding_reservation_tokens"` // Unexpired reservation tokens not yet used
+	Admission         *DetailedMetrics `json:"admission"`                      // Rates, confidence and the ETA of the last position
+	Streams           *QueueStats      `json:"streams,omitempty"`              // Per-user event streams
+	GeneratedAt       time.Time        `json:"generated_at"`
+}
+
+// AnalyticsSample is one point of the queue analytics time series
+type AnalyticsSample struct {
+	Timestamp         int64  `json:"ts"`                                       // Bucket start (Unix seconds)
+	Admitted          int64  `json:"admitted"`                                 // Admissions granted in the bucket
+	Depth             *int64 `json:"depth"`                                    // Queue depth sampled in the bucket (null = no sample)
+	OutstandingTokens *int64 `json:"outstanding_reservation_tokens,omitempty"` // Sampled with the depth
+}
+
+// LoadQueueAnalytics computes the live analytics of an event queue. Counting
+// expired heartbeats scans the whole queue, so this is meant for operators.
+func LoadQueueAnalytics(ctx context.Context, redisClient redis.UniversalClient, eventID string, logger *logrus.Logger) (*QueueAnalytics, error) {
+	now := time.Now()
+	analytics := &QueueAnalytics{
+		EventID:     eventID,
+		Lanes:       make(map[string]int64),
+		GeneratedAt: now.UTC(),
+	}
+
+	lanes, err := KnownLanes(ctx, redisClient, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list lanes: %w", err)
+	}
+
+	oldest := math.Inf(1)
+	for _, lane := range lanes {
+		key := EventQueueKey(eventID, lane)
+
+		depth, err := redisClient.ZCard(ctx, key).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read queue depth: %w", err)
+		}
+		analytics.Lanes[lane] = depth
+		analytics.Depth += depth
+
+		first, err := redisClient.ZRangeWithScores(ctx, key, 0, 0).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read oldest waiter: %w", err)
+		}
+		if len(first) > 0 && first[0].Score < oldest {
+			oldest = first[0].Score
+		}
+
+		err = scanDeadMembers(ctx, redisClient, eventID, key, 500, func(dead []interface{}) error {
+			analytics.HeartbeatExpired += int64(len(dead))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !math.IsInf(oldest, 1) {
+		analytics.OldestWaitSeconds = int64(math.Max(0, float64(now.Unix())-oldest))
+	}
+	if len(lanes) == 1 {
+		analytics.Lanes = nil
+	}
+
+	inventory, err := LoadInventory(ctx, redisClient, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read outstanding grants: %w", err)
+	}
+	analytics.OutstandingTokens = inventory.Outstanding
+
+	analytics.Admission = NewSlidingWindowMetrics(redisClient, eventID, logger).GetDetailedMetrics(ctx, int(analytics.Depth))
+
+	streams, err := NewStreamQueue(redisClient, logger).GetQueueStats(ctx, eventID)
+	if err != nil {
+		logger.WithError(err).WithField("event_id", eventID).Warn("Failed to read stream stats")
+	} else {
+		analytics.Streams = streams
+	}
+
+	return analytics, nil
+}
+
+// LoadAnalyticsSeries returns the last hour of an event queue in AnalyticsResolution
+// buckets, oldest first. Admissions come from the admission metrics; depth and
+// outstanding tokens from the samples recorded by the AnalyticsSampler.
+func LoadAnalyticsSeries(ctx context.Context, redisClient redis.UniversalClient, eventID string) ([]AnalyticsSample, error) {
+	resolution := int64(AnalyticsResolution / time.Second)
+	end := time.Now().Unix()/resolution*resolution + resolution
+	start := end - analyticsSamples*resolution
+
+	series := make([]AnalyticsSample, analyticsSamples)
+	for i := range series {
+		series[i].Timestamp = start + int64(i)*resolution
+	}
+	bucket := func(ts int64) int {
+		if ts < start || ts >= end {
+			return -1
+		}
+		return int((ts - start) / resolution)
+	}
+
+	admissions, err := redisClient.ZRangeByScoreWithScores(ctx, fmt.Sprintf("metrics:admission:%s", eventID), &redis.ZRangeBy{
+		Min: strconv.FormatInt(start, 10),
+		Max: "(" + strconv.FormatInt(end, 10),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read admission metrics: %w", err)
+	}
+	for _, admission := range admissions {
+		if i := bucket(int64(admission.Score)); i >= 0 {
+			series[i].Admitted++
+		}
+	}
+
+	samples, err := redisClient.LRange(ctx, AnalyticsSeriesKey(eventID), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read analytics samples: %w", err)
+	}
+	for _, raw := range samples {
+		var sample AnalyticsSample
+		if err := json.Unmarshal([]byte(raw), &sample); err != nil {
+			continue
+		}
+		if i := bucket(sample.Timestamp); i >= 0 {
+			series[i].Depth = sample.Depth
+			series[i].OutstandingTokens = sample.OutstandingTokens
+		}
+	}
+
+	return series, nil
+}
+
+// AnalyticsSampler records the depth and outstanding reservation tokens of every
+// active event each AnalyticsResolution, for LoadAnalyticsSeries. It runs as a leader worker.
+type AnalyticsSampler struct {
+	redisClient redis.UniversalClient
+	logger      *logrus.Logger
+}
+
+// NewAnalyticsSampler creates a new queue analytics sampler
+func NewAnalyticsSampler(redisClient redis.UniversalClient, logger *logrus.Logger) *AnalyticsSampler {
+	return &AnalyticsSampler{
+		redisClient: redisClient,
+		logger:      logger,
+	}
+}
+
+// Run samples every AnalyticsResolution until ctx is cancelled
+func (s *AnalyticsSampler) Run(ctx context.Context) {
+	ticker := time.NewTicker(AnalyticsResolution)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Sample(ctx); err != nil && ctx.Err() == nil {
+			s.logger.WithError(err).Warn("Queue analytics sampling failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sample records one sample for every active event
+func (s *AnalyticsSampler) Sample(ctx context.Context) error {
+	eventIDs, err := s.redisClient.ZRange(ctx, ActiveEventsKey, 0, -1).Result()
+	if err != nil {
+		return fmt.Errorf("failed to list active events: %w", err)
+	}
+
+	for _, eventID := range eventIDs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := s.SampleEvent(ctx, eventID); err != nil {
+			s.logger.WithError(err).WithField("event_id", eventID).Warn("Failed to sample event queue")
+		}
+	}
+
+	return nil
+}
+
+// SampleEvent appends the current depth and outstanding tokens of one event to its series
+func (s *AnalyticsSampler) SampleEvent(ctx context.Context, eventID string) error {
+	lanes, err := KnownLanes(ctx, s.redisClient, eventID)
+	if err != nil {
+		return fmt.Errorf("failed to list lanes: %w", err)
+	}
+	var depth int64
+	for _, lane := range lanes {
+		size, err := s.redisClient.ZCard(ctx, EventQueueKey(eventID, lane)).Result()
+		if err != nil {
+			return fmt.Errorf("failed to read queue depth: %w", err)
+		}
+		depth += size
+	}
+
+	inventory, err := LoadInventory(ctx, s.redisClient, eventID)
+	if err != nil {
+		return fmt.Errorf("failed to read outstanding grants: %w", err)
+	}
+
+	data, err := json.Marshal(AnalyticsSample{
+		Timestamp:         time.Now().Unix(),
+		Depth:             &depth,
+		OutstandingTokens: &inventory.Outstanding,
+	})
+	if err != nil {
+		return err
+	}
+
+	key := AnalyticsSeriesKey(eventID)
+	pipe := s.redisClient.Pipeline()
+	pipe.RPush(ctx, key, data)
+	pipe.LTrim(ctx, key, -analyticsSamples, -1)
+	pipe.Expire(ctx, key, 2*AnalyticsHistory)
+	_, err = pipe.Exec(ctx)
+	return err
+}
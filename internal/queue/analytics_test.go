@@ -0,0 +1,96 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/testutil"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueueAnalytics(t *testing.T) {
+	redisClient := testutil.NewRedisClient(t)
+
+	executor := NewLuaExecutor(redisClient, logrus.New())
+	ctx := context.Background()
+	eventID := "test-analytics-evt"
+	tokens := []string{"wt-1", "wt-2", "wt-3"}
+	admissionKey := fmt.Sprintf("metrics:admission:%s", eventID)
+
+	cleanup := func() {
+		keys := []string{
+			EventQueueKey(eventID, ""), PositionIndexKey(eventID, ""), GrantsKey(eventID),
+			AnalyticsSeriesKey(eventID), admissionKey,
+		}
+		for _, token := range tokens {
+			keys = append(keys, WaitingDataKey(eventID, token), HeartbeatKey(eventID, token),
+				UserStreamKey(eventID, "user-"+token), "dedupe:{"+eventID+"}:"+token)
+		}
+		redisClient.Del(ctx, keys...)
+	}
+	cleanup()
+	defer cleanup()
+
+	for _, token := range tokens {
+		_, err := executor.JoinQueue(ctx, &QueueJoin{
+			EventID:      eventID,
+			UserID:       "user-" + token,
+			Token:        token,
+			DedupeKey:    "dedupe:{" + eventID + "}:" + token,
+			Data:         []byte(`{"event_id":"` + eventID + `","status":"waiting"}`),
+			DataTTL:      time.Minute,
+			HeartbeatTTL: time.Minute,
+			DedupeTTL:    time.Second,
+		})
+		require.NoError(t, err)
+	}
+
+	// wt-1 joined two minutes ago and its heartbeat expired since
+	require.NoError(t, redisClient.ZAdd(ctx, EventQueueKey(eventID, ""), redis.Z{Score: float64(time.Now().Add(-2 * time.Minute).Unix()), Member: "wt-1"}).Err())
+	require.NoError(t, redisClient.Del(ctx, HeartbeatKey(eventID, "wt-1")).Err())
+
+	now := time.Now().Unix()
+	require.NoError(t, redisClient.ZAdd(ctx, admissionKey,
+		redis.Z{Score: float64(now), Member: "user-a"},
+		redis.Z{Score: float64(now - 120), Member: "user-b"},
+		redis.Z{Score: float64(now - 7200), Member: "user-old"},
+	).Err())
+	require.NoError(t, redisClient.ZAdd(ctx, GrantsKey(eventID), redis.Z{Score: float64(now + 30), Member: "rt-1"}).Err())
+
+	analytics, err := LoadQueueAnalytics(ctx, redisClient, eventID, logrus.New())
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), analytics.Depth)
+	assert.Nil(t, analytics.Lanes, "Single-lane events report no lane breakdown")
+	assert.Equal(t, int64(1), analytics.HeartbeatExpired)
+	assert.GreaterOrEqual(t, analytics.OldestWaitSeconds, int64(119))
+	assert.Equal(t, int64(1), analytics.OutstandingTokens)
+	assert.Equal(t, int64(1), analytics.Admission.Count1Min)
+	assert.Equal(t, int64(2), analytics.Admission.Count5Min)
+	assert.InDelta(t, 2.0/300, analytics.Admission.Rate5Min, 1e-9)
+
+	sampler := NewAnalyticsSampler(redisClient, logrus.New())
+	require.NoError(t, sampler.SampleEvent(ctx, eventID))
+
+	series, err := LoadAnalyticsSeries(ctx, redisClient, eventID)
+	require.NoError(t, err)
+	require.Len(t, series, 360)
+	assert.Equal(t, int64(AnalyticsResolution/time.Second), series[1].Timestamp-series[0].Timestamp)
+
+	var admitted int64
+	for _, sample := range series {
+		admitted += sample.Admitted
+	}
+	assert.Equal(t, int64(2), admitted, "Admissions older than an hour are outside the series")
+
+	last := series[len(series)-1]
+	require.NotNil(t, last.Depth)
+	assert.Equal(t, int64(3), *last.Depth)
+	assert.Equal(t, int64(1), *last.OutstandingTokens)
+	assert.Nil(t, series[0].Depth, "Buckets without a sample have no depth")
+}
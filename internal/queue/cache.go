@@ -0,0 +1,84 @@
+package queue
+
+import (
+	"sync"
+	"time"
+)
+
+// eventCacheMaxEntries bounds the per-event caches of the stores. Event IDs
+// come from clients, so a cache keyed by them must not grow with every ID tried.
+const eventCacheMaxEntries = 10000
+
+type eventCacheEntry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+// eventCache is a small in-process cache of per-event values. Entries expire
+// after ttl; once maxEntries is reached, expired entries are dropped (at most
+// once per ttl) and, if that frees nothing, an arbitrary one makes room.
+type eventCache[V any] struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu       sync.RWMutex
+	entries  map[string]eventCacheEntry[V]
+	prunedAt time.Time
+}
+
+func newEventCache[V any](ttl time.Duration, maxEntries int) *eventCache[V] {
+	return &eventCache[V]{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]eventCacheEntry[V]),
+	}
+}
+
+// get returns the unexpired value cached for eventID
+func (c *eventCache[V]) get(eventID string) (V, bool) {
+	c.mu.RLock()
+	entry, ok := c.entries[eventID]
+	c.mu.RUnlock()
+	if !ok || !time.Now().Before(entry.expiresAt) {
+		var zero V
+		return zero, false
+	}
+	return entry.value, true
+}
+
+func (c *eventCache[V]) set(eventID string, value V) {
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[eventID]; !ok && len(c.entries) >= c.maxEntries {
+		if now.Sub(c.prunedAt) >= c.ttl {
+			for id, entry := range c.entries {
+				if !now.Before(entry.expiresAt) {
+					delete(c.entries, id)
+				}
+			}
+			c.prunedAt = now
+		}
+		if len(c.entries) >= c.maxEntries {
+			for id := range c.entries {
+				delete(c.entries, id)
+				break
+			}
+		}
+	}
+	c.entries[eventID] = eventCacheEntry[V]{value: value, expiresAt: now.Add(c.ttl)}
+}
+
+func (c *eventCache[V]) delete(eventID string) {
+	c.mu.Lock()
+	delete(c.entries, eventID)
+	c.mu.Unlock()
+}
+
+func (c *eventCache[V]) len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.entries)
+}
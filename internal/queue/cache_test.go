@@ -0,0 +1,41 @@
+package queue
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventCache(t *testing.T) {
+	cache := newEventCache[int](50*time.Millisecond, 3)
+
+	cache.set("evt-1", 1)
+	value, ok := cache.get("evt-1")
+	assert.True(t, ok)
+	assert.Equal(t, 1, value)
+
+	// The cache never grows past its bound, however many event IDs are tried
+	for i := 0; i < 10; i++ {
+		cache.set(fmt.Sprintf("evt-%d", i), i)
+	}
+	assert.Equal(t, 3, cache.len())
+	value, ok = cache.get("evt-9")
+	assert.True(t, ok, "The newest entry is kept")
+	assert.Equal(t, 9, value)
+
+	// Updating a cached event does not evict another
+	cache.set("evt-9", 90)
+	assert.Equal(t, 3, cache.len())
+
+	// Expired entries are not returned and make room for new ones
+	time.Sleep(60 * time.Millisecond)
+	_, ok = cache.get("evt-9")
+	assert.False(t, ok)
+	cache.set("evt-new", 1)
+	assert.Equal(t, 1, cache.len(), "Expired entries are dropped once the cache is full")
+
+	cache.delete("evt-new")
+	assert.Equal(t, 0, cache.len())
+}
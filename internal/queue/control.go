@@ -0,0 +1,123 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// controlCacheTTL is kept short so a pause issued on one instance stops
+// admissions on every instance within about a second
+const controlCacheTTL = 1 * time.Second
+
+// QueueState is the operational state of an event queue
+type QueueState string
+
+const (
+	QueueStateOpen     QueueState = "open"     // Normal operation
+	QueueStatePaused   QueueState = "paused"   // Joins allowed, no admissions
+	QueueStateDraining QueueState = "draining" // No new joins, remaining users are still admitted
+	QueueStateClosed   QueueState = "closed"   // Everyone is expired with the reason
+)
+
+// QueueControl is the admin-controlled state of an event queue
+type QueueControl struct {
+	EventID   string     `json:"event_id"`
+	State     QueueState `json:"state"`
+	Reason    string     `json:"reason,omitempty"`
+	UpdatedAt time.Time  `json:"updated_at,omitempty"`
+}
+
+// AcceptsJoins reports whether Join may add users
+func (c *QueueControl) AcceptsJoins() bool {
+	return c.State == QueueStateOpen || c.State == QueueStatePaused
+}
+
+// AdmitsEntries reports whether Enter may grant admission
+func (c *QueueControl) AdmitsEntries() bool {
+	return c.State == QueueStateOpen || c.State == QueueStateDraining
+}
+
+// Closed reports whether the queue was closed
+func (c *QueueControl) Closed() bool {
+	return c.State == QueueStateClosed
+}
+
+// ControlStore loads and stores QueueControl documents in Redis with a short in-process cache
+type ControlStore struct {
+	redisClient redis.UniversalClient
+	logger      *logrus.Logger
+	cache       *eventCache[*QueueControl]
+}
+
+// NewControlStore creates a new queue control store
+func NewControlStore(redisClient redis.UniversalClient, logger *logrus.Logger) *ControlStore {
+	return &ControlStore{
+		redisClient: redisClient,
+		logger:      logger,
+		cache:       newEventCache[*QueueControl](controlCacheTTL, eventCacheMaxEntries),
+	}
+}
+
+func controlKey(eventID string) string {
+	return fmt.Sprintf("queue:control:{%s}", eventID)
+}
+
+// Get returns the queue state of an event (open when none is stored).
+// On Redis errors an open state is returned with the error.
+// The returned control is shared and must not be modified.
+func (s *ControlStore) Get(ctx context.Context, eventID string) (*QueueControl, error) {
+	if control, ok := s.cache.get(eventID); ok {
+		return control, nil
+	}
+
+	control := &QueueControl{EventID: eventID, State: QueueStateOpen}
+	data, err := s.redisClient.Get(ctx, controlKey(eventID)).Bytes()
+	if err != nil && err != redis.Nil {
+		return control, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, control); err != nil {
+			return &QueueControl{EventID: eventID, State: QueueStateOpen}, fmt.Errorf("failed to unmarshal queue control: %w", err)
+		}
+	}
+
+	s.cache.set(eventID, control)
+
+	return control, nil
+}
+
+// Set changes the queue state of an event. Setting open removes the stored state.
+func (s *ControlStore) Set(ctx context.Context, eventID string, state QueueState, reason string) (*QueueControl, error) {
+	control := &QueueControl{
+		EventID:   eventID,
+		State:     state,
+		Reason:    reason,
+		UpdatedAt: time.Now().UTC(),
+	}
+
+	var err error
+	if state == QueueStateOpen {
+		err = s.redisClient.Del(ctx, controlKey(eventID)).Err()
+	} else {
+		data, _ := json.Marshal(control)
+		err = s.redisClient.Set(ctx, controlKey(eventID), data, 0).Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.delete(eventID)
+
+	s.logger.WithFields(logrus.Fields{
+		"event_id": eventID,
+		"state":    state,
+		"reason":   reason,
+	}).Warn("Queue state changed")
+
+	return control, nil
+}
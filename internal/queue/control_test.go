@@ -0,0 +1,65 @@
+package queue
+
+import (
+	"context"
+	"testing"
+
+	"github.com/traffic-tacos/gateway-api/internal/testutil"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueueControl_Permissions(t *testing.T) {
+	cases := []struct {
+		state        QueueState
+		acceptsJoins bool
+		admits       bool
+	}{
+		{QueueStateOpen, true, true},
+		{QueueStatePaused, true, false},
+		{QueueStateDraining, false, true},
+		{QueueStateClosed, false, false},
+	}
+	for _, tc := range cases {
+		control := &QueueControl{State: tc.state}
+		assert.Equal(t, tc.acceptsJoins, control.AcceptsJoins(), string(tc.state))
+		assert.Equal(t, tc.admits, control.AdmitsEntries(), string(tc.state))
+	}
+}
+
+func TestControlStore_SetAndGet(t *testing.T) {
+	redisClient := testutil.NewRedisClient(t)
+
+	ctx := context.Background()
+	eventID := "test-control-evt"
+	redisClient.Del(ctx, controlKey(eventID))
+	defer redisClient.Del(ctx, controlKey(eventID))
+
+	store := NewControlStore(redisClient, logrus.New())
+
+	control, err := store.Get(ctx, eventID)
+	require.NoError(t, err)
+	assert.Equal(t, QueueStateOpen, control.State, "Events without stored state are open")
+
+	_, err = store.Set(ctx, eventID, QueueStateClosed, "Sold out")
+	require.NoError(t, err)
+
+	control, err = store.Get(ctx, eventID)
+	require.NoError(t, err)
+	assert.Equal(t, QueueStateClosed, control.State, "Set invalidates the local cache")
+	assert.Equal(t, "Sold out", control.Reason)
+
+	// Another instance sees the same state
+	control, err = NewControlStore(redisClient, logrus.New()).Get(ctx, eventID)
+	require.NoError(t, err)
+	assert.True(t, control.Closed())
+
+	_, err = store.Set(ctx, eventID, QueueStateOpen, "")
+	require.NoError(t, err)
+
+	exists, err := redisClient.Exists(ctx, controlKey(eventID)).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), exists, "Resuming removes the stored state")
+}
@@ -0,0 +1,329 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// etaCacheTTL keeps Status polling from reading the admission series on every
+	// request; the series only gains a bucket every AnalyticsResolution
+	etaCacheTTL = 2 * time.Second
+
+	// maxETASeconds caps estimates for queues that barely move
+	maxETASeconds = 24 * 60 * 60
+
+	// z90 is the standard normal quantile used for the p90 (pessimistic) ETA
+	z90 = 1.2816
+)
+
+// ETAPredictor forecasts admissions with Holt's linear (double exponential)
+// smoothing of an event's admission counts per bucket
+type ETAPredictor struct {
+	Alpha      float64       // Level smoothing (0..1]
+	Beta       float64       // Trend smoothing (0..1]
+	Resolution time.Duration // Bucket size
+	Window     int           // Buckets fitted (most recent)
+	MinSamples int           // Fewer non-empty buckets fall back to the configured rate
+}
+
+// DefaultETAPredictor returns the predictor used by Status: the last 15 minutes in 10s buckets
+func DefaultETAPredictor() ETAPredictor {
+	return ETAPredictor{
+		Alpha:      0.3,
+		Beta:       0.1,
+		Resolution: AnalyticsResolution,
+		Window:     90,
+		MinSamples: 3,
+	}
+}
+
+// ETAForecast is a fitted admission forecast
+type ETAForecast struct {
+	Level      float64       `json:"level"`   // Admissions per bucket now
+	Trend      float64       `json:"trend"`   // Change of the level per bucket
+	Sigma      float64       `json:"sigma"`   // RMS one-step forecast error per bucket
+	Samples    int           `json:"samples"` // Non-empty buckets fitted
+	Resolution time.Duration `json:"-"`
+	Learned    bool          `json:"learned"` // False when too little history was available
+}
+
+// ETAEstimate is an admission ETA range in seconds
+type ETAEstimate struct {
+	P50 int // Median estimate
+	P90 int // 90% of admissions are expected by then
+}
+
+// Fit runs Holt's smoothing over counts (oldest first, one entry per bucket)
+func (p ETAPredictor) Fit(counts []float64) ETAForecast {
+	forecast := ETAForecast{Resolution: p.Resolution}
+	if p.Window > 0 && len(counts) > p.Window {
+		counts = counts[len(counts)-p.Window:]
+	}
+
+	// Leading empty buckets are before the sale started admitting, not a rate of zero
+	start := 0
+	for start < len(counts) && counts[start] == 0 {
+		start++
+	}
+	counts = counts[start:]
+	for _, count := range counts {
+		if count > 0 {
+			forecast.Samples++
+		}
+	}
+	if forecast.Samples < p.MinSamples || len(counts) < 2 {
+		return forecast
+	}
+
+	level := counts[0]
+	trend := counts[1] - counts[0]
+	var squaredErrors float64
+	for _, count := range counts[1:] {
+		predicted := math.Max(level+trend, 0)
+		squaredErrors += (count - predicted) * (count - predicted)
+
+		previous := level
+		level = p.Alpha*count + (1-p.Alpha)*(level+trend)
+		trend = p.Beta*(level-previous) + (1-p.Beta)*trend
+	}
+
+	forecast.Level = math.Max(level, 0)
+	forecast.Trend = trend
+	forecast.Sigma = math.Sqrt(squaredErrors / float64(len(counts)-1))
+	forecast.Learned = forecast.Level > 0
+	return forecast
+}
+
+// rate returns the forecast admissions in the h-th bucket ahead. A falling trend
+// never takes the rate below a tenth of the current level, so queues keep moving.
+func (f ETAForecast) rate(h int) float64 {
+	return math.Max(f.Level+float64(h)*f.Trend, f.Level/10)
+}
+
+// ETA returns how long until position more admissions happen. p50 is when the
+// forecast reaches position; p90 when its lower bound (errors grow with the square
+// root of the horizon) does.
+func (f ETAForecast) ETA(position int) ETAEstimate {
+	if !f.Learned || position <= 0 {
+		return ETAEstimate{}
+	}
+
+	bucketSeconds := f.Resolution.Seconds()
+	maxBuckets := int(maxETASeconds / bucketSeconds)
+	target := float64(position)
+
+	estimate := ETAEstimate{P50: maxETASeconds, P90: maxETASeconds}
+	p50Found := false
+	var expected float64
+	for h := 1; h <= maxBuckets; h++ {
+		rate := f.rate(h)
+		before := expected
+		expected += rate
+
+		if !p50Found && expected >= target {
+			estimate.P50 = int(math.Ceil((float64(h-1) + (target-before)/rate) * bucketSeconds))
+			p50Found = true
+		}
+		if expected-z90*f.Sigma*math.Sqrt(float64(h)) >= target {
+			estimate.P90 = int(math.Ceil(float64(h) * bucketSeconds))
+			break
+		}
+	}
+
+	if estimate.P50 < 1 {
+		estimate.P50 = 1
+	}
+	if estimate.P90 < estimate.P50 {
+		estimate.P90 = estimate.P50
+	}
+	return estimate
+}
+
+// FallbackETA estimates the ETA from a configured admission rate (per second)
+// when the event has no admission history yet
+func FallbackETA(position int, ratePerSecond float64) ETAEstimate {
+	if position <= 0 {
+		return ETAEstimate{}
+	}
+	if ratePerSecond <= 0 {
+		eta := position * 2
+		return ETAEstimate{P50: eta, P90: eta * 2}
+	}
+
+	eta := int(math.Min(math.Ceil(float64(position)/ratePerSecond), maxETASeconds))
+	if eta < 1 {
+		eta = 1
+	}
+	// Configured rates are an upper bound; real admissions are slower
+	return ETAEstimate{P50: eta, P90: int(math.Min(float64(eta)*2, maxETASeconds))}
+}
+
+// LoadAdmissionCounts returns the admissions of an event in the last buckets
+// completed buckets of the given resolution, oldest first
+func LoadAdmissionCounts(ctx context.Context, redisClient redis.UniversalClient, eventID string, resolution time.Duration, buckets int) ([]float64, error) {
+	step := int64(resolution / time.Second)
+	end := time.Now().Unix() / step * step
+	start := end - int64(buckets)*step
+
+	admissions, err := redisClient.ZRangeByScoreWithScores(ctx, fmt.Sprintf("metrics:admission:%s", eventID), &redis.ZRangeBy{
+		Min: strconv.FormatInt(start, 10),
+		Max: "(" + strconv.FormatInt(end, 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make([]float64, buckets)
+	for _, admission := range admissions {
+		i := (int64(admission.Score) - start) / step
+		if i >= 0 && i < int64(buckets) {
+			counts[i]++
+		}
+	}
+	return counts, nil
+}
+
+// BacktestResult scores a predictor against recorded admissions
+type BacktestResult struct {
+	Samples       int     `json:"samples"`        // (origin, position) pairs whose admission was observed
+	MAESeconds    float64 `json:"mae_sec"`        // Mean absolute error of the p50 ETA
+	BiasSeconds   float64 `json:"bias_sec"`       // Mean signed error of the p50 ETA (positive = too pessimistic)
+	P50Coverage   float64 `json:"p50_coverage"`   // Share admitted by the p50 ETA (ideally about 0.5)
+	P90Coverage   float64 `json:"p90_coverage"`   // Share admitted by the p90 ETA (ideally about 0.9)
+	FallbackShare float64 `json:"fallback_share"` // Share of origins with too little history to learn from
+}
+
+// Backtest replays counts (oldest first): from every bucket after warmup, it
+// predicts when each of positions more admissions happen and compares with when
+// they actually did. Positions not reached before the end of counts are skipped.
+func (p ETAPredictor) Backtest(counts []float64, positions []int, warmup int) BacktestResult {
+	var result BacktestResult
+	var absErrors, signedErrors float64
+	var p50Hits, p90Hits, origins, fallbacks int
+	bucketSeconds := p.Resolution.Seconds()
+
+	for origin := warmup; origin < len(counts); origin++ {
+		history := counts[:origin]
+		if p.Window > 0 && len(history) > p.Window {
+			history = history[len(history)-p.Window:]
+		}
+		forecast := p.Fit(history)
+		origins++
+		if !forecast.Learned {
+			fallbacks++
+			continue
+		}
+
+		for _, position := range positions {
+			actual, ok := admittedAfter(counts[origin:], position, bucketSeconds)
+			if !ok {
+				continue
+			}
+
+			estimate := forecast.ETA(position)
+			diff := float64(estimate.P50) - actual
+			signedErrors += diff
+			absErrors += math.Abs(diff)
+			if actual <= float64(estimate.P50) {
+				p50Hits++
+			}
+			if actual <= float64(estimate.P90) {
+				p90Hits++
+			}
+			result.Samples++
+		}
+	}
+
+	if origins > 0 {
+		result.FallbackShare = float64(fallbacks) / float64(origins)
+	}
+	if result.Samples > 0 {
+		n := float64(result.Samples)
+		result.MAESeconds = absErrors / n
+		result.BiasSeconds = signedErrors / n
+		result.P50Coverage = float64(p50Hits) / n
+		result.P90Coverage = float64(p90Hits) / n
+	}
+	return result
+}
+
+// admittedAfter returns the seconds until position admissions happened in future
+// (assuming admissions spread evenly within a bucket)
+func admittedAfter(future []float64, position int, bucketSeconds float64) (float64, bool) {
+	var admitted float64
+	target := float64(position)
+	for h, count := range future {
+		if admitted+count >= target {
+			return (float64(h) + (target-admitted)/count) * bucketSeconds, true
+		}
+		admitted += count
+	}
+	return 0, false
+}
+
+// BacktestEvent scores a predictor against the admissions recorded for an event
+// over the last AnalyticsHistory
+func (p ETAPredictor) BacktestEvent(ctx context.Context, redisClient redis.UniversalClient, eventID string, positions []int) (BacktestResult, error) {
+	buckets := int(AnalyticsHistory / p.Resolution)
+	counts, err := LoadAdmissionCounts(ctx, redisClient, eventID, p.Resolution, buckets)
+	if err != nil {
+		return BacktestResult{}, fmt.Errorf("failed to load admissions: %w", err)
+	}
+	return p.Backtest(counts, positions, p.MinSamples), nil
+}
+
+// ETAStore caches fitted forecasts for a couple of seconds per event
+type ETAStore struct {
+	redisClient redis.UniversalClient
+	predictor   ETAPredictor
+	logger      *logrus.Logger
+	cache       *eventCache[ETAForecast]
+}
+
+// NewETAStore creates a new ETA store using the default predictor
+func NewETAStore(redisClient redis.UniversalClient, logger *logrus.Logger) *ETAStore {
+	return &ETAStore{
+		redisClient: redisClient,
+		predictor:   DefaultETAPredictor(),
+		logger:      logger,
+		cache:       newEventCache[ETAForecast](etaCacheTTL, eventCacheMaxEntries),
+	}
+}
+
+// Forecast returns the fitted admission forecast of an event. On Redis errors an
+// unlearned forecast is returned with the error.
+func (s *ETAStore) Forecast(ctx context.Context, eventID string) (ETAForecast, error) {
+	if forecast, ok := s.cache.get(eventID); ok {
+		return forecast, nil
+	}
+
+	counts, err := LoadAdmissionCounts(ctx, s.redisClient, eventID, s.predictor.Resolution, s.predictor.Window)
+	if err != nil {
+		return ETAForecast{Resolution: s.predictor.Resolution}, err
+	}
+	forecast := s.predictor.Fit(counts)
+
+	s.cache.set(eventID, forecast)
+
+	return forecast, nil
+}
+
+// Estimate returns the ETA range for position more admissions, falling back to
+// fallbackRate (admissions per second) until the event has admission history
+func (s *ETAStore) Estimate(ctx context.Context, eventID string, position int, fallbackRate float64) ETAEstimate {
+	forecast, err := s.Forecast(ctx, eventID)
+	if err != nil {
+		s.logger.WithError(err).WithField("event_id", eventID).Warn("Failed to load admission history for ETA")
+	}
+	if !forecast.Learned {
+		return FallbackETA(position, fallbackRate)
+	}
+	return forecast.ETA(position)
+}
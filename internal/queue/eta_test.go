@@ -0,0 +1,117 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/testutil"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func constantCounts(n int, count float64) []float64 {
+	counts := make([]float64, n)
+	for i := range counts {
+		counts[i] = count
+	}
+	return counts
+}
+
+func TestETAPredictor_Fit(t *testing.T) {
+	predictor := DefaultETAPredictor()
+
+	// No history: nothing learned, the configured rate is used instead
+	assert.False(t, predictor.Fit(make([]float64, 90)).Learned)
+	assert.Equal(t, ETAEstimate{}, predictor.Fit(nil).ETA(100))
+
+	// Steady 20 admissions per 10s bucket: 100 positions take 50s
+	steady := predictor.Fit(constantCounts(90, 20))
+	require.True(t, steady.Learned)
+	assert.InDelta(t, 20, steady.Level, 1e-9)
+	assert.InDelta(t, 0, steady.Trend, 1e-9)
+	eta := steady.ETA(100)
+	assert.Equal(t, 50, eta.P50)
+	assert.Equal(t, 50, eta.P90, "No forecast errors: no spread")
+
+	// Leading empty buckets (before the sale started) do not drag the level down
+	late := predictor.Fit(append(make([]float64, 60), constantCounts(30, 20)...))
+	assert.Equal(t, 50, late.ETA(100).P50)
+
+	// Admissions slowing down push the ETA out instead of in
+	slowing := make([]float64, 90)
+	for i := range slowing {
+		slowing[i] = 40 - float64(i)*0.4
+	}
+	assert.Greater(t, predictor.Fit(slowing).ETA(100).P50, steady.ETA(100).P50)
+
+	// Noisy admissions widen the range
+	noisy := make([]float64, 90)
+	for i := range noisy {
+		noisy[i] = 20 + float64((i%3)-1)*10
+	}
+	noisyETA := predictor.Fit(noisy).ETA(100)
+	assert.Greater(t, noisyETA.P90, noisyETA.P50)
+}
+
+func TestFallbackETA(t *testing.T) {
+	assert.Equal(t, ETAEstimate{P50: 10, P90: 20}, FallbackETA(500, 50))
+	assert.Equal(t, ETAEstimate{P50: 20, P90: 40}, FallbackETA(10, 0), "No configured rate: 2s per position")
+	assert.Equal(t, ETAEstimate{}, FallbackETA(0, 50))
+}
+
+func TestETAPredictor_Backtest(t *testing.T) {
+	predictor := DefaultETAPredictor()
+	positions := []int{10, 100, 500}
+
+	steady := predictor.Backtest(constantCounts(360, 20), positions, 3)
+	require.Greater(t, steady.Samples, 0)
+	assert.Less(t, steady.MAESeconds, 1.0)
+	assert.Equal(t, 1.0, steady.P90Coverage)
+
+	// Random admissions: the p90 ETA covers more than the p50 one
+	random := rand.New(rand.NewSource(1))
+	counts := make([]float64, 360)
+	for i := range counts {
+		counts[i] = float64(10 + random.Intn(21))
+	}
+	noisy := predictor.Backtest(counts, positions, 3)
+	require.Greater(t, noisy.Samples, 0)
+	assert.Greater(t, noisy.P90Coverage, noisy.P50Coverage)
+	assert.GreaterOrEqual(t, noisy.P90Coverage, 0.8)
+
+	// Warm-up origins without admissions count as fallbacks
+	warmup := predictor.Backtest(append(make([]float64, 10), constantCounts(10, 5)...), positions, 0)
+	assert.Greater(t, warmup.FallbackShare, 0.0)
+}
+
+func TestLoadAdmissionCounts(t *testing.T) {
+	redisClient := testutil.NewRedisClient(t)
+
+	ctx := context.Background()
+	eventID := "test-eta-evt"
+	key := fmt.Sprintf("metrics:admission:%s", eventID)
+	redisClient.Del(ctx, key)
+	defer redisClient.Del(ctx, key)
+
+	// Admissions in the last completed bucket and two buckets before it
+	bucketEnd := time.Now().Unix() / 10 * 10
+	require.NoError(t, redisClient.ZAdd(ctx, key,
+		redis.Z{Score: float64(bucketEnd - 1), Member: "wt-1"},
+		redis.Z{Score: float64(bucketEnd - 5), Member: "wt-2"},
+		redis.Z{Score: float64(bucketEnd - 25), Member: "wt-3"},
+		redis.Z{Score: float64(bucketEnd + 1), Member: "wt-4"}, // Current bucket, not complete yet
+	).Err())
+
+	counts, err := LoadAdmissionCounts(ctx, redisClient, eventID, 10*time.Second, 4)
+	require.NoError(t, err)
+	assert.Equal(t, []float64{0, 1, 0, 2}, counts)
+
+	result, err := DefaultETAPredictor().BacktestEvent(ctx, redisClient, eventID, []int{1})
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, result.FallbackShare, "Too little history to learn from")
+}
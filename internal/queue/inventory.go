@@ -0,0 +1,113 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// inventoryCacheTTL keeps Status polling from reading the counters on every request
+const inventoryCacheTTL = 1 * time.Second
+
+// InventoryKey returns the remaining seat counter decremented by hold_seat_atomic.lua.
+// The event hash tag lets Enter check it in the same script as the queue keys.
+func InventoryKey(eventID string) string {
+	return fmt.Sprintf("inventory:{%s}", eventID)
+}
+
+// GrantsKey returns the ZSET of outstanding reservation tokens granted by Enter,
+// scored by their expiry (Unix seconds)
+func GrantsKey(eventID string) string {
+	return fmt.Sprintf("queue:grants:{%s}", eventID)
+}
+
+// Inventory is a snapshot of an event's remaining seats and outstanding grants
+type Inventory struct {
+	Known       bool  // False when no inventory counter exists (admission is not capped)
+	Remaining   int64 // Seats left
+	Outstanding int64 // Unexpired reservation tokens not yet turned into reservations
+}
+
+// SoldOut reports whether the event has no seats left
+func (i *Inventory) SoldOut() bool {
+	return i.Known && i.Remaining <= 0
+}
+
+// Available returns how many more reservation tokens may be granted, or -1 when uncapped
+func (i *Inventory) Available(oversellFactor float64) int64 {
+	if !i.Known {
+		return -1
+	}
+	grantCap := int64(math.Floor(float64(i.Remaining) * oversellFactor))
+	if i.Outstanding >= grantCap {
+		return 0
+	}
+	return grantCap - i.Outstanding
+}
+
+// LoadInventory reads the remaining seats and the outstanding grants of an event
+func LoadInventory(ctx context.Context, redisClient redis.UniversalClient, eventID string) (*Inventory, error) {
+	pipe := redisClient.Pipeline()
+	remainingCmd := pipe.Get(ctx, InventoryKey(eventID))
+	outstandingCmd := pipe.ZCount(ctx, GrantsKey(eventID), "("+strconv.FormatInt(time.Now().Unix(), 10), "+inf")
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	inventory := &Inventory{Outstanding: outstandingCmd.Val()}
+	remaining, err := remainingCmd.Int64()
+	if err == redis.Nil {
+		return inventory, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid inventory counter: %w", err)
+	}
+	inventory.Known = true
+	inventory.Remaining = remaining
+	return inventory, nil
+}
+
+// ReleaseGrant removes a reservation token from the outstanding grants once it
+// became a reservation (its seats are then counted by the inventory itself)
+func ReleaseGrant(ctx context.Context, redisClient redis.UniversalClient, eventID, reservationToken string) error {
+	return redisClient.ZRem(ctx, GrantsKey(eventID), reservationToken).Err()
+}
+
+// InventoryStore caches inventory snapshots for about a second per event
+type InventoryStore struct {
+	redisClient redis.UniversalClient
+	logger      *logrus.Logger
+	cache       *eventCache[*Inventory]
+}
+
+// NewInventoryStore creates a new inventory store
+func NewInventoryStore(redisClient redis.UniversalClient, logger *logrus.Logger) *InventoryStore {
+	return &InventoryStore{
+		redisClient: redisClient,
+		logger:      logger,
+		cache:       newEventCache[*Inventory](inventoryCacheTTL, eventCacheMaxEntries),
+	}
+}
+
+// Get returns the inventory of an event. On Redis errors an unknown (uncapped)
+// inventory is returned with the error; Enter still enforces the cap atomically.
+// The returned inventory is shared and must not be modified.
+func (s *InventoryStore) Get(ctx context.Context, eventID string) (*Inventory, error) {
+	if inventory, ok := s.cache.get(eventID); ok {
+		return inventory, nil
+	}
+
+	inventory, err := LoadInventory(ctx, s.redisClient, eventID)
+	if err != nil {
+		return &Inventory{}, err
+	}
+
+	s.cache.set(eventID, inventory)
+
+	return inventory, nil
+}
@@ -0,0 +1,100 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/testutil"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInventory_Available(t *testing.T) {
+	unknown := &Inventory{}
+	assert.False(t, unknown.SoldOut())
+	assert.Equal(t, int64(-1), unknown.Available(1.0), "No counter: uncapped")
+
+	inventory := &Inventory{Known: true, Remaining: 10, Outstanding: 4}
+	assert.Equal(t, int64(6), inventory.Available(1.0))
+	assert.Equal(t, int64(11), inventory.Available(1.5))
+
+	full := &Inventory{Known: true, Remaining: 10, Outstanding: 12}
+	assert.Equal(t, int64(0), full.Available(1.0))
+
+	soldOut := &Inventory{Known: true, Remaining: 0}
+	assert.True(t, soldOut.SoldOut())
+	assert.Equal(t, int64(0), soldOut.Available(2.0))
+}
+
+func TestLuaExecutor_EnterInventoryCap(t *testing.T) {
+	redisClient := testutil.NewRedisClient(t)
+
+	executor := NewLuaExecutor(redisClient, logrus.New())
+	ctx := context.Background()
+	eventID := "test-inventory-evt"
+	tokens := []string{"wt-1", "wt-2", "wt-3"}
+
+	cleanup := func() {
+		keys := []string{
+			EventQueueKey(eventID, ""), PositionIndexKey(eventID, ""),
+			InventoryKey(eventID), GrantsKey(eventID),
+		}
+		for _, token := range tokens {
+			keys = append(keys, WaitingDataKey(eventID, token), HeartbeatKey(eventID, token),
+				ReservationTokenKey(eventID, "rt-"+token), UserStreamKey(eventID, "user-"+token),
+				"dedupe:{"+eventID+"}:"+token)
+		}
+		redisClient.Del(ctx, keys...)
+	}
+	cleanup()
+	defer cleanup()
+
+	for _, token := range tokens {
+		_, err := executor.JoinQueue(ctx, &QueueJoin{
+			EventID:      eventID,
+			UserID:       "user-" + token,
+			Token:        token,
+			DedupeKey:    "dedupe:{" + eventID + "}:" + token,
+			Data:         []byte(`{"event_id":"` + eventID + `","status":"waiting"}`),
+			DataTTL:      time.Minute,
+			HeartbeatTTL: time.Minute,
+			DedupeTTL:    time.Second,
+		})
+		require.NoError(t, err)
+	}
+
+	enter := func(token string) string {
+		result, err := executor.EnterQueue(ctx, eventID, "", token, "rt-"+token, []byte(`{}`), 30*time.Second, 1.0)
+		require.NoError(t, err)
+		return result.Error
+	}
+
+	// Two seats left: two grants, the third waits
+	require.NoError(t, redisClient.Set(ctx, InventoryKey(eventID), 2, 0).Err())
+	assert.Equal(t, "", enter("wt-1"))
+	assert.Equal(t, "", enter("wt-2"))
+	assert.Equal(t, "INVENTORY_FULL", enter("wt-3"))
+
+	inventory, err := LoadInventory(ctx, redisClient, eventID)
+	require.NoError(t, err)
+	assert.Equal(t, &Inventory{Known: true, Remaining: 2, Outstanding: 2}, inventory)
+
+	// A grant turned into a reservation that held a seat frees no capacity by itself...
+	require.NoError(t, ReleaseGrant(ctx, redisClient, eventID, "rt-wt-1"))
+	require.NoError(t, redisClient.Decr(ctx, InventoryKey(eventID)).Err())
+	assert.Equal(t, "INVENTORY_FULL", enter("wt-3"))
+
+	// ... but an expired grant does
+	require.NoError(t, redisClient.ZAdd(ctx, GrantsKey(eventID), redis.Z{Score: float64(time.Now().Add(-time.Second).Unix()), Member: "rt-wt-2"}).Err())
+	assert.Equal(t, "", enter("wt-3"))
+
+	// Sold out
+	require.NoError(t, redisClient.Set(ctx, InventoryKey(eventID), 0, 0).Err())
+	inventory, err = LoadInventory(ctx, redisClient, eventID)
+	require.NoError(t, err)
+	assert.True(t, inventory.SoldOut())
+}
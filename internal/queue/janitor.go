@@ -0,0 +1,317 @@
+package queue
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/metrics"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+//go:embed lua/expire_waiting.lua
+var expireWaitingScript string
+
+//go:embed lua/expire_grants.lua
+var expireGrantsScript string
+
+// ActiveEventsKey is a ZSET of event IDs scored by their last join (Unix seconds).
+// Join touches it so the janitor knows which events to sweep without SCAN.
+const ActiveEventsKey = "queue:active_events"
+
+// JanitorConfig controls how often and how aggressively the janitor sweeps
+type JanitorConfig struct {
+	Interval           time.Duration // Time between sweeps
+	ActiveWindow       time.Duration // Events without joins for this long are dropped from ActiveEventsKey
+	StreamMaxAge       time.Duration // Stream entries older than this are trimmed
+	AdmissionRetention time.Duration // metrics:admission entries older than this are pruned
+	BatchSize          int64         // ZSCAN count / heartbeat pipeline size
+}
+
+// DefaultJanitorConfig returns the janitor settings used when none are configured
+func DefaultJanitorConfig() JanitorConfig {
+	return JanitorConfig{
+		Interval:           15 * time.Second,
+		ActiveWindow:       2 * time.Hour,
+		StreamMaxAge:       1 * time.Hour,
+		AdmissionRetention: 1 * time.Hour,
+		BatchSize:          500,
+	}
+}
+
+// SweepResult counts what a sweep removed
+type SweepResult struct {
+	Events           int // Events swept
+	Waiting          int // Abandoned tokens removed from queue:event
+	PositionIndex    int // Abandoned or admitted tokens removed from position_index
+	StreamEntries    int // Trimmed stream entries
+	AdmissionMetrics int // Pruned metrics:admission entries
+	Grants           int // Reservation tokens that expired unused
+	InactiveEvents   int // Events dropped from the active set
+}
+
+func (r *SweepResult) add(other SweepResult) {
+	r.Events += other.Events
+	r.Waiting += other.Waiting
+	r.PositionIndex += other.PositionIndex
+	r.StreamEntries += other.StreamEntries
+	r.AdmissionMetrics += other.AdmissionMetrics
+	r.Grants += other.Grants
+	r.InactiveEvents += other.InactiveEvents
+}
+
+// Janitor removes waiters whose heartbeat expired without anyone calling Status,
+// records unused reservation tokens as expired, trims streams and prunes admission
+// metrics. It runs as a leader worker; a sweep overlapping another during a
+// failover is harmless, as every expiry is re-checked by its script.
+type Janitor struct {
+	redisClient   redis.UniversalClient
+	streamQueue   *StreamQueue
+	waitingScript *redis.Script
+	grantsScript  *redis.Script
+	config        JanitorConfig
+	logger        *logrus.Logger
+}
+
+// NewJanitor creates a new queue janitor
+func NewJanitor(redisClient redis.UniversalClient, config JanitorConfig, logger *logrus.Logger) *Janitor {
+	defaults := DefaultJanitorConfig()
+	if config.Interval <= 0 {
+		config.Interval = defaults.Interval
+	}
+	if config.ActiveWindow <= 0 {
+		config.ActiveWindow = defaults.ActiveWindow
+	}
+	if config.StreamMaxAge <= 0 {
+		config.StreamMaxAge = defaults.StreamMaxAge
+	}
+	if config.AdmissionRetention <= 0 {
+		config.AdmissionRetention = defaults.AdmissionRetention
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaults.BatchSize
+	}
+
+	return &Janitor{
+		redisClient:   redisClient,
+		streamQueue:   NewStreamQueue(redisClient, logger),
+		waitingScript: redis.NewScript(expireWaitingScript),
+		grantsScript:  redis.NewScript(expireGrantsScript),
+		config:        config,
+		logger:        logger,
+	}
+}
+
+// Run sweeps every interval until ctx is cancelled
+func (j *Janitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		j.tick(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (j *Janitor) tick(ctx context.Context) {
+	start := time.Now()
+	result, err := j.Sweep(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		metrics.RecordJanitorRun("failure", time.Since(start))
+		j.logger.WithError(err).Error("Queue janitor sweep failed")
+		return
+	}
+	metrics.RecordJanitorRun("success", time.Since(start))
+
+	if result.Waiting+result.PositionIndex+result.StreamEntries+result.AdmissionMetrics+result.Grants+result.InactiveEvents > 0 {
+		j.logger.WithFields(logrus.Fields{
+			"events":            result.Events,
+			"waiting":           result.Waiting,
+			"position_index":    result.PositionIndex,
+			"stream_entries":    result.StreamEntries,
+			"admission_metrics": result.AdmissionMetrics,
+			"grants":            result.Grants,
+			"inactive_events":   result.InactiveEvents,
+			"duration_ms":       time.Since(start).Milliseconds(),
+		}).Info("Queue janitor sweep completed")
+	}
+}
+
+// Sweep cleans every active event once
+func (j *Janitor) Sweep(ctx context.Context) (SweepResult, error) {
+	var total SweepResult
+
+	cutoff := time.Now().Add(-j.config.ActiveWindow).Unix()
+	inactive, err := j.redisClient.ZRemRangeByScore(ctx, ActiveEventsKey, "-inf", "("+strconv.FormatInt(cutoff, 10)).Result()
+	if err != nil {
+		return total, fmt.Errorf("failed to prune active events: %w", err)
+	}
+	total.InactiveEvents = int(inactive)
+	metrics.RecordJanitorRemoved("inactive_events", total.InactiveEvents)
+
+	eventIDs, err := j.redisClient.ZRange(ctx, ActiveEventsKey, 0, -1).Result()
+	if err != nil {
+		return total, fmt.Errorf("failed to list active events: %w", err)
+	}
+
+	for _, eventID := range eventIDs {
+		if ctx.Err() != nil {
+			return total, ctx.Err()
+		}
+
+		result, err := j.SweepEvent(ctx, eventID)
+		if err != nil {
+			j.logger.WithError(err).WithField("event_id", eventID).Warn("Failed to sweep event queue")
+		}
+		total.add(result)
+	}
+
+	return total, nil
+}
+
+// SweepEvent removes abandoned tokens, expires unused reservation tokens, trims
+// streams and prunes admission metrics for one event
+func (j *Janitor) SweepEvent(ctx context.Context, eventID string) (SweepResult, error) {
+	result := SweepResult{Events: 1}
+
+	lanes, err := KnownLanes(ctx, j.redisClient, eventID)
+	if err != nil {
+		return result, fmt.Errorf("failed to list lanes: %w", err)
+	}
+
+	for _, lane := range lanes {
+		waiting, err := j.expireDeadWaiters(ctx, eventID, lane)
+		result.Waiting += waiting
+		metrics.RecordJanitorRemoved("waiting", waiting)
+		if err != nil {
+			return result, err
+		}
+
+		// Also catches tokens admitted before Enter removed them from position_index,
+		// which would otherwise inflate positions reported to everyone behind them
+		indexed, err := j.removeDeadMembers(ctx, eventID, PositionIndexKey(eventID, lane))
+		result.PositionIndex += indexed
+		metrics.RecordJanitorRemoved("position_index", indexed)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	grants, err := j.grantsScript.Run(ctx, j.redisClient,
+		[]string{GrantsKey(eventID), LifecycleKey(eventID)}, lifecycleMaxLen).Int()
+	result.Grants = grants
+	metrics.RecordJanitorRemoved("grants", grants)
+	if err != nil {
+		return result, fmt.Errorf("failed to expire grants: %w", err)
+	}
+
+	trimmed, err := j.streamQueue.CleanupExpiredStreams(ctx, eventID, j.config.StreamMaxAge)
+	result.StreamEntries = trimmed
+	metrics.RecordJanitorRemoved("stream_entries", trimmed)
+	if err != nil {
+		return result, err
+	}
+
+	cutoff := time.Now().Add(-j.config.AdmissionRetention).Unix()
+	pruned, err := j.redisClient.ZRemRangeByScore(ctx, fmt.Sprintf("metrics:admission:%s", eventID),
+		"-inf", "("+strconv.FormatInt(cutoff, 10)).Result()
+	if err != nil {
+		return result, fmt.Errorf("failed to prune admission metrics: %w", err)
+	}
+	result.AdmissionMetrics = int(pruned)
+	metrics.RecordJanitorRemoved("admission_metrics", result.AdmissionMetrics)
+
+	return result, nil
+}
+
+// expireDeadWaiters removes a lane's queued tokens whose heartbeat key no longer
+// exists and records them as heartbeat_expired. Queue data is left in place so
+// Status still answers TOKEN_EXPIRED.
+func (j *Janitor) expireDeadWaiters(ctx context.Context, eventID, lane string) (int, error) {
+	removed := 0
+	key := EventQueueKey(eventID, lane)
+	err := scanDeadMembers(ctx, j.redisClient, eventID, key, j.config.BatchSize, func(dead []interface{}) error {
+		args := append([]interface{}{WaitingDataKey(eventID, ""), lifecycleMaxLen}, dead...)
+		n, err := j.waitingScript.Run(ctx, j.redisClient, []string{key, LifecycleKey(eventID)}, args...).Int()
+		if err != nil {
+			return fmt.Errorf("expire %s failed: %w", key, err)
+		}
+		removed += n
+		return nil
+	})
+	return removed, err
+}
+
+// removeDeadMembers removes ZSET members whose heartbeat key no longer exists.
+// queue:waiting data is left in place so Status still answers TOKEN_EXPIRED.
+func (j *Janitor) removeDeadMembers(ctx context.Context, eventID, key string) (int, error) {
+	removed := 0
+	err := scanDeadMembers(ctx, j.redisClient, eventID, key, j.config.BatchSize, func(dead []interface{}) error {
+		n, err := j.redisClient.ZRem(ctx, key, dead...).Result()
+		if err != nil {
+			return fmt.Errorf("zrem %s failed: %w", key, err)
+		}
+		removed += int(n)
+		return nil
+	})
+	return removed, err
+}
+
+// scanDeadMembers calls fn with each batch of ZSET members whose heartbeat key no longer exists
+func scanDeadMembers(ctx context.Context, redisClient redis.UniversalClient, eventID, key string, batchSize int64, fn func(dead []interface{}) error) error {
+	var cursor uint64
+
+	for {
+		pairs, next, err := redisClient.ZScan(ctx, key, cursor, "*", batchSize).Result()
+		if err != nil {
+			return fmt.Errorf("zscan %s failed: %w", key, err)
+		}
+
+		// ZSCAN returns member, score, member, score, ...
+		members := make([]string, 0, len(pairs)/2)
+		for i := 0; i < len(pairs); i += 2 {
+			members = append(members, pairs[i])
+		}
+
+		if len(members) > 0 {
+			pipe := redisClient.Pipeline()
+			checks := make([]*redis.IntCmd, len(members))
+			for i, member := range members {
+				checks[i] = pipe.Exists(ctx, HeartbeatKey(eventID, member))
+			}
+			if _, err := pipe.Exec(ctx); err != nil {
+				return fmt.Errorf("heartbeat check failed: %w", err)
+			}
+
+			dead := make([]interface{}, 0)
+			for i, check := range checks {
+				if check.Val() == 0 {
+					dead = append(dead, members[i])
+				}
+			}
+
+			if len(dead) > 0 {
+				if err := fn(dead); err != nil {
+					return err
+				}
+			}
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
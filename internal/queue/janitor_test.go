@@ -0,0 +1,97 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/testutil"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJanitor_SweepEvent(t *testing.T) {
+	redisClient := testutil.NewRedisClient(t)
+
+	ctx := context.Background()
+	eventID := "test-janitor-evt"
+	eventQueueKey := fmt.Sprintf("queue:event:{%s}", eventID)
+	positionIndexKey := fmt.Sprintf("position_index:{%s}", eventID)
+	admissionKey := fmt.Sprintf("metrics:admission:%s", eventID)
+	streamKey := fmt.Sprintf("stream:event:{%s}:user:u1", eventID)
+
+	tokens := []string{"janitor-alive-1", "janitor-dead-1", "janitor-alive-2", "janitor-dead-2"}
+	cleanup := func() {
+		redisClient.Del(ctx, eventQueueKey, positionIndexKey, admissionKey, streamKey, LifecycleKey(eventID))
+		redisClient.ZRem(ctx, ActiveEventsKey, eventID, "test-janitor-stale")
+		for _, token := range tokens {
+			redisClient.Del(ctx, HeartbeatKey(eventID, token))
+		}
+	}
+	cleanup()
+	defer cleanup()
+
+	now := time.Now()
+	for i, token := range tokens {
+		z := redis.Z{Score: float64(now.Unix() + int64(i)), Member: token}
+		require.NoError(t, redisClient.ZAdd(ctx, eventQueueKey, z).Err())
+		require.NoError(t, redisClient.ZAdd(ctx, positionIndexKey, z).Err())
+	}
+	redisClient.Set(ctx, HeartbeatKey(eventID, "janitor-alive-1"), "alive", time.Minute)
+	redisClient.Set(ctx, HeartbeatKey(eventID, "janitor-alive-2"), "alive", time.Minute)
+
+	// An admitted token: gone from queue:event, still in position_index, no heartbeat
+	require.NoError(t, redisClient.ZAdd(ctx, positionIndexKey, redis.Z{Score: float64(now.Unix()), Member: "janitor-admitted"}).Err())
+
+	// Old and recent admissions
+	redisClient.ZAdd(ctx, admissionKey,
+		redis.Z{Score: float64(now.Add(-2 * time.Hour).Unix()), Member: "old-user"},
+		redis.Z{Score: float64(now.Unix()), Member: "new-user"},
+	)
+
+	// Old and recent stream entries
+	redisClient.XAdd(ctx, &redis.XAddArgs{Stream: streamKey, ID: fmt.Sprintf("%d-0", now.Add(-2*time.Hour).UnixMilli()), Values: map[string]interface{}{"token": "old"}})
+	redisClient.XAdd(ctx, &redis.XAddArgs{Stream: streamKey, Values: map[string]interface{}{"token": "new"}})
+
+	// Active set: one live event, one that has not seen a join for hours
+	redisClient.ZAdd(ctx, ActiveEventsKey,
+		redis.Z{Score: float64(now.Unix()), Member: eventID},
+		redis.Z{Score: float64(now.Add(-3 * time.Hour).Unix()), Member: "test-janitor-stale"},
+	)
+
+	janitor := NewJanitor(redisClient, DefaultJanitorConfig(), logrus.New())
+
+	result, err := janitor.SweepEvent(ctx, eventID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Waiting)
+	assert.Equal(t, 3, result.PositionIndex, "Dead and admitted tokens leave position_index")
+	assert.Equal(t, 1, result.StreamEntries)
+	assert.Equal(t, 1, result.AdmissionMetrics)
+
+	expired, err := redisClient.XLen(ctx, LifecycleKey(eventID)).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), expired, "Removed waiters are recorded as heartbeat_expired")
+
+	members, err := redisClient.ZRange(ctx, eventQueueKey, 0, -1).Result()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"janitor-alive-1", "janitor-alive-2"}, members)
+
+	members, err = redisClient.ZRange(ctx, positionIndexKey, 0, -1).Result()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"janitor-alive-1", "janitor-alive-2"}, members)
+
+	// Full sweep drops the stale event from the active set
+	total, err := janitor.Sweep(ctx)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, total.InactiveEvents, 1)
+
+	score, err := redisClient.ZScore(ctx, ActiveEventsKey, eventID).Result()
+	require.NoError(t, err)
+	assert.Equal(t, float64(now.Unix()), score)
+	_, err = redisClient.ZScore(ctx, ActiveEventsKey, "test-janitor-stale").Result()
+	assert.Equal(t, redis.Nil, err)
+}
@@ -0,0 +1,223 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Lane is a priority lane within an event queue. Each lane is its own ordered
+// set; admission interleaves the lanes by weight (e.g. fanclub 3 : general 1).
+type Lane struct {
+	Name   string   `json:"name"`
+	Weight int      `json:"weight"`           // Share of admissions relative to the other lanes
+	Claim  string   `json:"claim,omitempty"`  // JWT claim that selects this lane (e.g. "role", "tier")
+	Values []string `json:"values,omitempty"` // Claim values routed to this lane
+}
+
+// IsDefault reports whether the lane catches everyone not matched by another lane.
+// The default lane is stored in the event's original queue keys.
+func (l *Lane) IsDefault() bool {
+	return l.Claim == ""
+}
+
+// EventQueueKey returns the waiting ZSET of a lane ("" = default lane)
+func EventQueueKey(eventID, lane string) string {
+	if lane == "" {
+		return fmt.Sprintf("queue:event:{%s}", eventID)
+	}
+	return fmt.Sprintf("queue:event:{%s}:lane:%s", eventID, lane)
+}
+
+// PositionIndexKey returns the position index ZSET of a lane ("" = default lane)
+func PositionIndexKey(eventID, lane string) string {
+	if lane == "" {
+		return fmt.Sprintf("position_index:{%s}", eventID)
+	}
+	return fmt.Sprintf("position_index:{%s}:lane:%s", eventID, lane)
+}
+
+// WaitingDataKey returns the queue data of a waiting token. Every per-token key
+// carries the event hash tag so join, enter and leave run as one script in Redis Cluster.
+func WaitingDataKey(eventID, token string) string {
+	return fmt.Sprintf("queue:waiting:{%s}:%s", eventID, token)
+}
+
+// HeartbeatKey returns the heartbeat key of a waiting token
+func HeartbeatKey(eventID, token string) string {
+	return fmt.Sprintf("heartbeat:{%s}:%s", eventID, token)
+}
+
+// UserSlotKey returns the key pointing at a user's active waiting token, so a
+// repeat Join finds it instead of queueing the user twice
+func UserSlotKey(eventID, userID string) string {
+	return fmt.Sprintf("queue:slot:{%s}:%s", eventID, userID)
+}
+
+// SessionEventsKey returns the SET of events an anonymous identity joined, so
+// logging in can hand its waiting tokens over to the user in each of them
+func SessionEventsKey(anonymousID string) string {
+	return fmt.Sprintf("queue:session_events:%s", anonymousID)
+}
+
+// UserStreamKey returns the join stream of a user
+func UserStreamKey(eventID, userID string) string {
+	return fmt.Sprintf("stream:event:{%s}:user:%s", eventID, userID)
+}
+
+// LanesKey returns the SET of non-default lanes that ever had joins for an event,
+// so cleanup and lobby opening find lane keys even after the policy changed
+func LanesKey(eventID string) string {
+	return fmt.Sprintf("queue:lanes:{%s}", eventID)
+}
+
+// KnownLanes returns the default lane ("") followed by every lane registered for the event
+func KnownLanes(ctx context.Context, redisClient redis.UniversalClient, eventID string) ([]string, error) {
+	lanes, err := redisClient.SMembers(ctx, LanesKey(eventID)).Result()
+	if err != nil {
+		return []string{""}, err
+	}
+	return append([]string{""}, lanes...), nil
+}
+
+// LaneFor picks the lane for a caller from their JWT claims.
+// Returns "" (the default lane) for anonymous callers or when no lane matches.
+func (p *QueuePolicy) LaneFor(claims map[string]interface{}) string {
+	if len(p.Lanes) == 0 || claims == nil {
+		return ""
+	}
+
+	for _, lane := range p.Lanes {
+		if lane.IsDefault() {
+			continue
+		}
+		if claimMatches(claims[lane.Claim], lane.Values) {
+			return lane.Name
+		}
+	}
+	return ""
+}
+
+func claimMatches(value interface{}, allowed []string) bool {
+	switch v := value.(type) {
+	case string:
+		for _, a := range allowed {
+			if v == a {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if claimMatches(item, allowed) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// LaneName returns the display name of a lane ("" maps to the default lane's name)
+func (p *QueuePolicy) LaneName(lane string) string {
+	if lane != "" {
+		return lane
+	}
+	for _, l := range p.Lanes {
+		if l.IsDefault() {
+			return l.Name
+		}
+	}
+	return ""
+}
+
+// laneWeight returns the weight of a lane. Lanes no longer in the policy weigh 1
+// so their remaining waiters are still served.
+func (p *QueuePolicy) laneWeight(lane string) int {
+	for _, l := range p.Lanes {
+		if (lane == "" && l.IsDefault()) || (lane != "" && l.Name == lane) {
+			return l.Weight
+		}
+	}
+	return 1
+}
+
+// EffectivePosition converts a position within a lane into a position in the
+// interleaved admission order. With weights w, the p-th user of lane L is
+// preceded by up to (p-1)*w_k/w_L users of every other lane k (bounded by
+// that lane's size). Without lanes it returns lanePosition unchanged.
+func (p *QueuePolicy) EffectivePosition(lane string, lanePosition int, laneSizes map[string]int64) int {
+	if len(laneSizes) <= 1 {
+		return lanePosition
+	}
+
+	weight := p.laneWeight(lane)
+	position := lanePosition
+	for other, size := range laneSizes {
+		if other == lane || size == 0 {
+			continue
+		}
+		ahead := int64((lanePosition - 1) * p.laneWeight(other) / weight)
+		if ahead > size {
+			ahead = size
+		}
+		position += int(ahead)
+	}
+	return position
+}
+
+// LaneSizes returns the number of waiters in every known lane of an event
+func LaneSizes(ctx context.Context, redisClient redis.UniversalClient, eventID string) (map[string]int64, error) {
+	lanes, err := KnownLanes(ctx, redisClient, eventID)
+	if err != nil {
+		return nil, err
+	}
+	if len(lanes) == 1 {
+		return map[string]int64{"": 0}, nil
+	}
+
+	pipe := redisClient.Pipeline()
+	counts := make([]*redis.IntCmd, len(lanes))
+	for i, lane := range lanes {
+		counts[i] = pipe.ZCard(ctx, EventQueueKey(eventID, lane))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	sizes := make(map[string]int64, len(lanes))
+	for i, lane := range lanes {
+		sizes[lane] = counts[i].Val()
+	}
+	return sizes, nil
+}
+
+func validateLanes(lanes []Lane) error {
+	if len(lanes) == 0 {
+		return nil
+	}
+
+	defaults := 0
+	seen := make(map[string]bool, len(lanes))
+	for i, lane := range lanes {
+		if lane.Name == "" || strings.ContainsAny(lane.Name, "{}: ") {
+			return fmt.Errorf("lanes[%d]: name is required and may not contain braces, colons or spaces", i)
+		}
+		if seen[lane.Name] {
+			return fmt.Errorf("lanes: duplicate name %q", lane.Name)
+		}
+		seen[lane.Name] = true
+		if lane.Weight < 1 {
+			return fmt.Errorf("lanes[%d]: weight must be at least 1", i)
+		}
+		if lane.IsDefault() {
+			defaults++
+		} else if len(lane.Values) == 0 {
+			return fmt.Errorf("lanes[%d]: values are required when claim is set", i)
+		}
+	}
+	if defaults != 1 {
+		return fmt.Errorf("lanes: exactly one lane without a claim (the default lane) is required")
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/testutil"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func lanePolicy() *QueuePolicy {
+	policy := DefaultQueuePolicy("evt")
+	policy.Lanes = []Lane{
+		{Name: "accessibility", Weight: 3, Claim: "tier", Values: []string{"accessibility"}},
+		{Name: "fanclub", Weight: 3, Claim: "role", Values: []string{"fanclub", "fanclub_gold"}},
+		{Name: "general", Weight: 1},
+	}
+	return policy
+}
+
+func TestQueuePolicy_LaneFor(t *testing.T) {
+	policy := lanePolicy()
+
+	assert.Equal(t, "", policy.LaneFor(nil), "Anonymous callers use the default lane")
+	assert.Equal(t, "", policy.LaneFor(map[string]interface{}{"role": "user"}))
+	assert.Equal(t, "fanclub", policy.LaneFor(map[string]interface{}{"role": "fanclub_gold"}))
+	assert.Equal(t, "fanclub", policy.LaneFor(map[string]interface{}{"role": []interface{}{"user", "fanclub"}}))
+	assert.Equal(t, "accessibility", policy.LaneFor(map[string]interface{}{"role": "fanclub", "tier": "accessibility"}),
+		"The first matching lane wins")
+
+	assert.Equal(t, "general", policy.LaneName(""))
+	assert.Equal(t, "fanclub", policy.LaneName("fanclub"))
+	assert.Equal(t, "", DefaultQueuePolicy("evt").LaneName(""), "No lanes configured")
+}
+
+func TestQueuePolicy_EffectivePosition(t *testing.T) {
+	policy := DefaultQueuePolicy("evt")
+	policy.Lanes = []Lane{
+		{Name: "fanclub", Weight: 3, Claim: "role", Values: []string{"fanclub"}},
+		{Name: "general", Weight: 1},
+	}
+
+	// Single lane: unchanged
+	assert.Equal(t, 7, policy.EffectivePosition("", 7, map[string]int64{"": 100}))
+
+	sizes := map[string]int64{"": 1000, "fanclub": 30}
+
+	// 3:1 - fanclub users are preceded by one general user per three fanclub users
+	assert.Equal(t, 1, policy.EffectivePosition("fanclub", 1, sizes))
+	assert.Equal(t, 5, policy.EffectivePosition("fanclub", 4, sizes))
+	assert.Equal(t, 13, policy.EffectivePosition("fanclub", 10, sizes))
+
+	// General users are preceded by three fanclub users per general user
+	assert.Equal(t, 1, policy.EffectivePosition("", 1, sizes))
+	assert.Equal(t, 5, policy.EffectivePosition("", 2, sizes))
+
+	// ... but never by more fanclub users than are waiting
+	assert.Equal(t, 50+30, policy.EffectivePosition("", 50, sizes))
+
+	// Empty lanes do not count
+	assert.Equal(t, 50, policy.EffectivePosition("", 50, map[string]int64{"": 1000, "fanclub": 0}))
+}
+
+func TestQueuePolicy_ValidateLanes(t *testing.T) {
+	require.NoError(t, lanePolicy().Validate())
+
+	cases := map[string]func(p *QueuePolicy){
+		"no default lane":   func(p *QueuePolicy) { p.Lanes = p.Lanes[:2] },
+		"two default lanes": func(p *QueuePolicy) { p.Lanes[0].Claim = "" },
+		"zero weight":       func(p *QueuePolicy) { p.Lanes[1].Weight = 0 },
+		"duplicate name":    func(p *QueuePolicy) { p.Lanes[1].Name = p.Lanes[0].Name },
+		"key characters":    func(p *QueuePolicy) { p.Lanes[0].Name = "a:b" },
+		"claim no values":   func(p *QueuePolicy) { p.Lanes[0].Values = nil },
+	}
+	for name, mutate := range cases {
+		policy := lanePolicy()
+		mutate(policy)
+		assert.Error(t, policy.Validate(), name)
+	}
+}
+
+func TestLobby_OpenWithLanes(t *testing.T) {
+	redisClient := testutil.NewRedisClient(t)
+
+	ctx := context.Background()
+	eventID := "test-lobby-lanes-evt"
+	cleanup := func() {
+		redisClient.Del(ctx,
+			LobbyKey(eventID), LaneLobbyKey(eventID, "fanclub"), LanesKey(eventID),
+			lobbyOpenedKey(eventID), lobbyLockKey(eventID),
+			EventQueueKey(eventID, ""), PositionIndexKey(eventID, ""),
+			EventQueueKey(eventID, "fanclub"), PositionIndexKey(eventID, "fanclub"),
+		)
+		redisClient.Del(ctx, lobbyJoinKeys(eventID, "g1", "g2", "g3", "f1", "f2")...)
+	}
+	cleanup()
+	defer cleanup()
+
+	executor := NewLuaExecutor(redisClient, logrus.New())
+	lobby := NewLobby(redisClient, logrus.New())
+	opensAt := time.Now().Add(1 * time.Hour)
+	policy := lanePolicy()
+	policy.EventID = eventID
+	policy.OpensAt = &opensAt
+
+	for _, token := range []string{"g1", "g2", "g3"} {
+		assert.Equal(t, "lobby", lobbyJoin(t, executor, lobby, policy, "", token))
+	}
+	for _, token := range []string{"f1", "f2"} {
+		assert.Equal(t, "lobby", lobbyJoin(t, executor, lobby, policy, "fanclub", token))
+	}
+
+	opened, err := lobby.Open(ctx, eventID, opensAt)
+	require.NoError(t, err)
+	assert.True(t, opened)
+
+	general, err := redisClient.ZCard(ctx, EventQueueKey(eventID, "")).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), general)
+
+	fanclub, err := redisClient.ZRange(ctx, PositionIndexKey(eventID, "fanclub"), 0, -1).Result()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"f1", "f2"}, fanclub, "Each lane opens into its own ZSETs")
+
+	sizes, err := LaneSizes(ctx, redisClient, eventID)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{"": 3, "fanclub": 2}, sizes)
+
+	exists, err := redisClient.Exists(ctx, lobbyOpenedKey(eventID)).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), exists)
+}
@@ -0,0 +1,84 @@
+package queue
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// lifecycleMaxLen approximately bounds an event's lifecycle stream. The exporter
+// keeps up within seconds; entries it has not read when trimmed are lost.
+const lifecycleMaxLen = 100000
+
+// eligibleMarkerTTL outlives the queue data, so a token is recorded eligible once
+const eligibleMarkerTTL = 30 * time.Minute
+
+// Lifecycle event types
+const (
+	LifecycleJoined                  = "joined"
+	LifecycleHeartbeatExpired        = "heartbeat_expired"
+	LifecycleEligible                = "eligible"
+	LifecycleEligibilityExpired      = "eligibility_expired" // Wave admission deadline missed
+	LifecycleEntered                 = "entered"
+	LifecycleLeft                    = "left"
+	LifecycleReservationTokenExpired = "reservation_token_expired"
+	LifecycleIdentityUpgraded        = "identity_upgraded" // An anonymous session logged in
+)
+
+// LifecycleKey returns the stream the queue scripts append an event's lifecycle
+// events to. The event hash tag lets them write it in the same script as the queue keys.
+func LifecycleKey(eventID string) string {
+	return fmt.Sprintf("queue:lifecycle:{%s}", eventID)
+}
+
+func eligibleMarkerKey(eventID, token string) string {
+	return fmt.Sprintf("queue:eligible:{%s}:%s", eventID, token)
+}
+
+// LifecycleEvent is one entry of an event's lifecycle stream
+type LifecycleEvent struct {
+	ID               string    `json:"id"` // Stream entry ID; unique per event, so exports can be deduplicated
+	EventID          string    `json:"event_id"`
+	Type             string    `json:"type"`
+	At               time.Time `json:"at"` // Redis server time of the transition
+	WaitingToken     string    `json:"waiting_token,omitempty"`
+	UserID           string    `json:"user_id,omitempty"`
+	Lane             string    `json:"lane,omitempty"`
+	Status           string    `json:"status,omitempty"`            // joined: waiting|lobby
+	ReservationToken string    `json:"reservation_token,omitempty"` // entered, reservation_token_expired
+	Reason           string    `json:"reason,omitempty"`            // left: "replaced" when a rejoin replaced the token
+	Deadline         int64     `json:"deadline,omitempty"`          // eligible by a wave: Enter deadline (Unix seconds)
+	PreviousUserID   string    `json:"previous_user_id,omitempty"`  // identity_upgraded: the anonymous identity
+}
+
+// parseLifecycleEvent converts a lifecycle stream entry
+func parseLifecycleEvent(eventID string, message redis.XMessage) LifecycleEvent {
+	field := func(name string) string {
+		value, _ := message.Values[name].(string)
+		return value
+	}
+
+	event := LifecycleEvent{
+		ID:               message.ID,
+		EventID:          eventID,
+		Type:             field("type"),
+		WaitingToken:     field("token"),
+		UserID:           field("user_id"),
+		Lane:             field("lane"),
+		Status:           field("status"),
+		ReservationToken: field("reservation_token"),
+		Reason:           field("reason"),
+		PreviousUserID:   field("previous_user_id"),
+	}
+	event.Deadline, _ = strconv.ParseInt(field("deadline"), 10, 64)
+
+	// Stream IDs start with the Redis server time in milliseconds
+	ms, _, _ := strings.Cut(message.ID, "-")
+	if millis, err := strconv.ParseInt(ms, 10, 64); err == nil {
+		event.At = time.UnixMilli(millis).UTC()
+	}
+	return event
+}
@@ -0,0 +1,335 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/metrics"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// LifecycleExportEventsKey is a SET of event IDs whose lifecycle streams the
+// exporter still reads. Active events are added every pass; an event is dropped
+// once it is no longer active and its stream has nothing left to export.
+const LifecycleExportEventsKey = "queue:lifecycle:export_events"
+
+const (
+	// lifecycleExportGroup is the consumer group the exporter reads with
+	lifecycleExportGroup = "lifecycle-exporter"
+
+	// lifecycleExportConsumer is shared by every leader: a new leader first
+	// rereads the entries its predecessor read but did not acknowledge
+	lifecycleExportConsumer = "exporter"
+
+	// lifecycleExportMaxBatches bounds the batches exported per event and pass,
+	// so one busy event does not hold back the others
+	lifecycleExportMaxBatches = 20
+)
+
+// LifecycleSink receives exported lifecycle events. Write returns nil only once
+// the events are stored; otherwise they are delivered again on the next pass,
+// so sinks must tolerate duplicates (LifecycleEvent.ID identifies an entry).
+type LifecycleSink interface {
+	Write(ctx context.Context, events []LifecycleEvent) error
+}
+
+// FileSink appends lifecycle events as NDJSON to one file per UTC day
+type FileSink struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileSink creates a file sink writing to dir, creating it if needed
+func NewFileSink(dir string) (*FileSink, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create export directory: %w", err)
+	}
+	return &FileSink{dir: dir}, nil
+}
+
+// Write appends events to lifecycle-YYYY-MM-DD.ndjson and syncs the file
+func (s *FileSink) Write(ctx context.Context, events []LifecycleEvent) error {
+	body, err := encodeNDJSON(events)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := filepath.Join(s.dir, "lifecycle-"+time.Now().UTC().Format("2006-01-02")+".ndjson")
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	if _, err := file.Write(body); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to sync %s: %w", path, err)
+	}
+	return file.Close()
+}
+
+// HTTPSink posts lifecycle events as an NDJSON body to a URL
+type HTTPSink struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// NewHTTPSink creates an HTTP sink. token, when set, is sent as a bearer token.
+func NewHTTPSink(url, token string, timeout time.Duration) *HTTPSink {
+	return &HTTPSink{
+		url:    url,
+		token:  token,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Write posts events in one request; any status other than 2xx is a failure
+func (s *HTTPSink) Write(ctx context.Context, events []LifecycleEvent) error {
+	body, err := encodeNDJSON(events)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create export request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("export request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("export sink returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func encodeNDJSON(events []LifecycleEvent) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return nil, fmt.Errorf("failed to encode lifecycle event: %w", err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// LifecycleExporterConfig controls how often and how much the exporter reads
+type LifecycleExporterConfig struct {
+	Interval  time.Duration // Time between passes
+	BatchSize int64         // Stream entries per read and sink write
+}
+
+// DefaultLifecycleExporterConfig returns the exporter settings used when none are configured
+func DefaultLifecycleExporterConfig() LifecycleExporterConfig {
+	return LifecycleExporterConfig{
+		Interval:  1 * time.Second,
+		BatchSize: 500,
+	}
+}
+
+// LifecycleExporter reads every event's lifecycle stream with a consumer group
+// and hands the entries to a sink. Entries are acknowledged only after the sink
+// stored them, so delivery is at least once. It runs as a leader worker.
+type LifecycleExporter struct {
+	redisClient redis.UniversalClient
+	sink        LifecycleSink
+	config      LifecycleExporterConfig
+	logger      *logrus.Logger
+
+	groups map[string]bool // Streams whose consumer group exists (Run goroutine only)
+}
+
+// NewLifecycleExporter creates a new lifecycle exporter
+func NewLifecycleExporter(redisClient redis.UniversalClient, sink LifecycleSink, config LifecycleExporterConfig, logger *logrus.Logger) *LifecycleExporter {
+	defaults := DefaultLifecycleExporterConfig()
+	if config.Interval <= 0 {
+		config.Interval = defaults.Interval
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaults.BatchSize
+	}
+
+	return &LifecycleExporter{
+		redisClient: redisClient,
+		sink:        sink,
+		config:      config,
+		logger:      logger,
+		groups:      make(map[string]bool),
+	}
+}
+
+// Run exports every interval until ctx is cancelled
+func (e *LifecycleExporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := e.Export(ctx); err != nil && ctx.Err() == nil {
+			e.logger.WithError(err).Error("Lifecycle export failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Export runs one pass over every event with lifecycle events to export and
+// returns the number of events written to the sink
+func (e *LifecycleExporter) Export(ctx context.Context) (int, error) {
+	active, err := e.redisClient.ZRange(ctx, ActiveEventsKey, 0, -1).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list active events: %w", err)
+	}
+	if len(active) > 0 {
+		members := make([]interface{}, len(active))
+		for i, eventID := range active {
+			members[i] = eventID
+		}
+		if err := e.redisClient.SAdd(ctx, LifecycleExportEventsKey, members...).Err(); err != nil {
+			return 0, fmt.Errorf("failed to register export events: %w", err)
+		}
+	}
+	isActive := make(map[string]bool, len(active))
+	for _, eventID := range active {
+		isActive[eventID] = true
+	}
+
+	eventIDs, err := e.redisClient.SMembers(ctx, LifecycleExportEventsKey).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list export events: %w", err)
+	}
+
+	total := 0
+	for _, eventID := range eventIDs {
+		if ctx.Err() != nil {
+			return total, ctx.Err()
+		}
+
+		exported, err := e.ExportEvent(ctx, eventID)
+		total += exported
+		if err != nil {
+			e.logger.WithError(err).WithField("event_id", eventID).Warn("Failed to export lifecycle events")
+			continue
+		}
+
+		if exported == 0 && !isActive[eventID] {
+			if err := e.redisClient.SRem(ctx, LifecycleExportEventsKey, eventID).Err(); err != nil {
+				e.logger.WithError(err).WithField("event_id", eventID).Warn("Failed to drop exported event")
+			}
+			delete(e.groups, eventID)
+		}
+	}
+
+	return total, nil
+}
+
+// ExportEvent writes an event's unacknowledged lifecycle entries to the sink:
+// first entries read earlier but not acknowledged, then new ones. Returns the
+// number of events written.
+func (e *LifecycleExporter) ExportEvent(ctx context.Context, eventID string) (int, error) {
+	key := LifecycleKey(eventID)
+	if !e.groups[eventID] {
+		err := e.redisClient.XGroupCreateMkStream(ctx, key, lifecycleExportGroup, "0").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return 0, fmt.Errorf("failed to create consumer group: %w", err)
+		}
+		e.groups[eventID] = true
+	}
+
+	exported := 0
+	for i := 0; i < lifecycleExportMaxBatches; i++ {
+		messages, err := e.read(ctx, eventID, "0")
+		if err != nil {
+			return exported, err
+		}
+		if len(messages) == 0 {
+			if messages, err = e.read(ctx, eventID, ">"); err != nil {
+				return exported, err
+			}
+		}
+		if len(messages) == 0 {
+			return exported, nil
+		}
+
+		ids := make([]string, 0, len(messages))
+		events := make([]LifecycleEvent, 0, len(messages))
+		for _, message := range messages {
+			ids = append(ids, message.ID)
+			// Entries trimmed after they were read come back without fields
+			if len(message.Values) > 0 {
+				events = append(events, parseLifecycleEvent(eventID, message))
+			}
+		}
+
+		if len(events) > 0 {
+			if err := e.sink.Write(ctx, events); err != nil {
+				metrics.RecordLifecycleExport("failure", len(events))
+				return exported, fmt.Errorf("sink write failed: %w", err)
+			}
+			metrics.RecordLifecycleExport("success", len(events))
+		}
+
+		if err := e.redisClient.XAck(ctx, key, lifecycleExportGroup, ids...).Err(); err != nil {
+			return exported, fmt.Errorf("failed to acknowledge lifecycle events: %w", err)
+		}
+		exported += len(events)
+	}
+
+	return exported, nil
+}
+
+// read returns up to a batch of an event's entries for the exporter's consumer:
+// id "0" for entries delivered but not acknowledged, ">" for new entries
+func (e *LifecycleExporter) read(ctx context.Context, eventID, id string) ([]redis.XMessage, error) {
+	streams, err := e.redisClient.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    lifecycleExportGroup,
+		Consumer: lifecycleExportConsumer,
+		Streams:  []string{LifecycleKey(eventID), id},
+		Count:    e.config.BatchSize,
+		Block:    -1, // Never block: the exporter polls many streams
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		// The group is gone when the stream expired or was deleted; recreate it next pass
+		if strings.HasPrefix(err.Error(), "NOGROUP") {
+			delete(e.groups, eventID)
+		}
+		return nil, fmt.Errorf("failed to read lifecycle stream: %w", err)
+	}
+	if len(streams) == 0 {
+		return nil, nil
+	}
+	return streams[0].Messages, nil
+}
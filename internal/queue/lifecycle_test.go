@@ -0,0 +1,187 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/testutil"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func lifecycleTypes(t *testing.T, redisClient redis.UniversalClient, eventID string) []string {
+	messages, err := redisClient.XRange(context.Background(), LifecycleKey(eventID), "-", "+").Result()
+	require.NoError(t, err)
+
+	types := make([]string, 0, len(messages))
+	for _, message := range messages {
+		types = append(types, parseLifecycleEvent(eventID, message).Type)
+	}
+	return types
+}
+
+func TestLifecycle_QueueTransitions(t *testing.T) {
+	redisClient := testutil.NewRedisClient(t)
+
+	executor := NewLuaExecutor(redisClient, logrus.New())
+	janitor := NewJanitor(redisClient, DefaultJanitorConfig(), logrus.New())
+	ctx := context.Background()
+	eventID := "test-lifecycle-evt"
+	tokens := []string{"wt-1", "wt-2", "wt-3"}
+
+	cleanup := func() {
+		keys := []string{
+			EventQueueKey(eventID, ""), PositionIndexKey(eventID, ""), LanesKey(eventID),
+			GrantsKey(eventID), LifecycleKey(eventID), ReservationTokenKey(eventID, "rt-1"),
+		}
+		for _, token := range tokens {
+			keys = append(keys, WaitingDataKey(eventID, token), HeartbeatKey(eventID, token),
+				UserStreamKey(eventID, "user-"+token), "dedupe:{"+eventID+"}:"+token,
+				eligibleMarkerKey(eventID, token))
+		}
+		redisClient.Del(ctx, keys...)
+	}
+	cleanup()
+	defer cleanup()
+
+	for _, token := range tokens {
+		_, err := executor.JoinQueue(ctx, &QueueJoin{
+			EventID:      eventID,
+			UserID:       "user-" + token,
+			Token:        token,
+			DedupeKey:    "dedupe:{" + eventID + "}:" + token,
+			Data:         []byte(`{"event_id":"` + eventID + `","user_id":"user-` + token + `","status":"waiting"}`),
+			DataTTL:      time.Minute,
+			HeartbeatTTL: time.Minute,
+			DedupeTTL:    time.Second,
+		})
+		require.NoError(t, err)
+	}
+
+	// Eligibility is recorded once however often Status reports it
+	require.NoError(t, executor.RecordEligible(ctx, eventID, "", "user-wt-1", "wt-1"))
+	require.NoError(t, executor.RecordEligible(ctx, eventID, "", "user-wt-1", "wt-1"))
+
+	entered, err := executor.EnterQueue(ctx, eventID, "", "wt-1", "rt-1", []byte(`{}`), 30*time.Second, 1.0)
+	require.NoError(t, err)
+	require.True(t, entered.Success)
+
+	_, err = executor.LeaveQueue(ctx, eventID, "", "user-wt-2", "wt-2", LifecycleLeft)
+	require.NoError(t, err)
+
+	// wt-3 abandons the queue: the janitor records the expiry, the later
+	// Status cleanup does not record it again
+	require.NoError(t, redisClient.Del(ctx, HeartbeatKey(eventID, "wt-3")).Err())
+	result, err := janitor.SweepEvent(ctx, eventID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Waiting)
+	_, err = executor.LeaveQueue(ctx, eventID, "", "user-wt-3", "wt-3", LifecycleHeartbeatExpired)
+	require.NoError(t, err)
+
+	// The unused reservation token expires
+	require.NoError(t, redisClient.ZAdd(ctx, GrantsKey(eventID), redis.Z{Score: float64(time.Now().Add(-time.Second).Unix()), Member: "rt-1"}).Err())
+	result, err = janitor.SweepEvent(ctx, eventID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Grants)
+
+	assert.Equal(t, []string{
+		LifecycleJoined, LifecycleJoined, LifecycleJoined,
+		LifecycleEligible,
+		LifecycleEntered,
+		LifecycleLeft,
+		LifecycleHeartbeatExpired,
+		LifecycleReservationTokenExpired,
+	}, lifecycleTypes(t, redisClient, eventID))
+
+	messages, err := redisClient.XRange(ctx, LifecycleKey(eventID), "-", "+").Result()
+	require.NoError(t, err)
+	enteredEvent := parseLifecycleEvent(eventID, messages[4])
+	assert.Equal(t, "wt-1", enteredEvent.WaitingToken)
+	assert.Equal(t, "user-wt-1", enteredEvent.UserID)
+	assert.Equal(t, "rt-1", enteredEvent.ReservationToken)
+	assert.WithinDuration(t, time.Now(), enteredEvent.At, time.Minute)
+
+	expiredEvent := parseLifecycleEvent(eventID, messages[6])
+	assert.Equal(t, "wt-3", expiredEvent.WaitingToken)
+	assert.Equal(t, "user-wt-3", expiredEvent.UserID)
+}
+
+// recordingSink stores exported events and fails while failing is set
+type recordingSink struct {
+	events  []LifecycleEvent
+	failing bool
+}
+
+func (s *recordingSink) Write(ctx context.Context, events []LifecycleEvent) error {
+	if s.failing {
+		return errors.New("sink unavailable")
+	}
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func TestLifecycleExporter_AtLeastOnce(t *testing.T) {
+	redisClient := testutil.NewRedisClient(t)
+
+	ctx := context.Background()
+	eventID := "test-lifecycle-export-evt"
+	cleanup := func() {
+		redisClient.Del(ctx, LifecycleKey(eventID))
+		redisClient.SRem(ctx, LifecycleExportEventsKey, eventID)
+		redisClient.ZRem(ctx, ActiveEventsKey, eventID)
+	}
+	cleanup()
+	defer cleanup()
+
+	record := func(event, token string) {
+		require.NoError(t, redisClient.XAdd(ctx, &redis.XAddArgs{
+			Stream: LifecycleKey(eventID),
+			Values: map[string]interface{}{"type": event, "token": token},
+		}).Err())
+	}
+	record(LifecycleJoined, "wt-1")
+	record(LifecycleJoined, "wt-2")
+	require.NoError(t, redisClient.ZAdd(ctx, ActiveEventsKey, redis.Z{Score: float64(time.Now().Unix()), Member: eventID}).Err())
+
+	sink := &recordingSink{failing: true}
+	exporter := NewLifecycleExporter(redisClient, sink, LifecycleExporterConfig{BatchSize: 10}, logrus.New())
+
+	// Sink down: the entries were read but stay pending
+	_, err := exporter.ExportEvent(ctx, eventID)
+	require.Error(t, err)
+	assert.Empty(t, sink.events)
+
+	// A new exporter (next leader) delivers the pending entries, then new ones
+	record(LifecycleEntered, "wt-1")
+	sink.failing = false
+	exporter = NewLifecycleExporter(redisClient, sink, LifecycleExporterConfig{BatchSize: 10}, logrus.New())
+	exported, err := exporter.Export(ctx)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, exported, 3)
+
+	var types []string
+	for _, event := range sink.events {
+		if event.EventID == eventID {
+			types = append(types, event.Type+":"+event.WaitingToken)
+		}
+	}
+	assert.Equal(t, []string{"joined:wt-1", "joined:wt-2", "entered:wt-1"}, types)
+
+	// Everything was acknowledged: nothing is exported twice
+	exported, err = exporter.ExportEvent(ctx, eventID)
+	require.NoError(t, err)
+	assert.Equal(t, 0, exported)
+
+	// Once the event is inactive and drained it leaves the export set
+	require.NoError(t, redisClient.ZRem(ctx, ActiveEventsKey, eventID).Err())
+	_, err = exporter.Export(ctx)
+	require.NoError(t, err)
+	isMember, err := redisClient.SIsMember(ctx, LifecycleExportEventsKey, eventID).Result()
+	require.NoError(t, err)
+	assert.False(t, isMember)
+}
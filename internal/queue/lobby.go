@@ -0,0 +1,326 @@
+package queue
+
+import (
+	"context"
+	crand "crypto/rand"
+	_ "embed"
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+//go:embed lua/lobby_open.lua
+var lobbyOpenScript string
+
+const (
+	// lobbyOpenLockTTL bounds how long one instance may spend shuffling a lobby
+	lobbyOpenLockTTL = 30 * time.Second
+
+	// lobbyOpenedTTL keeps the opened flag around long after the sale started
+	lobbyOpenedTTL = 7 * 24 * time.Hour
+
+	// lobbyGracePeriod keeps lobby keys alive for a while after opens_at in case the open is late
+	lobbyGracePeriod = 1 * time.Hour
+)
+
+// LobbyEventsKey is a ZSET of event IDs with a lobby, scored by opens_at (Unix
+// seconds). Lobby joins add to it so the opener finds due lobbies without SCAN.
+const LobbyEventsKey = "queue:lobby_events"
+
+// Lobby holds users who joined before an event's opens_at and shuffles them
+// into the queue at opening, so arriving first no longer decides the order
+type Lobby struct {
+	redisClient redis.UniversalClient
+	openScript  *redis.Script
+	logger      *logrus.Logger
+
+	// Events observed as opened; an event never closes its lobby again
+	opened sync.Map
+}
+
+// NewLobby creates a new pre-sale lobby
+func NewLobby(redisClient redis.UniversalClient, logger *logrus.Logger) *Lobby {
+	return &Lobby{
+		redisClient: redisClient,
+		openScript:  redis.NewScript(lobbyOpenScript),
+		logger:      logger,
+	}
+}
+
+// LobbyKey returns the SET holding lobby tokens for an event's default lane
+func LobbyKey(eventID string) string {
+	return fmt.Sprintf("queue:lobby:{%s}", eventID)
+}
+
+// LaneLobbyKey returns the SET holding lobby tokens for a lane ("" = default lane)
+func LaneLobbyKey(eventID, lane string) string {
+	if lane == "" {
+		return LobbyKey(eventID)
+	}
+	return fmt.Sprintf("queue:lobby:{%s}:lane:%s", eventID, lane)
+}
+
+func lobbyOpenedKey(eventID string) string {
+	return fmt.Sprintf("queue:opened:{%s}", eventID)
+}
+
+func lobbyLockKey(eventID string) string {
+	return fmt.Sprintf("queue:opening:{%s}", eventID)
+}
+
+// Pending reports whether joins should go to the lobby: opens_at is still ahead and
+// this instance has not seen the event open. queue_join.lua re-checks the opened flag.
+func (l *Lobby) Pending(policy *QueuePolicy) bool {
+	if policy.OpensAt == nil || !time.Now().Before(*policy.OpensAt) {
+		return false
+	}
+	_, opened := l.opened.Load(policy.EventID)
+	return !opened
+}
+
+// TTL returns how long lobby keys are kept: until opens_at plus a grace period
+func (l *Lobby) TTL(policy *QueuePolicy) time.Duration {
+	if policy.OpensAt == nil {
+		return lobbyGracePeriod
+	}
+	return time.Until(*policy.OpensAt) + lobbyGracePeriod
+}
+
+// OpensIn returns the time left until opening, or zero when the event is open
+func (l *Lobby) OpensIn(policy *QueuePolicy) time.Duration {
+	if policy.OpensAt == nil {
+		return 0
+	}
+	if d := time.Until(*policy.OpensAt); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// EnsureOpen reports whether the event is open, opening the lobby first when
+// opens_at has passed and the LobbyOpener has not opened it yet. Returns false
+// while the lobby is still being opened by another instance.
+func (l *Lobby) EnsureOpen(ctx context.Context, policy *QueuePolicy) (bool, error) {
+	if policy.OpensAt == nil {
+		return true, nil
+	}
+	if _, ok := l.opened.Load(policy.EventID); ok {
+		return true, nil
+	}
+	if time.Now().Before(*policy.OpensAt) {
+		return false, nil
+	}
+
+	exists, err := l.redisClient.Exists(ctx, lobbyOpenedKey(policy.EventID)).Result()
+	if err != nil {
+		return false, err
+	}
+	if exists == 1 {
+		l.opened.Store(policy.EventID, true)
+		return true, nil
+	}
+
+	return l.Open(ctx, policy.EventID, *policy.OpensAt)
+}
+
+// Open shuffles every lane's lobby into its queue:event and position_index.
+// Only one instance shuffles at a time; the Lua script guarantees it happens once.
+// Returns false if another instance currently holds the opening lock.
+func (l *Lobby) Open(ctx context.Context, eventID string, opensAt time.Time) (bool, error) {
+	locked, err := l.redisClient.SetNX(ctx, lobbyLockKey(eventID), "1", lobbyOpenLockTTL).Result()
+	if err != nil {
+		return false, err
+	}
+	if !locked {
+		return false, nil
+	}
+	defer l.redisClient.Del(ctx, lobbyLockKey(eventID))
+
+	start := time.Now()
+	lanes, err := KnownLanes(ctx, l.redisClient, eventID)
+	if err != nil {
+		return false, err
+	}
+
+	// Each lane is shuffled on its own; the last lane sets the opened flag
+	lobbySize := 0
+	queued := int64(0)
+	for i, lane := range lanes {
+		tokens, err := l.redisClient.SMembers(ctx, LaneLobbyKey(eventID, lane)).Result()
+		if err != nil {
+			return false, err
+		}
+		lobbySize += len(tokens)
+
+		shuffleTokens(tokens)
+
+		setFlag := "0"
+		if i == len(lanes)-1 {
+			setFlag = "1"
+		}
+
+		args := make([]interface{}, 0, len(tokens)+3)
+		args = append(args, opensAt.Unix(), int(lobbyOpenedTTL.Seconds()), setFlag)
+		for _, token := range tokens {
+			args = append(args, token)
+		}
+
+		result, err := l.openScript.Run(ctx, l.redisClient,
+			[]string{
+				LaneLobbyKey(eventID, lane),
+				EventQueueKey(eventID, lane),
+				PositionIndexKey(eventID, lane),
+				lobbyOpenedKey(eventID),
+			},
+			args...,
+		).Slice()
+		if err != nil {
+			return false, fmt.Errorf("lobby open failed: %w", err)
+		}
+
+		status, _ := result[0].(int64)
+		if status != 1 {
+			// Another instance already opened the event
+			l.opened.Store(eventID, true)
+			return true, nil
+		}
+		count, _ := result[1].(int64)
+		queued += count
+	}
+
+	l.opened.Store(eventID, true)
+
+	l.logger.WithFields(logrus.Fields{
+		"event_id":    eventID,
+		"lanes":       len(lanes),
+		"lobby_size":  lobbySize,
+		"queued":      queued,
+		"duration_ms": time.Since(start).Milliseconds(),
+	}).Info("Lobby opened - shuffled into queue")
+
+	return true, nil
+}
+
+// LobbyOpener opens lobbies as soon as their opens_at passes, so the shuffle
+// does not wait for the first Join or Status request after opening. It runs as
+// a leader worker; EnsureOpen remains the fallback of the request handlers.
+type LobbyOpener struct {
+	redisClient redis.UniversalClient
+	lobby       *Lobby
+	policies    *PolicyStore
+	interval    time.Duration
+	logger      *logrus.Logger
+}
+
+// NewLobbyOpener creates a new lobby opener
+func NewLobbyOpener(redisClient redis.UniversalClient, policies *PolicyStore, interval time.Duration, logger *logrus.Logger) *LobbyOpener {
+	if interval <= 0 {
+		interval = 1 * time.Second
+	}
+	return &LobbyOpener{
+		redisClient: redisClient,
+		lobby:       NewLobby(redisClient, logger),
+		policies:    policies,
+		interval:    interval,
+		logger:      logger,
+	}
+}
+
+// Run opens due lobbies every interval until ctx is cancelled
+func (o *LobbyOpener) Run(ctx context.Context) {
+	ticker := time.NewTicker(o.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := o.OpenDue(ctx); err != nil && ctx.Err() == nil {
+			o.logger.WithError(err).Error("Opening due lobbies failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// OpenDue opens every lobby whose opens_at has passed and returns how many it
+// opened (or found opened by a request handler). A lobby whose opening is
+// locked by another instance is retried on the next pass.
+func (o *LobbyOpener) OpenDue(ctx context.Context) (int, error) {
+	now := time.Now()
+	eventIDs, err := o.redisClient.ZRangeByScore(ctx, LobbyEventsKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.Unix(), 10),
+	}).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list lobby events: %w", err)
+	}
+
+	opened := 0
+	for _, eventID := range eventIDs {
+		if ctx.Err() != nil {
+			return opened, ctx.Err()
+		}
+
+		ok, err := o.openEvent(ctx, eventID, now)
+		if err != nil {
+			o.logger.WithError(err).WithField("event_id", eventID).Warn("Failed to open lobby")
+			continue
+		}
+		if ok {
+			opened++
+		}
+	}
+
+	return opened, nil
+}
+
+// openEvent opens one due lobby, rescheduling it when an operator moved
+// opens_at later
+func (o *LobbyOpener) openEvent(ctx context.Context, eventID string, now time.Time) (bool, error) {
+	policy, err := o.policies.Get(ctx, eventID)
+	if err != nil {
+		return false, err
+	}
+
+	var opened bool
+	switch {
+	case policy.OpensAt == nil:
+		// Schedule was removed while users were waiting: open right away
+		opened, err = o.lobby.Open(ctx, eventID, now)
+	case now.Before(*policy.OpensAt):
+		return false, o.redisClient.ZAdd(ctx, LobbyEventsKey, redis.Z{
+			Score:  float64(policy.OpensAt.Unix()),
+			Member: eventID,
+		}).Err()
+	default:
+		opened, err = o.lobby.EnsureOpen(ctx, policy)
+	}
+	if err != nil || !opened {
+		return false, err
+	}
+
+	return true, o.redisClient.ZRem(ctx, LobbyEventsKey, eventID).Err()
+}
+
+// shuffleTokens randomizes the order with a generator seeded from crypto/rand,
+// so the resulting order cannot be predicted from join timing
+func shuffleTokens(tokens []string) {
+	var seed [32]byte
+	if _, err := crand.Read(seed[:]); err != nil {
+		// crypto/rand never fails on supported platforms; fall back to the time
+		binary.LittleEndian.PutUint64(seed[:], uint64(time.Now().UnixNano()))
+	}
+
+	rng := rand.New(rand.NewChaCha8(seed))
+	rng.Shuffle(len(tokens), func(i, j int) {
+		tokens[i], tokens[j] = tokens[j], tokens[i]
+	})
+}
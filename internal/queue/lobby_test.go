@@ -0,0 +1,204 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/testutil"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lobbyJoin joins token the way the join handler does: into the lobby while
+// it is pending. Returns the join status.
+func lobbyJoin(t *testing.T, executor *LuaExecutor, lobby *Lobby, policy *QueuePolicy, lane, token string) string {
+	t.Helper()
+	result, err := executor.JoinQueue(context.Background(), &QueueJoin{
+		EventID:      policy.EventID,
+		UserID:       "user-" + token,
+		Lane:         lane,
+		Token:        token,
+		DedupeKey:    "dedupe:{" + policy.EventID + "}:" + token,
+		Data:         []byte(`{"event_id":"` + policy.EventID + `","user_id":"user-` + token + `","status":"waiting"}`),
+		DataTTL:      30 * time.Minute,
+		HeartbeatTTL: 5 * time.Minute,
+		DedupeTTL:    5 * time.Minute,
+		Lobby:        lobby.Pending(policy),
+		LobbyTTL:     lobby.TTL(policy),
+		LobbyDataTTL: time.Hour,
+	})
+	require.NoError(t, err)
+	require.Empty(t, result.Error)
+	return result.Status
+}
+
+// lobbyJoinKeys returns the keys lobbyJoin writes for tokens
+func lobbyJoinKeys(eventID string, tokens ...string) []string {
+	keys := []string{LifecycleKey(eventID), WaveReadyKey(eventID)}
+	for _, token := range tokens {
+		keys = append(keys,
+			WaitingDataKey(eventID, token), HeartbeatKey(eventID, token), "dedupe:{"+eventID+"}:"+token,
+			UserStreamKey(eventID, "user-"+token), UserSlotKey(eventID, "user-"+token),
+		)
+	}
+	return keys
+}
+
+func TestLobby_JoinAndOpen(t *testing.T) {
+	redisClient := testutil.NewRedisClient(t)
+
+	ctx := context.Background()
+	eventID := "test-lobby-evt"
+	eventQueueKey := fmt.Sprintf("queue:event:{%s}", eventID)
+	positionIndexKey := fmt.Sprintf("position_index:{%s}", eventID)
+
+	tokens := make([]string, 50)
+	for i := range tokens {
+		tokens[i] = fmt.Sprintf("lobby-token-%02d", i)
+	}
+
+	cleanup := func() {
+		redisClient.Del(ctx, LobbyKey(eventID), lobbyOpenedKey(eventID), lobbyLockKey(eventID), eventQueueKey, positionIndexKey)
+		redisClient.Del(ctx, lobbyJoinKeys(eventID, append(tokens, "late-token", "racing-token")...)...)
+	}
+	cleanup()
+	defer cleanup()
+
+	executor := NewLuaExecutor(redisClient, logrus.New())
+	lobby := NewLobby(redisClient, logrus.New())
+
+	opensAt := time.Now().Add(1 * time.Hour)
+	policy := DefaultQueuePolicy(eventID)
+	policy.OpensAt = &opensAt
+
+	// Before opens_at: joins go to the lobby
+	for _, token := range tokens {
+		assert.Equal(t, "lobby", lobbyJoin(t, executor, lobby, policy, "", token))
+	}
+	left, err := executor.LeaveQueue(ctx, eventID, "", "user-"+tokens[0], tokens[0], LifecycleLeft)
+	require.NoError(t, err)
+	require.True(t, left.Success)
+
+	opened, err := lobby.EnsureOpen(ctx, policy)
+	require.NoError(t, err)
+	assert.False(t, opened, "Lobby must stay closed before opens_at")
+	assert.Greater(t, lobby.OpensIn(policy), 59*time.Minute)
+
+	// Opening shuffles the remaining lobby into both ZSETs
+	opened, err = lobby.Open(ctx, eventID, opensAt)
+	require.NoError(t, err)
+	assert.True(t, opened)
+
+	members, err := redisClient.ZRangeWithScores(ctx, eventQueueKey, 0, -1).Result()
+	require.NoError(t, err)
+	require.Len(t, members, len(tokens)-1, "Tokens that left the lobby are not queued")
+
+	inOrder := true
+	for i, m := range members {
+		assert.Less(t, m.Score, float64(opensAt.Unix()), "Lobby tokens rank ahead of late joiners")
+		if m.Member != tokens[i+1] {
+			inOrder = false
+		}
+	}
+	assert.False(t, inOrder, "Lobby order should be shuffled")
+
+	indexCount, err := redisClient.ZCard(ctx, positionIndexKey).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(tokens)-1), indexCount)
+
+	exists, err := redisClient.Exists(ctx, LobbyKey(eventID)).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), exists, "Lobby is emptied at opening")
+
+	// After opening: joins are queued normally, also from an instance that has
+	// not seen the event open yet, and a second open is a no-op
+	assert.Equal(t, "waiting", lobbyJoin(t, executor, lobby, policy, "", "late-token"))
+
+	otherInstance := NewLobby(redisClient, logrus.New())
+	require.True(t, otherInstance.Pending(policy))
+	assert.Equal(t, "waiting", lobbyJoin(t, executor, otherInstance, policy, "", "racing-token"))
+
+	opened, err = lobby.Open(ctx, eventID, opensAt)
+	require.NoError(t, err)
+	assert.True(t, opened)
+	count, err := redisClient.ZCard(ctx, eventQueueKey).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(tokens)+1), count)
+
+	isMember, err := redisClient.SIsMember(ctx, LobbyKey(eventID), "racing-token").Result()
+	require.NoError(t, err)
+	assert.False(t, isMember)
+}
+
+func TestLobbyOpener_OpenDue(t *testing.T) {
+	redisClient := testutil.NewRedisClient(t)
+	ctx := context.Background()
+	logger := logrus.New()
+
+	dueEvent := "test-lobby-opener-due-evt"
+	movedEvent := "test-lobby-opener-moved-evt"
+	tokens := []string{"opener-token-1", "opener-token-2", "opener-token-3"}
+
+	cleanup := func() {
+		for _, eventID := range []string{dueEvent, movedEvent} {
+			redisClient.Del(ctx, LobbyKey(eventID), lobbyOpenedKey(eventID), lobbyLockKey(eventID), policyKey(eventID),
+				EventQueueKey(eventID, ""), PositionIndexKey(eventID, ""))
+			redisClient.Del(ctx, lobbyJoinKeys(eventID, tokens...)...)
+			redisClient.ZRem(ctx, LobbyEventsKey, eventID)
+		}
+	}
+	cleanup()
+	defer cleanup()
+
+	executor := NewLuaExecutor(redisClient, logger)
+	lobby := NewLobby(redisClient, logger)
+	policies := NewPolicyStore(redisClient, logger)
+
+	// Users wait in the lobby while opens_at is ahead
+	opensAt := time.Now().Add(time.Hour)
+	for _, eventID := range []string{dueEvent, movedEvent} {
+		policy := DefaultQueuePolicy(eventID)
+		policy.OpensAt = &opensAt
+		for _, token := range tokens {
+			require.Equal(t, "lobby", lobbyJoin(t, executor, lobby, policy, "", token))
+		}
+	}
+
+	// One event's opens_at has passed; the other's registration is due but an
+	// operator moved opens_at later
+	passed := time.Now().Add(-time.Second)
+	duePolicy := DefaultQueuePolicy(dueEvent)
+	duePolicy.OpensAt = &passed
+	require.NoError(t, policies.Set(ctx, duePolicy))
+	movedPolicy := DefaultQueuePolicy(movedEvent)
+	movedPolicy.OpensAt = &opensAt
+	require.NoError(t, policies.Set(ctx, movedPolicy))
+	require.NoError(t, redisClient.ZAdd(ctx, LobbyEventsKey,
+		redis.Z{Score: float64(passed.Unix()), Member: dueEvent},
+		redis.Z{Score: float64(passed.Unix()), Member: movedEvent},
+	).Err())
+
+	opener := NewLobbyOpener(redisClient, policies, time.Second, logger)
+	_, err := opener.OpenDue(ctx)
+	require.NoError(t, err)
+
+	// The due lobby is shuffled into the queue without any request
+	queued, err := redisClient.ZCard(ctx, EventQueueKey(dueEvent, "")).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(tokens)), queued)
+	_, err = redisClient.ZScore(ctx, LobbyEventsKey, dueEvent).Result()
+	assert.Equal(t, redis.Nil, err, "Opened lobbies are unregistered")
+
+	// The moved one stays closed and is rescheduled for its new opens_at
+	queued, err = redisClient.ZCard(ctx, EventQueueKey(movedEvent, "")).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), queued)
+	score, err := redisClient.ZScore(ctx, LobbyEventsKey, movedEvent).Result()
+	require.NoError(t, err)
+	assert.Equal(t, float64(opensAt.Unix()), score)
+}
@@ -0,0 +1,79 @@
+-- consume_reservation_token.lua
+-- Atomically validate and consume a reservation token granted by Enter, and
+-- turn the caller's holds on the reserved seats into RESERVED seats
+--
+-- KEYS[1]: reservation token key (e.g., "queue:reservation:{eventID}:abc123")
+-- KEYS[2]: seat status hash (e.g., "seat:status:{eventID}")
+-- KEYS[3]: hold owners hash, seat -> user (e.g., "hold:owner:{eventID}")
+-- KEYS[4]: hold expiry ZSET, seat -> expiry (e.g., "hold:expiry:{eventID}")
+-- KEYS[5]: seat change stream (e.g., "seat:changes:{eventID}")
+-- KEYS[6]: outstanding grants ZSET (e.g., "queue:grants:{eventID}")
+--
+-- ARGV[1]: event_id the reservation is for
+-- ARGV[2]: authenticated user_id
+-- ARGV[3]: attempt ID of the caller, recorded as used_by
+-- ARGV[4]: reservation token (the grant member)
+-- ARGV[5]: hold key prefix (e.g., "hold:seat:{eventID}:")
+-- ARGV[6]: user holds key prefix (e.g., "hold:user:{eventID}:")
+-- ARGV[7]: approximate maximum length of the seat change stream
+-- ARGV[8..]: seat IDs of the reservation
+--
+-- The token keeps its TTL and is marked used by the attempt, so that attempt
+-- can hand it back with RestoreReservationToken if the backend call fails.
+-- Reserved seats leave the hold bookkeeping, so the sweeper never releases
+-- them, and keep the inventory their hold took. The grant is released with
+-- them: those seats are already counted by the inventory. The seats and their
+-- hold expiry are recorded on the token for the restore.
+--
+-- Returns:
+--   {1, reserved_seat_count} on success
+--   {0, "NOT_FOUND"} token missing or expired
+--   {0, "EVENT_MISMATCH"} token was granted for another event
+--   {0, "USER_MISMATCH"} token was granted to another user
+--   {0, "ALREADY_USED"} token was already consumed
+
+local raw = redis.call('GET', KEYS[1])
+if not raw then
+    return {0, 'NOT_FOUND'}
+end
+
+local data = cjson.decode(raw)
+
+if data['event_id'] ~= ARGV[1] then
+    return {0, 'EVENT_MISMATCH'}
+end
+
+if data['user_id'] ~= ARGV[2] then
+    return {0, 'USER_MISMATCH'}
+end
+
+if data['used'] then
+    return {0, 'ALREADY_USED'}
+end
+
+-- Reserve the seats the caller still holds; others are left to the backend
+local reserved = {}
+for i = 8, #ARGV do
+    local seat = ARGV[i]
+    local holdKey = ARGV[5] .. seat
+    if redis.call('HGET', KEYS[2], seat) == 'HOLD' and redis.call('GET', holdKey) == ARGV[2] then
+        local expiresAt = redis.call('ZSCORE', KEYS[4], seat)
+        redis.call('DEL', holdKey)
+        redis.call('HDEL', KEYS[3], seat)
+        redis.call('ZREM', KEYS[4], seat)
+        redis.call('SREM', ARGV[6] .. ARGV[2], seat)
+        redis.call('HSET', KEYS[2], seat, 'RESERVED')
+        redis.call('XADD', KEYS[5], 'MAXLEN', '~', ARGV[7], '*', 'seat', seat, 'status', 'RESERVED')
+        table.insert(reserved, {seat = seat, expires_at = tonumber(expiresAt) or 0})
+    end
+end
+if #reserved > 0 then
+    data['reserved_seats'] = reserved
+    redis.call('ZREM', KEYS[6], ARGV[4])
+end
+
+data['used'] = true
+data['used_by'] = ARGV[3]
+redis.call('SET', KEYS[1], cjson.encode(data), 'KEEPTTL')
+
+return {1, #reserved}
@@ -0,0 +1,22 @@
+-- expire_grants.lua
+-- Prune expired reservation tokens from the outstanding grants and record reservation_token_expired
+--
+-- KEYS[1]: outstanding grants ZSET, reservation token -> expiry (e.g., "queue:grants:{eventID}")
+-- KEYS[2]: lifecycle stream (e.g., "queue:lifecycle:{eventID}")
+--
+-- ARGV[1]: lifecycle stream max length (approximate)
+--
+-- Grants turned into reservations were already removed by ReleaseGrant, so
+-- every grant pruned here expired unused.
+--
+-- Returns: number of grants pruned
+
+local now = tonumber(redis.call('TIME')[1])
+local expired = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', now)
+for _, token in ipairs(expired) do
+    redis.call('ZREM', KEYS[1], token)
+    redis.call('XADD', KEYS[2], 'MAXLEN', '~', ARGV[1], '*',
+        'type', 'reservation_token_expired', 'reservation_token', token)
+end
+
+return #expired
@@ -0,0 +1,27 @@
+-- expire_waiting.lua
+-- Remove abandoned tokens from a lane's queue and record heartbeat_expired
+--
+-- KEYS[1]: event queue ZSET of the lane (e.g., "queue:event:{eventID}")
+-- KEYS[2]: lifecycle stream (e.g., "queue:lifecycle:{eventID}")
+--
+-- ARGV[1]: queue data key prefix (e.g., "queue:waiting:{eventID}:")
+-- ARGV[2]: lifecycle stream max length (approximate)
+-- ARGV[3..]: tokens whose heartbeat expired
+--
+-- Only tokens still queued are recorded, so a token removed concurrently by
+-- Status is recorded once. Queue data is kept so Status still answers TOKEN_EXPIRED.
+--
+-- Returns: number of tokens removed
+
+local removed = 0
+for i = 3, #ARGV do
+    local token = ARGV[i]
+    if redis.call('ZREM', KEYS[1], token) == 1 then
+        removed = removed + 1
+        local data = cjson.decode(redis.call('GET', ARGV[1] .. token) or '{}')
+        redis.call('XADD', KEYS[2], 'MAXLEN', '~', ARGV[2], '*',
+            'type', 'heartbeat_expired', 'token', token, 'user_id', data['user_id'] or '', 'lane', data['lane'] or '')
+    end
+end
+
+return removed
@@ -1,26 +1,79 @@
 -- hold_seat_atomic.lua
--- Atomic seat hold operation: Check availability + Decrement inventory + Mark as HOLD
+-- Atomic seat hold operation: Check availability + per-user limit + Decrement inventory + Mark as HOLD
 --
--- KEYS[1]: seat status hash (e.g., "seat:status:concert")
--- KEYS[2]: hold key (e.g., "hold:seat:A-12")
--- KEYS[3]: inventory counter (e.g., "inventory:concert")
+-- KEYS[1]: seat status hash (e.g., "seat:status:{eventID}")
+-- KEYS[2]: hold key (e.g., "hold:seat:{eventID}:A-12")
+-- KEYS[3]: inventory counter (e.g., "inventory:{eventID}")
+-- KEYS[4]: seats held by the user (e.g., "hold:user:{eventID}:user-123")
+-- KEYS[5]: hold owners hash, seat -> user (e.g., "hold:owner:{eventID}")
+-- KEYS[6]: hold expiry ZSET, seat -> expiry (e.g., "hold:expiry:{eventID}")
+-- KEYS[7]: seat change stream (e.g., "seat:changes:{eventID}")
 --
 -- ARGV[1]: seat_id
 -- ARGV[2]: user_id
 -- ARGV[3]: ttl (seconds)
+-- ARGV[4]: maximum live holds per user (0 = unlimited)
+-- ARGV[5]: hold key prefix (e.g., "hold:seat:{eventID}:")
+-- ARGV[6]: user holds key prefix (e.g., "hold:user:{eventID}:")
+-- ARGV[7]: approximate maximum length of the seat change stream
+--
+-- A seat still marked HOLD whose hold key expired is reclaimed here before the
+-- sweeper gets to it, so an expired hold never blocks a new one.
 --
 -- Returns:
 --   {1, remaining_count} on success (status=1, remaining_inventory)
+--   {0, "UNKNOWN_SEAT"} if the seat is not in the seat status hash
 --   {0, "SEAT_UNAVAILABLE"} if seat is not available (status=0, error_msg)
+--   {0, "HOLD_LIMIT"} if the user already holds the maximum number of seats
+--   {0, "NO_INVENTORY"} if the event has no inventory counter
 --   {0, "SOLD_OUT"} if inventory is exhausted
 
--- 1. Check seat availability
+local now = tonumber(redis.call('TIME')[1])
+
+-- 1. Check seat availability (reclaiming a lapsed hold)
 local status = redis.call('HGET', KEYS[1], ARGV[1])
-if status ~= false and status ~= 'AVAILABLE' then
+if status == 'HOLD' and redis.call('EXISTS', KEYS[2]) == 0 then
+    local owner = redis.call('HGET', KEYS[5], ARGV[1])
+    if owner then
+        redis.call('SREM', ARGV[6] .. owner, ARGV[1])
+    end
+    redis.call('HDEL', KEYS[5], ARGV[1])
+    redis.call('ZREM', KEYS[6], ARGV[1])
+    redis.call('HSET', KEYS[1], ARGV[1], 'AVAILABLE')
+    redis.call('XADD', KEYS[7], 'MAXLEN', '~', ARGV[7], '*', 'seat', ARGV[1], 'status', 'AVAILABLE')
+    if redis.call('EXISTS', KEYS[3]) == 1 then
+        redis.call('INCR', KEYS[3])
+    end
+    status = 'AVAILABLE'
+end
+if status == false then
+    -- Only seats of the event's seat map can be held
+    return {0, 'UNKNOWN_SEAT'}
+end
+if status ~= 'AVAILABLE' then
     return {0, 'SEAT_UNAVAILABLE'}
 end
 
--- 2. Check and decrement inventory
+-- 2. Per-user limit (only holds that have not lapsed count)
+local limit = tonumber(ARGV[4])
+if limit > 0 then
+    local live = 0
+    for _, seat in ipairs(redis.call('SMEMBERS', KEYS[4])) do
+        if redis.call('EXISTS', ARGV[5] .. seat) == 1 then
+            live = live + 1
+        else
+            redis.call('SREM', KEYS[4], seat)
+        end
+    end
+    if live >= limit then
+        return {0, 'HOLD_LIMIT'}
+    end
+end
+
+-- 3. Check and decrement inventory
+if redis.call('EXISTS', KEYS[3]) == 0 then
+    return {0, 'NO_INVENTORY'}
+end
 local remaining = redis.call('DECR', KEYS[3])
 if remaining < 0 then
     -- Rollback inventory
@@ -28,11 +81,16 @@ if remaining < 0 then
     return {0, 'SOLD_OUT'}
 end
 
--- 3. Mark seat as HOLD
+-- 4. Mark seat as HOLD and publish the change
 redis.call('HSET', KEYS[1], ARGV[1], 'HOLD')
+redis.call('XADD', KEYS[7], 'MAXLEN', '~', ARGV[7], '*', 'seat', ARGV[1], 'status', 'HOLD')
 
--- 4. Set hold key with TTL (for automatic release)
+-- 5. Set hold key with TTL (released by the sweeper once it lapses)
 redis.call('SETEX', KEYS[2], ARGV[3], ARGV[2])
+redis.call('HSET', KEYS[5], ARGV[1], ARGV[2])
+redis.call('ZADD', KEYS[6], now + tonumber(ARGV[3]), ARGV[1])
+redis.call('SADD', KEYS[4], ARGV[1])
+redis.call('EXPIRE', KEYS[4], ARGV[3])
 
--- 5. Return success with remaining inventory
+-- 6. Return success with remaining inventory
 return {1, tostring(remaining)}
@@ -0,0 +1,75 @@
+-- lobby_open.lua
+-- Move one lane's lobby into its queue in the order shuffled by the caller, exactly once
+--
+-- KEYS[1]: lobby key (e.g., "queue:lobby:{eventID}")
+-- KEYS[2]: event queue ZSET (e.g., "queue:event:{eventID}")
+-- KEYS[3]: position index ZSET (e.g., "position_index:{eventID}")
+-- KEYS[4]: opened flag key (e.g., "queue:opened:{eventID}")
+--
+-- ARGV[1]: opens_at (unix seconds)
+-- ARGV[2]: opened flag ttl (seconds)
+-- ARGV[3]: "1" to set the opened flag (last lane), "0" otherwise
+-- ARGV[4..n]: lobby tokens in shuffled order
+--
+-- Shuffled tokens get scores in [opens_at - 1, opens_at) so they always rank
+-- ahead of late joiners, whose score is their join time (>= opens_at).
+-- Tokens that entered the lobby after the caller's snapshot are appended at opens_at.
+--
+-- Returns:
+--   {1, admitted_count} on success
+--   {0, "ALREADY_OPENED"} if another instance opened the event first
+
+if redis.call('EXISTS', KEYS[4]) == 1 then
+    return {0, 'ALREADY_OPENED'}
+end
+
+local opens_at = tonumber(ARGV[1])
+local base = opens_at - 1
+local n = #ARGV - 3
+local count = 0
+
+local function add_batch(batch)
+    if #batch > 0 then
+        redis.call('ZADD', KEYS[2], unpack(batch))
+        redis.call('ZADD', KEYS[3], unpack(batch))
+    end
+end
+
+-- 1. Shuffled snapshot (batched to stay under Lua's unpack limit)
+local batch = {}
+for i = 4, #ARGV do
+    local token = ARGV[i]
+    if redis.call('SREM', KEYS[1], token) == 1 then
+        local idx = i - 3
+        table.insert(batch, base + idx / (n + 1))
+        table.insert(batch, token)
+        count = count + 1
+    end
+    if #batch >= 1000 then
+        add_batch(batch)
+        batch = {}
+    end
+end
+add_batch(batch)
+
+-- 2. Stragglers that joined the lobby after the snapshot
+batch = {}
+for _, token in ipairs(redis.call('SMEMBERS', KEYS[1])) do
+    table.insert(batch, opens_at)
+    table.insert(batch, token)
+    count = count + 1
+    if #batch >= 1000 then
+        add_batch(batch)
+        batch = {}
+    end
+end
+add_batch(batch)
+
+redis.call('DEL', KEYS[1])
+redis.call('EXPIRE', KEYS[2], 3600)
+redis.call('EXPIRE', KEYS[3], 3600)
+if ARGV[3] == '1' then
+    redis.call('SET', KEYS[4], ARGV[1], 'EX', ARGV[2])
+end
+
+return {1, count}
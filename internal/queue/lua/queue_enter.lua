@@ -0,0 +1,83 @@
+-- queue_enter.lua
+-- Atomic admission: waiting -> ready with a reservation token
+--
+-- KEYS[1]: queue data key (e.g., "queue:waiting:{eventID}:token")
+-- KEYS[2]: heartbeat key (e.g., "heartbeat:{eventID}:token")
+-- KEYS[3]: event queue ZSET of the lane (e.g., "queue:event:{eventID}")
+-- KEYS[4]: position index ZSET of the lane (e.g., "position_index:{eventID}")
+-- KEYS[5]: reservation token key (e.g., "queue:reservation:{eventID}:abc123")
+-- KEYS[6]: wave ready ZSET (e.g., "queue:wave:ready:{eventID}")
+-- KEYS[7]: inventory counter (e.g., "inventory:{eventID}")
+-- KEYS[8]: outstanding grants ZSET, reservation token -> expiry (e.g., "queue:grants:{eventID}")
+-- KEYS[9]: lifecycle stream (e.g., "queue:lifecycle:{eventID}")
+--
+-- ARGV[1]: waiting token
+-- ARGV[2]: reservation data JSON
+-- ARGV[3]: reservation ttl (seconds)
+-- ARGV[4]: queue data ttl once ready (seconds)
+-- ARGV[5]: reservation token
+-- ARGV[6]: oversell factor; outstanding grants are capped at remaining inventory times this
+-- ARGV[7]: lifecycle stream max length (approximate)
+--
+-- Expired grants are recorded as reservation_token_expired before they are pruned.
+-- The grants ZSET outlives its last grant by an hour so the janitor records the rest.
+--
+-- Returns:
+--   {1, "GRANTED"} on success
+--   {0, "NOT_FOUND"} queue data missing or expired
+--   {0, "ALREADY_ENTERED"} admission was already granted
+--   {0, "NOT_QUEUED"} token is no longer in the queue (left or cleaned up)
+--   {0, "SOLD_OUT"} inventory counter reached zero
+--   {0, "INVENTORY_FULL"} outstanding grants already cover the remaining inventory
+
+local raw = redis.call('GET', KEYS[1])
+if not raw then
+    return {0, 'NOT_FOUND'}
+end
+
+local data = cjson.decode(raw)
+if data['status'] == 'ready' then
+    return {0, 'ALREADY_ENTERED'}
+end
+
+if not redis.call('ZSCORE', KEYS[3], ARGV[1]) then
+    return {0, 'NOT_QUEUED'}
+end
+
+-- Inventory cap (only when the event has an inventory counter)
+local now = tonumber(redis.call('TIME')[1])
+for _, expired in ipairs(redis.call('ZRANGEBYSCORE', KEYS[8], '-inf', now)) do
+    redis.call('ZREM', KEYS[8], expired)
+    redis.call('XADD', KEYS[9], 'MAXLEN', '~', ARGV[7], '*',
+        'type', 'reservation_token_expired', 'reservation_token', expired)
+end
+
+local remaining = redis.call('GET', KEYS[7])
+if remaining then
+    remaining = tonumber(remaining)
+    if remaining <= 0 then
+        return {0, 'SOLD_OUT'}
+    end
+    if redis.call('ZCARD', KEYS[8]) >= math.floor(remaining * tonumber(ARGV[6])) then
+        return {0, 'INVENTORY_FULL'}
+    end
+end
+
+redis.call('SET', KEYS[5], ARGV[2], 'EX', ARGV[3])
+redis.call('ZADD', KEYS[8], now + tonumber(ARGV[3]), ARGV[5])
+redis.call('EXPIRE', KEYS[8], tonumber(ARGV[3]) + 3600)
+
+data['status'] = 'ready'
+data['reservation_token'] = ARGV[5]
+redis.call('SET', KEYS[1], cjson.encode(data), 'EX', ARGV[4])
+
+redis.call('DEL', KEYS[2])
+redis.call('ZREM', KEYS[3], ARGV[1])
+redis.call('ZREM', KEYS[4], ARGV[1])
+redis.call('ZREM', KEYS[6], ARGV[1])
+
+redis.call('XADD', KEYS[9], 'MAXLEN', '~', ARGV[7], '*',
+    'type', 'entered', 'token', ARGV[1], 'user_id', data['user_id'] or '', 'lane', data['lane'] or '',
+    'reservation_token', ARGV[5])
+
+return {1, 'GRANTED'}
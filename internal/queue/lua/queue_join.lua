@@ -0,0 +1,142 @@
+-- queue_join.lua
+-- Atomic join: user slot + dedupe check + stream entry + queue data + heartbeat + queue position (or lobby)
+--
+-- KEYS[1]: dedupe key (e.g., "dedupe:{eventID}:abc123")
+-- KEYS[2]: user stream key (e.g., "stream:event:{eventID}:user:userID")
+-- KEYS[3]: queue data key (e.g., "queue:waiting:{eventID}:token")
+-- KEYS[4]: heartbeat key (e.g., "heartbeat:{eventID}:token")
+-- KEYS[5]: event queue ZSET of the lane (e.g., "queue:event:{eventID}")
+-- KEYS[6]: position index ZSET of the lane (e.g., "position_index:{eventID}")
+-- KEYS[7]: lanes SET (e.g., "queue:lanes:{eventID}")
+-- KEYS[8]: lobby SET of the lane (e.g., "queue:lobby:{eventID}")
+-- KEYS[9]: opened flag key (e.g., "queue:opened:{eventID}")
+-- KEYS[10]: lifecycle stream (e.g., "queue:lifecycle:{eventID}")
+-- KEYS[11]: user slot key, user -> active waiting token (e.g., "queue:slot:{eventID}:userID")
+-- KEYS[12]: wave ready ZSET (e.g., "queue:wave:ready:{eventID}")
+--
+-- ARGV[1]: token
+-- ARGV[2]: event_id
+-- ARGV[3]: user_id
+-- ARGV[4]: lane ("" = default lane)
+-- ARGV[5]: queue data JSON (status and stream_id are set here)
+-- ARGV[6]: queue data ttl (seconds)
+-- ARGV[7]: heartbeat ttl (seconds)
+-- ARGV[8]: dedupe ttl (seconds)
+-- ARGV[9]: "1" to join the pre-sale lobby unless the event already opened, "0" otherwise
+-- ARGV[10]: lobby ttl (seconds)
+-- ARGV[11]: queue data ttl while in the lobby (seconds)
+-- ARGV[12]: lifecycle stream max length (approximate)
+-- ARGV[13]: rejoin mode: "keep_oldest", "replace", or "" when the user has no slot (anonymous)
+-- ARGV[14]: event queue ZSET of the default lane; other lanes append ":lane:<lane>"
+-- ARGV[15]: position index ZSET of the default lane
+-- ARGV[16]: lobby SET of the default lane
+-- ARGV[17]: queue data key prefix (e.g., "queue:waiting:{eventID}:")
+-- ARGV[18]: heartbeat key prefix (e.g., "heartbeat:{eventID}:")
+--
+-- A user whose slot token is still waiting (or in the lobby) with a live
+-- heartbeat is not queued twice: keep_oldest renews and returns that token,
+-- replace removes it (its lane keys are built from the prefixes; they share
+-- the event's hash tag) and joins at the back.
+--
+-- The queue score is the server's TIME with microseconds, so ordering does
+-- not depend on gateway clocks and ties between joins are rare.
+--
+-- Returns:
+--   {1, streamID, "waiting"|"lobby"} on success
+--   {2, token, queue data JSON} when the user's existing slot token was kept
+--   {0, "DUPLICATE"} on duplicate request
+
+local function lane_key(base, lane)
+    if lane == '' then
+        return base
+    end
+    return base .. ':lane:' .. lane
+end
+
+-- 1. One waiting slot per user
+local existing, existing_data
+if ARGV[13] ~= '' then
+    existing = redis.call('GET', KEYS[11])
+    local raw = existing and redis.call('GET', ARGV[17] .. existing)
+    if raw then
+        existing_data = cjson.decode(raw)
+        local status = existing_data['status']
+        if (status ~= 'waiting' and status ~= 'lobby') or redis.call('EXISTS', ARGV[18] .. existing) == 0 then
+            existing_data = nil
+        elseif ARGV[13] == 'keep_oldest' then
+            redis.call('SET', ARGV[18] .. existing, 'alive', 'EX', ARGV[7])
+            return {2, existing, raw}
+        end
+    end
+end
+
+-- 2. Check for duplicates
+if redis.call('EXISTS', KEYS[1]) == 1 then
+    return {0, 'DUPLICATE'}
+end
+
+-- 3. Replace the user's live slot token
+if existing_data then
+    local lane = existing_data['lane'] or ''
+    redis.call('ZREM', lane_key(ARGV[14], lane), existing)
+    redis.call('ZREM', lane_key(ARGV[15], lane), existing)
+    redis.call('SREM', lane_key(ARGV[16], lane), existing)
+    redis.call('ZREM', KEYS[12], existing)
+    redis.call('DEL', ARGV[17] .. existing, ARGV[18] .. existing)
+    if existing_data['stream_id'] then
+        redis.call('XDEL', KEYS[2], existing_data['stream_id'])
+    end
+    redis.call('XADD', KEYS[10], 'MAXLEN', '~', ARGV[12], '*',
+        'type', 'left', 'token', existing, 'user_id', ARGV[3], 'lane', lane, 'reason', 'replaced')
+end
+
+-- 4. Server time
+local time = redis.call('TIME')
+local score = string.format('%d.%06d', time[1], time[2])
+
+-- 5. Add to stream
+local streamID = redis.call('XADD', KEYS[2], '*',
+    'token', ARGV[1],
+    'event_id', ARGV[2],
+    'user_id', ARGV[3],
+    'timestamp', time[1],
+    'timestamp_usec', time[2]
+)
+redis.call('SETEX', KEYS[1], ARGV[8], '1')
+
+-- 6. Register the lane so cleanup and lobby opening find its keys
+if ARGV[4] ~= '' then
+    redis.call('SADD', KEYS[7], ARGV[4])
+    redis.call('EXPIRE', KEYS[7], 86400)
+end
+
+-- 7. Lobby (positions are assigned at opening) or queue position
+local status = 'waiting'
+local data_ttl = ARGV[6]
+if ARGV[9] == '1' and redis.call('EXISTS', KEYS[9]) == 0 then
+    redis.call('SADD', KEYS[8], ARGV[1])
+    redis.call('EXPIRE', KEYS[8], ARGV[10])
+    status = 'lobby'
+    data_ttl = ARGV[11]
+else
+    redis.call('ZADD', KEYS[5], score, ARGV[1])
+    redis.call('EXPIRE', KEYS[5], 3600)
+    redis.call('ZADD', KEYS[6], score, ARGV[1])
+    redis.call('EXPIRE', KEYS[6], 3600)
+end
+
+-- 8. Queue data and heartbeat
+local data = cjson.decode(ARGV[5])
+data['status'] = status
+data['stream_id'] = streamID
+redis.call('SET', KEYS[3], cjson.encode(data), 'EX', data_ttl)
+redis.call('SET', KEYS[4], 'alive', 'EX', ARGV[7])
+if ARGV[13] ~= '' then
+    redis.call('SET', KEYS[11], ARGV[1], 'EX', data_ttl)
+end
+
+-- 9. Lifecycle event
+redis.call('XADD', KEYS[10], 'MAXLEN', '~', ARGV[12], '*',
+    'type', 'joined', 'token', ARGV[1], 'user_id', ARGV[3], 'lane', ARGV[4], 'status', status)
+
+return {1, streamID, status}
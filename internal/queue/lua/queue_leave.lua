@@ -0,0 +1,53 @@
+-- queue_leave.lua
+-- Atomic removal of a waiting token (voluntary leave or abandoned heartbeat)
+--
+-- KEYS[1]: queue data key (e.g., "queue:waiting:{eventID}:token")
+-- KEYS[2]: heartbeat key (e.g., "heartbeat:{eventID}:token")
+-- KEYS[3]: event queue ZSET of the lane (e.g., "queue:event:{eventID}")
+-- KEYS[4]: position index ZSET of the lane (e.g., "position_index:{eventID}")
+-- KEYS[5]: lobby SET of the lane (e.g., "queue:lobby:{eventID}")
+-- KEYS[6]: user stream key (e.g., "stream:event:{eventID}:user:userID")
+-- KEYS[7]: wave ready ZSET (e.g., "queue:wave:ready:{eventID}")
+-- KEYS[8]: lifecycle stream (e.g., "queue:lifecycle:{eventID}")
+-- KEYS[9]: user slot key (e.g., "queue:slot:{eventID}:userID"), freed if it holds this token
+--
+-- ARGV[1]: waiting token
+-- ARGV[2]: lifecycle event: "left" (voluntary) or "heartbeat_expired" (abandoned)
+-- ARGV[3]: user_id recorded with the event
+-- ARGV[4]: lane recorded with the event
+-- ARGV[5]: lifecycle stream max length (approximate)
+--
+-- The stream entry is removed by the stream_id recorded at join,
+-- so the user's stream is never scanned. heartbeat_expired is only recorded
+-- when the token was still queued: the janitor records the tokens it removed.
+--
+-- Returns:
+--   {1, "LEFT"} on success
+--   {0, "NOT_FOUND"} queue data was already gone (remaining keys are still removed)
+
+local raw = redis.call('GET', KEYS[1])
+
+redis.call('DEL', KEYS[2])
+local queued = redis.call('ZREM', KEYS[3], ARGV[1]) + redis.call('SREM', KEYS[5], ARGV[1])
+redis.call('ZREM', KEYS[4], ARGV[1])
+redis.call('ZREM', KEYS[7], ARGV[1])
+if redis.call('GET', KEYS[9]) == ARGV[1] then
+    redis.call('DEL', KEYS[9])
+end
+
+if not raw then
+    return {0, 'NOT_FOUND'}
+end
+
+if ARGV[2] == 'left' or queued > 0 then
+    redis.call('XADD', KEYS[8], 'MAXLEN', '~', ARGV[5], '*',
+        'type', ARGV[2], 'token', ARGV[1], 'user_id', ARGV[3], 'lane', ARGV[4])
+end
+
+local data = cjson.decode(raw)
+if data['stream_id'] then
+    redis.call('XDEL', KEYS[6], data['stream_id'])
+end
+redis.call('DEL', KEYS[1])
+
+return {1, 'LEFT'}
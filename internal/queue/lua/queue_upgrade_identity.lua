@@ -0,0 +1,150 @@
+-- queue_upgrade_identity.lua
+-- Hand an anonymous session's waiting token over to the user who logged in
+--
+-- KEYS[1]: anonymous user slot key (e.g., "queue:slot:{eventID}:anon:sessionID")
+-- KEYS[2]: user slot key (e.g., "queue:slot:{eventID}:userID")
+-- KEYS[3]: anonymous user stream key (e.g., "stream:event:{eventID}:user:anon:sessionID")
+-- KEYS[4]: user stream key (e.g., "stream:event:{eventID}:user:userID")
+-- KEYS[5]: lifecycle stream (e.g., "queue:lifecycle:{eventID}")
+-- KEYS[6]: wave ready ZSET (e.g., "queue:wave:ready:{eventID}")
+--
+-- ARGV[1]: queue data key prefix (e.g., "queue:waiting:{eventID}:")
+-- ARGV[2]: anonymous identity
+-- ARGV[3]: user_id
+-- ARGV[4]: lifecycle stream max length (approximate)
+-- ARGV[5]: reservation token key prefix (e.g., "queue:reservation:{eventID}:")
+-- ARGV[6]: rejoin mode of the event: "keep_oldest" or "replace"
+-- ARGV[7]: heartbeat key prefix (e.g., "heartbeat:{eventID}:")
+-- ARGV[8]: event queue ZSET of the default lane; other lanes append ":lane:<lane>"
+-- ARGV[9]: position index ZSET of the default lane
+-- ARGV[10]: lobby SET of the default lane
+--
+-- The queue data, join stream entry and (once admitted) reservation token move
+-- to the user; the token keeps its place. A user keeps one waiting slot, as on
+-- join: when both the user's slot token and the anonymous token are still
+-- waiting, keep_oldest removes the newer of the two and replace the older
+-- (recorded as left with reason "replaced"). Otherwise the anonymous token
+-- takes the slot unless the user's slot token is still waiting.
+--
+-- Returns: {1, token} when a token was upgraded, {0} otherwise
+
+local function lane_key(base, lane)
+    if lane == '' then
+        return base
+    end
+    return base .. ':lane:' .. lane
+end
+
+-- Queue data of a token still waiting (or in the lobby) with a live heartbeat
+local function waiting_data(token)
+    local raw = token and redis.call('GET', ARGV[1] .. token)
+    if not raw then
+        return nil
+    end
+    local data = cjson.decode(raw)
+    if (data['status'] ~= 'waiting' and data['status'] ~= 'lobby') or redis.call('EXISTS', ARGV[7] .. token) == 0 then
+        return nil
+    end
+    return data
+end
+
+-- Stream IDs come from the Redis clock, so they order joins across streams
+local function joined_after(a, b)
+    local a_ms, a_seq = string.match(a or '', '^(%d+)-(%d+)$')
+    local b_ms, b_seq = string.match(b or '', '^(%d+)-(%d+)$')
+    if not a_ms or not b_ms then
+        return true
+    end
+    if tonumber(a_ms) ~= tonumber(b_ms) then
+        return tonumber(a_ms) > tonumber(b_ms)
+    end
+    return tonumber(a_seq) > tonumber(b_seq)
+end
+
+local function replace(token, data, stream_key)
+    local lane = data['lane'] or ''
+    redis.call('ZREM', lane_key(ARGV[8], lane), token)
+    redis.call('ZREM', lane_key(ARGV[9], lane), token)
+    redis.call('SREM', lane_key(ARGV[10], lane), token)
+    redis.call('ZREM', KEYS[6], token)
+    redis.call('DEL', ARGV[1] .. token, ARGV[7] .. token)
+    if data['stream_id'] then
+        redis.call('XDEL', stream_key, data['stream_id'])
+    end
+    redis.call('XADD', KEYS[5], 'MAXLEN', '~', ARGV[4], '*',
+        'type', 'left', 'token', token, 'user_id', ARGV[3], 'lane', lane, 'reason', 'replaced')
+end
+
+local token = redis.call('GET', KEYS[1])
+if not token then
+    return {0}
+end
+redis.call('DEL', KEYS[1])
+
+local data_key = ARGV[1] .. token
+local raw = redis.call('GET', data_key)
+if not raw then
+    return {0}
+end
+local data = cjson.decode(raw)
+if data['user_id'] ~= ARGV[2] then
+    return {0}
+end
+
+-- 1. One waiting slot per user
+local existing = redis.call('GET', KEYS[2])
+local existing_data = existing ~= token and waiting_data(existing)
+local take_slot = not existing_data
+if existing_data and waiting_data(token) then
+    local anonymous_newer = joined_after(data['stream_id'], existing_data['stream_id'])
+    if (ARGV[6] == 'replace') ~= anonymous_newer then
+        replace(token, data, KEYS[3])
+        return {0}
+    end
+    replace(existing, existing_data, KEYS[4])
+    take_slot = true
+end
+
+-- 2. Move the join stream entry
+if data['stream_id'] then
+    local entries = redis.call('XRANGE', KEYS[3], data['stream_id'], data['stream_id'])
+    redis.call('XDEL', KEYS[3], data['stream_id'])
+    data['stream_id'] = nil
+    if entries[1] then
+        local fields = entries[1][2]
+        for i = 1, #fields, 2 do
+            if fields[i] == 'user_id' then
+                fields[i + 1] = ARGV[3]
+            end
+        end
+        data['stream_id'] = redis.call('XADD', KEYS[4], '*', unpack(fields))
+    end
+end
+
+-- 3. Reservation token granted while anonymous
+if data['reservation_token'] then
+    local reservation_key = ARGV[5] .. data['reservation_token']
+    local reservation = redis.call('GET', reservation_key)
+    if reservation then
+        local reservation_data = cjson.decode(reservation)
+        if reservation_data['user_id'] == ARGV[2] then
+            reservation_data['user_id'] = ARGV[3]
+            redis.call('SET', reservation_key, cjson.encode(reservation_data), 'KEEPTTL')
+        end
+    end
+end
+
+-- 4. Queue data and user slot
+data['user_id'] = ARGV[3]
+redis.call('SET', data_key, cjson.encode(data), 'KEEPTTL')
+local ttl = redis.call('PTTL', data_key)
+if ttl > 0 and take_slot then
+    redis.call('SET', KEYS[2], token, 'PX', ttl)
+end
+
+-- 5. Lifecycle event
+redis.call('XADD', KEYS[5], 'MAXLEN', '~', ARGV[4], '*',
+    'type', 'identity_upgraded', 'token', token, 'user_id', ARGV[3], 'lane', data['lane'] or '',
+    'previous_user_id', ARGV[2])
+
+return {1, token}
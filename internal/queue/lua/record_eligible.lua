@@ -0,0 +1,22 @@
+-- record_eligible.lua
+-- Record the first time a waiting token became eligible for Enter
+--
+-- KEYS[1]: eligible marker key (e.g., "queue:eligible:{eventID}:token")
+-- KEYS[2]: lifecycle stream (e.g., "queue:lifecycle:{eventID}")
+--
+-- ARGV[1]: waiting token
+-- ARGV[2]: user_id
+-- ARGV[3]: lane
+-- ARGV[4]: marker ttl (seconds)
+-- ARGV[5]: lifecycle stream max length (approximate)
+--
+-- Returns: 1 when recorded, 0 when the token was already recorded
+
+if not redis.call('SET', KEYS[1], '1', 'NX', 'EX', ARGV[4]) then
+    return 0
+end
+
+redis.call('XADD', KEYS[2], 'MAXLEN', '~', ARGV[5], '*',
+    'type', 'eligible', 'token', ARGV[1], 'user_id', ARGV[2], 'lane', ARGV[3])
+
+return 1
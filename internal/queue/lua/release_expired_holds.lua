@@ -0,0 +1,40 @@
+-- release_expired_holds.lua
+-- Put seats whose hold lapsed back to AVAILABLE and restore their inventory
+--
+-- KEYS[1]: seat status hash (e.g., "seat:status:{eventID}")
+-- KEYS[2]: inventory counter (e.g., "inventory:{eventID}")
+-- KEYS[3]: hold owners hash, seat -> user (e.g., "hold:owner:{eventID}")
+-- KEYS[4]: hold expiry ZSET, seat -> expiry (e.g., "hold:expiry:{eventID}")
+-- KEYS[5]: seat change stream (e.g., "seat:changes:{eventID}")
+--
+-- ARGV[1]: hold key prefix (e.g., "hold:seat:{eventID}:")
+-- ARGV[2]: user holds key prefix (e.g., "hold:user:{eventID}:")
+-- ARGV[3]: maximum seats to release in one call
+-- ARGV[4]: approximate maximum length of the seat change stream
+--
+-- Returns: {released, scanned}; scanned == ARGV[3] means more may be due
+
+local now = tonumber(redis.call('TIME')[1])
+local seats = redis.call('ZRANGEBYSCORE', KEYS[4], '-inf', now, 'LIMIT', 0, tonumber(ARGV[3]))
+
+local released = 0
+for _, seat in ipairs(seats) do
+    redis.call('ZREM', KEYS[4], seat)
+
+    -- Released or re-held in the meantime: nothing to do
+    if redis.call('EXISTS', ARGV[1] .. seat) == 0 and redis.call('HGET', KEYS[1], seat) == 'HOLD' then
+        redis.call('HSET', KEYS[1], seat, 'AVAILABLE')
+        redis.call('XADD', KEYS[5], 'MAXLEN', '~', ARGV[4], '*', 'seat', seat, 'status', 'AVAILABLE')
+        local owner = redis.call('HGET', KEYS[3], seat)
+        if owner then
+            redis.call('SREM', ARGV[2] .. owner, seat)
+        end
+        redis.call('HDEL', KEYS[3], seat)
+        if redis.call('EXISTS', KEYS[2]) == 1 then
+            redis.call('INCR', KEYS[2])
+        end
+        released = released + 1
+    end
+end
+
+return {released, #seats}
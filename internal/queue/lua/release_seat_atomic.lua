@@ -1,15 +1,22 @@
 -- release_seat_atomic.lua
 -- Atomic seat release operation: Remove hold + Increment inventory + Mark as AVAILABLE
 --
--- KEYS[1]: seat status hash
--- KEYS[2]: hold key
--- KEYS[3]: inventory counter
+-- KEYS[1]: seat status hash (e.g., "seat:status:{eventID}")
+-- KEYS[2]: hold key (e.g., "hold:seat:{eventID}:A-12")
+-- KEYS[3]: inventory counter (e.g., "inventory:{eventID}")
+-- KEYS[4]: hold owners hash, seat -> user (e.g., "hold:owner:{eventID}")
+-- KEYS[5]: hold expiry ZSET, seat -> expiry (e.g., "hold:expiry:{eventID}")
+-- KEYS[6]: seat change stream (e.g., "seat:changes:{eventID}")
 --
 -- ARGV[1]: seat_id
+-- ARGV[2]: user_id releasing the seat ("" = any holder)
+-- ARGV[3]: user holds key prefix (e.g., "hold:user:{eventID}:")
+-- ARGV[4]: approximate maximum length of the seat change stream
 --
 -- Returns:
 --   {1, remaining_count} on success (status=1, remaining_inventory)
 --   {0, "NOT_HELD"} if seat was not held (status=0, error_msg)
+--   {0, "NOT_HOLDER"} if the seat is held by another user
 
 -- 1. Check if seat is held
 local status = redis.call('HGET', KEYS[1], ARGV[1])
@@ -17,14 +24,26 @@ if status ~= 'HOLD' then
     return {0, 'NOT_HELD'}
 end
 
--- 2. Mark seat as AVAILABLE
+-- 2. Only the holder may release
+local owner = redis.call('HGET', KEYS[4], ARGV[1]) or redis.call('GET', KEYS[2])
+if ARGV[2] ~= '' and owner and owner ~= ARGV[2] then
+    return {0, 'NOT_HOLDER'}
+end
+
+-- 3. Mark seat as AVAILABLE and publish the change
 redis.call('HSET', KEYS[1], ARGV[1], 'AVAILABLE')
+redis.call('XADD', KEYS[6], 'MAXLEN', '~', ARGV[4], '*', 'seat', ARGV[1], 'status', 'AVAILABLE')
 
--- 3. Delete hold key
+-- 4. Delete hold key and its bookkeeping
 redis.call('DEL', KEYS[2])
+redis.call('HDEL', KEYS[4], ARGV[1])
+redis.call('ZREM', KEYS[5], ARGV[1])
+if owner then
+    redis.call('SREM', ARGV[3] .. owner, ARGV[1])
+end
 
--- 4. Increment inventory
+-- 5. Increment inventory
 local remaining = redis.call('INCR', KEYS[3])
 
--- 5. Return success with remaining inventory
+-- 6. Return success with remaining inventory
 return {1, tostring(remaining)}
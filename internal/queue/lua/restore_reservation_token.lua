@@ -0,0 +1,79 @@
+-- restore_reservation_token.lua
+-- Give a consumed reservation token back after a failed backend call, with the
+-- seats its consumption reserved and its grant
+--
+-- KEYS[1]: reservation token key (e.g., "queue:reservation:{eventID}:abc123")
+-- KEYS[2]: seat status hash (e.g., "seat:status:{eventID}")
+-- KEYS[3]: hold owners hash, seat -> user (e.g., "hold:owner:{eventID}")
+-- KEYS[4]: hold expiry ZSET, seat -> expiry (e.g., "hold:expiry:{eventID}")
+-- KEYS[5]: seat change stream (e.g., "seat:changes:{eventID}")
+-- KEYS[6]: outstanding grants ZSET (e.g., "queue:grants:{eventID}")
+-- KEYS[7]: inventory counter (e.g., "inventory:{eventID}")
+--
+-- ARGV[1]: attempt ID the token was consumed with
+-- ARGV[2]: reservation token (the grant member)
+-- ARGV[3]: hold key prefix (e.g., "hold:seat:{eventID}:")
+-- ARGV[4]: user holds key prefix (e.g., "hold:user:{eventID}:")
+-- ARGV[5]: approximate maximum length of the seat change stream
+--
+-- Only the attempt that consumed the token restores it: a late restore from an
+-- earlier attempt must not re-arm a token a later attempt consumed. Reserved
+-- seats are held again until their original hold expiry; a seat whose hold
+-- lapsed during the call is released and its inventory restored.
+--
+-- Returns:
+--   {1, "OK"} on success
+--   {0, "NOT_FOUND"} token expired in the meantime (nothing to restore)
+--   {0, "NOT_CONSUMER"} token is unused or was consumed by another attempt
+
+local raw = redis.call('GET', KEYS[1])
+if not raw then
+    return {0, 'NOT_FOUND'}
+end
+
+local data = cjson.decode(raw)
+if not data['used'] or data['used_by'] ~= ARGV[1] then
+    return {0, 'NOT_CONSUMER'}
+end
+
+local now = tonumber(redis.call('TIME')[1])
+local userID = data['user_id']
+local reserved = data['reserved_seats']
+if type(reserved) == 'table' and #reserved > 0 then
+    for _, entry in ipairs(reserved) do
+        local seat = entry['seat']
+        if redis.call('HGET', KEYS[2], seat) == 'RESERVED' then
+            local ttl = tonumber(entry['expires_at']) - now
+            if ttl > 0 then
+                redis.call('SET', ARGV[3] .. seat, userID, 'EX', ttl)
+                redis.call('HSET', KEYS[3], seat, userID)
+                redis.call('ZADD', KEYS[4], now + ttl, seat)
+                redis.call('SADD', ARGV[4] .. userID, seat)
+                if redis.call('TTL', ARGV[4] .. userID) < ttl then
+                    redis.call('EXPIRE', ARGV[4] .. userID, ttl)
+                end
+                redis.call('HSET', KEYS[2], seat, 'HOLD')
+                redis.call('XADD', KEYS[5], 'MAXLEN', '~', ARGV[5], '*', 'seat', seat, 'status', 'HOLD')
+            else
+                redis.call('HSET', KEYS[2], seat, 'AVAILABLE')
+                redis.call('XADD', KEYS[5], 'MAXLEN', '~', ARGV[5], '*', 'seat', seat, 'status', 'AVAILABLE')
+                if redis.call('EXISTS', KEYS[7]) == 1 then
+                    redis.call('INCR', KEYS[7])
+                end
+            end
+        end
+    end
+
+    -- The token counts as an outstanding grant again until it expires
+    local tokenTTL = redis.call('TTL', KEYS[1])
+    if tokenTTL > 0 then
+        redis.call('ZADD', KEYS[6], now + tokenTTL, ARGV[2])
+    end
+    data['reserved_seats'] = nil
+end
+
+data['used'] = false
+data['used_by'] = nil
+redis.call('SET', KEYS[1], cjson.encode(data), 'KEEPTTL')
+
+return {1, 'OK'}
@@ -0,0 +1,113 @@
+-- wave_admit.lua
+-- Mark the next wave of waiting tokens ready and skip tokens that missed their deadline
+--
+-- KEYS[1]: wave ready ZSET, token -> admission deadline (e.g., "queue:wave:ready:{eventID}")
+-- KEYS[2]: wave state HASH (e.g., "queue:wave:state:{eventID}")
+-- KEYS[3]: lifecycle stream (e.g., "queue:lifecycle:{eventID}")
+-- KEYS[4]: wave feedback HASH (e.g., "queue:wave:feedback:{eventID}")
+-- KEYS[5..]: per lane: event queue ZSET, position index ZSET (pairs, same order as ARGV[11..])
+--
+-- ARGV[1]: wave interval (seconds); a wave closer than this to the previous one is refused
+-- ARGV[2]: admission deadline (seconds after the wave)
+-- ARGV[3]: wave size recorded in the state
+-- ARGV[4]: heartbeat key prefix (e.g., "heartbeat:{eventID}:")
+-- ARGV[5]: queue data key prefix (e.g., "queue:waiting:{eventID}:")
+-- ARGV[6]: leader fencing token; waves from an older leader are refused
+-- ARGV[7]: lifecycle stream max length (approximate)
+-- ARGV[8..10]: feedback the wave size was computed from: requests, errors, latency_ms
+-- ARGV[11..]: tokens to mark per lane, in KEYS order
+--
+-- Per-token keys are built from the prefixes; they share the event's hash tag.
+-- Missed tokens leave the queue and their queue data is marked "expired".
+-- Marked tokens are recorded as eligible, missed ones as eligibility_expired.
+-- The feedback read for this wave is subtracted once it runs, so outcomes
+-- reported meanwhile count toward the next wave and a refused wave consumes none.
+--
+-- Returns:
+--   {1, marked, missed} on success
+--   {0, "STALE_FENCE"} when a newer leader already ran a wave
+--   {0, "TOO_EARLY"} when the previous wave is less than an interval ago
+
+local time = redis.call('TIME')
+local now = tonumber(time[1]) + tonumber(time[2]) / 1000000
+
+local fence = tonumber(ARGV[6])
+if fence < tonumber(redis.call('HGET', KEYS[2], 'fence') or '0') then
+    return {0, 'STALE_FENCE'}
+end
+
+local last = tonumber(redis.call('HGET', KEYS[2], 'last_at') or '0')
+if now - last < tonumber(ARGV[1]) - 0.5 then
+    return {0, 'TOO_EARLY'}
+end
+
+local lanes = (#KEYS - 4) / 2
+
+local function record(event, token, data, deadline)
+    redis.call('XADD', KEYS[3], 'MAXLEN', '~', ARGV[7], '*',
+        'type', event, 'token', token, 'user_id', data['user_id'] or '', 'lane', data['lane'] or '',
+        'deadline', deadline)
+end
+
+-- 1. Skip tokens whose deadline passed
+local missed = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', now)
+for _, token in ipairs(missed) do
+    redis.call('ZREM', KEYS[1], token)
+    for i = 0, lanes - 1 do
+        redis.call('ZREM', KEYS[5 + i * 2], token)
+        redis.call('ZREM', KEYS[6 + i * 2], token)
+    end
+    local raw = redis.call('GET', ARGV[5] .. token)
+    if raw then
+        local data = cjson.decode(raw)
+        if data['status'] ~= 'ready' then
+            data['status'] = 'expired'
+            redis.call('SET', ARGV[5] .. token, cjson.encode(data), 'KEEPTTL')
+            record('eligibility_expired', token, data, '')
+        end
+    end
+end
+
+-- 2. Mark the next live, unmarked tokens of every lane
+local deadline = now + tonumber(ARGV[2])
+local marked = 0
+for i = 0, lanes - 1 do
+    local want = tonumber(ARGV[11 + i])
+    local offset = 0
+    while want > 0 do
+        local batch = redis.call('ZRANGE', KEYS[5 + i * 2], offset, offset + 199)
+        if #batch == 0 then
+            break
+        end
+        for _, token in ipairs(batch) do
+            if want == 0 then
+                break
+            end
+            if not redis.call('ZSCORE', KEYS[1], token) and redis.call('EXISTS', ARGV[4] .. token) == 1 then
+                redis.call('ZADD', KEYS[1], deadline, token)
+                record('eligible', token, cjson.decode(redis.call('GET', ARGV[5] .. token) or '{}'), math.floor(deadline))
+                want = want - 1
+                marked = marked + 1
+            end
+        end
+        offset = offset + #batch
+    end
+end
+
+redis.call('HSET', KEYS[2], 'last_at', now, 'size', ARGV[3], 'fence', fence)
+redis.call('HINCRBY', KEYS[2], 'waves', 1)
+redis.call('EXPIRE', KEYS[1], 3600)
+redis.call('EXPIRE', KEYS[2], 86400)
+
+-- 3. Consume the feedback this wave was sized with
+if tonumber(ARGV[8]) > 0 then
+    local requests = redis.call('HINCRBY', KEYS[4], 'requests', -tonumber(ARGV[8]))
+    if requests <= 0 then
+        redis.call('DEL', KEYS[4])
+    else
+        redis.call('HINCRBY', KEYS[4], 'errors', -tonumber(ARGV[9]))
+        redis.call('HINCRBY', KEYS[4], 'latency_ms', -tonumber(ARGV[10]))
+    end
+end
+
+return {1, marked, #missed}
@@ -3,7 +3,9 @@ package queue
 import (
 	"context"
 	_ "embed"
+	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
@@ -20,14 +22,45 @@ var holdSeatAtomicScript string
 //go:embed lua/release_seat_atomic.lua
 var releaseSeatAtomicScript string
 
+//go:embed lua/consume_reservation_token.lua
+var consumeReservationTokenScript string
+
+//go:embed lua/restore_reservation_token.lua
+var restoreReservationTokenScript string
+
+//go:embed lua/queue_join.lua
+var queueJoinScript string
+
+//go:embed lua/queue_enter.lua
+var queueEnterScript string
+
+//go:embed lua/queue_leave.lua
+var queueLeaveScript string
+
+//go:embed lua/record_eligible.lua
+var recordEligibleScript string
+
+//go:embed lua/queue_upgrade_identity.lua
+var queueUpgradeIdentityScript string
+
+// readyDataTTL keeps the queue data of admitted tokens so Status keeps answering "ready"
+const readyDataTTL = 30 * time.Minute
+
 // LuaExecutor executes Lua scripts atomically on Redis
 type LuaExecutor struct {
 	redis redis.UniversalClient // 🔴 Changed to UniversalClient for Cluster support
 
 	// Preloaded scripts
-	enqueueScript *redis.Script
-	holdScript    *redis.Script
-	releaseScript *redis.Script
+	enqueueScript  *redis.Script
+	holdScript     *redis.Script
+	releaseScript  *redis.Script
+	consumeScript  *redis.Script
+	restoreScript  *redis.Script
+	joinScript     *redis.Script
+	enterScript    *redis.Script
+	leaveScript    *redis.Script
+	eligibleScript *redis.Script
+	upgradeScript  *redis.Script
 
 	logger *logrus.Logger
 }
@@ -35,11 +68,18 @@ type LuaExecutor struct {
 // NewLuaExecutor creates a new Lua script executor
 func NewLuaExecutor(redisClient redis.UniversalClient, logger *logrus.Logger) *LuaExecutor {
 	return &LuaExecutor{
-		redis:         redisClient,
-		enqueueScript: redis.NewScript(enqueueAtomicStreamsScript),
-		holdScript:    redis.NewScript(holdSeatAtomicScript),
-		releaseScript: redis.NewScript(releaseSeatAtomicScript),
-		logger:        logger,
+		redis:          redisClient,
+		enqueueScript:  redis.NewScript(enqueueAtomicStreamsScript),
+		holdScript:     redis.NewScript(holdSeatAtomicScript),
+		releaseScript:  redis.NewScript(releaseSeatAtomicScript),
+		consumeScript:  redis.NewScript(consumeReservationTokenScript),
+		restoreScript:  redis.NewScript(restoreReservationTokenScript),
+		joinScript:     redis.NewScript(queueJoinScript),
+		enterScript:    redis.NewScript(queueEnterScript),
+		leaveScript:    redis.NewScript(queueLeaveScript),
+		eligibleScript: redis.NewScript(recordEligibleScript),
+		upgradeScript:  redis.NewScript(queueUpgradeIdentityScript),
+		logger:         logger,
 	}
 }
 
@@ -132,21 +172,31 @@ type HoldSeatAtomicResult struct {
 	Error     string
 }
 
-// HoldSeatAtomic performs atomic seat hold operation
+// HoldSeatAtomic performs atomic seat hold operation. The hold lapses after ttl
+// seconds (HoldSweeper then releases it); maxHoldsPerUser caps the live holds of
+// userID for the event (0 = unlimited).
+// Errors: UNKNOWN_SEAT|SEAT_UNAVAILABLE|HOLD_LIMIT|NO_INVENTORY|SOLD_OUT
 func (le *LuaExecutor) HoldSeatAtomic(
 	ctx context.Context,
-	seatStatusKey string,
-	holdKey string,
-	inventoryKey string,
+	eventID string,
 	seatID string,
 	userID string,
 	ttl int,
+	maxHoldsPerUser int,
 ) (*HoldSeatAtomicResult, error) {
 	result, err := le.holdScript.Run(
 		ctx,
 		le.redis,
-		[]string{seatStatusKey, holdKey, inventoryKey},
-		seatID, userID, ttl,
+		[]string{
+			SeatStatusKey(eventID),
+			SeatHoldKey(eventID, seatID),
+			InventoryKey(eventID),
+			UserHoldsKey(eventID, userID),
+			HoldOwnersKey(eventID),
+			HoldExpiryKey(eventID),
+			SeatChangesKey(eventID),
+		},
+		seatID, userID, ttl, maxHoldsPerUser, seatHoldPrefix(eventID), userHoldsPrefix(eventID), seatChangesMaxLen,
 	).Result()
 
 	if err != nil {
@@ -201,7 +251,13 @@ func (le *LuaExecutor) HoldSeatAtomic(
 	var remaining int64
 	_, _ = fmt.Sscanf(remainingStr, "%d", &remaining)
 
+	// Let the sweeper find this event's holds; a stale entry only costs an empty sweep
+	if err := le.redis.ZAdd(ctx, HoldEventsKey, redis.Z{Score: float64(time.Now().Unix()), Member: eventID}).Err(); err != nil {
+		le.logger.WithError(err).WithField("event_id", eventID).Warn("Failed to index seat hold event")
+	}
+
 	le.logger.WithFields(logrus.Fields{
+		"event_id":  eventID,
 		"seat_id":   seatID,
 		"user_id":   userID,
 		"remaining": remaining,
@@ -220,19 +276,27 @@ type ReleaseSeatAtomicResult struct {
 	Error     string
 }
 
-// ReleaseSeatAtomic performs atomic seat release operation
+// ReleaseSeatAtomic performs atomic seat release operation. Only userID may
+// release its own hold ("" releases regardless of the holder).
+// Errors: NOT_HELD|NOT_HOLDER
 func (le *LuaExecutor) ReleaseSeatAtomic(
 	ctx context.Context,
-	seatStatusKey string,
-	holdKey string,
-	inventoryKey string,
+	eventID string,
 	seatID string,
+	userID string,
 ) (*ReleaseSeatAtomicResult, error) {
 	result, err := le.releaseScript.Run(
 		ctx,
 		le.redis,
-		[]string{seatStatusKey, holdKey, inventoryKey},
-		seatID,
+		[]string{
+			SeatStatusKey(eventID),
+			SeatHoldKey(eventID, seatID),
+			InventoryKey(eventID),
+			HoldOwnersKey(eventID),
+			HoldExpiryKey(eventID),
+			SeatChangesKey(eventID),
+		},
+		seatID, userID, userHoldsPrefix(eventID), seatChangesMaxLen,
 	).Result()
 
 	if err != nil {
@@ -285,6 +349,7 @@ func (le *LuaExecutor) ReleaseSeatAtomic(
 	_, _ = fmt.Sscanf(remainingStr, "%d", &remaining)
 
 	le.logger.WithFields(logrus.Fields{
+		"event_id":  eventID,
 		"seat_id":   seatID,
 		"remaining": remaining,
 	}).Info("Seat release successful")
@@ -294,3 +359,423 @@ func (le *LuaExecutor) ReleaseSeatAtomic(
 		Remaining: remaining,
 	}, nil
 }
+
+// ReservationTokenKey returns the Redis key of a reservation token granted by Enter.
+// The event hash tag lets Enter write it in the same script as the queue keys.
+func ReservationTokenKey(eventID, reservationToken string) string {
+	return fmt.Sprintf("queue:reservation:{%s}:%s", eventID, reservationToken)
+}
+
+// ReservationTokenResult contains the result of consuming or restoring a reservation token
+type ReservationTokenResult struct {
+	Success bool
+	Error   string // NOT_FOUND|EVENT_MISMATCH|USER_MISMATCH|ALREADY_USED|NOT_CONSUMER
+}
+
+// ConsumeReservationToken atomically checks that a reservation token exists,
+// was granted for eventID to userID and is unused, then marks it used by attemptID.
+// The seats of seatIDs userID holds become RESERVED in the same step, so their
+// holds no longer lapse; RestoreReservationToken holds them again.
+func (le *LuaExecutor) ConsumeReservationToken(
+	ctx context.Context,
+	reservationToken string,
+	eventID string,
+	userID string,
+	attemptID string,
+	seatIDs []string,
+) (*ReservationTokenResult, error) {
+	args := []interface{}{eventID, userID, attemptID, reservationToken, seatHoldPrefix(eventID), userHoldsPrefix(eventID), seatChangesMaxLen}
+	for _, seatID := range seatIDs {
+		args = append(args, seatID)
+	}
+
+	result, err := le.consumeScript.Run(
+		ctx,
+		le.redis,
+		[]string{
+			ReservationTokenKey(eventID, reservationToken),
+			SeatStatusKey(eventID),
+			HoldOwnersKey(eventID),
+			HoldExpiryKey(eventID),
+			SeatChangesKey(eventID),
+			GrantsKey(eventID),
+		},
+		args...,
+	).Result()
+
+	if err != nil {
+		le.logger.WithError(err).WithField("event_id", eventID).Error("Consume reservation token Lua script failed")
+		return nil, fmt.Errorf("lua script failed: %w", err)
+	}
+
+	return le.parseReservationTokenResult(result)
+}
+
+// CheckReservationToken checks that a reservation token exists and was granted
+// for eventID to userID without consuming it. A used token reports ALREADY_USED.
+func (le *LuaExecutor) CheckReservationToken(
+	ctx context.Context,
+	reservationToken string,
+	eventID string,
+	userID string,
+) (*ReservationTokenResult, error) {
+	raw, err := le.redis.Get(ctx, ReservationTokenKey(eventID, reservationToken)).Bytes()
+	if err == redis.Nil {
+		return &ReservationTokenResult{Error: "NOT_FOUND"}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var data struct {
+		EventID string `json:"event_id"`
+		UserID  string `json:"user_id"`
+		Used    bool   `json:"used"`
+	}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("invalid reservation token data: %w", err)
+	}
+
+	switch {
+	case data.EventID != eventID:
+		return &ReservationTokenResult{Error: "EVENT_MISMATCH"}, nil
+	case data.UserID != userID:
+		return &ReservationTokenResult{Error: "USER_MISMATCH"}, nil
+	case data.Used:
+		return &ReservationTokenResult{Error: "ALREADY_USED"}, nil
+	}
+	return &ReservationTokenResult{Success: true}, nil
+}
+
+// RestoreReservationToken marks a reservation token consumed by attemptID unused
+// again so the user can retry within the remaining TTL, and holds the seats the
+// consumption reserved again. A token consumed by another attempt is left alone
+// (NOT_CONSUMER).
+func (le *LuaExecutor) RestoreReservationToken(ctx context.Context, eventID, reservationToken, attemptID string) (*ReservationTokenResult, error) {
+	result, err := le.restoreScript.Run(
+		ctx,
+		le.redis,
+		[]string{
+			ReservationTokenKey(eventID, reservationToken),
+			SeatStatusKey(eventID),
+			HoldOwnersKey(eventID),
+			HoldExpiryKey(eventID),
+			SeatChangesKey(eventID),
+			GrantsKey(eventID),
+			InventoryKey(eventID),
+		},
+		attemptID, reservationToken, seatHoldPrefix(eventID), userHoldsPrefix(eventID), seatChangesMaxLen,
+	).Result()
+
+	if err != nil {
+		le.logger.WithError(err).Error("Restore reservation token Lua script failed")
+		return nil, fmt.Errorf("lua script failed: %w", err)
+	}
+
+	return le.parseReservationTokenResult(result)
+}
+
+func (le *LuaExecutor) parseReservationTokenResult(result interface{}) (*ReservationTokenResult, error) {
+	success, errMsg, err := parseStatusResult(result)
+	if err != nil {
+		return nil, err
+	}
+	return &ReservationTokenResult{Success: success, Error: errMsg}, nil
+}
+
+// parseStatusResult parses the {status, data/error_msg} array returned by the scripts
+func parseStatusResult(result interface{}) (bool, string, error) {
+	resultArray, ok := result.([]interface{})
+	if !ok {
+		return false, "", fmt.Errorf("unexpected result type: %T", result)
+	}
+
+	if len(resultArray) < 2 {
+		return false, "", fmt.Errorf("invalid result array length: %d", len(resultArray))
+	}
+
+	status, ok := resultArray[0].(int64)
+	if !ok {
+		return false, "", fmt.Errorf("invalid status type: %T", resultArray[0])
+	}
+
+	if status == 0 {
+		errMsg, ok := resultArray[1].(string)
+		if !ok {
+			errMsg = fmt.Sprintf("%v", resultArray[1])
+		}
+		return false, errMsg, nil
+	}
+
+	return true, "", nil
+}
+
+// QueueJoin describes a waiting token joining an event queue
+type QueueJoin struct {
+	EventID      string
+	UserID       string
+	Lane         string // "" = default lane
+	Token        string
+	DedupeKey    string
+	Data         []byte        // queue:waiting payload; status and stream_id are set by the script
+	DataTTL      time.Duration // queue:waiting TTL for a queued token
+	HeartbeatTTL time.Duration
+	DedupeTTL    time.Duration
+	Lobby        bool          // Join the pre-sale lobby unless the event opened in the meantime
+	LobbyTTL     time.Duration // Lobby SET TTL
+	LobbyDataTTL time.Duration // queue:waiting TTL for a lobby token
+	RejoinMode   string        // RejoinKeepOldest or RejoinReplace; ignored for anonymous joins
+}
+
+// QueueJoinResult contains the result of an atomic queue join
+type QueueJoinResult struct {
+	StreamID string
+	Status   string // waiting|lobby
+	Error    string // DUPLICATE
+
+	// Set when the user's existing waiting token was kept instead of joining again
+	Existing     bool
+	Token        string // Existing waiting token
+	ExistingData []byte // Its queue data
+}
+
+// QueueTransitionResult contains the result of an atomic enter or leave
+type QueueTransitionResult struct {
+	Success bool
+	Error   string // NOT_FOUND|ALREADY_ENTERED|NOT_QUEUED
+}
+
+// JoinQueue atomically records a join: dedupe key, stream entry, queue data,
+// heartbeat and either the lane's queue position (scored by Redis TIME) or the lobby.
+// A user already holding a live waiting token gets it back (RejoinKeepOldest) or
+// has it replaced (RejoinReplace).
+func (le *LuaExecutor) JoinQueue(ctx context.Context, join *QueueJoin) (*QueueJoinResult, error) {
+	lobby := "0"
+	if join.Lobby {
+		lobby = "1"
+	}
+
+	rejoinMode := join.RejoinMode
+	if join.UserID == "" {
+		rejoinMode = ""
+	} else if rejoinMode == "" {
+		rejoinMode = RejoinKeepOldest
+	}
+
+	result, err := le.joinScript.Run(
+		ctx,
+		le.redis,
+		[]string{
+			join.DedupeKey,
+			UserStreamKey(join.EventID, join.UserID),
+			WaitingDataKey(join.EventID, join.Token),
+			HeartbeatKey(join.EventID, join.Token),
+			EventQueueKey(join.EventID, join.Lane),
+			PositionIndexKey(join.EventID, join.Lane),
+			LanesKey(join.EventID),
+			LaneLobbyKey(join.EventID, join.Lane),
+			lobbyOpenedKey(join.EventID),
+			LifecycleKey(join.EventID),
+			UserSlotKey(join.EventID, join.UserID),
+			WaveReadyKey(join.EventID),
+		},
+		join.Token, join.EventID, join.UserID, join.Lane, join.Data,
+		int(join.DataTTL.Seconds()), int(join.HeartbeatTTL.Seconds()), int(join.DedupeTTL.Seconds()),
+		lobby, int(join.LobbyTTL.Seconds()), int(join.LobbyDataTTL.Seconds()), lifecycleMaxLen,
+		rejoinMode, EventQueueKey(join.EventID, ""), PositionIndexKey(join.EventID, ""), LaneLobbyKey(join.EventID, ""),
+		WaitingDataKey(join.EventID, ""), HeartbeatKey(join.EventID, ""),
+	).Slice()
+
+	if err != nil {
+		le.logger.WithError(err).WithFields(logrus.Fields{
+			"event_id": join.EventID,
+			"user_id":  join.UserID,
+		}).Error("Queue join Lua script failed")
+		return nil, fmt.Errorf("lua script failed: %w", err)
+	}
+
+	if len(result) < 2 {
+		return nil, fmt.Errorf("invalid result array length: %d", len(result))
+	}
+
+	status, _ := result[0].(int64)
+	if status == 0 {
+		return &QueueJoinResult{Error: fmt.Sprintf("%v", result[1])}, nil
+	}
+
+	if len(result) < 3 {
+		return nil, fmt.Errorf("invalid result array length: %d", len(result))
+	}
+
+	if status == 2 {
+		token, _ := result[1].(string)
+		data, _ := result[2].(string)
+		return &QueueJoinResult{Existing: true, Token: token, ExistingData: []byte(data)}, nil
+	}
+
+	streamID, _ := result[1].(string)
+	joinStatus, _ := result[2].(string)
+	return &QueueJoinResult{
+		StreamID: streamID,
+		Status:   joinStatus,
+	}, nil
+}
+
+// EnterQueue atomically moves a waiting token to ready: stores the reservation
+// token, marks the queue data ready and removes the heartbeat and queue positions.
+// When the event has an inventory counter, outstanding reservation tokens are
+// capped at the remaining seats times oversellFactor.
+func (le *LuaExecutor) EnterQueue(
+	ctx context.Context,
+	eventID string,
+	lane string,
+	token string,
+	reservationToken string,
+	reservationData []byte,
+	reservationTTL time.Duration,
+	oversellFactor float64,
+) (*QueueTransitionResult, error) {
+	result, err := le.enterScript.Run(
+		ctx,
+		le.redis,
+		[]string{
+			WaitingDataKey(eventID, token),
+			HeartbeatKey(eventID, token),
+			EventQueueKey(eventID, lane),
+			PositionIndexKey(eventID, lane),
+			ReservationTokenKey(eventID, reservationToken),
+			WaveReadyKey(eventID),
+			InventoryKey(eventID),
+			GrantsKey(eventID),
+			LifecycleKey(eventID),
+		},
+		token, reservationData, int(reservationTTL.Seconds()), int(readyDataTTL.Seconds()),
+		reservationToken, oversellFactor, lifecycleMaxLen,
+	).Result()
+
+	if err != nil {
+		le.logger.WithError(err).WithField("event_id", eventID).Error("Queue enter Lua script failed")
+		return nil, fmt.Errorf("lua script failed: %w", err)
+	}
+
+	return le.parseTransitionResult(result)
+}
+
+// LeaveQueue atomically removes a waiting token: queue data, heartbeat, queue
+// positions, lobby membership, its stream entry and the user's slot. reason is the lifecycle
+// event recorded: LifecycleLeft or LifecycleHeartbeatExpired.
+func (le *LuaExecutor) LeaveQueue(ctx context.Context, eventID, lane, userID, token, reason string) (*QueueTransitionResult, error) {
+	result, err := le.leaveScript.Run(
+		ctx,
+		le.redis,
+		[]string{
+			WaitingDataKey(eventID, token),
+			HeartbeatKey(eventID, token),
+			EventQueueKey(eventID, lane),
+			PositionIndexKey(eventID, lane),
+			LaneLobbyKey(eventID, lane),
+			UserStreamKey(eventID, userID),
+			WaveReadyKey(eventID),
+			LifecycleKey(eventID),
+			UserSlotKey(eventID, userID),
+		},
+		token, reason, userID, lane, lifecycleMaxLen,
+	).Result()
+
+	if err != nil {
+		le.logger.WithError(err).WithField("event_id", eventID).Error("Queue leave Lua script failed")
+		return nil, fmt.Errorf("lua script failed: %w", err)
+	}
+
+	return le.parseTransitionResult(result)
+}
+
+// RecordEligible records the first time a waiting token became eligible for
+// Enter as a lifecycle event. Later calls for the same token record nothing.
+func (le *LuaExecutor) RecordEligible(ctx context.Context, eventID, lane, userID, token string) error {
+	err := le.eligibleScript.Run(
+		ctx,
+		le.redis,
+		[]string{eligibleMarkerKey(eventID, token), LifecycleKey(eventID)},
+		token, userID, lane, int(eligibleMarkerTTL.Seconds()), lifecycleMaxLen,
+	).Err()
+
+	if err != nil {
+		return fmt.Errorf("lua script failed: %w", err)
+	}
+	return nil
+}
+
+// UpgradeIdentity hands the waiting token an anonymous identity holds in an
+// event over to userID: queue data, join stream entry, user slot and a
+// reservation token already granted. When userID is still waiting with another
+// token, rejoinMode decides which of the two stays, as on join. Returns the
+// token, or "" if there was none or it was the one removed.
+func (le *LuaExecutor) UpgradeIdentity(ctx context.Context, eventID, anonymousID, userID, rejoinMode string) (string, error) {
+	if rejoinMode == "" {
+		rejoinMode = RejoinKeepOldest
+	}
+
+	result, err := le.upgradeScript.Run(
+		ctx,
+		le.redis,
+		[]string{
+			UserSlotKey(eventID, anonymousID),
+			UserSlotKey(eventID, userID),
+			UserStreamKey(eventID, anonymousID),
+			UserStreamKey(eventID, userID),
+			LifecycleKey(eventID),
+			WaveReadyKey(eventID),
+		},
+		WaitingDataKey(eventID, ""), anonymousID, userID, lifecycleMaxLen, ReservationTokenKey(eventID, ""),
+		rejoinMode, HeartbeatKey(eventID, ""), EventQueueKey(eventID, ""), PositionIndexKey(eventID, ""), LaneLobbyKey(eventID, ""),
+	).Slice()
+
+	if err != nil {
+		return "", fmt.Errorf("lua script failed: %w", err)
+	}
+	if len(result) < 2 {
+		return "", nil
+	}
+	token, _ := result[1].(string)
+	return token, nil
+}
+
+// UpgradeSession upgrades an anonymous identity in every event it joined (see
+// SessionEventsKey), with the rejoin mode of each event's policy. Returns the
+// number of waiting tokens handed over.
+func (le *LuaExecutor) UpgradeSession(ctx context.Context, policies *PolicyStore, anonymousID, userID string) (int, error) {
+	key := SessionEventsKey(anonymousID)
+	eventIDs, err := le.redis.SMembers(ctx, key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list session events: %w", err)
+	}
+
+	upgraded := 0
+	for _, eventID := range eventIDs {
+		policy, err := policies.Get(ctx, eventID)
+		if err != nil {
+			le.logger.WithError(err).WithField("event_id", eventID).Warn("Failed to load queue policy, using defaults")
+		}
+		token, err := le.UpgradeIdentity(ctx, eventID, anonymousID, userID, policy.RejoinMode)
+		if err != nil {
+			return upgraded, err
+		}
+		if token != "" {
+			upgraded++
+		}
+	}
+
+	if err := le.redis.Del(ctx, key).Err(); err != nil {
+		return upgraded, fmt.Errorf("failed to clear session events: %w", err)
+	}
+	return upgraded, nil
+}
+
+func (le *LuaExecutor) parseTransitionResult(result interface{}) (*QueueTransitionResult, error) {
+	success, errMsg, err := parseStatusResult(result)
+	if err != nil {
+		return nil, err
+	}
+	return &QueueTransitionResult{Success: success, Error: errMsg}, nil
+}
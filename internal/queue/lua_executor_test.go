@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"sync"
 	"testing"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/testutil"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
@@ -157,9 +160,10 @@ func TestLuaExecutor_HoldSeatAtomic(t *testing.T) {
 	executor := NewLuaExecutor(redisClient, logger)
 	ctx := context.Background()
 
-	seatStatusKey := "seat:status:test-concert"
-	holdKey := "hold:seat:A-12"
-	inventoryKey := "inventory:test-concert"
+	eventID := "test-concert"
+	seatStatusKey := SeatStatusKey(eventID)
+	holdKey := SeatHoldKey(eventID, "A-12")
+	inventoryKey := InventoryKey(eventID)
 	seatID := "A-12"
 
 	// Setup: Set initial inventory and seat status
@@ -168,18 +172,19 @@ func TestLuaExecutor_HoldSeatAtomic(t *testing.T) {
 
 	// Cleanup
 	defer func() {
-		redisClient.Del(ctx, seatStatusKey, holdKey, inventoryKey)
+		redisClient.Del(ctx, seatStatusKey, holdKey, inventoryKey, HoldOwnersKey(eventID), HoldExpiryKey(eventID),
+			UserHoldsKey(eventID, "user-123"), UserHoldsKey(eventID, "user-456"))
+		redisClient.ZRem(ctx, HoldEventsKey, eventID)
 	}()
 
 	// Test 1: Hold available seat
 	result1, err := executor.HoldSeatAtomic(
 		ctx,
-		seatStatusKey,
-		holdKey,
-		inventoryKey,
+		eventID,
 		seatID,
 		"user-123",
 		60, // 1 min TTL
+		4,
 	)
 
 	require.NoError(t, err)
@@ -192,12 +197,11 @@ func TestLuaExecutor_HoldSeatAtomic(t *testing.T) {
 	// Test 2: Try to hold same seat again (should fail)
 	result2, err := executor.HoldSeatAtomic(
 		ctx,
-		seatStatusKey,
-		holdKey,
-		inventoryKey,
+		eventID,
 		seatID,
 		"user-456",
 		60,
+		4,
 	)
 
 	require.NoError(t, err)
@@ -222,9 +226,10 @@ func TestLuaExecutor_ReleaseSeatAtomic(t *testing.T) {
 	executor := NewLuaExecutor(redisClient, logger)
 	ctx := context.Background()
 
-	seatStatusKey := "seat:status:test-concert-2"
-	holdKey := "hold:seat:B-23"
-	inventoryKey := "inventory:test-concert-2"
+	eventID := "test-concert-2"
+	seatStatusKey := SeatStatusKey(eventID)
+	holdKey := SeatHoldKey(eventID, "B-23")
+	inventoryKey := InventoryKey(eventID)
 	seatID := "B-23"
 
 	// Setup: Hold a seat first
@@ -237,13 +242,18 @@ func TestLuaExecutor_ReleaseSeatAtomic(t *testing.T) {
 		redisClient.Del(ctx, seatStatusKey, holdKey, inventoryKey)
 	}()
 
+	// Another user cannot release it
+	result, err := executor.ReleaseSeatAtomic(ctx, eventID, seatID, "user-456")
+	require.NoError(t, err)
+	assert.False(t, result.Success)
+	assert.Equal(t, "NOT_HOLDER", result.Error)
+
 	// Test: Release held seat
-	result, err := executor.ReleaseSeatAtomic(
+	result, err = executor.ReleaseSeatAtomic(
 		ctx,
-		seatStatusKey,
-		holdKey,
-		inventoryKey,
+		eventID,
 		seatID,
+		"user-123",
 	)
 
 	require.NoError(t, err)
@@ -272,8 +282,9 @@ func TestLuaExecutor_SoldOut(t *testing.T) {
 	executor := NewLuaExecutor(redisClient, logger)
 	ctx := context.Background()
 
-	seatStatusKey := "seat:status:soldout-test"
-	inventoryKey := "inventory:soldout-test"
+	eventID := "soldout-test"
+	seatStatusKey := SeatStatusKey(eventID)
+	inventoryKey := InventoryKey(eventID)
 
 	// Setup: Set inventory to 0 (sold out)
 	redisClient.Set(ctx, inventoryKey, 0, 0)
@@ -287,12 +298,11 @@ func TestLuaExecutor_SoldOut(t *testing.T) {
 	// Test: Try to hold when sold out
 	result, err := executor.HoldSeatAtomic(
 		ctx,
-		seatStatusKey,
-		"hold:seat:C-1",
-		inventoryKey,
+		eventID,
 		"C-1",
 		"user-789",
 		60,
+		4,
 	)
 
 	require.NoError(t, err)
@@ -339,3 +349,446 @@ func BenchmarkLuaExecutor_EnqueueAtomic(b *testing.B) {
 		)
 	}
 }
+
+func TestLuaExecutor_ReservationToken(t *testing.T) {
+	redisClient := testutil.NewRedisClient(t)
+
+	logger := logrus.New()
+	executor := NewLuaExecutor(redisClient, logger)
+	ctx := context.Background()
+
+	token := "test-reservation-token"
+	key := ReservationTokenKey("evt-1", token)
+	defer redisClient.Del(ctx, key)
+
+	require.NoError(t, redisClient.Set(ctx, key,
+		`{"event_id":"evt-1","user_id":"user1","waiting_token":"wt","granted_at":"2025-01-01T00:00:00Z"}`,
+		30*time.Second).Err())
+
+	// Wrong event or user is rejected without consuming
+	result, err := executor.ConsumeReservationToken(ctx, token, "evt-2", "user1", "attempt-1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "NOT_FOUND", result.Error, "Reservation tokens are keyed by event")
+
+	result, err = executor.ConsumeReservationToken(ctx, token, "evt-1", "user2", "attempt-1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "USER_MISMATCH", result.Error)
+
+	// Restoring an unused token does nothing
+	result, err = executor.RestoreReservationToken(ctx, "evt-1", token, "attempt-1")
+	require.NoError(t, err)
+	assert.Equal(t, "NOT_CONSUMER", result.Error)
+
+	// First consume succeeds, second is rejected
+	result, err = executor.ConsumeReservationToken(ctx, token, "evt-1", "user1", "attempt-1", nil)
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+
+	result, err = executor.ConsumeReservationToken(ctx, token, "evt-1", "user1", "attempt-2", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "ALREADY_USED", result.Error)
+
+	ttl, err := redisClient.TTL(ctx, key).Result()
+	require.NoError(t, err)
+	assert.Greater(t, ttl, time.Duration(0), "Consuming must keep the TTL")
+
+	// Only the consuming attempt restores the token, which allows a retry
+	result, err = executor.RestoreReservationToken(ctx, "evt-1", token, "attempt-2")
+	require.NoError(t, err)
+	assert.Equal(t, "NOT_CONSUMER", result.Error)
+
+	result, err = executor.RestoreReservationToken(ctx, "evt-1", token, "attempt-1")
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+
+	result, err = executor.ConsumeReservationToken(ctx, token, "evt-1", "user1", "attempt-3", nil)
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+
+	// A late restore by the earlier attempt does not re-arm the retry's token
+	result, err = executor.RestoreReservationToken(ctx, "evt-1", token, "attempt-1")
+	require.NoError(t, err)
+	assert.Equal(t, "NOT_CONSUMER", result.Error)
+
+	result, err = executor.ConsumeReservationToken(ctx, token, "evt-1", "user1", "attempt-4", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "ALREADY_USED", result.Error)
+
+	// Missing tokens
+	result, err = executor.ConsumeReservationToken(ctx, "missing-token", "evt-1", "user1", "attempt-5", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "NOT_FOUND", result.Error)
+}
+
+func TestLuaExecutor_QueueTransitions(t *testing.T) {
+	redisClient := testutil.NewRedisClient(t)
+
+	executor := NewLuaExecutor(redisClient, logrus.New())
+	ctx := context.Background()
+	eventID := "test-transitions-evt"
+
+	cleanup := func() {
+		keys := []string{
+			EventQueueKey(eventID, ""), PositionIndexKey(eventID, ""),
+			EventQueueKey(eventID, "fanclub"), PositionIndexKey(eventID, "fanclub"),
+			LanesKey(eventID), LaneLobbyKey(eventID, ""), lobbyOpenedKey(eventID),
+			UserStreamKey(eventID, "user1"), UserStreamKey(eventID, "user2"),
+			"dedupe:{" + eventID + "}:a", "dedupe:{" + eventID + "}:b", "dedupe:{" + eventID + "}:c",
+			ReservationTokenKey(eventID, "rt-1"), GrantsKey(eventID),
+			UserSlotKey(eventID, "user1"), UserSlotKey(eventID, "user2"),
+		}
+		for _, token := range []string{"wt-1", "wt-2", "wt-3"} {
+			keys = append(keys, WaitingDataKey(eventID, token), HeartbeatKey(eventID, token))
+		}
+		redisClient.Del(ctx, keys...)
+	}
+	cleanup()
+	defer cleanup()
+
+	join := func(token, userID, lane, dedupe string, lobby bool) *QueueJoinResult {
+		result, err := executor.JoinQueue(ctx, &QueueJoin{
+			EventID:      eventID,
+			UserID:       userID,
+			Lane:         lane,
+			Token:        token,
+			DedupeKey:    "dedupe:{" + eventID + "}:" + dedupe,
+			Data:         []byte(`{"event_id":"` + eventID + `","user_id":"` + userID + `","status":"waiting"}`),
+			DataTTL:      30 * time.Minute,
+			HeartbeatTTL: 5 * time.Minute,
+			DedupeTTL:    5 * time.Minute,
+			Lobby:        lobby,
+			LobbyTTL:     time.Hour,
+			LobbyDataTTL: time.Hour,
+		})
+		require.NoError(t, err)
+		return result
+	}
+
+	// Join writes every key in one step
+	joined := join("wt-1", "user1", "fanclub", "a", false)
+	assert.Equal(t, "waiting", joined.Status)
+	assert.NotEmpty(t, joined.StreamID)
+
+	data, err := redisClient.Get(ctx, WaitingDataKey(eventID, "wt-1")).Result()
+	require.NoError(t, err)
+	assert.Contains(t, data, `"stream_id":"`+joined.StreamID+`"`)
+
+	score, err := redisClient.ZScore(ctx, EventQueueKey(eventID, "fanclub"), "wt-1").Result()
+	require.NoError(t, err)
+	assert.InDelta(t, float64(time.Now().Unix()), score, 5, "Scored by server TIME")
+	assert.NotEqual(t, float64(int64(score)), score, "Scores carry microseconds")
+
+	lanes, err := redisClient.SMembers(ctx, LanesKey(eventID)).Result()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"fanclub"}, lanes)
+
+	exists, err := redisClient.Exists(ctx, HeartbeatKey(eventID, "wt-1"), PositionIndexKey(eventID, "fanclub")).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), exists)
+
+	assert.Equal(t, "DUPLICATE", join("wt-x", "user3", "fanclub", "a", false).Error)
+
+	// Enter moves the token to ready
+	entered, err := executor.EnterQueue(ctx, eventID, "fanclub", "wt-1", "rt-1", []byte(`{"event_id":"`+eventID+`","user_id":"user1"}`), 30*time.Second, 1.0)
+	require.NoError(t, err)
+	assert.True(t, entered.Success)
+
+	data, err = redisClient.Get(ctx, WaitingDataKey(eventID, "wt-1")).Result()
+	require.NoError(t, err)
+	assert.Contains(t, data, `"status":"ready"`)
+
+	exists, err = redisClient.Exists(ctx, HeartbeatKey(eventID, "wt-1")).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), exists)
+
+	_, err = redisClient.ZScore(ctx, PositionIndexKey(eventID, "fanclub"), "wt-1").Result()
+	assert.Equal(t, redis.Nil, err, "Admitted tokens leave position_index")
+
+	consumed, err := executor.ConsumeReservationToken(ctx, "rt-1", eventID, "user1", "attempt-1", nil)
+	require.NoError(t, err)
+	assert.True(t, consumed.Success)
+
+	entered, err = executor.EnterQueue(ctx, eventID, "fanclub", "wt-1", "rt-2", []byte(`{}`), 30*time.Second, 1.0)
+	require.NoError(t, err)
+	assert.Equal(t, "ALREADY_ENTERED", entered.Error)
+
+	entered, err = executor.EnterQueue(ctx, eventID, "", "wt-missing", "rt-3", []byte(`{}`), 30*time.Second, 1.0)
+	require.NoError(t, err)
+	assert.Equal(t, "NOT_FOUND", entered.Error)
+
+	// Leave removes the token and its stream entry
+	joined = join("wt-2", "user2", "", "b", false)
+	left, err := executor.LeaveQueue(ctx, eventID, "", "user2", "wt-2", LifecycleLeft)
+	require.NoError(t, err)
+	assert.True(t, left.Success)
+
+	exists, err = redisClient.Exists(ctx, WaitingDataKey(eventID, "wt-2"), HeartbeatKey(eventID, "wt-2")).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), exists)
+
+	entries, err := redisClient.XRange(ctx, UserStreamKey(eventID, "user2"), "-", "+").Result()
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	_, err = redisClient.ZScore(ctx, EventQueueKey(eventID, ""), "wt-2").Result()
+	assert.Equal(t, redis.Nil, err)
+
+	// Enter after leave is rejected
+	entered, err = executor.EnterQueue(ctx, eventID, "", "wt-2", "rt-4", []byte(`{}`), 30*time.Second, 1.0)
+	require.NoError(t, err)
+	assert.Equal(t, "NOT_FOUND", entered.Error)
+
+	// Lobby joins skip the queue until the event opens
+	joined = join("wt-3", "user2", "", "c", true)
+	assert.Equal(t, "lobby", joined.Status)
+	isMember, err := redisClient.SIsMember(ctx, LaneLobbyKey(eventID, ""), "wt-3").Result()
+	require.NoError(t, err)
+	assert.True(t, isMember)
+	_, err = redisClient.ZScore(ctx, EventQueueKey(eventID, ""), "wt-3").Result()
+	assert.Equal(t, redis.Nil, err)
+}
+
+func TestLuaExecutor_JoinRejoin(t *testing.T) {
+	redisClient := testutil.NewRedisClient(t)
+
+	executor := NewLuaExecutor(redisClient, logrus.New())
+	ctx := context.Background()
+	eventID := "test-rejoin-evt"
+	tokens := []string{"wt-1", "wt-2", "wt-3", "wt-4", "wt-other"}
+
+	cleanup := func() {
+		keys := []string{
+			EventQueueKey(eventID, ""), PositionIndexKey(eventID, ""), LifecycleKey(eventID),
+			UserStreamKey(eventID, "user1"), UserStreamKey(eventID, "user2"),
+			UserSlotKey(eventID, "user1"), UserSlotKey(eventID, "user2"),
+		}
+		for _, token := range tokens {
+			keys = append(keys, WaitingDataKey(eventID, token), HeartbeatKey(eventID, token), "dedupe:{"+eventID+"}:"+token)
+		}
+		redisClient.Del(ctx, keys...)
+	}
+	cleanup()
+	defer cleanup()
+
+	join := func(token, userID, mode string) *QueueJoinResult {
+		result, err := executor.JoinQueue(ctx, &QueueJoin{
+			EventID:      eventID,
+			UserID:       userID,
+			Token:        token,
+			DedupeKey:    "dedupe:{" + eventID + "}:" + token,
+			Data:         []byte(`{"event_id":"` + eventID + `","user_id":"` + userID + `","status":"waiting"}`),
+			DataTTL:      30 * time.Minute,
+			HeartbeatTTL: 5 * time.Minute,
+			DedupeTTL:    5 * time.Minute,
+			RejoinMode:   mode,
+		})
+		require.NoError(t, err)
+		return result
+	}
+
+	assert.False(t, join("wt-1", "user1", RejoinKeepOldest).Existing)
+	assert.False(t, join("wt-other", "user2", RejoinKeepOldest).Existing)
+
+	// keep_oldest: the second tab gets the first token back, queued once
+	again := join("wt-2", "user1", RejoinKeepOldest)
+	require.True(t, again.Existing)
+	assert.Equal(t, "wt-1", again.Token)
+	assert.Contains(t, string(again.ExistingData), `"status":"waiting"`)
+
+	members, err := redisClient.ZRange(ctx, EventQueueKey(eventID, ""), 0, -1).Result()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"wt-1", "wt-other"}, members)
+
+	// replace: the old token leaves and the user joins at the back
+	replaced := join("wt-3", "user1", RejoinReplace)
+	require.False(t, replaced.Existing)
+	assert.Equal(t, "waiting", replaced.Status)
+
+	members, err = redisClient.ZRange(ctx, EventQueueKey(eventID, ""), 0, -1).Result()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"wt-other", "wt-3"}, members)
+	exists, err := redisClient.Exists(ctx, WaitingDataKey(eventID, "wt-1"), HeartbeatKey(eventID, "wt-1")).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), exists)
+
+	// An abandoned slot token (heartbeat expired) does not block a new join
+	require.NoError(t, redisClient.Del(ctx, HeartbeatKey(eventID, "wt-3")).Err())
+	fresh := join("wt-4", "user1", RejoinKeepOldest)
+	require.False(t, fresh.Existing)
+	slot, err := redisClient.Get(ctx, UserSlotKey(eventID, "user1")).Result()
+	require.NoError(t, err)
+	assert.Equal(t, "wt-4", slot)
+
+	// Leave frees the slot
+	_, err = executor.LeaveQueue(ctx, eventID, "", "user1", "wt-4", LifecycleLeft)
+	require.NoError(t, err)
+	_, err = redisClient.Get(ctx, UserSlotKey(eventID, "user1")).Result()
+	assert.Equal(t, redis.Nil, err)
+}
+
+func TestLuaExecutor_UpgradeSession(t *testing.T) {
+	redisClient := testutil.NewRedisClient(t)
+
+	executor := NewLuaExecutor(redisClient, logrus.New())
+	ctx := context.Background()
+	eventID := "test-upgrade-evt"
+	anonymousID := "anon:session1"
+	userID := "user1"
+
+	cleanup := func() {
+		redisClient.Del(ctx,
+			EventQueueKey(eventID, ""), PositionIndexKey(eventID, ""), LifecycleKey(eventID), GrantsKey(eventID),
+			WaitingDataKey(eventID, "wt-1"), HeartbeatKey(eventID, "wt-1"), "dedupe:{"+eventID+"}:wt-1",
+			UserStreamKey(eventID, anonymousID), UserStreamKey(eventID, userID),
+			UserSlotKey(eventID, anonymousID), UserSlotKey(eventID, userID),
+			ReservationTokenKey(eventID, "rt-1"), SessionEventsKey(anonymousID),
+		)
+	}
+	cleanup()
+	defer cleanup()
+
+	_, err := executor.JoinQueue(ctx, &QueueJoin{
+		EventID:      eventID,
+		UserID:       anonymousID,
+		Token:        "wt-1",
+		DedupeKey:    "dedupe:{" + eventID + "}:wt-1",
+		Data:         []byte(`{"event_id":"` + eventID + `","user_id":"` + anonymousID + `","status":"waiting"}`),
+		DataTTL:      30 * time.Minute,
+		HeartbeatTTL: 5 * time.Minute,
+		DedupeTTL:    5 * time.Minute,
+	})
+	require.NoError(t, err)
+	require.NoError(t, redisClient.SAdd(ctx, SessionEventsKey(anonymousID), eventID).Err())
+
+	// Admitted while anonymous: the reservation token moves with the waiting token
+	entered, err := executor.EnterQueue(ctx, eventID, "", "wt-1", "rt-1",
+		[]byte(`{"event_id":"`+eventID+`","user_id":"`+anonymousID+`"}`), 30*time.Second, 1.0)
+	require.NoError(t, err)
+	require.True(t, entered.Success)
+
+	upgraded, err := executor.UpgradeSession(ctx, NewPolicyStore(redisClient, logrus.New()), anonymousID, userID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, upgraded)
+
+	data, err := redisClient.Get(ctx, WaitingDataKey(eventID, "wt-1")).Result()
+	require.NoError(t, err)
+	assert.Contains(t, data, `"user_id":"user1"`)
+
+	slot, err := redisClient.Get(ctx, UserSlotKey(eventID, userID)).Result()
+	require.NoError(t, err)
+	assert.Equal(t, "wt-1", slot)
+
+	anonymousEntries, err := redisClient.XLen(ctx, UserStreamKey(eventID, anonymousID)).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), anonymousEntries)
+	userEntries, err := redisClient.XRange(ctx, UserStreamKey(eventID, userID), "-", "+").Result()
+	require.NoError(t, err)
+	require.Len(t, userEntries, 1)
+	assert.Equal(t, "wt-1", userEntries[0].Values["token"])
+
+	consumed, err := executor.ConsumeReservationToken(ctx, "rt-1", eventID, userID, "attempt-1", nil)
+	require.NoError(t, err)
+	assert.True(t, consumed.Success)
+
+	assert.Equal(t, LifecycleIdentityUpgraded, lifecycleTypes(t, redisClient, eventID)[2])
+
+	// A second login has nothing left to hand over
+	upgraded, err = executor.UpgradeSession(ctx, NewPolicyStore(redisClient, logrus.New()), anonymousID, userID)
+	require.NoError(t, err)
+	assert.Equal(t, 0, upgraded)
+}
+
+func TestLuaExecutor_UpgradeSessionKeepsOneSlot(t *testing.T) {
+	redisClient := testutil.NewRedisClient(t)
+
+	executor := NewLuaExecutor(redisClient, logrus.New())
+	policies := NewPolicyStore(redisClient, logrus.New())
+	ctx := context.Background()
+	userID := "user1"
+
+	join := func(eventID, identity, token string) {
+		_, err := executor.JoinQueue(ctx, &QueueJoin{
+			EventID:      eventID,
+			UserID:       identity,
+			Token:        token,
+			DedupeKey:    "dedupe:{" + eventID + "}:" + token,
+			Data:         []byte(`{"event_id":"` + eventID + `","user_id":"` + identity + `","status":"waiting"}`),
+			DataTTL:      30 * time.Minute,
+			HeartbeatTTL: 5 * time.Minute,
+			DedupeTTL:    5 * time.Minute,
+		})
+		require.NoError(t, err)
+		require.NoError(t, redisClient.SAdd(ctx, SessionEventsKey(identity), eventID).Err())
+		time.Sleep(2 * time.Millisecond) // Distinct join stream IDs
+	}
+	cleanup := func(eventID string, anonymousIDs ...string) {
+		keys, _ := redisClient.Keys(ctx, "*{"+eventID+"}*").Result()
+		if len(keys) > 0 {
+			redisClient.Del(ctx, keys...)
+		}
+		for _, anonymousID := range anonymousIDs {
+			redisClient.Del(ctx, SessionEventsKey(anonymousID))
+		}
+	}
+
+	// keep_oldest: a token joined anonymously after the user's leaves on login
+	keepEvent := "test-upgrade-keep-evt"
+	cleanup(keepEvent, "anon:s1", "anon:s2")
+	defer cleanup(keepEvent, "anon:s1", "anon:s2")
+
+	join(keepEvent, userID, "wt-user")
+	join(keepEvent, "anon:s1", "wt-s1")
+	join(keepEvent, "anon:s2", "wt-s2")
+
+	for _, anonymousID := range []string{"anon:s1", "anon:s2"} {
+		upgraded, err := executor.UpgradeSession(ctx, policies, anonymousID, userID)
+		require.NoError(t, err)
+		assert.Equal(t, 0, upgraded, "The newer anonymous token is not handed over")
+	}
+
+	slot, err := redisClient.Get(ctx, UserSlotKey(keepEvent, userID)).Result()
+	require.NoError(t, err)
+	assert.Equal(t, "wt-user", slot)
+	queued, err := redisClient.ZRange(ctx, EventQueueKey(keepEvent, ""), 0, -1).Result()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"wt-user"}, queued, "One account keeps one position")
+	exists, err := redisClient.Exists(ctx, WaitingDataKey(keepEvent, "wt-s1"), WaitingDataKey(keepEvent, "wt-s2")).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), exists)
+
+	messages, err := redisClient.XRange(ctx, LifecycleKey(keepEvent), "-", "+").Result()
+	require.NoError(t, err)
+	replaced := 0
+	for _, message := range messages {
+		if message.Values["type"] == LifecycleLeft && message.Values["reason"] == "replaced" {
+			replaced++
+		}
+	}
+	assert.Equal(t, 2, replaced)
+
+	// replace: the newer anonymous token takes the place of the user's older one
+	replaceEvent := "test-upgrade-replace-evt"
+	cleanup(replaceEvent, "anon:s3")
+	defer cleanup(replaceEvent, "anon:s3")
+	policy := DefaultQueuePolicy(replaceEvent)
+	policy.RejoinMode = RejoinReplace
+	require.NoError(t, policies.Set(ctx, policy))
+
+	join(replaceEvent, userID, "wt-user")
+	join(replaceEvent, "anon:s3", "wt-s3")
+
+	upgraded, err := executor.UpgradeSession(ctx, policies, "anon:s3", userID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, upgraded)
+
+	slot, err = redisClient.Get(ctx, UserSlotKey(replaceEvent, userID)).Result()
+	require.NoError(t, err)
+	assert.Equal(t, "wt-s3", slot)
+	queued, err = redisClient.ZRange(ctx, EventQueueKey(replaceEvent, ""), 0, -1).Result()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"wt-s3"}, queued)
+	entries, err := redisClient.XRange(ctx, UserStreamKey(replaceEvent, userID), "-", "+").Result()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "wt-s3", entries[0].Values["token"])
+}
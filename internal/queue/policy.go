@@ -0,0 +1,296 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// policyCacheTTL bounds how long a gateway instance keeps using a policy
+// after it was changed through the admin API on another instance
+const policyCacheTTL = 5 * time.Second
+
+// maxSeatHoldTTLSeconds keeps holds well inside the window the hold sweeper watches an event
+const maxSeatHoldTTLSeconds = 3600
+
+// Rejoin modes: what a repeat Join does while the user still holds a waiting slot
+const (
+	RejoinKeepOldest = "keep_oldest" // Return the existing waiting token and position
+	RejoinReplace    = "replace"     // Drop the existing token and join at the back
+)
+
+// WaitTier is a minimum wait applied to positions up to (and including) UpToPosition
+type WaitTier struct {
+	UpToPosition   int `json:"up_to_position"`
+	MinWaitSeconds int `json:"min_wait_sec"`
+}
+
+// QueuePolicy holds the per-event admission settings used by Join, Status and Enter
+type QueuePolicy struct {
+	EventID string `json:"event_id"`
+
+	// Scheduled opening: joins before OpensAt wait in a lobby that is shuffled
+	// into the queue at opening (nil = queue is open, FIFO from the first join)
+	OpensAt *time.Time `json:"opens_at,omitempty"`
+
+	// Eligibility
+	AdmissionWindow    int        `json:"admission_window"`     // Only the top N positions may enter
+	VIPBypassPositions int        `json:"vip_bypass_positions"` // Top N skip the token bucket (0 = disabled)
+	MinWaitTiers       []WaitTier `json:"min_wait_tiers"`       // Sorted by UpToPosition
+
+	// Priority lanes chosen from a JWT claim at Join (empty = single FIFO queue).
+	// Positions above are effective positions in the weighted, interleaved order.
+	Lanes []Lane `json:"lanes,omitempty"`
+
+	// Token bucket
+	BucketCapacity   int     `json:"bucket_capacity"`    // Maximum burst size
+	BucketRefillRate float64 `json:"bucket_refill_rate"` // Tokens per second
+
+	// Outstanding reservation tokens are capped at remaining inventory times this
+	// factor (only when an inventory counter exists for the event)
+	OversellFactor float64 `json:"oversell_factor"`
+
+	// Seat holds placed by admitted users before they reserve
+	SeatHoldTTLSeconds int `json:"seat_hold_ttl_sec"`  // Hold lifetime; lapsed holds are released by the sweeper
+	MaxHoldsPerUser    int `json:"max_holds_per_user"` // Live holds per user (0 = unlimited)
+
+	// One waiting slot per user: keep_oldest or replace
+	RejoinMode string `json:"rejoin_mode"`
+
+	// Wave admission replaces the window, wait tiers and token bucket with
+	// scheduled waves marked by the leader (nil = token bucket at Enter)
+	Wave *WavePolicy `json:"wave,omitempty"`
+
+	// TTLs
+	DedupeTTLSeconds      int `json:"dedupe_ttl_sec"`
+	HeartbeatTTLSeconds   int `json:"heartbeat_ttl_sec"`
+	ReservationTTLSeconds int `json:"reservation_ttl_sec"`
+
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+}
+
+// DefaultQueuePolicy returns the settings used when no policy is stored for an event
+func DefaultQueuePolicy(eventID string) *QueuePolicy {
+	return &QueuePolicy{
+		EventID:            eventID,
+		AdmissionWindow:    100,
+		VIPBypassPositions: 10,
+		MinWaitTiers: []WaitTier{
+			{UpToPosition: 10, MinWaitSeconds: 0}, // Top 10: immediate entry
+			{UpToPosition: 50, MinWaitSeconds: 2},
+			{UpToPosition: 100, MinWaitSeconds: 5},
+		},
+		BucketCapacity:        500,
+		BucketRefillRate:      50.0,
+		OversellFactor:        1.0,
+		SeatHoldTTLSeconds:    300,
+		MaxHoldsPerUser:       4,
+		RejoinMode:            RejoinKeepOldest,
+		DedupeTTLSeconds:      300,
+		HeartbeatTTLSeconds:   300,
+		ReservationTTLSeconds: 30,
+	}
+}
+
+// Validate checks that the policy values are usable and sorts the wait tiers
+func (p *QueuePolicy) Validate() error {
+	if p.EventID == "" {
+		return fmt.Errorf("event_id is required")
+	}
+	if p.AdmissionWindow < 1 {
+		return fmt.Errorf("admission_window must be at least 1")
+	}
+	if p.VIPBypassPositions < 0 || p.VIPBypassPositions > p.AdmissionWindow {
+		return fmt.Errorf("vip_bypass_positions must be between 0 and admission_window")
+	}
+	if p.BucketCapacity < 1 {
+		return fmt.Errorf("bucket_capacity must be at least 1")
+	}
+	if p.BucketRefillRate <= 0 {
+		return fmt.Errorf("bucket_refill_rate must be positive")
+	}
+	if p.OversellFactor < 1 {
+		return fmt.Errorf("oversell_factor must be at least 1")
+	}
+	if p.SeatHoldTTLSeconds < 1 || p.SeatHoldTTLSeconds > maxSeatHoldTTLSeconds {
+		return fmt.Errorf("seat_hold_ttl_sec must be between 1 and %d", maxSeatHoldTTLSeconds)
+	}
+	if p.MaxHoldsPerUser < 0 {
+		return fmt.Errorf("max_holds_per_user must be non-negative")
+	}
+	if p.RejoinMode != RejoinKeepOldest && p.RejoinMode != RejoinReplace {
+		return fmt.Errorf("rejoin_mode must be %q or %q", RejoinKeepOldest, RejoinReplace)
+	}
+	if p.DedupeTTLSeconds < 1 || p.HeartbeatTTLSeconds < 1 || p.ReservationTTLSeconds < 1 {
+		return fmt.Errorf("dedupe_ttl_sec, heartbeat_ttl_sec and reservation_ttl_sec must be at least 1")
+	}
+
+	if err := validateLanes(p.Lanes); err != nil {
+		return err
+	}
+	if p.Wave != nil {
+		if err := p.Wave.validate(); err != nil {
+			return err
+		}
+	}
+
+	sort.Slice(p.MinWaitTiers, func(i, j int) bool {
+		return p.MinWaitTiers[i].UpToPosition < p.MinWaitTiers[j].UpToPosition
+	})
+	for i, tier := range p.MinWaitTiers {
+		if tier.UpToPosition < 1 || tier.MinWaitSeconds < 0 {
+			return fmt.Errorf("min_wait_tiers[%d]: up_to_position must be at least 1 and min_wait_sec non-negative", i)
+		}
+		if i > 0 && tier.UpToPosition == p.MinWaitTiers[i-1].UpToPosition {
+			return fmt.Errorf("min_wait_tiers: duplicate up_to_position %d", tier.UpToPosition)
+		}
+	}
+
+	return nil
+}
+
+// MinWaitFor returns the minimum time a user at position must have waited before entering.
+// Positions beyond the last tier use the last tier's wait.
+func (p *QueuePolicy) MinWaitFor(position int) time.Duration {
+	if len(p.MinWaitTiers) == 0 {
+		return 0
+	}
+	for _, tier := range p.MinWaitTiers {
+		if position <= tier.UpToPosition {
+			return time.Duration(tier.MinWaitSeconds) * time.Second
+		}
+	}
+	return time.Duration(p.MinWaitTiers[len(p.MinWaitTiers)-1].MinWaitSeconds) * time.Second
+}
+
+// DedupeTTL returns the Join deduplication window
+func (p *QueuePolicy) DedupeTTL() time.Duration {
+	return time.Duration(p.DedupeTTLSeconds) * time.Second
+}
+
+// HeartbeatTTL returns how long a waiting token survives without a heartbeat
+func (p *QueuePolicy) HeartbeatTTL() time.Duration {
+	return time.Duration(p.HeartbeatTTLSeconds) * time.Second
+}
+
+// ConfiguredAdmissionRate returns the admissions per second the policy allows at
+// most: the wave size per interval, or the token bucket refill rate
+func (p *QueuePolicy) ConfiguredAdmissionRate() float64 {
+	if p.Wave != nil {
+		return float64(p.Wave.Size) / float64(p.Wave.IntervalSeconds)
+	}
+	return p.BucketRefillRate
+}
+
+// SeatHoldTTL returns how long a seat hold lasts before it is released
+func (p *QueuePolicy) SeatHoldTTL() time.Duration {
+	return time.Duration(p.SeatHoldTTLSeconds) * time.Second
+}
+
+// ReservationTTL returns the lifetime of a reservation token granted by Enter
+func (p *QueuePolicy) ReservationTTL() time.Duration {
+	return time.Duration(p.ReservationTTLSeconds) * time.Second
+}
+
+// PolicyStore loads and stores QueuePolicy documents in Redis with a short in-process cache
+type PolicyStore struct {
+	redisClient redis.UniversalClient
+	logger      *logrus.Logger
+	cache       *eventCache[*QueuePolicy]
+}
+
+// NewPolicyStore creates a new policy store
+func NewPolicyStore(redis redis.UniversalClient, logger *logrus.Logger) *PolicyStore {
+	return &PolicyStore{
+		redisClient: redis,
+		logger:      logger,
+		cache:       newEventCache[*QueuePolicy](policyCacheTTL, eventCacheMaxEntries),
+	}
+}
+
+func policyKey(eventID string) string {
+	return fmt.Sprintf("queue:policy:{%s}", eventID)
+}
+
+// Get returns the effective policy for an event, falling back to defaults
+// when none is stored. On Redis errors the defaults are returned with the error.
+// The returned policy is shared and must not be modified.
+func (s *PolicyStore) Get(ctx context.Context, eventID string) (*QueuePolicy, error) {
+	if policy, ok := s.cache.get(eventID); ok {
+		return policy, nil
+	}
+
+	policy, err := s.Load(ctx, eventID)
+	if err == redis.Nil {
+		policy = DefaultQueuePolicy(eventID)
+	} else if err != nil {
+		return DefaultQueuePolicy(eventID), err
+	}
+
+	s.cache.set(eventID, policy)
+
+	return policy, nil
+}
+
+// Load reads the stored policy for an event, bypassing the cache.
+// Returns redis.Nil when no policy is stored.
+func (s *PolicyStore) Load(ctx context.Context, eventID string) (*QueuePolicy, error) {
+	data, err := s.redisClient.Get(ctx, policyKey(eventID)).Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	policy := DefaultQueuePolicy(eventID)
+	if err := json.Unmarshal(data, policy); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal queue policy: %w", err)
+	}
+
+	return policy, nil
+}
+
+// Set validates and stores a policy
+func (s *PolicyStore) Set(ctx context.Context, policy *QueuePolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+
+	policy.UpdatedAt = time.Now().UTC()
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return fmt.Errorf("failed to marshal queue policy: %w", err)
+	}
+
+	if err := s.redisClient.Set(ctx, policyKey(policy.EventID), data, 0).Err(); err != nil {
+		return err
+	}
+
+	s.Invalidate(policy.EventID)
+
+	s.logger.WithFields(logrus.Fields{
+		"event_id": policy.EventID,
+		"policy":   string(data),
+	}).Info("Queue policy updated")
+
+	return nil
+}
+
+// Delete removes a stored policy so the event falls back to defaults
+func (s *PolicyStore) Delete(ctx context.Context, eventID string) error {
+	if err := s.redisClient.Del(ctx, policyKey(eventID)).Err(); err != nil {
+		return err
+	}
+
+	s.Invalidate(eventID)
+	s.logger.WithField("event_id", eventID).Info("Queue policy reset to defaults")
+	return nil
+}
+
+// Invalidate drops the cached policy for an event on this instance
+func (s *PolicyStore) Invalidate(eventID string) {
+	s.cache.delete(eventID)
+}
@@ -0,0 +1,100 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/testutil"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueuePolicy_MinWaitFor(t *testing.T) {
+	policy := DefaultQueuePolicy("evt")
+
+	assert.Equal(t, 0*time.Second, policy.MinWaitFor(1))
+	assert.Equal(t, 0*time.Second, policy.MinWaitFor(10))
+	assert.Equal(t, 2*time.Second, policy.MinWaitFor(11))
+	assert.Equal(t, 2*time.Second, policy.MinWaitFor(50))
+	assert.Equal(t, 5*time.Second, policy.MinWaitFor(51))
+	assert.Equal(t, 5*time.Second, policy.MinWaitFor(500), "Positions past the last tier use the last tier")
+
+	policy.MinWaitTiers = nil
+	assert.Equal(t, 0*time.Second, policy.MinWaitFor(42))
+}
+
+func TestQueuePolicy_Validate(t *testing.T) {
+	require.NoError(t, DefaultQueuePolicy("evt").Validate())
+
+	policy := DefaultQueuePolicy("evt")
+	policy.MinWaitTiers = []WaitTier{
+		{UpToPosition: 200, MinWaitSeconds: 10},
+		{UpToPosition: 20, MinWaitSeconds: 1},
+	}
+	require.NoError(t, policy.Validate())
+	assert.Equal(t, 20, policy.MinWaitTiers[0].UpToPosition, "Tiers should be sorted")
+
+	cases := map[string]func(p *QueuePolicy){
+		"missing event":       func(p *QueuePolicy) { p.EventID = "" },
+		"zero window":         func(p *QueuePolicy) { p.AdmissionWindow = 0 },
+		"vip beyond window":   func(p *QueuePolicy) { p.VIPBypassPositions = p.AdmissionWindow + 1 },
+		"zero capacity":       func(p *QueuePolicy) { p.BucketCapacity = 0 },
+		"zero refill":         func(p *QueuePolicy) { p.BucketRefillRate = 0 },
+		"zero heartbeat ttl":  func(p *QueuePolicy) { p.HeartbeatTTLSeconds = 0 },
+		"unknown rejoin mode": func(p *QueuePolicy) { p.RejoinMode = "newest" },
+		"negative tier wait":  func(p *QueuePolicy) { p.MinWaitTiers[0].MinWaitSeconds = -1 },
+		"duplicate tier edge": func(p *QueuePolicy) { p.MinWaitTiers[1].UpToPosition = p.MinWaitTiers[0].UpToPosition },
+	}
+	for name, mutate := range cases {
+		policy := DefaultQueuePolicy("evt")
+		mutate(policy)
+		assert.Error(t, policy.Validate(), name)
+	}
+}
+
+func TestPolicyStore_RoundTrip(t *testing.T) {
+	redisClient := testutil.NewRedisClient(t)
+
+	ctx := context.Background()
+	eventID := "test-policy-evt"
+	defer redisClient.Del(ctx, policyKey(eventID))
+
+	store := NewPolicyStore(redisClient, logrus.New())
+
+	// No policy stored: defaults
+	policy, err := store.Get(ctx, eventID)
+	require.NoError(t, err)
+	assert.Equal(t, 100, policy.AdmissionWindow)
+	assert.Equal(t, 500, policy.BucketCapacity)
+
+	// Store a custom policy
+	custom := DefaultQueuePolicy(eventID)
+	custom.AdmissionWindow = 1000
+	custom.VIPBypassPositions = 0
+	custom.ReservationTTLSeconds = 90
+	require.NoError(t, store.Set(ctx, custom))
+
+	policy, err = store.Get(ctx, eventID)
+	require.NoError(t, err)
+	assert.Equal(t, 1000, policy.AdmissionWindow)
+	assert.Equal(t, 0, policy.VIPBypassPositions, "Explicit zero must not fall back to the default")
+	assert.Equal(t, 90*time.Second, policy.ReservationTTL())
+
+	// Invalid policies are rejected
+	invalid := DefaultQueuePolicy(eventID)
+	invalid.BucketCapacity = 0
+	assert.Error(t, store.Set(ctx, invalid))
+
+	// Delete falls back to defaults
+	require.NoError(t, store.Delete(ctx, eventID))
+	_, err = store.Load(ctx, eventID)
+	assert.Equal(t, redis.Nil, err)
+
+	policy, err = store.Get(ctx, eventID)
+	require.NoError(t, err)
+	assert.Equal(t, 100, policy.AdmissionWindow)
+}
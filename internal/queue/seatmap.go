@@ -0,0 +1,159 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// seatChangesMaxLen approximately bounds the seat change stream; clients whose
+// cursor fell off the end reload the full map
+const seatChangesMaxLen = 10000
+
+// SeatChangesCursorStart is the cursor of a seat map loaded before any change was recorded
+const SeatChangesCursorStart = "0"
+
+// SeatChangesKey returns the stream the seat hold scripts append every status change to.
+// The event hash tag keeps it in the same slot as the seat status hash.
+func SeatChangesKey(eventID string) string {
+	return fmt.Sprintf("seat:changes:{%s}", eventID)
+}
+
+// SeatMap is a snapshot of an event's seat statuses
+type SeatMap struct {
+	Seats  map[string]string // Seat ID -> AVAILABLE/HOLD/...
+	Cursor string            // Last change included in the snapshot, for SeatChanges
+	ETag   string            // Strong ETag over the seat statuses
+}
+
+// SeatChange is one seat status change from the change stream
+type SeatChange struct {
+	Cursor string `json:"cursor"`
+	SeatID string `json:"seat_id"`
+	Status string `json:"status"`
+}
+
+// SeatChangeFeed is a page of seat changes after a cursor
+type SeatChangeFeed struct {
+	Changes []SeatChange
+	Cursor  string // Pass as since to read the next page
+	Reset   bool   // The cursor is older than the stream; reload the seat map
+}
+
+// LoadSeatMap reads an event's seat statuses together with the current change cursor
+func LoadSeatMap(ctx context.Context, redisClient redis.UniversalClient, eventID string) (*SeatMap, error) {
+	// Same slot, so MULTI keeps the snapshot and the cursor consistent
+	pipe := redisClient.TxPipeline()
+	seatsCmd := pipe.HGetAll(ctx, SeatStatusKey(eventID))
+	lastCmd := pipe.XRevRangeN(ctx, SeatChangesKey(eventID), "+", "-", 1)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	seatMap := &SeatMap{
+		Seats:  seatsCmd.Val(),
+		Cursor: SeatChangesCursorStart,
+	}
+	if last := lastCmd.Val(); len(last) > 0 {
+		seatMap.Cursor = last[0].ID
+	}
+	seatMap.ETag = seatMapETag(seatMap.Seats)
+
+	return seatMap, nil
+}
+
+// seatMapETag hashes the seat statuses in seat order, so instances agree on the
+// ETag and seats changed outside the hold scripts still change it
+func seatMapETag(seats map[string]string) string {
+	seatIDs := make([]string, 0, len(seats))
+	for seatID := range seats {
+		seatIDs = append(seatIDs, seatID)
+	}
+	sort.Strings(seatIDs)
+
+	hash := fnv.New64a()
+	for _, seatID := range seatIDs {
+		hash.Write([]byte(seatID))
+		hash.Write([]byte{0})
+		hash.Write([]byte(seats[seatID]))
+		hash.Write([]byte{0})
+	}
+	return `"` + strconv.FormatUint(hash.Sum64(), 16) + `"`
+}
+
+// ValidSeatChangesCursor reports whether since is a cursor returned by LoadSeatMap or SeatChanges
+func ValidSeatChangesCursor(since string) bool {
+	if since == SeatChangesCursorStart {
+		return true
+	}
+	ms, seq, ok := strings.Cut(since, "-")
+	if !ok {
+		return false
+	}
+	if _, err := strconv.ParseUint(ms, 10, 64); err != nil {
+		return false
+	}
+	_, err := strconv.ParseUint(seq, 10, 64)
+	return err == nil
+}
+
+// SeatChanges returns up to limit seat changes recorded after since
+func SeatChanges(ctx context.Context, redisClient redis.UniversalClient, eventID, since string, limit int64) (*SeatChangeFeed, error) {
+	key := SeatChangesKey(eventID)
+	feed := &SeatChangeFeed{Changes: []SeatChange{}, Cursor: since}
+
+	// Trimming removes the oldest entries first: if the cursor entry is gone,
+	// changes right after it may be gone too
+	if since == SeatChangesCursorStart {
+		trimmed, err := seatChangesTrimmed(ctx, redisClient, key)
+		if err != nil {
+			return nil, err
+		}
+		if trimmed {
+			feed.Reset = true
+			return feed, nil
+		}
+	} else {
+		cursorEntry, err := redisClient.XRange(ctx, key, since, since).Result()
+		if err != nil {
+			return nil, err
+		}
+		if len(cursorEntry) == 0 {
+			feed.Reset = true
+			return feed, nil
+		}
+	}
+
+	entries, err := redisClient.XRangeN(ctx, key, "("+since, "+", limit).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		seatID, _ := entry.Values["seat"].(string)
+		status, _ := entry.Values["status"].(string)
+		feed.Changes = append(feed.Changes, SeatChange{Cursor: entry.ID, SeatID: seatID, Status: status})
+		feed.Cursor = entry.ID
+	}
+
+	return feed, nil
+}
+
+// seatChangesTrimmed reports whether changes were removed from the start of
+// the stream, so reading it from SeatChangesCursorStart would miss some.
+// Redis before 7.0 does not report entries-added and is never seen as trimmed.
+func seatChangesTrimmed(ctx context.Context, redisClient redis.UniversalClient, key string) (bool, error) {
+	info, err := redisClient.XInfoStream(ctx, key).Result()
+	if err != nil {
+		if strings.Contains(err.Error(), "no such key") {
+			return false, nil
+		}
+		return false, err
+	}
+	return info.EntriesAdded > info.Length, nil
+}
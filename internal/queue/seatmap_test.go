@@ -0,0 +1,106 @@
+package queue
+
+import (
+	"context"
+	"testing"
+
+	"github.com/traffic-tacos/gateway-api/internal/testutil"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeatMap_ChangeFeed(t *testing.T) {
+	redisClient := testutil.NewRedisClient(t)
+
+	executor := NewLuaExecutor(redisClient, logrus.New())
+	ctx := context.Background()
+	eventID := "test-seat-map"
+	seats := []string{"A-1", "A-2"}
+
+	cleanup := func() {
+		cleanupSeatHolds(ctx, redisClient, eventID, seats, []string{"user-1"})
+		redisClient.Del(ctx, SeatChangesKey(eventID))
+	}
+	cleanup()
+	defer cleanup()
+
+	require.NoError(t, redisClient.Set(ctx, InventoryKey(eventID), 10, 0).Err())
+	require.NoError(t, redisClient.HSet(ctx, SeatStatusKey(eventID), "A-1", "AVAILABLE", "A-2", "AVAILABLE").Err())
+
+	initial, err := LoadSeatMap(ctx, redisClient, eventID)
+	require.NoError(t, err)
+	assert.Equal(t, SeatChangesCursorStart, initial.Cursor)
+	assert.Equal(t, map[string]string{"A-1": "AVAILABLE", "A-2": "AVAILABLE"}, initial.Seats)
+
+	// Nothing changed yet
+	feed, err := SeatChanges(ctx, redisClient, eventID, initial.Cursor, 100)
+	require.NoError(t, err)
+	assert.Empty(t, feed.Changes)
+	assert.Equal(t, initial.Cursor, feed.Cursor)
+
+	_, err = executor.HoldSeatAtomic(ctx, eventID, "A-1", "user-1", 60, 0)
+	require.NoError(t, err)
+	_, err = executor.HoldSeatAtomic(ctx, eventID, "A-2", "user-1", 60, 0)
+	require.NoError(t, err)
+
+	held, err := LoadSeatMap(ctx, redisClient, eventID)
+	require.NoError(t, err)
+	assert.NotEqual(t, initial.ETag, held.ETag)
+	assert.NotEqual(t, SeatChangesCursorStart, held.Cursor)
+
+	// Paging through the feed from the initial snapshot
+	feed, err = SeatChanges(ctx, redisClient, eventID, initial.Cursor, 1)
+	require.NoError(t, err)
+	require.Len(t, feed.Changes, 1)
+	assert.Equal(t, SeatChange{Cursor: feed.Cursor, SeatID: "A-1", Status: "HOLD"}, feed.Changes[0])
+
+	feed, err = SeatChanges(ctx, redisClient, eventID, feed.Cursor, 100)
+	require.NoError(t, err)
+	require.Len(t, feed.Changes, 1)
+	assert.Equal(t, "A-2", feed.Changes[0].SeatID)
+	assert.Equal(t, held.Cursor, feed.Cursor)
+
+	_, err = executor.ReleaseSeatAtomic(ctx, eventID, "A-1", "user-1")
+	require.NoError(t, err)
+
+	feed, err = SeatChanges(ctx, redisClient, eventID, held.Cursor, 100)
+	require.NoError(t, err)
+	require.Len(t, feed.Changes, 1)
+	assert.Equal(t, "AVAILABLE", feed.Changes[0].Status)
+
+	// Seats changed outside the scripts change the ETag too; equal statuses give equal ETags
+	released, err := LoadSeatMap(ctx, redisClient, eventID)
+	require.NoError(t, err)
+	require.NoError(t, redisClient.HSet(ctx, SeatStatusKey(eventID), "A-2", "AVAILABLE").Err())
+	again, err := LoadSeatMap(ctx, redisClient, eventID)
+	require.NoError(t, err)
+	assert.NotEqual(t, released.ETag, again.ETag)
+	assert.Equal(t, initial.ETag, again.ETag)
+
+	// A cursor trimmed off the stream asks for a reload
+	require.NoError(t, redisClient.XTrimMaxLen(ctx, SeatChangesKey(eventID), 1).Err())
+	feed, err = SeatChanges(ctx, redisClient, eventID, held.Cursor, 100)
+	require.NoError(t, err)
+	assert.True(t, feed.Reset)
+
+	// So does the start cursor, whose first changes were trimmed too (Redis
+	// before 7.0 does not report the entries added to a stream)
+	info, err := redisClient.XInfoStream(ctx, SeatChangesKey(eventID)).Result()
+	require.NoError(t, err)
+	if info.EntriesAdded > 0 {
+		feed, err = SeatChanges(ctx, redisClient, eventID, SeatChangesCursorStart, 100)
+		require.NoError(t, err)
+		assert.True(t, feed.Reset)
+	}
+}
+
+func TestValidSeatChangesCursor(t *testing.T) {
+	assert.True(t, ValidSeatChangesCursor("0"))
+	assert.True(t, ValidSeatChangesCursor("1700000000000-3"))
+	assert.False(t, ValidSeatChangesCursor(""))
+	assert.False(t, ValidSeatChangesCursor("-"))
+	assert.False(t, ValidSeatChangesCursor("+"))
+	assert.False(t, ValidSeatChangesCursor("abc-1"))
+}
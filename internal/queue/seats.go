@@ -0,0 +1,162 @@
+package queue
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/metrics"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+//go:embed lua/release_expired_holds.lua
+var releaseExpiredHoldsScript string
+
+// HoldEventsKey is a ZSET of event IDs scored by their last seat hold (Unix seconds).
+// HoldSeatAtomic touches it so the sweeper knows which events to check without SCAN.
+const HoldEventsKey = "hold:events"
+
+// holdEventsWindow drops events from HoldEventsKey once every hold placed there has long lapsed
+// (seat_hold_ttl_sec is capped well below it)
+const holdEventsWindow = 24 * time.Hour
+
+// holdSweepBatch bounds the seats released by one script call
+const holdSweepBatch = 500
+
+// SeatStatusKey returns the hash of seat ID -> AVAILABLE/HOLD/RESERVED for an event
+func SeatStatusKey(eventID string) string {
+	return fmt.Sprintf("seat:status:{%s}", eventID)
+}
+
+// SeatHoldKey returns the key holding the holder's user ID for the hold TTL
+func SeatHoldKey(eventID, seatID string) string {
+	return seatHoldPrefix(eventID) + seatID
+}
+
+func seatHoldPrefix(eventID string) string {
+	return fmt.Sprintf("hold:seat:{%s}:", eventID)
+}
+
+// UserHoldsKey returns the set of seats a user holds for an event (per-user hold limit)
+func UserHoldsKey(eventID, userID string) string {
+	return userHoldsPrefix(eventID) + userID
+}
+
+func userHoldsPrefix(eventID string) string {
+	return fmt.Sprintf("hold:user:{%s}:", eventID)
+}
+
+// HoldOwnersKey returns the hash of held seat ID -> holder, kept after the hold key expires
+func HoldOwnersKey(eventID string) string {
+	return fmt.Sprintf("hold:owner:{%s}", eventID)
+}
+
+// HoldExpiryKey returns the ZSET of held seat IDs scored by hold expiry (Unix seconds)
+func HoldExpiryKey(eventID string) string {
+	return fmt.Sprintf("hold:expiry:{%s}", eventID)
+}
+
+// HoldSweeper puts seats whose hold TTL lapsed back to AVAILABLE and restores
+// the inventory they took. Without it an expired hold key leaves the seat
+// marked HOLD forever. It runs as a leader worker.
+type HoldSweeper struct {
+	redisClient   redis.UniversalClient
+	releaseScript *redis.Script
+	interval      time.Duration
+	logger        *logrus.Logger
+}
+
+// NewHoldSweeper creates a new expired seat hold sweeper
+func NewHoldSweeper(redisClient redis.UniversalClient, interval time.Duration, logger *logrus.Logger) *HoldSweeper {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	return &HoldSweeper{
+		redisClient:   redisClient,
+		releaseScript: redis.NewScript(releaseExpiredHoldsScript),
+		interval:      interval,
+		logger:        logger,
+	}
+}
+
+// Run sweeps every interval until ctx is cancelled
+func (s *HoldSweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		released, err := s.Sweep(ctx)
+		if err != nil && ctx.Err() == nil {
+			s.logger.WithError(err).Error("Seat hold sweep failed")
+		}
+		if released > 0 {
+			s.logger.WithField("released", released).Info("Released expired seat holds")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep releases the expired holds of every event with recent holds
+func (s *HoldSweeper) Sweep(ctx context.Context) (int, error) {
+	cutoff := time.Now().Add(-holdEventsWindow).Unix()
+	if err := s.redisClient.ZRemRangeByScore(ctx, HoldEventsKey, "-inf", "("+strconv.FormatInt(cutoff, 10)).Err(); err != nil {
+		return 0, fmt.Errorf("failed to prune hold events: %w", err)
+	}
+
+	eventIDs, err := s.redisClient.ZRange(ctx, HoldEventsKey, 0, -1).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list hold events: %w", err)
+	}
+
+	total := 0
+	for _, eventID := range eventIDs {
+		if ctx.Err() != nil {
+			return total, ctx.Err()
+		}
+
+		released, err := s.SweepEvent(ctx, eventID)
+		total += released
+		if err != nil {
+			s.logger.WithError(err).WithField("event_id", eventID).Warn("Failed to sweep seat holds")
+		}
+	}
+
+	return total, nil
+}
+
+// SweepEvent releases every expired hold of one event
+func (s *HoldSweeper) SweepEvent(ctx context.Context, eventID string) (int, error) {
+	total := 0
+	for {
+		result, err := s.releaseScript.Run(
+			ctx,
+			s.redisClient,
+			[]string{SeatStatusKey(eventID), InventoryKey(eventID), HoldOwnersKey(eventID), HoldExpiryKey(eventID), SeatChangesKey(eventID)},
+			seatHoldPrefix(eventID), userHoldsPrefix(eventID), holdSweepBatch, seatChangesMaxLen,
+		).Int64Slice()
+		if err != nil {
+			return total, fmt.Errorf("release expired holds script failed: %w", err)
+		}
+		if len(result) < 2 {
+			return total, fmt.Errorf("invalid result array length: %d", len(result))
+		}
+
+		released := int(result[0])
+		total += released
+		metrics.RecordSeatHolds("expired", released)
+
+		// A full batch may leave more expired seats behind
+		if result[1] < holdSweepBatch {
+			return total, nil
+		}
+	}
+}
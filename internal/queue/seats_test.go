@@ -0,0 +1,224 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/testutil"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func cleanupSeatHolds(ctx context.Context, redisClient redis.UniversalClient, eventID string, seats, users []string) {
+	keys := []string{SeatStatusKey(eventID), InventoryKey(eventID), HoldOwnersKey(eventID), HoldExpiryKey(eventID)}
+	for _, seat := range seats {
+		keys = append(keys, SeatHoldKey(eventID, seat))
+	}
+	for _, user := range users {
+		keys = append(keys, UserHoldsKey(eventID, user))
+	}
+	redisClient.Del(ctx, keys...)
+	redisClient.ZRem(ctx, HoldEventsKey, eventID)
+}
+
+// seedSeats adds seats to the event's seat map as available
+func seedSeats(t *testing.T, redisClient redis.UniversalClient, eventID string, seats []string) {
+	for _, seat := range seats {
+		require.NoError(t, redisClient.HSet(context.Background(), SeatStatusKey(eventID), seat, "AVAILABLE").Err())
+	}
+}
+
+func TestLuaExecutor_HoldLimit(t *testing.T) {
+	redisClient := testutil.NewRedisClient(t)
+
+	executor := NewLuaExecutor(redisClient, logrus.New())
+	ctx := context.Background()
+	eventID := "test-hold-limit"
+	seats := []string{"A-1", "A-2", "A-3"}
+
+	cleanupSeatHolds(ctx, redisClient, eventID, seats, []string{"user-1"})
+	defer cleanupSeatHolds(ctx, redisClient, eventID, seats, []string{"user-1"})
+	seedSeats(t, redisClient, eventID, seats)
+
+	// Seats outside the seat map cannot be held
+	result, err := executor.HoldSeatAtomic(ctx, eventID, "Z-99", "user-1", 60, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "UNKNOWN_SEAT", result.Error)
+
+	// No inventory counter: the event is not set up for seat holds
+	result, err = executor.HoldSeatAtomic(ctx, eventID, "A-1", "user-1", 60, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "NO_INVENTORY", result.Error)
+
+	require.NoError(t, redisClient.Set(ctx, InventoryKey(eventID), 10, 0).Err())
+
+	for _, seat := range seats[:2] {
+		result, err := executor.HoldSeatAtomic(ctx, eventID, seat, "user-1", 60, 2)
+		require.NoError(t, err)
+		assert.True(t, result.Success)
+	}
+
+	result, err = executor.HoldSeatAtomic(ctx, eventID, "A-3", "user-1", 60, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "HOLD_LIMIT", result.Error)
+
+	// Releasing one frees a slot
+	released, err := executor.ReleaseSeatAtomic(ctx, eventID, "A-1", "user-1")
+	require.NoError(t, err)
+	assert.True(t, released.Success)
+	assert.Equal(t, int64(9), released.Remaining)
+
+	result, err = executor.HoldSeatAtomic(ctx, eventID, "A-3", "user-1", 60, 2)
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+	assert.Equal(t, int64(8), result.Remaining)
+
+	// A lapsed hold no longer counts and its seat can be taken right away
+	require.NoError(t, redisClient.Del(ctx, SeatHoldKey(eventID, "A-2")).Err())
+	result, err = executor.HoldSeatAtomic(ctx, eventID, "A-2", "user-2", 60, 2)
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+	assert.Equal(t, int64(8), result.Remaining, "The lapsed hold gave its seat back first")
+	redisClient.Del(ctx, UserHoldsKey(eventID, "user-2"))
+
+	members, err := redisClient.SMembers(ctx, UserHoldsKey(eventID, "user-1")).Result()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"A-3"}, members)
+}
+
+func TestHoldSweeper_ReleasesExpiredHolds(t *testing.T) {
+	redisClient := testutil.NewRedisClient(t)
+
+	executor := NewLuaExecutor(redisClient, logrus.New())
+	sweeper := NewHoldSweeper(redisClient, time.Second, logrus.New())
+	ctx := context.Background()
+	eventID := "test-hold-sweeper"
+	seats := []string{"B-1", "B-2"}
+
+	cleanupSeatHolds(ctx, redisClient, eventID, seats, []string{"user-1"})
+	defer cleanupSeatHolds(ctx, redisClient, eventID, seats, []string{"user-1"})
+	seedSeats(t, redisClient, eventID, seats)
+
+	require.NoError(t, redisClient.Set(ctx, InventoryKey(eventID), 5, 0).Err())
+	for _, seat := range seats {
+		result, err := executor.HoldSeatAtomic(ctx, eventID, seat, "user-1", 60, 0)
+		require.NoError(t, err)
+		require.True(t, result.Success)
+	}
+
+	// Nothing is due yet
+	released, err := sweeper.SweepEvent(ctx, eventID)
+	require.NoError(t, err)
+	assert.Equal(t, 0, released)
+
+	// B-1's hold lapsed
+	require.NoError(t, redisClient.Del(ctx, SeatHoldKey(eventID, "B-1")).Err())
+	require.NoError(t, redisClient.ZAdd(ctx, HoldExpiryKey(eventID), redis.Z{Score: float64(time.Now().Add(-time.Second).Unix()), Member: "B-1"}).Err())
+
+	released, err = sweeper.Sweep(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, released)
+
+	status, err := redisClient.HGet(ctx, SeatStatusKey(eventID), "B-1").Result()
+	require.NoError(t, err)
+	assert.Equal(t, "AVAILABLE", status)
+
+	inventory, err := redisClient.Get(ctx, InventoryKey(eventID)).Int64()
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), inventory, "The lapsed seat was returned to inventory")
+
+	members, err := redisClient.SMembers(ctx, UserHoldsKey(eventID, "user-1")).Result()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"B-2"}, members)
+
+	// Sweeping again changes nothing
+	released, err = sweeper.SweepEvent(ctx, eventID)
+	require.NoError(t, err)
+	assert.Equal(t, 0, released)
+}
+
+func TestReservationToken_ReservesHeldSeats(t *testing.T) {
+	redisClient := testutil.NewRedisClient(t)
+
+	executor := NewLuaExecutor(redisClient, logrus.New())
+	sweeper := NewHoldSweeper(redisClient, time.Second, logrus.New())
+	ctx := context.Background()
+	eventID := "test-reserve-held-seats"
+	seats := []string{"C-1", "C-2", "C-3"}
+	tokenKey := ReservationTokenKey(eventID, "rt-1")
+
+	cleanup := func() {
+		cleanupSeatHolds(ctx, redisClient, eventID, seats, []string{"user-1", "user-2"})
+		redisClient.Del(ctx, tokenKey, GrantsKey(eventID), SeatChangesKey(eventID))
+	}
+	cleanup()
+	defer cleanup()
+	seedSeats(t, redisClient, eventID, seats)
+
+	require.NoError(t, redisClient.Set(ctx, InventoryKey(eventID), 5, 0).Err())
+	require.NoError(t, redisClient.Set(ctx, tokenKey, `{"event_id":"`+eventID+`","user_id":"user-1"}`, time.Minute).Err())
+	require.NoError(t, redisClient.ZAdd(ctx, GrantsKey(eventID), redis.Z{Score: float64(time.Now().Add(time.Minute).Unix()), Member: "rt-1"}).Err())
+	for seat, user := range map[string]string{"C-1": "user-1", "C-2": "user-2"} {
+		result, err := executor.HoldSeatAtomic(ctx, eventID, seat, user, 60, 0)
+		require.NoError(t, err)
+		require.True(t, result.Success)
+	}
+
+	// Only the caller's hold becomes a reserved seat; it keeps its inventory
+	consumed, err := executor.ConsumeReservationToken(ctx, "rt-1", eventID, "user-1", "attempt-1", []string{"C-1", "C-2", "C-3"})
+	require.NoError(t, err)
+	require.True(t, consumed.Success)
+
+	statuses, err := redisClient.HGetAll(ctx, SeatStatusKey(eventID)).Result()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"C-1": "RESERVED", "C-2": "HOLD", "C-3": "AVAILABLE"}, statuses)
+	exists, err := redisClient.Exists(ctx, SeatHoldKey(eventID, "C-1")).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), exists)
+	_, err = redisClient.ZScore(ctx, GrantsKey(eventID), "rt-1").Result()
+	assert.Equal(t, redis.Nil, err, "The reserved seats are counted by the inventory, not the grant")
+
+	// The sweeper has no hold of the reserved seat to release
+	require.NoError(t, redisClient.Del(ctx, SeatHoldKey(eventID, "C-2")).Err())
+	require.NoError(t, redisClient.ZAdd(ctx, HoldExpiryKey(eventID), redis.Z{Score: float64(time.Now().Add(-time.Second).Unix()), Member: "C-2"}).Err())
+	released, err := sweeper.SweepEvent(ctx, eventID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, released)
+	status, err := redisClient.HGet(ctx, SeatStatusKey(eventID), "C-1").Result()
+	require.NoError(t, err)
+	assert.Equal(t, "RESERVED", status)
+	inventory, err := redisClient.Get(ctx, InventoryKey(eventID)).Int64()
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), inventory, "Only the lapsed hold returned its seat")
+
+	// A failed backend call holds the seat again and re-arms the token and its grant
+	restored, err := executor.RestoreReservationToken(ctx, eventID, "rt-1", "attempt-1")
+	require.NoError(t, err)
+	require.True(t, restored.Success)
+
+	status, err = redisClient.HGet(ctx, SeatStatusKey(eventID), "C-1").Result()
+	require.NoError(t, err)
+	assert.Equal(t, "HOLD", status)
+	holder, err := redisClient.Get(ctx, SeatHoldKey(eventID, "C-1")).Result()
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", holder)
+	_, err = redisClient.ZScore(ctx, HoldExpiryKey(eventID), "C-1").Result()
+	assert.NoError(t, err)
+	_, err = redisClient.ZScore(ctx, GrantsKey(eventID), "rt-1").Result()
+	assert.NoError(t, err)
+	inventory, err = redisClient.Get(ctx, InventoryKey(eventID)).Int64()
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), inventory)
+
+	// The retry reserves it again
+	consumed, err = executor.ConsumeReservationToken(ctx, "rt-1", eventID, "user-1", "attempt-2", []string{"C-1"})
+	require.NoError(t, err)
+	require.True(t, consumed.Success)
+	status, err = redisClient.HGet(ctx, SeatStatusKey(eventID), "C-1").Result()
+	require.NoError(t, err)
+	assert.Equal(t, "RESERVED", status)
+}
@@ -100,79 +100,6 @@ func (s *SlidingWindowMetrics) getAdmissionRateForWindow(ctx context.Context, no
 	return rate
 }
 
-// CalculateAdvancedETA calculates ETA using sliding window with hourly patterns
-func (s *SlidingWindowMetrics) CalculateAdvancedETA(ctx context.Context, position int) int {
-	// Get weighted admission rate
-	rate := s.GetWeightedAdmissionRate(ctx)
-
-	// Apply hourly weight adjustment
-	hourWeight := s.getHourlyWeight(time.Now().Hour())
-	adjustedRate := rate * hourWeight
-
-	s.logger.WithFields(logrus.Fields{
-		"position":      position,
-		"base_rate":     rate,
-		"hour_weight":   hourWeight,
-		"adjusted_rate": adjustedRate,
-	}).Debug("Advanced ETA calculation")
-
-	// Fallback if no rate data
-	if adjustedRate == 0 {
-		s.logger.Warn("No admission rate data, using fallback")
-		return position * 2
-	}
-
-	// Calculate ETA with 10% safety buffer
-	eta := float64(position) / adjustedRate * 1.1
-
-	// Clamp between 1 and 600 seconds
-	if eta < 1 {
-		return 1
-	} else if eta > 600 {
-		return 600
-	}
-
-	return int(eta)
-}
-
-// getHourlyWeight returns traffic pattern weight based on hour of day
-// This accounts for peak and off-peak hours
-func (s *SlidingWindowMetrics) getHourlyWeight(hour int) float64 {
-	// Traffic pattern weights (based on typical e-commerce patterns)
-	weights := map[int]float64{
-		0:  0.3, // Late night - very low traffic
-		1:  0.2, // Early morning - lowest traffic
-		2:  0.2,
-		3:  0.2,
-		4:  0.3,
-		5:  0.4,
-		6:  0.6, // Morning - traffic starts
-		7:  0.8,
-		8:  1.0, // Work hours - normal traffic
-		9:  1.2, // Morning peak
-		10: 1.3,
-		11: 1.4,
-		12: 1.5, // Lunch time - peak
-		13: 1.4,
-		14: 1.2,
-		15: 1.1,
-		16: 1.0,
-		17: 1.2,
-		18: 1.8, // Evening - highest peak
-		19: 2.0, // Prime time
-		20: 1.8,
-		21: 1.5,
-		22: 1.2,
-		23: 0.8, // Late evening
-	}
-
-	if weight, ok := weights[hour]; ok {
-		return weight
-	}
-
-	return 1.0 // Default weight
-}
-
 // GetETAConfidence returns confidence level of ETA prediction (0.0 to 1.0)
 func (s *SlidingWindowMetrics) GetETAConfidence(ctx context.Context) float64 {
 	now := time.Now()
@@ -227,34 +154,44 @@ func (s *SlidingWindowMetrics) getCountForWindow(ctx context.Context, now time.T
 
 // GetDetailedMetrics returns comprehensive metrics for monitoring
 type DetailedMetrics struct {
-	Position     int     `json:"position"`
-	ETA          int     `json:"eta_sec"`
-	Confidence   float64 `json:"confidence"`
-	Rate1Min     float64 `json:"rate_1min"`
-	Rate5Min     float64 `json:"rate_5min"`
-	Rate15Min    float64 `json:"rate_15min"`
-	WeightedRate float64 `json:"weighted_rate"`
-	HourWeight   float64 `json:"hour_weight"`
-	Count1Min    int64   `json:"count_1min"`
-	Count5Min    int64   `json:"count_5min"`
-	Count15Min   int64   `json:"count_15min"`
+	Position     int         `json:"position"`
+	ETA          int         `json:"eta_sec"`     // Learned p50 ETA of the position
+	ETAP90       int         `json:"eta_p90_sec"` // Learned p90 ETA of the position
+	Confidence   float64     `json:"confidence"`
+	Rate1Min     float64     `json:"rate_1min"`
+	Rate5Min     float64     `json:"rate_5min"`
+	Rate15Min    float64     `json:"rate_15min"`
+	WeightedRate float64     `json:"weighted_rate"`
+	Forecast     ETAForecast `json:"forecast"`
+	Count1Min    int64       `json:"count_1min"`
+	Count5Min    int64       `json:"count_5min"`
+	Count15Min   int64       `json:"count_15min"`
 }
 
 func (s *SlidingWindowMetrics) GetDetailedMetrics(ctx context.Context, position int) *DetailedMetrics {
 	now := time.Now()
 
+	predictor := DefaultETAPredictor()
+	counts, err := LoadAdmissionCounts(ctx, s.redisClient, s.eventID, predictor.Resolution, predictor.Window)
+	if err != nil {
+		s.logger.WithError(err).WithField("event_id", s.eventID).Warn("Failed to load admission history for ETA")
+	}
+	forecast := predictor.Fit(counts)
+	eta := forecast.ETA(position)
+
 	metrics := &DetailedMetrics{
 		Position:     position,
 		Rate1Min:     s.getAdmissionRateForWindow(ctx, now, 1*time.Minute),
 		Rate5Min:     s.getAdmissionRateForWindow(ctx, now, 5*time.Minute),
 		Rate15Min:    s.getAdmissionRateForWindow(ctx, now, 15*time.Minute),
 		WeightedRate: s.GetWeightedAdmissionRate(ctx),
-		HourWeight:   s.getHourlyWeight(now.Hour()),
+		Forecast:     forecast,
 		Count1Min:    s.getCountForWindow(ctx, now, 1*time.Minute),
 		Count5Min:    s.getCountForWindow(ctx, now, 5*time.Minute),
 		Count15Min:   s.getCountForWindow(ctx, now, 15*time.Minute),
 		Confidence:   s.GetETAConfidence(ctx),
-		ETA:          s.CalculateAdvancedETA(ctx, position),
+		ETA:          eta.P50,
+		ETAP90:       eta.P90,
 	}
 
 	return metrics
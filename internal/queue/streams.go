@@ -272,9 +272,9 @@ func (sq *StreamQueue) CleanupExpiredStreams(
 // GetQueueStats returns statistics for the queue
 // ✅ Uses SCAN instead of KEYS for non-blocking operation
 type QueueStats struct {
-	TotalUsers    int
-	TotalMessages int
-	AvgPerUser    float64
+	TotalUsers    int     `json:"total_users"`
+	TotalMessages int     `json:"total_messages"`
+	AvgPerUser    float64 `json:"avg_per_user"`
 }
 
 func (sq *StreamQueue) GetQueueStats(
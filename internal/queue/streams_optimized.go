@@ -21,13 +21,24 @@ func (sq *StreamQueue) CalculateApproximatePosition(
 	ctx context.Context,
 	eventID string,
 	waitingToken string,
+) (int, error) {
+	return sq.CalculateLanePosition(ctx, eventID, "", waitingToken)
+}
+
+// CalculateLanePosition returns the position within a priority lane ("" = default lane)
+// ✅ O(log N) time complexity
+func (sq *StreamQueue) CalculateLanePosition(
+	ctx context.Context,
+	eventID string,
+	lane string,
+	waitingToken string,
 ) (int, error) {
 	// Use ZSET for fast position lookup
-	// Key: position_index:{eventID} (matches Join API)
-	// Score: timestamp (Unix milliseconds)
+	// Key: position_index:{eventID}[:lane:name] (matches Join API)
+	// Score: timestamp (Unix seconds)
 	// Member: waitingToken
 
-	positionKey := fmt.Sprintf("position_index:{%s}", eventID)
+	positionKey := PositionIndexKey(eventID, lane)
 
 	// Get rank (position) in sorted set
 	rank, err := sq.redis.ZRank(ctx, positionKey, waitingToken).Result()
@@ -0,0 +1,157 @@
+package queue
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// waitingTokenVersion prefixes every signed waiting token so the format can evolve
+const waitingTokenVersion = "v1"
+
+var (
+	// ErrInvalidWaitingToken is returned for malformed, forged or unknown-key tokens
+	ErrInvalidWaitingToken = errors.New("invalid waiting token")
+
+	// ErrWaitingTokenMismatch is returned when a valid token is presented by another session
+	ErrWaitingTokenMismatch = errors.New("waiting token does not belong to this session")
+)
+
+// WaitingTokenClaims is the payload carried inside a signed waiting token.
+// ID is the opaque identifier used for the queue:waiting/heartbeat/ZSET keys.
+type WaitingTokenClaims struct {
+	ID       string `json:"id"`
+	EventID  string `json:"eid"`
+	UserID   string `json:"uid,omitempty"`
+	JoinedAt int64  `json:"iat"` // Unix seconds
+	Binding  string `json:"bnd"` // Session binding, see BindingFor
+}
+
+// SigningKey is an HMAC key identified by a key ID
+type SigningKey struct {
+	ID     string
+	Secret []byte
+}
+
+// TokenSigner issues and verifies waiting tokens of the form
+// v1.<kid>.<base64url(payload)>.<base64url(hmac-sha256)>.
+// The first key signs; all keys verify, so keys can be rotated without
+// invalidating tokens issued before the rotation.
+type TokenSigner struct {
+	active SigningKey
+	keys   map[string][]byte
+}
+
+// NewTokenSigner creates a signer. keys[0] is used for signing.
+func NewTokenSigner(keys []SigningKey) (*TokenSigner, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("at least one waiting token signing key is required")
+	}
+
+	signer := &TokenSigner{
+		active: keys[0],
+		keys:   make(map[string][]byte, len(keys)),
+	}
+	for _, key := range keys {
+		if key.ID == "" || strings.Contains(key.ID, ".") {
+			return nil, fmt.Errorf("invalid waiting token key id %q", key.ID)
+		}
+		if len(key.Secret) == 0 {
+			return nil, fmt.Errorf("empty secret for waiting token key %q", key.ID)
+		}
+		if _, dup := signer.keys[key.ID]; dup {
+			return nil, fmt.Errorf("duplicate waiting token key id %q", key.ID)
+		}
+		signer.keys[key.ID] = key.Secret
+	}
+
+	return signer, nil
+}
+
+// ParseSigningKeys parses "kid1:secret1,kid2:secret2" into signing keys
+func ParseSigningKeys(spec string) ([]SigningKey, error) {
+	var keys []SigningKey
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kid, secret, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("waiting token key must be kid:secret, got %q", kid)
+		}
+		keys = append(keys, SigningKey{ID: strings.TrimSpace(kid), Secret: []byte(secret)})
+	}
+	return keys, nil
+}
+
+// Sign issues a signed waiting token for the claims
+func (s *TokenSigner) Sign(claims WaitingTokenClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal waiting token claims: %w", err)
+	}
+
+	signingInput := waitingTokenVersion + "." + s.active.ID + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signingInput + "." + sign(s.active.Secret, signingInput), nil
+}
+
+// Verify checks the token signature and returns its claims
+func (s *TokenSigner) Verify(token string) (*WaitingTokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 4 || parts[0] != waitingTokenVersion {
+		return nil, ErrInvalidWaitingToken
+	}
+
+	secret, ok := s.keys[parts[1]]
+	if !ok {
+		return nil, ErrInvalidWaitingToken
+	}
+
+	signingInput := parts[0] + "." + parts[1] + "." + parts[2]
+	if !hmac.Equal([]byte(sign(secret, signingInput)), []byte(parts[3])) {
+		return nil, ErrInvalidWaitingToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidWaitingToken
+	}
+
+	var claims WaitingTokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.ID == "" || claims.EventID == "" {
+		return nil, ErrInvalidWaitingToken
+	}
+
+	return &claims, nil
+}
+
+// VerifyBinding checks the token and that it was issued to the given session binding
+func (s *TokenSigner) VerifyBinding(token, binding string) (*WaitingTokenClaims, error) {
+	claims, err := s.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(claims.Binding), []byte(binding)) {
+		return claims, ErrWaitingTokenMismatch
+	}
+	return claims, nil
+}
+
+// BindingFor derives the session binding stored in a waiting token from a
+// stable caller identity (e.g. "user:<id>"). Only a digest is embedded.
+func BindingFor(identity string) string {
+	sum := sha256.Sum256([]byte(identity))
+	return hex.EncodeToString(sum[:12])
+}
+
+func sign(secret []byte, input string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(input))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
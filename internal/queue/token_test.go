@@ -0,0 +1,115 @@
+package queue
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testClaims() WaitingTokenClaims {
+	return WaitingTokenClaims{
+		ID:       "7f8e4a3c-entry",
+		EventID:  "evt_2025_1001",
+		UserID:   "user-1",
+		JoinedAt: time.Now().Unix(),
+		Binding:  BindingFor("session:abc"),
+	}
+}
+
+func TestTokenSigner_SignVerify(t *testing.T) {
+	signer, err := NewTokenSigner([]SigningKey{{ID: "k1", Secret: []byte("secret-1")}})
+	require.NoError(t, err)
+
+	token, err := signer.Sign(testClaims())
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(token, "v1.k1."))
+
+	claims, err := signer.VerifyBinding(token, BindingFor("session:abc"))
+	require.NoError(t, err)
+	assert.Equal(t, "7f8e4a3c-entry", claims.ID)
+	assert.Equal(t, "evt_2025_1001", claims.EventID)
+	assert.Equal(t, "user-1", claims.UserID)
+
+	// Another session presenting the same token
+	_, err = signer.VerifyBinding(token, BindingFor("session:other"))
+	assert.ErrorIs(t, err, ErrWaitingTokenMismatch)
+}
+
+func TestTokenSigner_RejectsForgedTokens(t *testing.T) {
+	signer, err := NewTokenSigner([]SigningKey{{ID: "k1", Secret: []byte("secret-1")}})
+	require.NoError(t, err)
+
+	token, err := signer.Sign(testClaims())
+	require.NoError(t, err)
+	parts := strings.Split(token, ".")
+
+	// Payload swapped for another entry id, original signature kept
+	forgedClaims := testClaims()
+	forgedClaims.ID = "someone-else"
+	other, err := signer.Sign(forgedClaims)
+	require.NoError(t, err)
+	otherParts := strings.Split(other, ".")
+
+	// Signed with a key the gateway does not know
+	foreign, err := NewTokenSigner([]SigningKey{{ID: "k1", Secret: []byte("attacker")}})
+	require.NoError(t, err)
+	foreignToken, err := foreign.Sign(testClaims())
+	require.NoError(t, err)
+
+	cases := map[string]string{
+		"bare uuid":         "7f8e4a3c-9b2d-4f1e-8c3a-1d2e3f4a5b6c",
+		"empty":             "",
+		"wrong version":     "v2." + strings.Join(parts[1:], "."),
+		"unknown kid":       "v1.k9." + parts[2] + "." + parts[3],
+		"tampered payload":  parts[0] + "." + parts[1] + "." + otherParts[2] + "." + parts[3],
+		"truncated":         parts[0] + "." + parts[1] + "." + parts[2],
+		"foreign signature": foreignToken,
+	}
+	for name, token := range cases {
+		_, err := signer.Verify(token)
+		assert.ErrorIs(t, err, ErrInvalidWaitingToken, name)
+	}
+}
+
+func TestTokenSigner_KeyRotation(t *testing.T) {
+	oldSigner, err := NewTokenSigner([]SigningKey{{ID: "2025-09", Secret: []byte("old")}})
+	require.NoError(t, err)
+	oldToken, err := oldSigner.Sign(testClaims())
+	require.NoError(t, err)
+
+	// New key signs, old key still verifies
+	keys, err := ParseSigningKeys("2025-10:new, 2025-09:old")
+	require.NoError(t, err)
+	rotated, err := NewTokenSigner(keys)
+	require.NoError(t, err)
+
+	_, err = rotated.Verify(oldToken)
+	assert.NoError(t, err, "Tokens issued before the rotation should still verify")
+
+	newToken, err := rotated.Sign(testClaims())
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(newToken, "v1.2025-10."))
+
+	// Old key retired
+	retired, err := NewTokenSigner(keys[:1])
+	require.NoError(t, err)
+	_, err = retired.Verify(oldToken)
+	assert.ErrorIs(t, err, ErrInvalidWaitingToken)
+}
+
+func TestNewTokenSigner_InvalidKeys(t *testing.T) {
+	_, err := NewTokenSigner(nil)
+	assert.Error(t, err)
+
+	_, err = NewTokenSigner([]SigningKey{{ID: "a.b", Secret: []byte("x")}})
+	assert.Error(t, err, "Key ids cannot contain the separator")
+
+	_, err = NewTokenSigner([]SigningKey{{ID: "k1", Secret: []byte("x")}, {ID: "k1", Secret: []byte("y")}})
+	assert.Error(t, err)
+
+	_, err = ParseSigningKeys("missing-secret")
+	assert.Error(t, err)
+}
@@ -0,0 +1,196 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// watchInterval is how often a watched event is checked for changes
+const watchInterval = 1 * time.Second
+
+// watchLifecycleBatch bounds the lifecycle entries read per check. A check
+// that reads a full batch reports a change without looking at the rest.
+const watchLifecycleBatch = 1000
+
+// EventWatcher tells subscribers when an event's queue changed. One goroutine
+// per watched event reads the lifecycle entries added since its last check,
+// the queue control, the lobby opened flag and the inventory counter in a
+// single round trip, so status streams re-read their own status after a
+// change instead of each polling Redis. Joins are not changes: a token that
+// joins at the tail moves nobody else's position.
+type EventWatcher struct {
+	redisClient redis.UniversalClient
+	logger      *logrus.Logger
+
+	mu     sync.Mutex
+	events map[string]*watchedEvent
+}
+
+type watchedEvent struct {
+	subscribers map[chan struct{}]struct{}
+	stop        chan struct{}
+}
+
+// NewEventWatcher creates a new event watcher
+func NewEventWatcher(redisClient redis.UniversalClient, logger *logrus.Logger) *EventWatcher {
+	return &EventWatcher{
+		redisClient: redisClient,
+		logger:      logger,
+		events:      make(map[string]*watchedEvent),
+	}
+}
+
+// Subscribe returns a channel signalled after changes to eventID's queue, and
+// a function ending the subscription. Changes made after Subscribe returns are
+// signalled; several changes may be coalesced into one signal.
+func (w *EventWatcher) Subscribe(eventID string) (<-chan struct{}, func()) {
+	changes := make(chan struct{}, 1)
+
+	w.mu.Lock()
+	event, ok := w.events[eventID]
+	if !ok {
+		event = &watchedEvent{
+			subscribers: make(map[chan struct{}]struct{}),
+			stop:        make(chan struct{}),
+		}
+		w.events[eventID] = event
+		go w.watch(eventID, event)
+	}
+	event.subscribers[changes] = struct{}{}
+	w.mu.Unlock()
+
+	var once sync.Once
+	return changes, func() {
+		once.Do(func() {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			delete(event.subscribers, changes)
+			if len(event.subscribers) == 0 {
+				delete(w.events, eventID)
+				close(event.stop)
+			}
+		})
+	}
+}
+
+// Watching returns the number of subscribers of eventID
+func (w *EventWatcher) Watching(eventID string) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if event, ok := w.events[eventID]; ok {
+		return len(event.subscribers)
+	}
+	return 0
+}
+
+// watchState is what the last check of an event saw
+type watchState struct {
+	cursor    string // Newest lifecycle entry read
+	control   string
+	opened    int64
+	inventory string
+}
+
+func (w *EventWatcher) watch(eventID string, event *watchedEvent) {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	var last *watchState
+	for {
+		select {
+		case <-event.stop:
+			return
+		case <-ticker.C:
+		}
+
+		state, changed, err := w.check(eventID, last)
+		if err != nil {
+			w.logger.WithError(err).WithField("event_id", eventID).Warn("Failed to check event for changes")
+			continue
+		}
+		last = state
+		if !changed {
+			continue
+		}
+
+		w.mu.Lock()
+		for changes := range event.subscribers {
+			select {
+			case changes <- struct{}{}:
+			default: // Already signalled
+			}
+		}
+		w.mu.Unlock()
+	}
+}
+
+// check reports whether a position, an eligibility, the queue state or the
+// inventory of eventID changed since last. The first check (last == nil)
+// always reports a change.
+func (w *EventWatcher) check(eventID string, last *watchState) (*watchState, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), watchInterval)
+	defer cancel()
+
+	pipe := w.redisClient.Pipeline()
+	newestCmd := pipe.XRevRangeN(ctx, LifecycleKey(eventID), "+", "-", 1)
+	var entriesCmd *redis.XMessageSliceCmd
+	if last != nil && last.cursor != "" {
+		// Inclusive of the cursor, which is skipped below
+		entriesCmd = pipe.XRangeN(ctx, LifecycleKey(eventID), last.cursor, "+", watchLifecycleBatch+1)
+	}
+	controlCmd := pipe.Get(ctx, controlKey(eventID))
+	openedCmd := pipe.Exists(ctx, lobbyOpenedKey(eventID))
+	inventoryCmd := pipe.Get(ctx, InventoryKey(eventID))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, false, err
+	}
+
+	state := &watchState{
+		control:   controlCmd.Val(),
+		opened:    openedCmd.Val(),
+		inventory: inventoryCmd.Val(),
+	}
+	if entries := newestCmd.Val(); len(entries) > 0 {
+		state.cursor = entries[0].ID
+	}
+
+	switch {
+	case last == nil:
+		return state, true, nil
+	case state.control != last.control, state.opened != last.opened, state.inventory != last.inventory:
+		return state, true, nil
+	case state.cursor == last.cursor:
+		return state, false, nil
+	case entriesCmd == nil:
+		// The stream was empty at the last check
+		return state, true, nil
+	}
+
+	entries := entriesCmd.Val()
+	if len(entries) > 0 && entries[0].ID == last.cursor {
+		entries = entries[1:]
+	}
+	if len(entries) >= watchLifecycleBatch {
+		return state, true, nil
+	}
+	for _, entry := range entries {
+		if movesPositions(entry) {
+			return state, true, nil
+		}
+	}
+	return state, false, nil
+}
+
+// movesPositions reports whether a lifecycle entry can change the status of
+// tokens other than its own: joins and identity upgrades cannot
+func movesPositions(entry redis.XMessage) bool {
+	switch entry.Values["type"] {
+	case LifecycleJoined, LifecycleIdentityUpgraded:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package queue
+
+import (
+	"context"
+	"testing"
+
+	"github.com/traffic-tacos/gateway-api/internal/testutil"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventWatcher_JoinsAreNotChanges(t *testing.T) {
+	redisClient := testutil.NewRedisClient(t)
+	ctx := context.Background()
+	eventID := "test-event-watcher"
+	keys := []string{LifecycleKey(eventID), InventoryKey(eventID), controlKey(eventID), lobbyOpenedKey(eventID)}
+	redisClient.Del(ctx, keys...)
+	defer redisClient.Del(ctx, keys...)
+
+	watcher := NewEventWatcher(redisClient, logrus.New())
+	appendEntry := func(entryType string) {
+		require.NoError(t, redisClient.XAdd(ctx, &redis.XAddArgs{
+			Stream: LifecycleKey(eventID),
+			Values: map[string]interface{}{"type": entryType, "token": "wtkn-" + entryType},
+		}).Err())
+	}
+
+	appendEntry(LifecycleJoined)
+	state, changed, err := watcher.check(eventID, nil)
+	require.NoError(t, err)
+	assert.True(t, changed, "The first check always reports a change")
+
+	// Tail joins move nobody's position
+	appendEntry(LifecycleJoined)
+	appendEntry(LifecycleJoined)
+	state, changed, err = watcher.check(eventID, state)
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	// An admission among the joins moves everybody behind it
+	appendEntry(LifecycleJoined)
+	appendEntry(LifecycleEntered)
+	appendEntry(LifecycleJoined)
+	state, changed, err = watcher.check(eventID, state)
+	require.NoError(t, err)
+	assert.True(t, changed)
+
+	state, changed, err = watcher.check(eventID, state)
+	require.NoError(t, err)
+	assert.False(t, changed, "Entries are reported once")
+
+	require.NoError(t, redisClient.Set(ctx, InventoryKey(eventID), 10, 0).Err())
+	_, changed, err = watcher.check(eventID, state)
+	require.NoError(t, err)
+	assert.True(t, changed, "Inventory changes are changes")
+}
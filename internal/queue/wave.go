@@ -0,0 +1,361 @@
+package queue
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/metrics"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+//go:embed lua/wave_admit.lua
+var waveAdmitScript string
+
+// ErrStaleFence is returned when a wave is refused because a newer leader already ran one
+var ErrStaleFence = errors.New("wave refused: stale leader fence")
+
+// WavePolicy switches an event from the Enter-time token bucket to wave admission:
+// every Interval the leader marks the next Size waiting tokens ready with a deadline.
+// The size adapts to the reservation backend's latency and error rate.
+type WavePolicy struct {
+	IntervalSeconds int     `json:"interval_sec"`      // Time between waves
+	Size            int     `json:"size"`              // Initial wave size
+	MinSize         int     `json:"min_size"`          // Lower bound when the backend struggles
+	MaxSize         int     `json:"max_size"`          // Upper bound when the backend is healthy
+	DeadlineSeconds int     `json:"deadline_sec"`      // Time a marked user has to call Enter
+	TargetLatencyMs int     `json:"target_latency_ms"` // Average reservation latency above which waves shrink
+	MaxErrorRate    float64 `json:"max_error_rate"`    // Reservation error rate above which waves shrink (0-1)
+}
+
+func (w *WavePolicy) validate() error {
+	if w.IntervalSeconds < 1 || w.DeadlineSeconds < 1 {
+		return fmt.Errorf("wave: interval_sec and deadline_sec must be at least 1")
+	}
+	if w.MinSize < 1 || w.MaxSize < w.MinSize || w.Size < w.MinSize || w.Size > w.MaxSize {
+		return fmt.Errorf("wave: sizes must satisfy 1 <= min_size <= size <= max_size")
+	}
+	if w.TargetLatencyMs < 1 {
+		return fmt.Errorf("wave: target_latency_ms must be at least 1")
+	}
+	if w.MaxErrorRate <= 0 || w.MaxErrorRate > 1 {
+		return fmt.Errorf("wave: max_error_rate must be in (0, 1]")
+	}
+	return nil
+}
+
+// Interval returns the time between waves
+func (w *WavePolicy) Interval() time.Duration {
+	return time.Duration(w.IntervalSeconds) * time.Second
+}
+
+// WaveFeedback summarizes reservation backend calls since the previous wave
+type WaveFeedback struct {
+	Requests  int64
+	Errors    int64
+	LatencyMs int64 // Sum over all requests
+}
+
+// NextSize adapts the wave size (AIMD): halve it when the backend is slow or
+// failing, grow it by a tenth of the initial size when latency is well below target.
+// Without feedback the size is kept.
+func (w *WavePolicy) NextSize(current int, feedback WaveFeedback) int {
+	if current <= 0 {
+		current = w.Size
+	}
+
+	if feedback.Requests > 0 {
+		errorRate := float64(feedback.Errors) / float64(feedback.Requests)
+		avgLatency := feedback.LatencyMs / feedback.Requests
+
+		switch {
+		case errorRate > w.MaxErrorRate || avgLatency > int64(w.TargetLatencyMs):
+			current /= 2
+		case avgLatency < int64(w.TargetLatencyMs)/2:
+			step := w.Size / 10
+			if step < 1 {
+				step = 1
+			}
+			current += step
+		}
+	}
+
+	if current < w.MinSize {
+		return w.MinSize
+	}
+	if current > w.MaxSize {
+		return w.MaxSize
+	}
+	return current
+}
+
+// WaveShares splits a wave across lanes by weight, as the interleaved admission
+// order would: each slot goes to the lane with the fewest slots per unit of weight
+// that still has waiters. Lanes are visited in name order ("" first) on ties.
+func (p *QueuePolicy) WaveShares(size int, laneSizes map[string]int64) map[string]int {
+	lanes := make([]string, 0, len(laneSizes))
+	for lane, n := range laneSizes {
+		if n > 0 {
+			lanes = append(lanes, lane)
+		}
+	}
+	sort.Strings(lanes)
+
+	shares := make(map[string]int, len(lanes))
+	for slot := 0; slot < size; slot++ {
+		best := ""
+		bestLoad := -1.0
+		for _, lane := range lanes {
+			if int64(shares[lane]) >= laneSizes[lane] {
+				continue
+			}
+			load := float64(shares[lane]) / float64(p.laneWeight(lane))
+			if bestLoad < 0 || load < bestLoad {
+				best, bestLoad = lane, load
+			}
+		}
+		if bestLoad < 0 {
+			break // Every lane is exhausted
+		}
+		shares[best]++
+	}
+	return shares
+}
+
+// WaveReadyKey returns the ZSET of tokens marked by a wave, scored by their admission deadline
+func WaveReadyKey(eventID string) string {
+	return fmt.Sprintf("queue:wave:ready:{%s}", eventID)
+}
+
+func waveStateKey(eventID string) string {
+	return fmt.Sprintf("queue:wave:state:{%s}", eventID)
+}
+
+func waveFeedbackKey(eventID string) string {
+	return fmt.Sprintf("queue:wave:feedback:{%s}", eventID)
+}
+
+// WaveDeadline returns the admission deadline of a token marked by a wave.
+// ok is false when the token is not marked or its deadline passed.
+func WaveDeadline(ctx context.Context, redisClient redis.UniversalClient, eventID, token string) (time.Time, bool, error) {
+	score, err := redisClient.ZScore(ctx, WaveReadyKey(eventID), token).Result()
+	if err == redis.Nil {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	deadline := time.Unix(0, int64(score*float64(time.Second)))
+	return deadline, time.Now().Before(deadline), nil
+}
+
+// RecordReservationOutcome feeds a reservation backend call into the next wave size
+func RecordReservationOutcome(ctx context.Context, redisClient redis.UniversalClient, eventID string, latency time.Duration, failed bool) error {
+	key := waveFeedbackKey(eventID)
+	pipe := redisClient.Pipeline()
+	pipe.HIncrBy(ctx, key, "requests", 1)
+	pipe.HIncrBy(ctx, key, "latency_ms", latency.Milliseconds())
+	if failed {
+		pipe.HIncrBy(ctx, key, "errors", 1)
+	}
+	pipe.Expire(ctx, key, time.Hour)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// WaveResult describes one wave
+type WaveResult struct {
+	Ran    bool // False when the previous wave was less than an interval ago
+	Size   int
+	Marked int
+	Missed int
+}
+
+// WaveScheduler runs admission waves for events whose policy enables them.
+// It runs as a leader worker; waves carry the leader's fencing token so a
+// deposed leader cannot mark a wave after its successor.
+type WaveScheduler struct {
+	redisClient redis.UniversalClient
+	policies    *PolicyStore
+	controls    *ControlStore
+	admitScript *redis.Script
+	tick        time.Duration
+	logger      *logrus.Logger
+}
+
+// NewWaveScheduler creates a new wave scheduler. tick is how often due waves are
+// looked for; each event's own interval comes from its policy.
+func NewWaveScheduler(redisClient redis.UniversalClient, policies *PolicyStore, controls *ControlStore, tick time.Duration, logger *logrus.Logger) *WaveScheduler {
+	if tick <= 0 {
+		tick = time.Second
+	}
+
+	return &WaveScheduler{
+		redisClient: redisClient,
+		policies:    policies,
+		controls:    controls,
+		admitScript: redis.NewScript(waveAdmitScript),
+		tick:        tick,
+		logger:      logger,
+	}
+}
+
+// Run looks for due waves every tick until ctx is cancelled
+func (w *WaveScheduler) Run(ctx context.Context, fence int64) {
+	ticker := time.NewTicker(w.tick)
+	defer ticker.Stop()
+
+	for {
+		if err := w.runDue(ctx, fence); err == ErrStaleFence {
+			w.logger.WithField("fence", fence).Warn("Wave scheduler fenced off by a newer leader")
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *WaveScheduler) runDue(ctx context.Context, fence int64) error {
+	eventIDs, err := w.redisClient.ZRange(ctx, ActiveEventsKey, 0, -1).Result()
+	if err != nil {
+		w.logger.WithError(err).Warn("Failed to list active events")
+		return err
+	}
+
+	for _, eventID := range eventIDs {
+		policy, err := w.policies.Get(ctx, eventID)
+		if err != nil || policy.Wave == nil {
+			continue
+		}
+		// Paused and closed queues admit nobody, so no wave (deadlines keep running)
+		if control, err := w.controls.Get(ctx, eventID); err != nil || !control.AdmitsEntries() {
+			continue
+		}
+
+		result, err := w.RunWave(ctx, policy, fence)
+		if err == ErrStaleFence {
+			return err
+		}
+		if err != nil {
+			metrics.RecordWave("failure", 0, 0)
+			w.logger.WithError(err).WithField("event_id", eventID).Error("Admission wave failed")
+			continue
+		}
+		if !result.Ran {
+			continue
+		}
+		metrics.RecordWave("success", result.Marked, result.Missed)
+
+		if result.Marked+result.Missed > 0 {
+			w.logger.WithFields(logrus.Fields{
+				"event_id": eventID,
+				"size":     result.Size,
+				"marked":   result.Marked,
+				"missed":   result.Missed,
+			}).Info("Admission wave completed")
+		}
+	}
+	return nil
+}
+
+// RunWave marks the next wave for an event if its interval elapsed. fence is the
+// caller's leader fencing token; ErrStaleFence is returned when a newer one ran a wave.
+func (w *WaveScheduler) RunWave(ctx context.Context, policy *QueuePolicy, fence int64) (*WaveResult, error) {
+	eventID := policy.EventID
+	wave := policy.Wave
+
+	state, err := w.redisClient.HGetAll(ctx, waveStateKey(eventID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read wave state: %w", err)
+	}
+	lastAt, _ := strconv.ParseFloat(state["last_at"], 64)
+	if time.Since(time.Unix(0, int64(lastAt*float64(time.Second)))) < wave.Interval() {
+		return &WaveResult{}, nil
+	}
+
+	// Backend feedback since the previous wave; wave_admit.lua consumes it
+	// only if the wave runs
+	fields, err := w.redisClient.HGetAll(ctx, waveFeedbackKey(eventID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read wave feedback: %w", err)
+	}
+	feedback := WaveFeedback{}
+	feedback.Requests, _ = strconv.ParseInt(fields["requests"], 10, 64)
+	feedback.Errors, _ = strconv.ParseInt(fields["errors"], 10, 64)
+	feedback.LatencyMs, _ = strconv.ParseInt(fields["latency_ms"], 10, 64)
+
+	current, _ := strconv.Atoi(state["size"])
+	size := wave.NextSize(current, feedback)
+
+	laneSizes, err := LaneSizes(ctx, w.redisClient, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lane sizes: %w", err)
+	}
+	if len(laneSizes) == 1 {
+		// LaneSizes skips counting when there is a single lane
+		n, err := w.redisClient.ZCard(ctx, EventQueueKey(eventID, "")).Result()
+		if err != nil {
+			return nil, err
+		}
+		laneSizes[""] = n
+	}
+
+	// Never mark more users than the remaining inventory can still admit
+	mark := size
+	inventory, err := LoadInventory(ctx, w.redisClient, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load inventory: %w", err)
+	}
+	if available := inventory.Available(policy.OversellFactor); available >= 0 {
+		pending, err := w.redisClient.ZCount(ctx, WaveReadyKey(eventID), "("+strconv.FormatInt(time.Now().Unix(), 10), "+inf").Result()
+		if err != nil {
+			return nil, err
+		}
+		if int64(mark) > available-pending {
+			mark = int(max(available-pending, 0))
+		}
+	}
+	shares := policy.WaveShares(mark, laneSizes)
+
+	keys := []string{WaveReadyKey(eventID), waveStateKey(eventID), LifecycleKey(eventID), waveFeedbackKey(eventID)}
+	args := []interface{}{
+		wave.IntervalSeconds, wave.DeadlineSeconds, size,
+		HeartbeatKey(eventID, ""), WaitingDataKey(eventID, ""), fence, lifecycleMaxLen,
+		feedback.Requests, feedback.Errors, feedback.LatencyMs,
+	}
+	for lane := range laneSizes {
+		keys = append(keys, EventQueueKey(eventID, lane), PositionIndexKey(eventID, lane))
+		args = append(args, shares[lane])
+	}
+
+	result, err := w.admitScript.Run(ctx, w.redisClient, keys, args...).Slice()
+	if err != nil {
+		return nil, fmt.Errorf("wave script failed: %w", err)
+	}
+	if status, _ := result[0].(int64); status == 0 {
+		if reason, _ := result[1].(string); reason == "STALE_FENCE" {
+			return nil, ErrStaleFence
+		}
+		return &WaveResult{}, nil
+	}
+
+	marked, _ := result[1].(int64)
+	missed, _ := result[2].(int64)
+	return &WaveResult{
+		Ran:    true,
+		Size:   size,
+		Marked: int(marked),
+		Missed: int(missed),
+	}, nil
+}
@@ -0,0 +1,252 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/testutil"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func wavePolicy() *WavePolicy {
+	return &WavePolicy{
+		IntervalSeconds: 10,
+		Size:            100,
+		MinSize:         10,
+		MaxSize:         400,
+		DeadlineSeconds: 60,
+		TargetLatencyMs: 200,
+		MaxErrorRate:    0.05,
+	}
+}
+
+func TestWavePolicy_NextSize(t *testing.T) {
+	wave := wavePolicy()
+
+	assert.Equal(t, 100, wave.NextSize(0, WaveFeedback{}), "First wave uses the initial size")
+	assert.Equal(t, 150, wave.NextSize(150, WaveFeedback{}), "No feedback keeps the size")
+
+	// Healthy backend: additive increase
+	assert.Equal(t, 160, wave.NextSize(150, WaveFeedback{Requests: 100, LatencyMs: 100 * 50}))
+	assert.Equal(t, 400, wave.NextSize(395, WaveFeedback{Requests: 100, LatencyMs: 100 * 50}))
+
+	// Latency between half and full target: unchanged
+	assert.Equal(t, 150, wave.NextSize(150, WaveFeedback{Requests: 100, LatencyMs: 100 * 150}))
+
+	// Slow or failing backend: multiplicative decrease
+	assert.Equal(t, 75, wave.NextSize(150, WaveFeedback{Requests: 100, LatencyMs: 100 * 500}))
+	assert.Equal(t, 75, wave.NextSize(150, WaveFeedback{Requests: 100, Errors: 10, LatencyMs: 100 * 50}))
+	assert.Equal(t, 10, wave.NextSize(12, WaveFeedback{Requests: 100, Errors: 50}))
+}
+
+func TestWavePolicy_Validate(t *testing.T) {
+	policy := DefaultQueuePolicy("evt")
+	policy.Wave = wavePolicy()
+	require.NoError(t, policy.Validate())
+
+	cases := map[string]func(w *WavePolicy){
+		"zero interval":     func(w *WavePolicy) { w.IntervalSeconds = 0 },
+		"zero deadline":     func(w *WavePolicy) { w.DeadlineSeconds = 0 },
+		"size below min":    func(w *WavePolicy) { w.Size = 5 },
+		"max below min":     func(w *WavePolicy) { w.MaxSize = 5 },
+		"no latency target": func(w *WavePolicy) { w.TargetLatencyMs = 0 },
+		"error rate":        func(w *WavePolicy) { w.MaxErrorRate = 1.5 },
+	}
+	for name, mutate := range cases {
+		policy := DefaultQueuePolicy("evt")
+		policy.Wave = wavePolicy()
+		mutate(policy.Wave)
+		assert.Error(t, policy.Validate(), name)
+	}
+}
+
+func TestQueuePolicy_WaveShares(t *testing.T) {
+	policy := lanePolicy()
+
+	// 3:3:1 weights
+	assert.Equal(t, map[string]int{"": 1, "accessibility": 3, "fanclub": 3},
+		policy.WaveShares(7, map[string]int64{"": 100, "accessibility": 100, "fanclub": 100}))
+
+	// Short lanes give their slots to the others
+	assert.Equal(t, map[string]int{"": 5, "fanclub": 2},
+		policy.WaveShares(7, map[string]int64{"": 100, "accessibility": 0, "fanclub": 2}))
+
+	// Fewer waiters than slots
+	assert.Equal(t, map[string]int{"": 2, "fanclub": 1},
+		policy.WaveShares(10, map[string]int64{"": 2, "fanclub": 1}))
+
+	assert.Equal(t, map[string]int{"": 4}, DefaultQueuePolicy("evt").WaveShares(4, map[string]int64{"": 10}))
+}
+
+func TestWaveScheduler_RunWave(t *testing.T) {
+	redisClient := testutil.NewRedisClient(t)
+
+	ctx := context.Background()
+	eventID := "test-wave-evt"
+	tokens := []string{"wave-1", "wave-2", "wave-dead", "wave-3", "wave-4"}
+	cleanup := func() {
+		redisClient.Del(ctx,
+			EventQueueKey(eventID, ""), PositionIndexKey(eventID, ""), LanesKey(eventID),
+			WaveReadyKey(eventID), waveStateKey(eventID), waveFeedbackKey(eventID),
+		)
+		for _, token := range tokens {
+			redisClient.Del(ctx, HeartbeatKey(eventID, token), WaitingDataKey(eventID, token))
+		}
+	}
+	cleanup()
+	defer cleanup()
+
+	now := time.Now()
+	for i, token := range tokens {
+		z := redis.Z{Score: float64(now.Unix() + int64(i)), Member: token}
+		require.NoError(t, redisClient.ZAdd(ctx, EventQueueKey(eventID, ""), z).Err())
+		require.NoError(t, redisClient.ZAdd(ctx, PositionIndexKey(eventID, ""), z).Err())
+		data, _ := json.Marshal(map[string]interface{}{"event_id": eventID, "status": "waiting"})
+		require.NoError(t, redisClient.Set(ctx, WaitingDataKey(eventID, token), data, time.Hour).Err())
+		if token != "wave-dead" {
+			require.NoError(t, redisClient.Set(ctx, HeartbeatKey(eventID, token), "alive", time.Minute).Err())
+		}
+	}
+
+	policy := DefaultQueuePolicy(eventID)
+	policy.Wave = wavePolicy()
+	policy.Wave.Size, policy.Wave.MinSize, policy.Wave.MaxSize = 3, 1, 3
+	scheduler := NewWaveScheduler(redisClient, nil, nil, time.Second, logrus.New())
+
+	// First wave marks the first three live tokens, skipping the one without heartbeat
+	result, err := scheduler.RunWave(ctx, policy, 1)
+	require.NoError(t, err)
+	assert.True(t, result.Ran)
+	assert.Equal(t, 3, result.Marked)
+	assert.Equal(t, 0, result.Missed)
+
+	marked, err := redisClient.ZRange(ctx, WaveReadyKey(eventID), 0, -1).Result()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"wave-1", "wave-2", "wave-3"}, marked)
+
+	deadline, ok, err := WaveDeadline(ctx, redisClient, eventID, "wave-1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.WithinDuration(t, now.Add(60*time.Second), deadline, 2*time.Second)
+
+	_, ok, err = WaveDeadline(ctx, redisClient, eventID, "wave-4")
+	require.NoError(t, err)
+	assert.False(t, ok, "Tokens outside the wave are not marked")
+
+	// Within the interval nothing runs
+	result, err = scheduler.RunWave(ctx, policy, 1)
+	require.NoError(t, err)
+	assert.False(t, result.Ran)
+
+	// wave-1 misses its deadline; the next wave skips it and fills its slot
+	require.NoError(t, redisClient.ZAdd(ctx, WaveReadyKey(eventID), redis.Z{Score: float64(now.Add(-time.Second).Unix()), Member: "wave-1"}).Err())
+	require.NoError(t, redisClient.Del(ctx, waveStateKey(eventID)).Err())
+
+	result, err = scheduler.RunWave(ctx, policy, 1)
+	require.NoError(t, err)
+	assert.True(t, result.Ran)
+	assert.Equal(t, 1, result.Missed)
+	assert.Equal(t, 1, result.Marked, "wave-2 and wave-3 stay marked, only wave-4 is new")
+
+	_, err = redisClient.ZScore(ctx, EventQueueKey(eventID, ""), "wave-1").Result()
+	assert.Equal(t, redis.Nil, err, "Missed tokens leave the queue")
+
+	raw, err := redisClient.Get(ctx, WaitingDataKey(eventID, "wave-1")).Bytes()
+	require.NoError(t, err)
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal(raw, &data))
+	assert.Equal(t, "expired", data["status"])
+
+	// A newer leader ran the last wave: the old one is fenced off
+	require.NoError(t, redisClient.HSet(ctx, waveStateKey(eventID), "last_at", 0, "fence", 2).Err())
+	_, err = scheduler.RunWave(ctx, policy, 1)
+	assert.ErrorIs(t, err, ErrStaleFence)
+}
+
+func TestWaveScheduler_Feedback(t *testing.T) {
+	redisClient := testutil.NewRedisClient(t)
+
+	ctx := context.Background()
+	eventID := "test-wave-feedback-evt"
+	cleanup := func() {
+		redisClient.Del(ctx, EventQueueKey(eventID, ""), WaveReadyKey(eventID), waveStateKey(eventID), waveFeedbackKey(eventID))
+	}
+	cleanup()
+	defer cleanup()
+
+	// A failing backend halves the next wave
+	for i := 0; i < 10; i++ {
+		require.NoError(t, RecordReservationOutcome(ctx, redisClient, eventID, 50*time.Millisecond, i < 5))
+	}
+
+	policy := DefaultQueuePolicy(eventID)
+	policy.Wave = wavePolicy()
+	scheduler := NewWaveScheduler(redisClient, nil, nil, time.Second, logrus.New())
+
+	result, err := scheduler.RunWave(ctx, policy, 1)
+	require.NoError(t, err)
+	assert.True(t, result.Ran)
+	assert.Equal(t, 50, result.Size)
+
+	exists, err := redisClient.Exists(ctx, waveFeedbackKey(eventID)).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), exists, "Feedback is reset after each wave")
+
+	// A wave refused by the script leaves the feedback for the next one
+	for i := 0; i < 10; i++ {
+		require.NoError(t, RecordReservationOutcome(ctx, redisClient, eventID, 50*time.Millisecond, i < 5))
+	}
+	require.NoError(t, redisClient.HSet(ctx, waveStateKey(eventID), "last_at", 0).Err())
+	_, err = scheduler.RunWave(ctx, policy, 0)
+	assert.ErrorIs(t, err, ErrStaleFence)
+	requests, err := redisClient.HGet(ctx, waveFeedbackKey(eventID), "requests").Int()
+	require.NoError(t, err)
+	assert.Equal(t, 10, requests)
+
+	result, err = scheduler.RunWave(ctx, policy, 1)
+	require.NoError(t, err)
+	assert.True(t, result.Ran)
+	assert.Equal(t, 25, result.Size, "Halved again by the kept feedback")
+}
+
+func TestWaveScheduler_InventoryCap(t *testing.T) {
+	redisClient := testutil.NewRedisClient(t)
+
+	ctx := context.Background()
+	eventID := "test-wave-inventory-evt"
+	tokens := []string{"inv-1", "inv-2", "inv-3"}
+	cleanup := func() {
+		redisClient.Del(ctx, EventQueueKey(eventID, ""), PositionIndexKey(eventID, ""),
+			WaveReadyKey(eventID), waveStateKey(eventID), InventoryKey(eventID), GrantsKey(eventID))
+		for _, token := range tokens {
+			redisClient.Del(ctx, HeartbeatKey(eventID, token))
+		}
+	}
+	cleanup()
+	defer cleanup()
+
+	for i, token := range tokens {
+		require.NoError(t, redisClient.ZAdd(ctx, EventQueueKey(eventID, ""), redis.Z{Score: float64(i), Member: token}).Err())
+		require.NoError(t, redisClient.Set(ctx, HeartbeatKey(eventID, token), "alive", time.Minute).Err())
+	}
+
+	// Two seats left, one of them already granted: only one user is marked
+	require.NoError(t, redisClient.Set(ctx, InventoryKey(eventID), 2, 0).Err())
+	require.NoError(t, redisClient.ZAdd(ctx, GrantsKey(eventID), redis.Z{Score: float64(time.Now().Add(time.Minute).Unix()), Member: "rt"}).Err())
+
+	policy := DefaultQueuePolicy(eventID)
+	policy.Wave = wavePolicy()
+	scheduler := NewWaveScheduler(redisClient, nil, nil, time.Second, logrus.New())
+
+	result, err := scheduler.RunWave(ctx, policy, 1)
+	require.NoError(t, err)
+	assert.True(t, result.Ran)
+	assert.Equal(t, 100, result.Size, "The adaptive size is kept")
+	assert.Equal(t, 1, result.Marked)
+}
@@ -0,0 +1,12 @@
+package routes
+
+import "github.com/traffic-tacos/gateway-api/internal/middleware"
+
+// accessPolicies declares the roles and scopes routes require, enforced after
+// authentication by middleware.RBACMiddleware.Authorize. The first matching
+// policy applies; routes under a policy's group that none matches are denied,
+// other routes only need a valid token.
+var accessPolicies = []middleware.RoutePolicy{
+	// Queue policies, pause/drain/close, analytics and flushing test data
+	{Path: "/api/v1/admin/*", Roles: []string{middleware.RoleAdmin}},
+}
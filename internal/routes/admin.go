@@ -4,6 +4,9 @@ import (
 	"context"
 	"time"
 
+	"github.com/traffic-tacos/gateway-api/internal/auth"
+	"github.com/traffic-tacos/gateway-api/internal/queue"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
@@ -11,12 +14,18 @@ import (
 
 type AdminHandler struct {
 	redisClient redis.UniversalClient
+	policies    *queue.PolicyStore
+	controls    *queue.ControlStore
+	loginGuard  *auth.LoginGuard
 	logger      *logrus.Logger
 }
 
-func NewAdminHandler(redisClient redis.UniversalClient, logger *logrus.Logger) *AdminHandler {
+func NewAdminHandler(redisClient redis.UniversalClient, policies *queue.PolicyStore, controls *queue.ControlStore, loginGuard *auth.LoginGuard, logger *logrus.Logger) *AdminHandler {
 	return &AdminHandler{
 		redisClient: redisClient,
+		policies:    policies,
+		controls:    controls,
+		loginGuard:  loginGuard,
 		logger:      logger,
 	}
 }
@@ -26,8 +35,11 @@ func NewAdminHandler(redisClient redis.UniversalClient, logger *logrus.Logger) *
 // @Description Clear all test-related data from Redis (queues, idempotency, heartbeats) for k6 load testing
 // @Tags Admin
 // @Produce json
+// @Security Bearer
 // @Param patterns query string false "Comma-separated key patterns (default: queue:*,idempotency:*,heartbeat:*,dedupe:*,stream:*,allow:*)"
 // @Success 200 {object} map[string]interface{} "Success with deleted keys count"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Admin role required"
 // @Failure 500 {object} map[string]interface{} "Internal error"
 // @Router /admin/flush-test-data [post]
 func (a *AdminHandler) FlushTestData(c *fiber.Ctx) error {
@@ -168,7 +180,10 @@ func (a *AdminHandler) deleteBatch(ctx context.Context, keys []string) (int, err
 // @Description Get service health status including Redis connectivity
 // @Tags Admin
 // @Produce json
+// @Security Bearer
 // @Success 200 {object} map[string]interface{} "Service is healthy"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Admin role required"
 // @Failure 503 {object} map[string]interface{} "Service is unhealthy"
 // @Router /admin/health [get]
 func (a *AdminHandler) HealthCheck(c *fiber.Ctx) error {
@@ -199,7 +214,10 @@ func (a *AdminHandler) HealthCheck(c *fiber.Ctx) error {
 // @Description Get current Redis connection and key statistics
 // @Tags Admin
 // @Produce json
+// @Security Bearer
 // @Success 200 {object} map[string]interface{} "Redis statistics"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Admin role required"
 // @Failure 500 {object} map[string]interface{} "Internal error"
 // @Router /admin/stats [get]
 func (a *AdminHandler) GetStats(c *fiber.Ctx) error {
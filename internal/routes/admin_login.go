@@ -0,0 +1,40 @@
+package routes
+
+import (
+	"context"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// UnlockUser clears the login failures and lockout of an account
+// @Summary Unlock account
+// @Description Clear the failed login count, backoff and lockout of a username. The unlock is recorded in the login events stream.
+// @Tags Admin
+// @Produce json
+// @Security Bearer
+// @Param username path string true "Username"
+// @Success 200 {object} map[string]interface{} "Unlocked"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Admin role required"
+// @Failure 500 {object} map[string]interface{} "Internal error"
+// @Router /admin/users/{username}/unlock [post]
+func (a *AdminHandler) UnlockUser(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	username := c.Params("username")
+	wasLocked, err := a.loginGuard.Unlock(ctx, username, middleware.GetUserID(c))
+	if err != nil {
+		a.logger.WithError(err).WithField("username", username).Error("Failed to unlock account")
+		return a.errorResponse(c, fiber.StatusInternalServerError, "UNLOCK_ERROR", "Failed to unlock account")
+	}
+
+	return c.JSON(fiber.Map{
+		"username":   username,
+		"unlocked":   true,
+		"was_locked": wasLocked,
+	})
+}
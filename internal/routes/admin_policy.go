@@ -0,0 +1,146 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/queue"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// QueuePolicyResponse wraps a policy with where it came from
+type QueuePolicyResponse struct {
+	EventID string             `json:"event_id"`
+	Source  string             `json:"source"` // custom|default
+	Policy  *queue.QueuePolicy `json:"policy"`
+}
+
+// GetQueuePolicy returns the effective queue policy for an event
+// @Summary Get event queue policy
+// @Description Get the admission policy for an event. Returns the defaults when no policy is stored.
+// @Tags Admin
+// @Produce json
+// @Security Bearer
+// @Param id path string true "Event ID"
+// @Success 200 {object} QueuePolicyResponse
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Admin role required"
+// @Failure 500 {object} map[string]interface{} "Internal error"
+// @Router /admin/events/{id}/policy [get]
+func (a *AdminHandler) GetQueuePolicy(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	eventID := c.Params("id")
+	policy, err := a.policies.Load(ctx, eventID)
+	if err == redis.Nil {
+		return c.JSON(QueuePolicyResponse{
+			EventID: eventID,
+			Source:  "default",
+			Policy:  queue.DefaultQueuePolicy(eventID),
+		})
+	}
+	if err != nil {
+		a.logger.WithError(err).WithField("event_id", eventID).Error("Failed to load queue policy")
+		return a.errorResponse(c, fiber.StatusInternalServerError, "POLICY_ERROR", "Failed to load queue policy")
+	}
+
+	return c.JSON(QueuePolicyResponse{
+		EventID: eventID,
+		Source:  "custom",
+		Policy:  policy,
+	})
+}
+
+// PutQueuePolicy creates or updates the queue policy for an event
+// @Summary Set event queue policy
+// @Description Create or update the admission policy for an event. Omitted fields keep their current value (or the default).
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path string true "Event ID"
+// @Param request body queue.QueuePolicy true "Queue policy"
+// @Success 200 {object} QueuePolicyResponse
+// @Failure 400 {object} map[string]interface{} "Invalid policy"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Admin role required"
+// @Failure 500 {object} map[string]interface{} "Internal error"
+// @Router /admin/events/{id}/policy [put]
+func (a *AdminHandler) PutQueuePolicy(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	eventID := c.Params("id")
+
+	// Merge the request onto the current policy so partial updates are possible
+	policy, err := a.policies.Load(ctx, eventID)
+	if err == redis.Nil {
+		policy = queue.DefaultQueuePolicy(eventID)
+	} else if err != nil {
+		a.logger.WithError(err).WithField("event_id", eventID).Error("Failed to load queue policy")
+		return a.errorResponse(c, fiber.StatusInternalServerError, "POLICY_ERROR", "Failed to load queue policy")
+	}
+
+	if err := json.Unmarshal(c.Body(), policy); err != nil {
+		return a.errorResponse(c, fiber.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+	}
+	policy.EventID = eventID // Path wins over body
+
+	if err := policy.Validate(); err != nil {
+		return a.errorResponse(c, fiber.StatusBadRequest, "INVALID_POLICY", err.Error())
+	}
+
+	if err := a.policies.Set(ctx, policy); err != nil {
+		a.logger.WithError(err).WithField("event_id", eventID).Error("Failed to store queue policy")
+		return a.errorResponse(c, fiber.StatusInternalServerError, "POLICY_ERROR", "Failed to store queue policy")
+	}
+
+	return c.JSON(QueuePolicyResponse{
+		EventID: eventID,
+		Source:  "custom",
+		Policy:  policy,
+	})
+}
+
+// DeleteQueuePolicy resets an event to the default queue policy
+// @Summary Reset event queue policy
+// @Description Remove the stored admission policy so the event uses the defaults
+// @Tags Admin
+// @Produce json
+// @Security Bearer
+// @Param id path string true "Event ID"
+// @Success 200 {object} QueuePolicyResponse
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Admin role required"
+// @Failure 500 {object} map[string]interface{} "Internal error"
+// @Router /admin/events/{id}/policy [delete]
+func (a *AdminHandler) DeleteQueuePolicy(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	eventID := c.Params("id")
+	if err := a.policies.Delete(ctx, eventID); err != nil {
+		a.logger.WithError(err).WithField("event_id", eventID).Error("Failed to delete queue policy")
+		return a.errorResponse(c, fiber.StatusInternalServerError, "POLICY_ERROR", "Failed to delete queue policy")
+	}
+
+	return c.JSON(QueuePolicyResponse{
+		EventID: eventID,
+		Source:  "default",
+		Policy:  queue.DefaultQueuePolicy(eventID),
+	})
+}
+
+func (a *AdminHandler) errorResponse(c *fiber.Ctx, status int, code, message string) error {
+	return c.Status(status).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":     code,
+			"message":  message,
+			"trace_id": c.Get("X-Request-ID"),
+		},
+	})
+}
@@ -0,0 +1,56 @@
+package routes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/traffic-tacos/gateway-api/internal/queue"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueuePolicyRoutes_RequireAdmin(t *testing.T) {
+	admin := newAdminTestApp(t)
+	ctx := context.Background()
+	eventID := "test-admin-policy-evt"
+	path := "/api/v1/admin/events/" + eventID + "/policy"
+
+	stored := queue.DefaultQueuePolicy(eventID)
+	stored.AdmissionWindow = 7
+	stored.VIPBypassPositions = 0
+	require.NoError(t, admin.handler.policies.Set(ctx, stored))
+	t.Cleanup(func() { _ = admin.handler.policies.Delete(ctx, eventID) })
+
+	update := []byte(`{"admission_window": 3}`)
+	routes := []struct {
+		method string
+		body   []byte
+	}{
+		{fiber.MethodGet, nil},
+		{fiber.MethodPut, update},
+		{fiber.MethodDelete, nil},
+	}
+
+	for _, route := range routes {
+		t.Run(route.method, func(t *testing.T) {
+			resp := admin.request(t, "", route.method, path, route.body)
+			assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode, "Anonymous callers are rejected")
+
+			resp = admin.request(t, "user", route.method, path, route.body)
+			assert.Equal(t, fiber.StatusForbidden, resp.StatusCode, "Callers without the admin role are rejected")
+		})
+	}
+
+	// Rejected callers left the stored policy alone
+	policy, err := admin.handler.policies.Load(ctx, eventID)
+	require.NoError(t, err)
+	assert.Equal(t, 7, policy.AdmissionWindow)
+
+	resp := admin.request(t, "admin", fiber.MethodPut, path, update)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	policy, err = admin.handler.policies.Load(ctx, eventID)
+	require.NoError(t, err)
+	assert.Equal(t, 3, policy.AdmissionWindow)
+}
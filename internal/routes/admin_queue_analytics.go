@@ -0,0 +1,70 @@
+package routes
+
+import (
+	"context"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/queue"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// QueueAnalyticsResponse is the live view of an event queue with its last hour
+type QueueAnalyticsResponse struct {
+	*queue.QueueAnalytics
+	ResolutionSeconds int                     `json:"resolution_sec"`
+	Series            []queue.AnalyticsSample `json:"series"` // Last hour, oldest first
+
+	// How the learned ETA would have done over the last hour
+	ETABacktest *queue.BacktestResult `json:"eta_backtest,omitempty"`
+}
+
+// etaBacktestPositions are the queue positions the ETA backtest predicts
+var etaBacktestPositions = []int{10, 100, 1000}
+
+// GetQueueAnalytics returns live analytics of an event queue
+// @Summary Get event queue analytics
+// @Description Queue depth, admission rates over 1/5/15 minutes, weighted rate, ETA confidence,
+// @Description heartbeat-expired tokens, oldest waiter age and outstanding reservation tokens,
+// @Description with a time series of the last hour at 10s resolution and a backtest of the learned ETA
+// @Tags Admin
+// @Produce json
+// @Security Bearer
+// @Param id path string true "Event ID"
+// @Success 200 {object} QueueAnalyticsResponse
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Admin role required"
+// @Failure 500 {object} map[string]interface{} "Internal error"
+// @Router /admin/events/{id}/queue [get]
+func (a *AdminHandler) GetQueueAnalytics(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	eventID := c.Params("id")
+	analytics, err := queue.LoadQueueAnalytics(ctx, a.redisClient, eventID, a.logger)
+	if err != nil {
+		a.logger.WithError(err).WithField("event_id", eventID).Error("Failed to load queue analytics")
+		return a.errorResponse(c, fiber.StatusInternalServerError, "QUEUE_ANALYTICS_ERROR", "Failed to load queue analytics")
+	}
+
+	series, err := queue.LoadAnalyticsSeries(ctx, a.redisClient, eventID)
+	if err != nil {
+		a.logger.WithError(err).WithField("event_id", eventID).Error("Failed to load queue analytics series")
+		return a.errorResponse(c, fiber.StatusInternalServerError, "QUEUE_ANALYTICS_ERROR", "Failed to load queue analytics")
+	}
+
+	response := QueueAnalyticsResponse{
+		QueueAnalytics:    analytics,
+		ResolutionSeconds: int(queue.AnalyticsResolution / time.Second),
+		Series:            series,
+	}
+
+	backtest, err := queue.DefaultETAPredictor().BacktestEvent(ctx, a.redisClient, eventID, etaBacktestPositions)
+	if err != nil {
+		a.logger.WithError(err).WithField("event_id", eventID).Warn("Failed to backtest queue ETA")
+	} else {
+		response.ETABacktest = &backtest
+	}
+
+	return c.JSON(response)
+}
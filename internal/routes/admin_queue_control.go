@@ -0,0 +1,93 @@
+package routes
+
+import (
+	"context"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/queue"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// queueControlActions maps admin actions to the queue state they set
+var queueControlActions = map[string]queue.QueueState{
+	"pause":  queue.QueueStatePaused,
+	"resume": queue.QueueStateOpen,
+	"drain":  queue.QueueStateDraining,
+	"close":  queue.QueueStateClosed,
+}
+
+// QueueControlRequest is the optional body of a queue control action
+type QueueControlRequest struct {
+	Reason string `json:"reason,omitempty"` // Shown to waiting users
+}
+
+// GetQueueState returns the operational state of an event queue
+// @Summary Get event queue state
+// @Description Get whether an event queue is open, paused, draining or closed
+// @Tags Admin
+// @Produce json
+// @Security Bearer
+// @Param id path string true "Event ID"
+// @Success 200 {object} queue.QueueControl
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Admin role required"
+// @Failure 500 {object} map[string]interface{} "Internal error"
+// @Router /admin/events/{id}/queue/state [get]
+func (a *AdminHandler) GetQueueState(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	eventID := c.Params("id")
+	control, err := a.controls.Get(ctx, eventID)
+	if err != nil {
+		a.logger.WithError(err).WithField("event_id", eventID).Error("Failed to load queue state")
+		return a.errorResponse(c, fiber.StatusInternalServerError, "QUEUE_STATE_ERROR", "Failed to load queue state")
+	}
+
+	return c.JSON(control)
+}
+
+// SetQueueState pauses, resumes, drains or closes an event queue
+// @Summary Control event queue
+// @Description pause: joins continue, Enter returns QUEUE_PAUSED. resume: back to normal operation.
+// @Description drain: new joins are rejected with QUEUE_DRAINING, remaining users are still admitted.
+// @Description close: every waiting user is expired with the given reason and joins return QUEUE_CLOSED.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path string true "Event ID"
+// @Param action path string true "pause|resume|drain|close"
+// @Param request body QueueControlRequest false "Reason shown to waiting users"
+// @Success 200 {object} queue.QueueControl
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Admin role required"
+// @Failure 500 {object} map[string]interface{} "Internal error"
+// @Router /admin/events/{id}/queue/{action} [post]
+func (a *AdminHandler) SetQueueState(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	eventID := c.Params("id")
+	state, ok := queueControlActions[c.Params("action")]
+	if !ok {
+		return a.errorResponse(c, fiber.StatusBadRequest, "INVALID_ACTION", "action must be one of pause, resume, drain, close")
+	}
+
+	var req QueueControlRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return a.errorResponse(c, fiber.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		}
+	}
+
+	control, err := a.controls.Set(ctx, eventID, state, req.Reason)
+	if err != nil {
+		a.logger.WithError(err).WithField("event_id", eventID).Error("Failed to store queue state")
+		return a.errorResponse(c, fiber.StatusInternalServerError, "QUEUE_STATE_ERROR", "Failed to store queue state")
+	}
+
+	return c.JSON(control)
+}
@@ -0,0 +1,52 @@
+package routes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/traffic-tacos/gateway-api/internal/queue"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueueControlRoutes_RequireAdmin(t *testing.T) {
+	admin := newAdminTestApp(t)
+	ctx := context.Background()
+	eventID := "test-admin-control-evt"
+	basePath := "/api/v1/admin/events/" + eventID + "/queue/"
+	t.Cleanup(func() { _, _ = admin.handler.controls.Set(ctx, eventID, queue.QueueStateOpen, "") })
+
+	routes := []struct {
+		method string
+		path   string
+	}{
+		{fiber.MethodGet, basePath + "state"},
+		{fiber.MethodPost, basePath + "pause"},
+		{fiber.MethodPost, basePath + "resume"},
+		{fiber.MethodPost, basePath + "drain"},
+		{fiber.MethodPost, basePath + "close"},
+	}
+
+	for _, route := range routes {
+		t.Run(route.method+" "+route.path, func(t *testing.T) {
+			resp := admin.request(t, "", route.method, route.path, nil)
+			assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode, "Anonymous callers are rejected")
+
+			resp = admin.request(t, "user", route.method, route.path, nil)
+			assert.Equal(t, fiber.StatusForbidden, resp.StatusCode, "Callers without the admin role are rejected")
+		})
+	}
+
+	// Rejected callers left the queue open
+	control, err := admin.handler.controls.Get(ctx, eventID)
+	require.NoError(t, err)
+	assert.Equal(t, queue.QueueStateOpen, control.State)
+
+	resp := admin.request(t, "admin", fiber.MethodPost, basePath+"pause", []byte(`{"reason": "maintenance"}`))
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	control, err = admin.handler.controls.Get(ctx, eventID)
+	require.NoError(t, err)
+	assert.Equal(t, queue.QueueStatePaused, control.State)
+}
@@ -0,0 +1,69 @@
+package routes
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/auth"
+	"github.com/traffic-tacos/gateway-api/internal/config"
+	"github.com/traffic-tacos/gateway-api/internal/middleware"
+	"github.com/traffic-tacos/gateway-api/internal/queue"
+	"github.com/traffic-tacos/gateway-api/internal/testutil"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+const adminTestSecret = "admin-test-secret"
+
+// adminTestApp serves the admin routes behind the production authentication
+// and access policies. Callers authenticate with HS256 tokens.
+type adminTestApp struct {
+	app     *fiber.App
+	handler *AdminHandler
+}
+
+func newAdminTestApp(t *testing.T) *adminTestApp {
+	redisClient := testutil.NewRedisClient(t)
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+
+	jwtConfig := &config.JWTConfig{Secret: adminTestSecret, HMACVerification: true}
+	authMiddleware, err := middleware.NewAuthMiddleware(jwtConfig, redisClient, nil, logger)
+	require.NoError(t, err)
+	middlewareManager := &middleware.Manager{
+		Auth: authMiddleware,
+		RBAC: middleware.NewRBACMiddleware(redisClient, logger),
+	}
+
+	handler := NewAdminHandler(redisClient, queue.NewPolicyStore(redisClient, logger), queue.NewControlStore(redisClient, logger),
+		auth.NewLoginGuard(redisClient, &config.LoginConfig{}, logger), logger)
+
+	app := fiber.New()
+	setupAdminRoutes(app.Group("/api/v1"), middlewareManager, handler)
+	return &adminTestApp{app: app, handler: handler}
+}
+
+// request calls the admin routes as a caller with role (anonymously when empty)
+func (a *adminTestApp) request(t *testing.T, role, method, path string, body []byte) *http.Response {
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	if role != "" {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"sub":  role + "-1",
+			"role": role,
+			"exp":  time.Now().Add(time.Minute).Unix(),
+		}).SignedString([]byte(adminTestSecret))
+		require.NoError(t, err)
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	}
+
+	resp, err := a.app.Test(req, -1)
+	require.NoError(t, err)
+	return resp
+}
@@ -2,7 +2,10 @@ package routes
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"strconv"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -12,33 +15,55 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/traffic-tacos/gateway-api/internal/auth"
+	"github.com/traffic-tacos/gateway-api/internal/middleware"
 	"github.com/traffic-tacos/gateway-api/internal/models"
+	"github.com/traffic-tacos/gateway-api/internal/queue"
 )
 
+// errUserNotFound is returned by getUserByUsername and getUserByID for
+// unknown users
+var errUserNotFound = errors.New("user not found")
+
+// dummyPasswordHash is compared against for unknown usernames, at the cost
+// Register hashes passwords with
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password-for-timing"), bcrypt.DefaultCost)
+
 // AuthHandler handles authentication endpoints
 type AuthHandler struct {
 	dynamoClient *dynamodb.Client
+	sessions     *auth.SessionStore
+	luaExecutor  *queue.LuaExecutor // Upgrades anonymous waiting tokens on login
+	policies     *queue.PolicyStore // Rejoin mode of the events upgraded on login
+	loginGuard   *auth.LoginGuard   // Backoff and lockout after failed logins
+	signingKeys  *auth.KeyRing
 	tableName    string
-	jwtSecret    string
+	issuer       string
 	logger       *logrus.Logger
 }
 
 // NewAuthHandler creates a new auth handler
-func NewAuthHandler(dynamoClient *dynamodb.Client, tableName string, jwtSecret string, logger *logrus.Logger) *AuthHandler {
+func NewAuthHandler(dynamoClient *dynamodb.Client, redisClient redis.UniversalClient, policies *queue.PolicyStore, sessions *auth.SessionStore, signingKeys *auth.KeyRing, loginGuard *auth.LoginGuard, tableName string, issuer string, logger *logrus.Logger) *AuthHandler {
 	return &AuthHandler{
 		dynamoClient: dynamoClient,
+		sessions:     sessions,
+		luaExecutor:  queue.NewLuaExecutor(redisClient, logger),
+		policies:     policies,
+		loginGuard:   loginGuard,
+		signingKeys:  signingKeys,
 		tableName:    tableName,
-		jwtSecret:    jwtSecret,
+		issuer:       issuer,
 		logger:       logger,
 	}
 }
 
 // Login handles user login
 // @Summary User login
-// @Description Authenticate user and return JWT token
+// @Description Authenticate user and return a short-lived access token with a refresh token
 // @Tags Auth
 // @Accept json
 // @Produce json
@@ -46,6 +71,7 @@ func NewAuthHandler(dynamoClient *dynamodb.Client, tableName string, jwtSecret s
 // @Success 200 {object} models.AuthResponse
 // @Failure 400 {object} map[string]interface{} "Invalid request"
 // @Failure 401 {object} map[string]interface{} "Invalid credentials"
+// @Failure 429 {object} map[string]interface{} "Too many failed attempts (Retry-After header)"
 // @Failure 500 {object} map[string]interface{} "Internal error"
 // @Router /auth/login [post]
 func (h *AuthHandler) Login(c *fiber.Ctx) error {
@@ -59,9 +85,21 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 		})
 	}
 
+	// Backoff and lockout after repeated failures for this username or IP
+	clientIP := c.IP()
+	if decision := h.loginGuard.Check(c.Context(), req.Username, clientIP); !decision.Allowed {
+		return h.throttledError(c, req.Username, clientIP, decision)
+	}
+
 	// Get user by username from DynamoDB
 	user, err := h.getUserByUsername(c.Context(), req.Username)
 	if err != nil {
+		// Unknown users get the same bcrypt comparison, so the response time
+		// does not tell which usernames exist
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(req.Password))
+		if errors.Is(err, errUserNotFound) {
+			h.loginGuard.RecordFailure(c.Context(), req.Username, clientIP)
+		}
 		h.logger.WithError(err).WithField("username", req.Username).Warn("User not found")
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": fiber.Map{
@@ -73,6 +111,7 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 
 	// Verify password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		h.loginGuard.RecordFailure(c.Context(), req.Username, clientIP)
 		h.logger.WithError(err).WithField("username", req.Username).Warn("Invalid password")
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": fiber.Map{
@@ -81,9 +120,10 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 			},
 		})
 	}
+	h.loginGuard.RecordSuccess(c.Context(), req.Username)
 
-	// Generate JWT token
-	token, expiresIn, err := h.generateJWT(user)
+	// Start a session: access token + refresh token
+	resp, err := h.issueTokens(c.Context(), user)
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to generate JWT")
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -94,19 +134,15 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 		})
 	}
 
+	// Waiting tokens joined anonymously from this session now belong to the user
+	upgradeSession(c.Context(), h.luaExecutor, h.policies, h.logger, middleware.GetAnonymousID(c), user.UserID)
+
 	h.logger.WithFields(logrus.Fields{
 		"user_id":  user.UserID,
 		"username": user.Username,
 	}).Info("User logged in successfully")
 
-	return c.JSON(models.AuthResponse{
-		Token:       token,
-		UserID:      user.UserID,
-		Username:    user.Username,
-		DisplayName: user.DisplayName,
-		Role:        user.Role,
-		ExpiresIn:   expiresIn,
-	})
+	return c.JSON(resp)
 }
 
 // Register handles user registration
@@ -179,8 +215,8 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 		})
 	}
 
-	// Generate JWT token
-	token, expiresIn, err := h.generateJWT(user)
+	// Start a session: access token + refresh token
+	resp, err := h.issueTokens(c.Context(), user)
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to generate JWT")
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -191,18 +227,221 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 		})
 	}
 
+	// Registering logs the user in: the same hand-over as Login
+	upgradeSession(c.Context(), h.luaExecutor, h.policies, h.logger, middleware.GetAnonymousID(c), user.UserID)
+
 	h.logger.WithFields(logrus.Fields{
 		"user_id":  user.UserID,
 		"username": user.Username,
 	}).Info("User registered successfully")
 
-	return c.Status(fiber.StatusCreated).JSON(models.AuthResponse{
-		Token:       token,
-		UserID:      user.UserID,
-		Username:    user.Username,
-		DisplayName: user.DisplayName,
-		Role:        user.Role,
-		ExpiresIn:   expiresIn,
+	return c.Status(fiber.StatusCreated).JSON(resp)
+}
+
+// Refresh handles access token renewal
+// @Summary Refresh access token
+// @Description Exchange a refresh token for a new access token and a new refresh token. Each refresh token works once; presenting one that was already used revokes its session. The new access token carries the user's current profile; a deleted user or a changed role revokes all of the user's sessions.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param request body models.RefreshRequest true "Refresh token"
+// @Success 200 {object} models.AuthResponse
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 401 {object} map[string]interface{} "Invalid, expired or reused refresh token, or the account changed since login"
+// @Failure 500 {object} map[string]interface{} "Internal error"
+// @Router /auth/refresh [post]
+func (h *AuthHandler) Refresh(c *fiber.Ctx) error {
+	var req models.RefreshRequest
+	if err := c.BodyParser(&req); err != nil || req.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INVALID_REQUEST",
+				"message": "refresh_token is required",
+			},
+		})
+	}
+
+	session, refreshToken, err := h.sessions.Rotate(c.Context(), req.RefreshToken)
+	switch {
+	case errors.Is(err, auth.ErrRefreshTokenReused):
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "REFRESH_TOKEN_REUSED",
+				"message": "Refresh token was already used; the session has been revoked",
+			},
+		})
+	case errors.Is(err, auth.ErrRefreshTokenInvalid):
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INVALID_REFRESH_TOKEN",
+				"message": "Refresh token is invalid or expired",
+			},
+		})
+	case err != nil:
+		h.logger.WithError(err).Error("Failed to rotate refresh token")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "TOKEN_ERROR",
+				"message": "Failed to refresh token",
+			},
+		})
+	}
+
+	// The access token carries the user's current role, not the one they had at
+	// login: a deleted user or a changed role ends every session of the user
+	user, err := h.getUserByID(c.Context(), session.UserID)
+	switch {
+	case errors.Is(err, errUserNotFound):
+		return h.revokeOnRefresh(c, session.UserID, "User no longer exists")
+	case err != nil:
+		h.logger.WithError(err).WithField("user_id", session.UserID).Error("Failed to load user")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "TOKEN_ERROR",
+				"message": "Failed to refresh token",
+			},
+		})
+	case user.Role != session.Role:
+		return h.revokeOnRefresh(c, session.UserID, "User role changed")
+	}
+
+	token, expiresIn, err := h.generateJWT(c.Context(), user, session.ID)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to generate JWT")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "TOKEN_ERROR",
+				"message": "Failed to generate token",
+			},
+		})
+	}
+
+	return c.JSON(h.authResponse(user, session, token, refreshToken, expiresIn))
+}
+
+// Logout handles logout of the current session
+// @Summary Logout
+// @Description Revoke the access token and its session; its refresh token stops working
+// @Tags Auth
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} map[string]interface{} "Logged out"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 500 {object} map[string]interface{} "Internal error"
+// @Router /auth/logout [post]
+func (h *AuthHandler) Logout(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	claims := middleware.GetUserClaims(c)
+
+	tokenID, _ := claims["jti"].(string)
+	expiresAt, _ := claims["exp"].(float64)
+	if err := h.sessions.RevokeToken(c.Context(), userID, tokenID, time.Unix(int64(expiresAt), 0)); err != nil {
+		h.logger.WithError(err).WithField("user_id", userID).Error("Failed to revoke token")
+		return h.logoutError(c)
+	}
+
+	if sessionID, _ := claims["sid"].(string); sessionID != "" {
+		if err := h.sessions.Revoke(c.Context(), userID, sessionID); err != nil {
+			h.logger.WithError(err).WithField("user_id", userID).Error("Failed to revoke session")
+			return h.logoutError(c)
+		}
+	}
+
+	h.logger.WithField("user_id", userID).Info("User logged out")
+
+	return c.JSON(fiber.Map{
+		"status": "logged_out",
+	})
+}
+
+// LogoutAll handles logout of every session of the user
+// @Summary Logout everywhere
+// @Description Revoke every session and access token of the user, on all devices
+// @Tags Auth
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} map[string]interface{} "Logged out"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 500 {object} map[string]interface{} "Internal error"
+// @Router /auth/logout-all [post]
+func (h *AuthHandler) LogoutAll(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	revoked, err := h.sessions.RevokeAll(c.Context(), userID)
+	if err != nil {
+		h.logger.WithError(err).WithField("user_id", userID).Error("Failed to revoke sessions")
+		return h.logoutError(c)
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"user_id":  userID,
+		"sessions": revoked,
+	}).Info("User logged out of all sessions")
+
+	return c.JSON(fiber.Map{
+		"status":           "logged_out",
+		"sessions_revoked": revoked,
+	})
+}
+
+// revokeOnRefresh ends every session of a user whose account changed since
+// login and refuses the refresh
+func (h *AuthHandler) revokeOnRefresh(c *fiber.Ctx, userID, reason string) error {
+	count, err := h.sessions.RevokeAll(c.Context(), userID)
+	if err != nil {
+		h.logger.WithError(err).WithField("user_id", userID).Error("Failed to revoke sessions")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "TOKEN_ERROR",
+				"message": "Failed to refresh token",
+			},
+		})
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"user_id":  userID,
+		"sessions": count,
+	}).Warn(reason + ", sessions revoked on refresh")
+
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":    "SESSION_REVOKED",
+			"message": "The account changed since login; please log in again",
+		},
+	})
+}
+
+func (h *AuthHandler) logoutError(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":    "LOGOUT_ERROR",
+			"message": "Failed to revoke session",
+		},
+	})
+}
+
+// throttledError refuses a login attempt made during backoff or lockout
+func (h *AuthHandler) throttledError(c *fiber.Ctx, username, clientIP string, decision auth.LoginDecision) error {
+	retryAfter := int(math.Ceil(decision.RetryAfter.Seconds()))
+	h.logger.WithFields(logrus.Fields{
+		"username":    username,
+		"client_ip":   clientIP,
+		"subject":     decision.Subject,
+		"locked":      decision.Locked,
+		"retry_after": retryAfter,
+	}).Warn("Login attempt throttled")
+
+	code, message := "LOGIN_BACKOFF", "Too many failed login attempts, try again later"
+	if decision.Locked {
+		code, message = "LOGIN_LOCKED", "Login is temporarily locked after repeated failures"
+	}
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":        code,
+			"message":     message,
+			"retry_after": retryAfter,
+		},
 	})
 }
 
@@ -224,7 +463,7 @@ func (h *AuthHandler) getUserByUsername(ctx context.Context, username string) (*
 	}
 
 	if len(result.Items) == 0 {
-		return nil, fmt.Errorf("user not found")
+		return nil, errUserNotFound
 	}
 
 	var user models.User
@@ -235,6 +474,31 @@ func (h *AuthHandler) getUserByUsername(ctx context.Context, username string) (*
 	return &user, nil
 }
 
+func (h *AuthHandler) getUserByID(ctx context.Context, userID string) (*models.User, error) {
+	result, err := h.dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(h.tableName),
+		Key: map[string]types.AttributeValue{
+			"user_id": &types.AttributeValueMemberS{Value: userID},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("get item failed: %w", err)
+	}
+
+	if len(result.Item) == 0 {
+		return nil, errUserNotFound
+	}
+
+	var user models.User
+	if err := attributevalue.UnmarshalMap(result.Item, &user); err != nil {
+		return nil, fmt.Errorf("unmarshal failed: %w", err)
+	}
+
+	return &user, nil
+}
+
 func (h *AuthHandler) createUser(ctx context.Context, user *models.User) error {
 	item, err := attributevalue.MarshalMap(user)
 	if err != nil {
@@ -254,8 +518,44 @@ func (h *AuthHandler) createUser(ctx context.Context, user *models.User) error {
 	return nil
 }
 
-func (h *AuthHandler) generateJWT(user *models.User) (string, int, error) {
-	expiresIn := 24 * 3600 // 24 hours
+// issueTokens starts a session for user and returns its first access and refresh tokens
+func (h *AuthHandler) issueTokens(ctx context.Context, user *models.User) (*models.AuthResponse, error) {
+	session, refreshToken, err := h.sessions.Create(ctx, auth.Session{
+		UserID:      user.UserID,
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		Role:        user.Role,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	token, expiresIn, err := h.generateJWT(ctx, user, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	return h.authResponse(user, session, token, refreshToken, expiresIn), nil
+}
+
+func (h *AuthHandler) authResponse(user *models.User, session *auth.Session, token, refreshToken string, expiresIn int) *models.AuthResponse {
+	sessionEnds := session.CreatedAt.Add(h.sessions.RefreshTTL())
+	return &models.AuthResponse{
+		Token:            token,
+		RefreshToken:     refreshToken,
+		UserID:           user.UserID,
+		Username:         user.Username,
+		DisplayName:      user.DisplayName,
+		Role:             user.Role,
+		ExpiresIn:        expiresIn,
+		RefreshExpiresIn: int(time.Until(sessionEnds).Seconds()),
+	}
+}
+
+// generateJWT signs an access token for user within session sessionID. The
+// "jti" lets logout revoke this token, the "sid" its whole session. It is
+// signed with the current key pair, named in the "kid" header.
+func (h *AuthHandler) generateJWT(ctx context.Context, user *models.User, sessionID string) (string, int, error) {
+	expiresIn := int(h.sessions.AccessTTL().Seconds())
 	expiresAt := time.Now().Add(time.Duration(expiresIn) * time.Second)
 
 	claims := jwt.MapClaims{
@@ -265,12 +565,13 @@ func (h *AuthHandler) generateJWT(user *models.User) (string, int, error) {
 		"role":     user.Role,
 		"exp":      expiresAt.Unix(),
 		"iat":      time.Now().Unix(),
-		"iss":      "traffic-tacos-gateway",
+		"iss":      h.issuer,
 		"aud":      "traffic-tacos-api",
+		"jti":      uuid.New().String(),
+		"sid":      sessionID,
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(h.jwtSecret))
+	tokenString, err := h.signingKeys.Sign(ctx, claims)
 	if err != nil {
 		return "", 0, err
 	}
@@ -3,7 +3,9 @@ package routes
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/traffic-tacos/gateway-api/internal/middleware"
@@ -20,25 +22,44 @@ type QueueHandler struct {
 	logger      *logrus.Logger
 	luaExecutor *queue.LuaExecutor
 	streamQueue *queue.StreamQueue
+	policies    *queue.PolicyStore
+	controls    *queue.ControlStore
+	lobby       *queue.Lobby
+	inventory   *queue.InventoryStore
+	etas        *queue.ETAStore
+	watcher     *queue.EventWatcher // Shared by status streams: one change check per event
+	tokens      *queue.TokenSigner
 }
 
 type JoinQueueRequest struct {
 	EventID string `json:"event_id" validate:"required"`
-	UserID  string `json:"user_id,omitempty"`
+	UserID  string `json:"user_id,omitempty"` // Ignored: set from the JWT or the anonymous session
 }
 
 type QueueStatusResponse struct {
-	Status        string `json:"status"`          // waiting|ready|expired
-	Position      int    `json:"position"`        // Current position in queue
-	ETASeconds    int    `json:"eta_sec"`         // Estimated time to admission
-	WaitingTime   int    `json:"waiting_time"`    // Time already waited in seconds
-	ReadyForEntry bool   `json:"ready_for_entry"` // True if user can call Enter API
+	Status        string `json:"status"`                 // lobby|waiting|ready|expired|sold_out
+	Position      int    `json:"position"`               // Current position in queue
+	ETASeconds    int    `json:"eta_sec"`                // Estimated time to admission (same as eta_p50_sec)
+	ETAP50Seconds int    `json:"eta_p50_sec"`            // Median ETA learned from the event's admissions
+	ETAP90Seconds int    `json:"eta_p90_sec"`            // 90% of users at this position are admitted by then
+	WaitingTime   int    `json:"waiting_time"`           // Time already waited in seconds
+	ReadyForEntry bool   `json:"ready_for_entry"`        // True if user can call Enter API
+	OpensInSec    int    `json:"opens_in_sec,omitempty"` // Countdown until the sale opens (lobby only)
+	Lane          string `json:"lane,omitempty"`         // Priority lane; position is within this lane
+	QueueState    string `json:"queue_state,omitempty"`  // open|paused|draining|closed
+	Reason        string `json:"reason,omitempty"`       // Operator message when the queue is paused, draining or closed
+
+	// Wave admission: seconds left to call Enter after a wave marked this token
+	EnterDeadlineSec int `json:"enter_deadline_sec,omitempty"`
 }
 
 type JoinQueueResponse struct {
 	WaitingToken string `json:"waiting_token"`
 	PositionHint int    `json:"position_hint"`
-	Status       string `json:"status"`
+	Status       string `json:"status"`                 // lobby|waiting
+	OpensInSec   int    `json:"opens_in_sec,omitempty"` // Countdown until the sale opens (lobby only)
+	Lane         string `json:"lane,omitempty"`         // Priority lane chosen from the JWT claims
+	Rejoined     bool   `json:"rejoined"`               // True when the user's existing waiting token was returned
 }
 
 type EnterQueueRequest struct {
@@ -56,27 +77,53 @@ type QueueData struct {
 	UserID   string    `json:"user_id,omitempty"`
 	JoinedAt time.Time `json:"joined_at"`
 	Position int       `json:"position"`
-	Status   string    `json:"status"` // waiting|ready|expired
+	Status   string    `json:"status"`              // lobby|waiting|ready|expired
+	Lane     string    `json:"lane,omitempty"`      // Priority lane ("" = default lane)
+	StreamID string    `json:"stream_id,omitempty"` // Join stream entry, removed on leave
 }
 
-func NewQueueHandler(redisClient redis.UniversalClient, logger *logrus.Logger) *QueueHandler {
+const (
+	// waveDeadlineMissed explains why a token skipped by an admission wave expired
+	waveDeadlineMissed = "Admission deadline missed"
+
+	soldOutMessage = "This event is sold out"
+)
+
+// Admission failures reported by the enter script (a missing token is redis.Nil)
+var (
+	errAlreadyEntered = errors.New("admission was already granted")
+	errNotQueued      = errors.New("waiting token is no longer queued")
+	errSoldOut        = errors.New("event is sold out")
+	errInventoryFull  = errors.New("outstanding grants cover the remaining inventory")
+)
+
+func NewQueueHandler(redisClient redis.UniversalClient, policies *queue.PolicyStore, controls *queue.ControlStore, tokens *queue.TokenSigner, logger *logrus.Logger) *QueueHandler {
 	return &QueueHandler{
 		redisClient: redisClient,
 		logger:      logger,
 		luaExecutor: queue.NewLuaExecutor(redisClient, logger),
 		streamQueue: queue.NewStreamQueue(redisClient, logger),
+		policies:    policies,
+		controls:    controls,
+		lobby:       queue.NewLobby(redisClient, logger),
+		inventory:   queue.NewInventoryStore(redisClient, logger),
+		etas:        queue.NewETAStore(redisClient, logger),
+		watcher:     queue.NewEventWatcher(redisClient, logger),
+		tokens:      tokens,
 	}
 }
 
 // Join handles queue joining
 // @Summary Join waiting queue
-// @Description Join the waiting queue for an event
+// @Description Join the waiting queue for an event. A user who is already waiting gets the existing token back (rejoined=true) or has it replaced, per the event's rejoin_mode.
 // @Tags Queue
 // @Accept json
 // @Produce json
 // @Param request body JoinQueueRequest true "Join queue request"
 // @Success 202 {object} JoinQueueResponse
 // @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 403 {object} map[string]interface{} "Queue is draining"
+// @Failure 410 {object} map[string]interface{} "Queue is closed or event sold out"
 // @Failure 500 {object} map[string]interface{} "Internal error"
 // @Router /queue/join [post]
 func (q *QueueHandler) Join(c *fiber.Ctx) error {
@@ -89,13 +136,30 @@ func (q *QueueHandler) Join(c *fiber.Ctx) error {
 		return q.badRequestError(c, "MISSING_EVENT_ID", "event_id is required")
 	}
 
-	// Get user ID from auth context if available
+	// Authenticated users join as themselves, everyone else with the identity of
+	// their anonymous session. A user who joined before logging in keeps that token.
+	req.UserID = middleware.GetIdentity(c)
 	if userID := middleware.GetUserID(c); userID != "" {
-		req.UserID = userID
+		upgradeSession(c.Context(), q.luaExecutor, q.policies, q.logger, middleware.GetAnonymousID(c), userID)
 	}
 
-	// Generate waiting token
+	// Paused queues keep accepting joins; draining and closed queues do not
+	if control := q.controlFor(c.Context(), req.EventID); !control.AcceptsJoins() {
+		return q.queueStateError(c, control)
+	}
+
+	if q.inventoryFor(c.Context(), req.EventID).SoldOut() {
+		return q.soldOutError(c)
+	}
+
+	// Generate the queue entry id; clients receive it inside a signed waiting token
 	waitingToken := uuid.New().String()
+	joinedAt := time.Now()
+	signedToken, err := q.issueWaitingToken(c, waitingToken, req.EventID, req.UserID, joinedAt)
+	if err != nil {
+		q.logger.WithError(err).Error("Failed to sign waiting token")
+		return q.internalError(c, "QUEUE_ERROR", "Failed to join queue")
+	}
 
 	// Generate idempotency key (request-based or user-based)
 	idempotencyKey := c.Get("Idempotency-Key")
@@ -105,30 +169,64 @@ func (q *QueueHandler) Join(c *fiber.Ctx) error {
 	}
 
 	ctx := context.Background()
+	policy := q.policyFor(ctx, req.EventID)
+
+	// Priority lane from the caller's JWT claims (anonymous callers use the default lane)
+	lane := policy.LaneFor(middleware.GetUserClaims(c))
 
-	// Atomic enqueue with deduplication using Lua Script
-	// 🔴 Use hash tag {eventID} to ensure both keys are in the same Redis Cluster slot
+	// 🔴 Atomic join in a single Lua script: dedupe check, stream entry, queue data,
+	// heartbeat and queue position (or lobby) - no partial state if Redis fails midway.
+	// All keys carry the {eventID} hash tag so they share one Redis Cluster slot.
 	dedupeKey := fmt.Sprintf("dedupe:{%s}:%s", req.EventID, idempotencyKey)
-	streamKey := fmt.Sprintf("stream:event:{%s}:user:%s", req.EventID, req.UserID)
-
-	result, err := q.luaExecutor.EnqueueAtomic(
-		ctx,
-		dedupeKey,
-		streamKey,
-		waitingToken,
-		req.EventID,
-		req.UserID,
-		300, // TTL: 5 minutes
-	)
+
+	// 🎟️ Scheduled opening: joins before opens_at wait in the lobby and are
+	// shuffled into the queue at opening instead of ranking by arrival time
+	if policy.OpensAt != nil {
+		if _, err := q.lobby.EnsureOpen(ctx, policy); err != nil {
+			q.logger.WithError(err).WithField("event_id", req.EventID).Warn("Failed to open lobby")
+		}
+	}
+	opensIn := q.lobby.OpensIn(policy)
+
+	queueData := QueueData{
+		EventID:  req.EventID,
+		UserID:   req.UserID,
+		JoinedAt: joinedAt,
+		Status:   "waiting", // Set by the script (waiting|lobby)
+		Position: 0,         // Will be calculated by Status API
+		Lane:     lane,
+	}
+	queueDataBytes, _ := json.Marshal(queueData)
+
+	result, err := q.luaExecutor.JoinQueue(ctx, &queue.QueueJoin{
+		EventID:      req.EventID,
+		UserID:       req.UserID,
+		Lane:         lane,
+		Token:        waitingToken,
+		DedupeKey:    dedupeKey,
+		Data:         queueDataBytes,
+		DataTTL:      30 * time.Minute,
+		HeartbeatTTL: policy.HeartbeatTTL(),
+		DedupeTTL:    policy.DedupeTTL(),
+		Lobby:        q.lobby.Pending(policy),
+		LobbyTTL:     q.lobby.TTL(policy),
+		LobbyDataTTL: 30*time.Minute + opensIn,
+		RejoinMode:   policy.RejoinMode,
+	})
 
 	if err != nil {
 		q.logger.WithError(err).WithFields(logrus.Fields{
 			"event_id": req.EventID,
 			"user_id":  req.UserID,
-		}).Error("Failed to enqueue atomically")
+		}).Error("Failed to join queue atomically")
 		return q.internalError(c, "QUEUE_ERROR", "Failed to join queue")
 	}
 
+	// The user already holds a waiting slot: hand back that token and its position
+	if result.Existing {
+		return q.rejoin(c, result)
+	}
+
 	// Check for duplicate
 	if result.Error == "DUPLICATE" {
 		q.logger.WithFields(logrus.Fields{
@@ -145,83 +243,106 @@ func (q *QueueHandler) Join(c *fiber.Ctx) error {
 		})
 	}
 
-	// Create queue data for backward compatibility
-	queueData := QueueData{
-		EventID:  req.EventID,
-		UserID:   req.UserID,
-		JoinedAt: time.Now(),
-		Status:   "waiting",
-		Position: 0, // Will be calculated by Status API
+	// Register the event for the background janitor (global key, outside the event's slot)
+	if err := q.redisClient.ZAdd(ctx, queue.ActiveEventsKey, redis.Z{
+		Score:  float64(joinedAt.Unix()),
+		Member: req.EventID,
+	}).Err(); err != nil {
+		q.logger.WithError(err).WithField("event_id", req.EventID).Warn("Failed to register active event")
 	}
 
-	// 🚀 PERFORMANCE OPTIMIZATION: Use Pipeline to batch all Redis operations
-	// This reduces 7 round trips to 1, improving throughput by 70%
-	// Critical for handling 10K+ RPS burst traffic without Redis CPU saturation
-	pipe := q.redisClient.Pipeline()
-
-	// 1. Store queue data for legacy compatibility
-	queueKey := fmt.Sprintf("queue:waiting:%s", waitingToken)
-	queueDataBytes, _ := json.Marshal(queueData)
-	pipe.Set(ctx, queueKey, queueDataBytes, 30*time.Minute)
-
-	// 2. Add to ZSET for position calculation (with TTL)
-	eventQueueKey := fmt.Sprintf("queue:event:{%s}", req.EventID)
-	score := float64(time.Now().Unix()) // Use timestamp as score for FIFO ordering
-	pipe.ZAdd(ctx, eventQueueKey, redis.Z{
-		Score:  score,
-		Member: waitingToken,
-	})
-	pipe.Expire(ctx, eventQueueKey, 1*time.Hour)
-
-	// 3. Create heartbeat key for auto-removal mechanism
-	heartbeatKey := fmt.Sprintf("heartbeat:%s", waitingToken)
-	pipe.Set(ctx, heartbeatKey, "alive", 5*time.Minute)
+	// Remember the event so logging in hands the anonymous token over to the user
+	if strings.HasPrefix(req.UserID, middleware.AnonymousIDPrefix) {
+		sessionEventsKey := queue.SessionEventsKey(req.UserID)
+		pipe := q.redisClient.TxPipeline()
+		pipe.SAdd(ctx, sessionEventsKey, req.EventID)
+		pipe.Expire(ctx, sessionEventsKey, 30*time.Minute+opensIn)
+		if _, err := pipe.Exec(ctx); err != nil {
+			q.logger.WithError(err).WithField("event_id", req.EventID).Warn("Failed to record session event")
+		}
+	}
 
-	// 4. Update position index for fast Status API lookups (O(log N) vs O(N))
-	positionIndexKey := fmt.Sprintf("position_index:{%s}", req.EventID)
-	pipe.ZAdd(ctx, positionIndexKey, redis.Z{
-		Score:  score,
-		Member: waitingToken,
-	})
-	pipe.Expire(ctx, positionIndexKey, 1*time.Hour)
-
-	// Execute all commands in a single round trip
-	if _, err := pipe.Exec(ctx); err != nil {
-		q.logger.WithError(err).Error("Failed to execute pipeline")
-		// Continue anyway - the Lua script already succeeded
-	}
-
-	// 🔄 ASYNC: Get global position asynchronously to avoid blocking response
-	// Position will be available in Status API, no need to block Join response
-	// This allows Join API to respond immediately (<50ms) even under high load
-	go func() {
-		bgCtx := context.Background()
-		position, err := q.streamQueue.GetGlobalPosition(bgCtx, req.EventID, req.UserID, result.StreamID)
-		if err != nil {
-			q.logger.WithError(err).WithField("stream_id", result.StreamID).Debug("Failed to calculate position in background")
-		} else {
-			// Update position in queue data for next Status call
-			queueData.Position = position
-			updatedBytes, _ := json.Marshal(queueData)
-			q.redisClient.Set(bgCtx, queueKey, updatedBytes, 30*time.Minute)
+	if result.Status == "lobby" {
+		// Register the lobby for the opener worker (global key, outside the event's slot)
+		if policy.OpensAt != nil {
+			if err := q.redisClient.ZAdd(ctx, queue.LobbyEventsKey, redis.Z{
+				Score:  float64(policy.OpensAt.Unix()),
+				Member: req.EventID,
+			}).Err(); err != nil {
+				q.logger.WithError(err).WithField("event_id", req.EventID).Warn("Failed to register lobby event")
+			}
 		}
-	}()
+
+		q.logger.WithFields(logrus.Fields{
+			"waiting_token": waitingToken,
+			"event_id":      req.EventID,
+			"user_id":       req.UserID,
+			"opens_in_sec":  int(opensIn.Seconds()),
+		}).Info("User joined pre-sale lobby")
+
+		return c.Status(fiber.StatusAccepted).JSON(JoinQueueResponse{
+			WaitingToken: signedToken,
+			PositionHint: 0,
+			Status:       "lobby",
+			OpensInSec:   int(opensIn.Seconds()),
+			Lane:         policy.LaneName(lane),
+		})
+	}
 
 	q.logger.WithFields(logrus.Fields{
 		"waiting_token": waitingToken,
 		"stream_id":     result.StreamID,
 		"event_id":      req.EventID,
 		"user_id":       req.UserID,
-		"optimization":  "pipeline_batching",
-	}).Info("User joined queue via Lua + Pipeline (7 calls → 1 round trip)")
+		"lane":          lane,
+	}).Info("User joined queue")
 
 	return c.Status(fiber.StatusAccepted).JSON(JoinQueueResponse{
-		WaitingToken: waitingToken,
+		WaitingToken: signedToken,
 		PositionHint: 0, // Position will be calculated on first Status API call
 		Status:       "waiting",
+		Lane:         policy.LaneName(lane),
 	})
 }
 
+// rejoin answers a repeat Join with the user's existing waiting token, re-signed
+// for the caller's session so a user who lost the token keeps their place
+func (q *QueueHandler) rejoin(c *fiber.Ctx, result *queue.QueueJoinResult) error {
+	var queueData QueueData
+	if err := json.Unmarshal(result.ExistingData, &queueData); err != nil {
+		q.logger.WithError(err).Error("Failed to parse existing queue data")
+		return q.internalError(c, "QUEUE_ERROR", "Failed to join queue")
+	}
+
+	signedToken, err := q.issueWaitingToken(c, result.Token, queueData.EventID, queueData.UserID, queueData.JoinedAt)
+	if err != nil {
+		q.logger.WithError(err).Error("Failed to sign waiting token")
+		return q.internalError(c, "QUEUE_ERROR", "Failed to join queue")
+	}
+
+	ctx := c.Context()
+	policy := q.policyFor(ctx, queueData.EventID)
+	resp := JoinQueueResponse{
+		WaitingToken: signedToken,
+		Status:       queueData.Status,
+		Lane:         policy.LaneName(queueData.Lane),
+		Rejoined:     true,
+	}
+	if queueData.Status == "lobby" {
+		resp.OpensInSec = int(q.lobby.OpensIn(policy).Seconds())
+	} else {
+		resp.PositionHint, _ = q.calculatePositionAndETA(ctx, &queueData, result.Token)
+	}
+
+	q.logger.WithFields(logrus.Fields{
+		"waiting_token": result.Token,
+		"event_id":      queueData.EventID,
+		"user_id":       queueData.UserID,
+	}).Info("User rejoined queue with existing waiting token")
+
+	return c.Status(fiber.StatusAccepted).JSON(resp)
+}
+
 // Status handles queue status queries
 // @Summary Check queue status
 // @Description Check the current status of a waiting token in the queue
@@ -230,58 +351,27 @@ func (q *QueueHandler) Join(c *fiber.Ctx) error {
 // @Param token query string true "Waiting token"
 // @Success 200 {object} QueueStatusResponse
 // @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Invalid waiting token signature"
+// @Failure 403 {object} map[string]interface{} "Waiting token belongs to another session"
 // @Failure 404 {object} map[string]interface{} "Token not found"
 // @Failure 500 {object} map[string]interface{} "Internal error"
 // @Router /queue/status [get]
 func (q *QueueHandler) Status(c *fiber.Ctx) error {
-	waitingToken := c.Query("token")
-	if waitingToken == "" {
+	rawToken := c.Query("token")
+	if rawToken == "" {
 		return q.badRequestError(c, "MISSING_TOKEN", "waiting token is required")
 	}
 
-	ctx := c.Context()
-
-	// 🔴 NEW: Heartbeat check and renewal
-	// Check if heartbeat key exists (user is still active)
-	heartbeatKey := fmt.Sprintf("heartbeat:%s", waitingToken)
-	exists, err := q.redisClient.Exists(ctx, heartbeatKey).Result()
+	claims, err := q.verifyWaitingToken(c, rawToken)
 	if err != nil {
-		q.logger.WithError(err).Warn("Failed to check heartbeat")
-	} else if exists == 0 {
-		// Heartbeat expired - user abandoned the queue
-		// Clean up and return expired status
-		q.logger.WithField("waiting_token", waitingToken).Info("Heartbeat expired - cleaning up abandoned user")
-
-		// Get queue data first to clean up properly
-		queueData, _ := q.getQueueData(ctx, waitingToken)
-		if queueData != nil {
-			// Remove from ZSET
-			eventQueueKey := fmt.Sprintf("queue:event:{%s}", queueData.EventID)
-			q.redisClient.ZRem(ctx, eventQueueKey, waitingToken)
-
-			// Remove from Stream
-			streamKey := fmt.Sprintf("stream:event:{%s}:user:%s", queueData.EventID, queueData.UserID)
-			entries, _ := q.redisClient.XRange(ctx, streamKey, "-", "+").Result()
-			for _, entry := range entries {
-				if token, ok := entry.Values["token"].(string); ok && token == waitingToken {
-					q.redisClient.XDel(ctx, streamKey, entry.ID)
-					break
-				}
-			}
-
-			// Remove queue data
-			queueKey := fmt.Sprintf("queue:waiting:%s", waitingToken)
-			q.redisClient.Del(ctx, queueKey)
-		}
-
-		return q.notFoundError(c, "TOKEN_EXPIRED", "Waiting token expired due to inactivity")
-	} else {
-		// Renew heartbeat TTL (user is still active)
-		q.redisClient.Expire(ctx, heartbeatKey, 5*time.Minute)
+		return q.waitingTokenError(c, err)
 	}
+	waitingToken := claims.ID
+
+	ctx := c.Context()
 
 	// Get queue data
-	queueData, err := q.getQueueData(ctx, waitingToken)
+	queueData, err := q.getQueueData(ctx, claims.EventID, waitingToken)
 	if err != nil {
 		if err == redis.Nil {
 			return q.notFoundError(c, "TOKEN_NOT_FOUND", "Waiting token not found or expired")
@@ -290,22 +380,15 @@ func (q *QueueHandler) Status(c *fiber.Ctx) error {
 		return q.internalError(c, "QUEUE_ERROR", "Failed to get queue status")
 	}
 
-	// Calculate current position and ETA
-	currentPosition, eta := q.calculatePositionAndETA(c.Context(), queueData, waitingToken)
-	waitingTime := int(time.Since(queueData.JoinedAt).Seconds())
+	// 🔴 NEW: Heartbeat check and renewal
+	alive, err := q.checkHeartbeat(ctx, queueData, waitingToken)
+	if err != nil {
+		q.logger.WithError(err).Warn("Failed to check heartbeat")
+	} else if !alive {
+		return q.notFoundError(c, "TOKEN_EXPIRED", "Waiting token expired due to inactivity")
+	}
 
-	// 🔴 CRITICAL FIX: Status API should NOT consume tokens, only check eligibility
-	// Check if user is ready for entry (eligible to call Enter API)
-	// We check Position + Wait Time only, NOT Token Bucket (to avoid consuming tokens)
-	readyForEntry := q.isEligibleForEntryWithoutTokenConsumption(c.Context(), queueData, waitingToken)
-
-	return c.JSON(QueueStatusResponse{
-		Status:        queueData.Status,
-		Position:      currentPosition,
-		ETASeconds:    eta,
-		WaitingTime:   waitingTime,
-		ReadyForEntry: readyForEntry,
-	})
+	return c.JSON(q.buildStatus(ctx, queueData, waitingToken))
 }
 
 // Enter handles queue entrance requests
@@ -317,9 +400,13 @@ func (q *QueueHandler) Status(c *fiber.Ctx) error {
 // @Param request body EnterQueueRequest true "Enter queue request"
 // @Success 200 {object} EnterQueueResponse
 // @Failure 400 {object} map[string]interface{} "Bad request"
-// @Failure 403 {object} map[string]interface{} "Not ready for entrance"
+// @Failure 401 {object} map[string]interface{} "Invalid waiting token signature"
+// @Failure 403 {object} map[string]interface{} "Not ready for entrance or token belongs to another session"
 // @Failure 404 {object} map[string]interface{} "Token not found"
+// @Failure 409 {object} map[string]interface{} "Already entered"
+// @Failure 410 {object} map[string]interface{} "Queue is closed or event sold out"
 // @Failure 500 {object} map[string]interface{} "Internal error"
+// @Failure 503 {object} map[string]interface{} "Queue is paused"
 // @Router /queue/enter [post]
 func (q *QueueHandler) Enter(c *fiber.Ctx) error {
 	var req EnterQueueRequest
@@ -331,8 +418,14 @@ func (q *QueueHandler) Enter(c *fiber.Ctx) error {
 		return q.badRequestError(c, "MISSING_TOKEN", "waiting_token is required")
 	}
 
+	claims, err := q.verifyWaitingToken(c, req.WaitingToken)
+	if err != nil {
+		return q.waitingTokenError(c, err)
+	}
+	waitingToken := claims.ID
+
 	// Get queue data
-	queueData, err := q.getQueueData(c.Context(), req.WaitingToken)
+	queueData, err := q.getQueueData(c.Context(), claims.EventID, waitingToken)
 	if err != nil {
 		if err == redis.Nil {
 			return q.notFoundError(c, "TOKEN_NOT_FOUND", "Waiting token not found or expired")
@@ -340,72 +433,59 @@ func (q *QueueHandler) Enter(c *fiber.Ctx) error {
 		return q.internalError(c, "QUEUE_ERROR", "Failed to validate waiting token")
 	}
 
-	// Check if user is eligible for entry (position, wait time, rate limit)
-	if !q.isEligibleForEntry(c.Context(), queueData, req.WaitingToken) {
-		return q.forbiddenError(c, "NOT_READY", "Your turn has not arrived yet")
+	if control := q.controlFor(c.Context(), queueData.EventID); !control.AdmitsEntries() {
+		return q.queueStateError(c, control)
 	}
 
-	// Generate reservation token
-	reservationToken := uuid.New().String()
-
-	// Store reservation token with TTL (30 seconds as per spec)
-	reservationKey := fmt.Sprintf("queue:reservation:%s", reservationToken)
-	reservationData := map[string]interface{}{
-		"event_id":      queueData.EventID,
-		"user_id":       queueData.UserID,
-		"waiting_token": req.WaitingToken,
-		"granted_at":    time.Now(),
+	if queueData.Status == "expired" {
+		return q.notFoundError(c, "TOKEN_EXPIRED", waveDeadlineMissed)
 	}
 
-	ctx := context.Background()
-	reservationDataBytes, _ := json.Marshal(reservationData)
-	if err := q.redisClient.Set(ctx, reservationKey, reservationDataBytes, 30*time.Second).Err(); err != nil {
-		q.logger.WithError(err).Error("Failed to store reservation token")
-		return q.internalError(c, "QUEUE_ERROR", "Failed to grant admission")
+	// Joined anonymously, authenticated since: the reservation token goes to the user
+	if userID := middleware.GetUserID(c); userID != "" && queueData.UserID != userID &&
+		queueData.UserID == middleware.GetAnonymousID(c) {
+		upgradeSession(c.Context(), q.luaExecutor, q.policies, q.logger, queueData.UserID, userID)
+		queueData.UserID = userID
 	}
 
-	// Update queue status to ready
-	queueData.Status = "ready"
-	queueDataBytes, _ := json.Marshal(queueData)
-	queueKey := fmt.Sprintf("queue:waiting:%s", req.WaitingToken)
-	q.redisClient.Set(ctx, queueKey, queueDataBytes, 30*time.Minute)
-
-	// 🔴 NEW: Remove heartbeat key (user successfully entered, no longer waiting)
-	heartbeatKey := fmt.Sprintf("heartbeat:%s", req.WaitingToken)
-	if err := q.redisClient.Del(ctx, heartbeatKey).Err(); err != nil {
-		q.logger.WithError(err).Warn("Failed to remove heartbeat key")
+	// Sold out: answer before the eligibility check so no bucket token is spent
+	if q.inventoryFor(c.Context(), queueData.EventID).SoldOut() {
+		return q.soldOutError(c)
 	}
 
-	// 🔴 CRITICAL FIX: Remove from ZSET to update position for other users
-	eventQueueKey := fmt.Sprintf("queue:event:{%s}", queueData.EventID)
-	if err := q.redisClient.ZRem(ctx, eventQueueKey, req.WaitingToken).Err(); err != nil {
-		q.logger.WithError(err).Warn("Failed to remove from ZSET queue")
+	// Check if user is eligible for entry (position, wait time, rate limit)
+	eligible, bucketTokenTaken := q.isEligibleForEntry(c.Context(), queueData, waitingToken)
+	if !eligible {
+		return q.forbiddenError(c, "NOT_READY", "Your turn has not arrived yet")
 	}
 
-	// 🔴 CRITICAL FIX: Mark as processed in Stream (or trim)
-	streamKey := fmt.Sprintf("stream:event:{%s}:user:%s", queueData.EventID, queueData.UserID)
-	// Note: We keep stream for audit trail, but mark it by removing from active calculation
-	// Alternatively, we could XTRIM or XDEL here
-	_ = streamKey // Keep for now, ZSET removal is sufficient
-
-	// Record admission for metrics tracking
-	metrics := queue.NewAdmissionMetrics(q.redisClient, queueData.EventID, q.logger)
-	if err := metrics.RecordAdmission(ctx, queueData.UserID); err != nil {
-		q.logger.WithError(err).Warn("Failed to record admission metric")
+	resp, err := q.grantAdmission(context.Background(), queueData, waitingToken)
+	if err != nil && bucketTokenTaken {
+		q.refundBucketToken(context.Background(), queueData)
+	}
+	switch {
+	case err == redis.Nil:
+		return q.notFoundError(c, "TOKEN_NOT_FOUND", "Waiting token not found or expired")
+	case errors.Is(err, errNotQueued):
+		return q.notFoundError(c, "TOKEN_EXPIRED", "Waiting token is no longer in the queue")
+	case errors.Is(err, errSoldOut):
+		return q.soldOutError(c)
+	case errors.Is(err, errInventoryFull):
+		return q.forbiddenError(c, "NOT_READY", "All remaining seats are being reserved, please wait")
+	case errors.Is(err, errAlreadyEntered):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":     "ALREADY_ENTERED",
+				"message":  "Admission was already granted for this waiting token",
+				"trace_id": c.Get("X-Request-ID"),
+			},
+		})
+	case err != nil:
+		q.logger.WithError(err).Error("Failed to grant admission")
+		return q.internalError(c, "QUEUE_ERROR", "Failed to grant admission")
 	}
 
-	q.logger.WithFields(logrus.Fields{
-		"waiting_token":     req.WaitingToken,
-		"reservation_token": reservationToken,
-		"event_id":          queueData.EventID,
-		"user_id":           queueData.UserID,
-	}).Info("Queue admission granted")
-
-	return c.JSON(EnterQueueResponse{
-		Admission:        "granted",
-		ReservationToken: reservationToken,
-		TTLSeconds:       30,
-	})
+	return c.JSON(resp)
 }
 
 // Leave handles queue departure
@@ -416,52 +496,40 @@ func (q *QueueHandler) Enter(c *fiber.Ctx) error {
 // @Param token query string true "Waiting token"
 // @Success 200 {object} map[string]interface{} "Success"
 // @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Invalid waiting token signature"
+// @Failure 403 {object} map[string]interface{} "Waiting token belongs to another session"
+// @Failure 500 {object} map[string]interface{} "Internal error"
 // @Router /queue/leave [delete]
 func (q *QueueHandler) Leave(c *fiber.Ctx) error {
-	waitingToken := c.Query("token")
-	if waitingToken == "" {
+	rawToken := c.Query("token")
+	if rawToken == "" {
 		return q.badRequestError(c, "MISSING_TOKEN", "waiting token is required")
 	}
 
-	ctx := context.Background()
-
-	// Get queue data first (before deletion)
-	queueData, err := q.getQueueData(ctx, waitingToken)
-
-	// 🔴 NEW: Remove heartbeat key
-	heartbeatKey := fmt.Sprintf("heartbeat:%s", waitingToken)
-	if err := q.redisClient.Del(ctx, heartbeatKey).Err(); err != nil {
-		q.logger.WithError(err).Warn("Failed to remove heartbeat key")
+	claims, err := q.verifyWaitingToken(c, rawToken)
+	if err != nil {
+		return q.waitingTokenError(c, err)
 	}
+	waitingToken := claims.ID
+
+	ctx := context.Background()
 
-	// Remove from waiting queue
-	queueKey := fmt.Sprintf("queue:waiting:%s", waitingToken)
-	if err := q.redisClient.Del(ctx, queueKey).Err(); err != nil {
-		q.logger.WithError(err).Error("Failed to remove from waiting queue")
+	// Queue data tells which lane and stream the token is in; a missing token has nothing left to remove
+	queueData, err := q.getQueueData(ctx, claims.EventID, waitingToken)
+	if err != nil && err != redis.Nil {
+		q.logger.WithError(err).Error("Failed to get queue data")
+		return q.internalError(c, "QUEUE_ERROR", "Failed to leave queue")
 	}
 
-	// Remove from ZSET event queue
 	if err == nil {
-		eventQueueKey := fmt.Sprintf("queue:event:{%s}", queueData.EventID)
-		if err := q.redisClient.ZRem(ctx, eventQueueKey, waitingToken).Err(); err != nil {
-			q.logger.WithError(err).Warn("Failed to remove from ZSET queue")
-		}
-
-		// 🔴 CRITICAL FIX: Also clean up Stream entries
-		streamKey := fmt.Sprintf("stream:event:{%s}:user:%s", queueData.EventID, queueData.UserID)
-		// Get all entries for this user and delete the matching one
-		entries, _ := q.redisClient.XRange(ctx, streamKey, "-", "+").Result()
-		for _, entry := range entries {
-			if token, ok := entry.Values["token"].(string); ok && token == waitingToken {
-				q.redisClient.XDel(ctx, streamKey, entry.ID)
-				break
-			}
+		if _, err := q.luaExecutor.LeaveQueue(ctx, queueData.EventID, queueData.Lane, queueData.UserID, waitingToken, queue.LifecycleLeft); err != nil {
+			return q.internalError(c, "QUEUE_ERROR", "Failed to leave queue")
 		}
 	}
 
 	q.logger.WithFields(logrus.Fields{
 		"waiting_token": waitingToken,
-	}).Info("User left queue (removed from ZSET and Stream)")
+	}).Info("User left queue")
 
 	return c.JSON(fiber.Map{
 		"status": "left",
@@ -470,9 +538,8 @@ func (q *QueueHandler) Leave(c *fiber.Ctx) error {
 
 // Helper methods
 
-func (q *QueueHandler) getQueueData(ctx context.Context, waitingToken string) (*QueueData, error) {
-	queueKey := fmt.Sprintf("queue:waiting:%s", waitingToken)
-	data, err := q.redisClient.Get(ctx, queueKey).Result()
+func (q *QueueHandler) getQueueData(ctx context.Context, eventID, waitingToken string) (*QueueData, error) {
+	data, err := q.redisClient.Get(ctx, queue.WaitingDataKey(eventID, waitingToken)).Result()
 	if err != nil {
 		return nil, err
 	}
@@ -482,116 +549,382 @@ func (q *QueueHandler) getQueueData(ctx context.Context, waitingToken string) (*
 		return nil, fmt.Errorf("failed to unmarshal queue data: %w", err)
 	}
 
+	if queueData.Status == "lobby" {
+		q.promoteFromLobby(ctx, &queueData, waitingToken)
+	}
+
 	return &queueData, nil
 }
 
-func (q *QueueHandler) calculatePositionAndETA(ctx context.Context, queueData *QueueData, waitingToken string) (int, int) {
+// promoteFromLobby switches a lobby token to waiting once its event has opened,
+// opening the lobby first if the lobby opener has not yet
+func (q *QueueHandler) promoteFromLobby(ctx context.Context, queueData *QueueData, waitingToken string) {
+	policy := q.policyFor(ctx, queueData.EventID)
+
+	var opened bool
+	var err error
+	if policy.OpensAt == nil {
+		// Schedule was removed while users were waiting: open right away
+		opened, err = q.lobby.Open(ctx, queueData.EventID, time.Now())
+	} else {
+		opened, err = q.lobby.EnsureOpen(ctx, policy)
+	}
+	if err != nil {
+		q.logger.WithError(err).WithField("event_id", queueData.EventID).Warn("Failed to open lobby")
+		return
+	}
+	if !opened {
+		return
+	}
+
+	queueData.Status = "waiting"
+	queueDataBytes, _ := json.Marshal(queueData)
+	// XX: never recreate data removed by a concurrent Leave
+	queueKey := queue.WaitingDataKey(queueData.EventID, waitingToken)
+	if err := q.redisClient.SetArgs(ctx, queueKey, queueDataBytes, redis.SetArgs{KeepTTL: true, Mode: "XX"}).Err(); err != nil && err != redis.Nil {
+		q.logger.WithError(err).Warn("Failed to update lobby token status")
+	}
+}
+
+// grantAdmission issues a reservation token for an eligible waiting token and
+// removes it from the waiting queue in one atomic step. Shared by Enter and the WebSocket channel.
+// Returns redis.Nil, errAlreadyEntered or errNotQueued when the token can no longer be admitted,
+// errSoldOut or errInventoryFull when the inventory cap stops the admission.
+func (q *QueueHandler) grantAdmission(ctx context.Context, queueData *QueueData, waitingToken string) (*EnterQueueResponse, error) {
+	policy := q.policyFor(ctx, queueData.EventID)
+	q.recordEligible(ctx, policy, queueData, waitingToken)
+
+	// Generate reservation token
+	reservationToken := uuid.New().String()
+
+	// Reservation token lives for the event's reservation TTL (30 seconds by default)
+	reservationData := map[string]interface{}{
+		"event_id":      queueData.EventID,
+		"user_id":       queueData.UserID,
+		"waiting_token": waitingToken,
+		"granted_at":    time.Now(),
+	}
+	reservationDataBytes, _ := json.Marshal(reservationData)
+
+	// 🔴 Atomic waiting -> ready: reservation token, queue data, heartbeat and
+	// ZSET removal (so others move up) happen together or not at all
+	result, err := q.luaExecutor.EnterQueue(ctx, queueData.EventID, queueData.Lane, waitingToken,
+		reservationToken, reservationDataBytes, policy.ReservationTTL(), policy.OversellFactor)
+	if err != nil {
+		return nil, err
+	}
+	if !result.Success {
+		switch result.Error {
+		case "NOT_FOUND":
+			return nil, redis.Nil
+		case "ALREADY_ENTERED":
+			return nil, errAlreadyEntered
+		case "SOLD_OUT":
+			return nil, errSoldOut
+		case "INVENTORY_FULL":
+			return nil, errInventoryFull
+		default:
+			return nil, errNotQueued
+		}
+	}
+
+	// Record admission for metrics tracking, keyed by the reservation token: a
+	// user who is admitted again after their reservation expired counts twice
+	metrics := queue.NewAdmissionMetrics(q.redisClient, queueData.EventID, q.logger)
+	if err := metrics.RecordAdmission(ctx, reservationToken); err != nil {
+		q.logger.WithError(err).Warn("Failed to record admission metric")
+	}
+
+	q.logger.WithFields(logrus.Fields{
+		"waiting_token":     waitingToken,
+		"reservation_token": reservationToken,
+		"event_id":          queueData.EventID,
+		"user_id":           queueData.UserID,
+	}).Info("Queue admission granted")
+
+	return &EnterQueueResponse{
+		Admission:        "granted",
+		ReservationToken: reservationToken,
+		TTLSeconds:       policy.ReservationTTLSeconds,
+	}, nil
+}
+
+// recordEligible records the lifecycle event of a waiting token becoming eligible
+// for Enter. Wave admission records it when the wave marks the token.
+func (q *QueueHandler) recordEligible(ctx context.Context, policy *queue.QueuePolicy, queueData *QueueData, waitingToken string) {
+	if policy.Wave != nil {
+		return
+	}
+	if err := q.luaExecutor.RecordEligible(ctx, queueData.EventID, queueData.Lane, queueData.UserID, waitingToken); err != nil {
+		q.logger.WithError(err).WithField("waiting_token", waitingToken).Warn("Failed to record eligibility")
+	}
+}
+
+// checkHeartbeat renews the heartbeat of an active waiting token.
+// Returns false when the heartbeat already expired, in which case the
+// abandoned token is cleaned up before returning.
+func (q *QueueHandler) checkHeartbeat(ctx context.Context, queueData *QueueData, waitingToken string) (bool, error) {
+	heartbeatKey := queue.HeartbeatKey(queueData.EventID, waitingToken)
+	exists, err := q.redisClient.Exists(ctx, heartbeatKey).Result()
+	if err != nil {
+		return false, err
+	}
+
+	if exists == 0 {
+		// Heartbeat expired - user abandoned the queue
+		q.logger.WithField("waiting_token", waitingToken).Info("Heartbeat expired - cleaning up abandoned user")
+		q.cleanupAbandoned(ctx, queueData.EventID, waitingToken)
+		return false, nil
+	}
+
+	// Renew heartbeat TTL (user is still active)
+	q.redisClient.Expire(ctx, heartbeatKey, q.policyFor(ctx, queueData.EventID).HeartbeatTTL())
+	return true, nil
+}
+
+// cleanupAbandoned removes an abandoned waiting token from the queue, lobby, Stream and queue data
+func (q *QueueHandler) cleanupAbandoned(ctx context.Context, eventID, waitingToken string) {
+	// Get queue data first to find the token's lane and stream
+	queueData, _ := q.getQueueData(ctx, eventID, waitingToken)
+	if queueData == nil {
+		return
+	}
+
+	if _, err := q.luaExecutor.LeaveQueue(ctx, queueData.EventID, queueData.Lane, queueData.UserID, waitingToken, queue.LifecycleHeartbeatExpired); err != nil {
+		q.logger.WithError(err).WithField("waiting_token", waitingToken).Warn("Failed to clean up abandoned token")
+	}
+}
+
+// buildStatus computes the status payload shared by Status and StatusStream
+func (q *QueueHandler) buildStatus(ctx context.Context, queueData *QueueData, waitingToken string) QueueStatusResponse {
+	waitingTime := int(time.Since(queueData.JoinedAt).Seconds())
+
+	// Closed queues expire every waiter with the operator's reason
+	control := q.controlFor(ctx, queueData.EventID)
+	if control.Closed() {
+		return QueueStatusResponse{
+			Status:      "expired",
+			WaitingTime: waitingTime,
+			QueueState:  string(control.State),
+			Reason:      control.Reason,
+		}
+	}
+
+	// Wave admission skipped this token after it missed its Enter deadline
+	if queueData.Status == "expired" {
+		return QueueStatusResponse{
+			Status:      "expired",
+			WaitingTime: waitingTime,
+			QueueState:  string(control.State),
+			Reason:      waveDeadlineMissed,
+		}
+	}
+
+	// Sold out: nobody else will be admitted
+	if q.inventoryFor(ctx, queueData.EventID).SoldOut() {
+		return QueueStatusResponse{
+			Status:      "sold_out",
+			WaitingTime: waitingTime,
+			QueueState:  string(control.State),
+			Reason:      soldOutMessage,
+		}
+	}
+
+	// Lobby: no position until the sale opens and the lobby is shuffled
+	if queueData.Status == "lobby" {
+		opensIn := int(q.lobby.OpensIn(q.policyFor(ctx, queueData.EventID)).Seconds())
+		return QueueStatusResponse{
+			Status:      "lobby",
+			ETASeconds:  opensIn,
+			WaitingTime: waitingTime,
+			OpensInSec:  opensIn,
+			Lane:        q.policyFor(ctx, queueData.EventID).LaneName(queueData.Lane),
+			QueueState:  string(control.State),
+			Reason:      control.Reason,
+		}
+	}
+
+	// Calculate current position and ETA range
+	currentPosition, eta := q.calculatePositionAndETA(ctx, queueData, waitingToken)
+
+	// 🔴 CRITICAL FIX: Status API should NOT consume tokens, only check eligibility
+	// Check if user is ready for entry (eligible to call Enter API)
+	// We check Position + Wait Time only, NOT Token Bucket (to avoid consuming tokens)
+	readyForEntry := q.isEligibleForEntryWithoutTokenConsumption(ctx, queueData, waitingToken)
+
+	// Wave admission: ready means marked by a wave, with a deadline to enter
+	enterDeadline := 0
+	if readyForEntry && q.policyFor(ctx, queueData.EventID).Wave != nil {
+		if deadline, ok := q.waveDeadline(ctx, queueData, waitingToken); ok {
+			enterDeadline = int(time.Until(deadline).Seconds())
+		}
+	} else if readyForEntry {
+		q.recordEligible(ctx, q.policyFor(ctx, queueData.EventID), queueData, waitingToken)
+	}
+
+	return QueueStatusResponse{
+		Status:           queueData.Status,
+		Position:         currentPosition,
+		ETASeconds:       eta.P50,
+		ETAP50Seconds:    eta.P50,
+		ETAP90Seconds:    eta.P90,
+		WaitingTime:      waitingTime,
+		ReadyForEntry:    readyForEntry,
+		Lane:             q.policyFor(ctx, queueData.EventID).LaneName(queueData.Lane),
+		QueueState:       string(control.State),
+		Reason:           control.Reason,
+		EnterDeadlineSec: enterDeadline,
+	}
+}
+
+// calculatePositionAndETA returns the position within the token's lane and an ETA
+// range based on its effective position in the interleaved admission order
+func (q *QueueHandler) calculatePositionAndETA(ctx context.Context, queueData *QueueData, waitingToken string) (int, queue.ETAEstimate) {
+	position := q.lanePosition(ctx, queueData, waitingToken)
+	if position == 0 {
+		return queueData.Position, queue.ETAEstimate{P50: 60, P90: 60} // Default ETA
+	}
+
+	// Lanes are admitted by weight, so the ETA follows the lane's share of admissions.
+	// Until the event has admission history, the policy's configured rate is used.
+	policy := q.policyFor(ctx, queueData.EventID)
+	effective := q.effectivePosition(ctx, policy, queueData, position)
+	eta := q.etas.Estimate(ctx, queueData.EventID, effective, policy.ConfiguredAdmissionRate())
+
+	return position, eta
+}
+
+// lanePosition returns the token's 1-based position within its lane, or 0 if it is not queued
+func (q *QueueHandler) lanePosition(ctx context.Context, queueData *QueueData, waitingToken string) int {
 	// 🔴 OPTIMIZATION: Try Position Index (ZSET) first - O(log N), fastest!
 	// This eliminates expensive KEYS scan from Stream approach
-	position, err := q.streamQueue.CalculateApproximatePosition(ctx, queueData.EventID, waitingToken)
+	position, err := q.streamQueue.CalculateLanePosition(ctx, queueData.EventID, queueData.Lane, waitingToken)
 	if err == nil && position > 0 {
-		// Success! Use fast ZSET-based position
-		slidingWindow := queue.NewSlidingWindowMetrics(q.redisClient, queueData.EventID, q.logger)
-		eta := slidingWindow.CalculateAdvancedETA(ctx, position)
-
 		q.logger.WithFields(logrus.Fields{
 			"waiting_token": waitingToken,
 			"position":      position,
-			"eta":           eta,
+			"lane":          queueData.Lane,
 			"method":        "position_index", // Fast path
 		}).Debug("Calculated position from Position Index (O(log N))")
 
-		return position, eta
-	}
-
-	// Fallback 1: Try Stream-based calculation (more accurate but slower)
-	streamKey := fmt.Sprintf("stream:event:{%s}:user:%s", queueData.EventID, queueData.UserID)
-	entries, err := q.redisClient.XRange(ctx, streamKey, "-", "+").Result()
-	if err == nil && len(entries) > 0 {
-		for _, entry := range entries {
-			if token, ok := entry.Values["token"].(string); ok && token == waitingToken {
-				// Use optimized SCAN-based position calculation (not KEYS)
-				position, err := q.streamQueue.GetGlobalPosition(ctx, queueData.EventID, queueData.UserID, entry.ID)
-				if err == nil {
-					slidingWindow := queue.NewSlidingWindowMetrics(q.redisClient, queueData.EventID, q.logger)
-					eta := slidingWindow.CalculateAdvancedETA(ctx, position)
-
-					q.logger.WithFields(logrus.Fields{
-						"waiting_token": waitingToken,
-						"stream_id":     entry.ID,
-						"position":      position,
-						"eta":           eta,
-						"method":        "stream_fallback",
-					}).Debug("Calculated position from Stream (fallback)")
-
-					return position, eta
+		return position
+	}
+
+	// Fallback 1: Try Stream-based calculation (default lane only, streams are not per lane)
+	if queueData.Lane == "" {
+		streamKey := queue.UserStreamKey(queueData.EventID, queueData.UserID)
+		entries, err := q.redisClient.XRange(ctx, streamKey, "-", "+").Result()
+		if err == nil && len(entries) > 0 {
+			for _, entry := range entries {
+				if token, ok := entry.Values["token"].(string); ok && token == waitingToken {
+					// Use optimized SCAN-based position calculation (not KEYS)
+					position, err := q.streamQueue.GetGlobalPosition(ctx, queueData.EventID, queueData.UserID, entry.ID)
+					if err == nil {
+						q.logger.WithFields(logrus.Fields{
+							"waiting_token": waitingToken,
+							"stream_id":     entry.ID,
+							"position":      position,
+							"method":        "stream_fallback",
+						}).Debug("Calculated position from Stream (fallback)")
+
+						return position
+					}
 				}
 			}
 		}
 	}
 
 	// Fallback 2: Legacy ZSET (compatibility)
-	eventQueueKey := fmt.Sprintf("queue:event:{%s}", queueData.EventID)
+	eventQueueKey := queue.EventQueueKey(queueData.EventID, queueData.Lane)
 	rank, err := q.redisClient.ZRank(ctx, eventQueueKey, waitingToken).Result()
 	if err != nil {
 		q.logger.WithError(err).WithFields(logrus.Fields{
 			"waiting_token": waitingToken,
 			"event_id":      queueData.EventID,
+			"lane":          queueData.Lane,
 		}).Warn("Failed to get queue rank, using stored position")
-		return queueData.Position, 60 // Default ETA
+		return 0
 	}
 
 	position = int(rank) + 1
-	slidingWindow := queue.NewSlidingWindowMetrics(q.redisClient, queueData.EventID, q.logger)
-	eta := slidingWindow.CalculateAdvancedETA(ctx, position)
-
 	q.logger.WithFields(logrus.Fields{
 		"waiting_token": waitingToken,
 		"position":      position,
-		"eta":           eta,
+		"lane":          queueData.Lane,
 		"method":        "legacy_zset",
 	}).Debug("Calculated position with legacy ZSET (final fallback)")
 
-	return position, eta
+	return position
+}
+
+// effectivePosition maps a position within a lane to the position in the weighted,
+// interleaved admission order used by the admission window, wait tiers and ETA
+func (q *QueueHandler) effectivePosition(ctx context.Context, policy *queue.QueuePolicy, queueData *QueueData, lanePosition int) int {
+	if len(policy.Lanes) == 0 && queueData.Lane == "" {
+		return lanePosition
+	}
+
+	sizes, err := queue.LaneSizes(ctx, q.redisClient, queueData.EventID)
+	if err != nil {
+		q.logger.WithError(err).WithField("event_id", queueData.EventID).Warn("Failed to get lane sizes, using lane position")
+		return lanePosition
+	}
+	return policy.EffectivePosition(queueData.Lane, lanePosition, sizes)
 }
 
-func (q *QueueHandler) isEligibleForEntry(ctx context.Context, queueData *QueueData, waitingToken string) bool {
-	// 1. Get current position first
-	eventQueueKey := fmt.Sprintf("queue:event:{%s}", queueData.EventID)
+// isEligibleForEntry checks whether the token may enter now. bucketTokenTaken
+// reports that the check spent a token bucket token, which the caller returns
+// with refundBucketToken if the admission then fails.
+func (q *QueueHandler) isEligibleForEntry(ctx context.Context, queueData *QueueData, waitingToken string) (eligible, bucketTokenTaken bool) {
+	// 0. Paused and closed queues admit nobody
+	if !q.controlFor(ctx, queueData.EventID).AdmitsEntries() {
+		return false, false
+	}
+
+	policy := q.policyFor(ctx, queueData.EventID)
+
+	// Inventory cap: no admission (and no bucket token spent) while outstanding
+	// reservation tokens already cover the remaining seats
+	if q.inventoryFor(ctx, queueData.EventID).Available(policy.OversellFactor) == 0 {
+		return false, false
+	}
+
+	// Wave admission: only tokens marked by the leader's wave may enter (no token bucket)
+	if policy.Wave != nil {
+		_, marked := q.waveDeadline(ctx, queueData, waitingToken)
+		return marked, false
+	}
+
+	// 1. Get current position first (effective position across priority lanes)
+	eventQueueKey := queue.EventQueueKey(queueData.EventID, queueData.Lane)
 	rank, err := q.redisClient.ZRank(ctx, eventQueueKey, waitingToken).Result()
 	if err != nil {
 		q.logger.WithFields(logrus.Fields{
 			"waiting_token": waitingToken,
 			"error":         err,
 		}).Debug("Not eligible: failed to get rank")
-		return false
+		return false, false
 	}
 
-	position := int(rank) + 1
+	position := q.effectivePosition(ctx, policy, queueData, int(rank)+1)
 
-	// 2. Position check (top 100 only)
-	if position > 100 {
+	// 2. Position check (admission window, top 100 by default)
+	if position > policy.AdmissionWindow {
 		q.logger.WithFields(logrus.Fields{
-			"waiting_token": waitingToken,
-			"position":      position,
-		}).Debug("Not eligible: not in top 100 positions")
-		return false
+			"waiting_token":    waitingToken,
+			"position":         position,
+			"admission_window": policy.AdmissionWindow,
+		}).Debug("Not eligible: outside admission window")
+		return false, false
 	}
 
-	// 3. Dynamic minimum wait time based on position
+	// 3. Dynamic minimum wait time based on position (policy wait tiers)
+	// Default tiers:
 	// - Position 1-10: 0 seconds (immediate entry)
 	// - Position 11-50: 2 seconds
 	// - Position 51-100: 5 seconds
 	waitTime := time.Since(queueData.JoinedAt)
-	var minWaitTime time.Duration
-
-	if position <= 10 {
-		minWaitTime = 0 * time.Second // Top 10: immediate entry! 🎉
-	} else if position <= 50 {
-		minWaitTime = 2 * time.Second
-	} else {
-		minWaitTime = 5 * time.Second
-	}
+	minWaitTime := policy.MinWaitFor(position)
 
 	if waitTime < minWaitTime {
 		q.logger.WithFields(logrus.Fields{
@@ -600,30 +933,29 @@ func (q *QueueHandler) isEligibleForEntry(ctx context.Context, queueData *QueueD
 			"wait_time":     waitTime.Seconds(),
 			"min_wait_time": minWaitTime.Seconds(),
 		}).Debug("Not eligible: minimum wait time not met")
-		return false
+		return false, false
 	}
 
 	// 4. Token Bucket check (rate limiting)
-	// 🔴 Top 10 users bypass token bucket (VIP treatment)
-	if position <= 10 {
+	// 🔴 Top N users bypass token bucket (VIP treatment, top 10 by default)
+	if position <= policy.VIPBypassPositions {
 		q.logger.WithFields(logrus.Fields{
 			"waiting_token": waitingToken,
 			"position":      position,
 			"wait_time":     waitTime.Seconds(),
 			"min_wait_time": minWaitTime.Seconds(),
 			"admitted":      true,
-			"bypass":        "top_10_vip",
+			"bypass":        "vip",
 		}).Info("Eligibility check completed - VIP bypass")
-		return true
+		return true, false
 	}
 
-	// For position > 10, apply token bucket rate limiting
-	bucket := queue.NewTokenBucketAdmission(q.redisClient, queueData.EventID, q.logger)
-	admitted, err := bucket.TryAdmit(ctx, queueData.UserID)
+	// Outside the VIP positions, apply token bucket rate limiting
+	admitted, err := q.admissionBucket(policy, queueData).TryAdmit(ctx, queueData.UserID)
 
 	if err != nil {
 		q.logger.WithError(err).Error("Token bucket admission failed")
-		return false
+		return false, false
 	}
 
 	q.logger.WithFields(logrus.Fields{
@@ -634,16 +966,47 @@ func (q *QueueHandler) isEligibleForEntry(ctx context.Context, queueData *QueueD
 		"admitted":      admitted,
 	}).Info("Eligibility check completed")
 
-	return admitted
+	return admitted, admitted
+}
+
+// refundBucketToken returns the token bucket token spent by isEligibleForEntry
+// when the admission it allowed failed
+func (q *QueueHandler) refundBucketToken(ctx context.Context, queueData *QueueData) {
+	policy := q.policyFor(ctx, queueData.EventID)
+	if err := q.admissionBucket(policy, queueData).Refund(ctx, queueData.UserID); err != nil {
+		q.logger.WithError(err).WithField("event_id", queueData.EventID).Warn("Failed to refund token bucket admission")
+	}
+}
+
+func (q *QueueHandler) admissionBucket(policy *queue.QueuePolicy, queueData *QueueData) *queue.TokenBucketAdmission {
+	bucket := queue.NewTokenBucketAdmission(q.redisClient, queueData.EventID, q.logger)
+	bucket.SetCapacity(policy.BucketCapacity)
+	bucket.SetRefillRate(policy.BucketRefillRate)
+	return bucket
 }
 
 // isEligibleForEntryWithoutTokenConsumption checks eligibility WITHOUT consuming tokens
 // This is used by Status API to avoid consuming tokens during polling
-// Only checks: Position (≤100) + Minimum Wait Time
+// Only checks: Position (admission window) + Minimum Wait Time
 // Does NOT check: Token Bucket (that would consume a token!)
 func (q *QueueHandler) isEligibleForEntryWithoutTokenConsumption(ctx context.Context, queueData *QueueData, waitingToken string) bool {
-	// 1. Get current position first
-	eventQueueKey := fmt.Sprintf("queue:event:{%s}", queueData.EventID)
+	if !q.controlFor(ctx, queueData.EventID).AdmitsEntries() {
+		return false
+	}
+
+	policy := q.policyFor(ctx, queueData.EventID)
+
+	if q.inventoryFor(ctx, queueData.EventID).Available(policy.OversellFactor) == 0 {
+		return false
+	}
+
+	if policy.Wave != nil {
+		_, marked := q.waveDeadline(ctx, queueData, waitingToken)
+		return marked
+	}
+
+	// 1. Get current position first (effective position across priority lanes)
+	eventQueueKey := queue.EventQueueKey(queueData.EventID, queueData.Lane)
 	rank, err := q.redisClient.ZRank(ctx, eventQueueKey, waitingToken).Result()
 	if err != nil {
 		q.logger.WithFields(logrus.Fields{
@@ -653,24 +1016,16 @@ func (q *QueueHandler) isEligibleForEntryWithoutTokenConsumption(ctx context.Con
 		return false
 	}
 
-	position := int(rank) + 1
+	position := q.effectivePosition(ctx, policy, queueData, int(rank)+1)
 
-	// 2. Position check (top 100 only)
-	if position > 100 {
+	// 2. Position check (admission window)
+	if position > policy.AdmissionWindow {
 		return false
 	}
 
 	// 3. Dynamic minimum wait time based on position
 	waitTime := time.Since(queueData.JoinedAt)
-	var minWaitTime time.Duration
-
-	if position <= 10 {
-		minWaitTime = 0 * time.Second // Top 10: immediate entry! 🎉
-	} else if position <= 50 {
-		minWaitTime = 2 * time.Second
-	} else {
-		minWaitTime = 5 * time.Second
-	}
+	minWaitTime := policy.MinWaitFor(position)
 
 	if waitTime < minWaitTime {
 		return false
@@ -689,7 +1044,80 @@ func (q *QueueHandler) isEligibleForEntryWithoutTokenConsumption(ctx context.Con
 	return true
 }
 
+// waveDeadline returns the Enter deadline of a token marked by an admission wave.
+// ok is false when the token is unmarked, its deadline passed or Redis is unavailable.
+func (q *QueueHandler) waveDeadline(ctx context.Context, queueData *QueueData, waitingToken string) (time.Time, bool) {
+	deadline, ok, err := queue.WaveDeadline(ctx, q.redisClient, queueData.EventID, waitingToken)
+	if err != nil {
+		q.logger.WithError(err).WithField("waiting_token", waitingToken).Warn("Failed to read wave mark")
+		return time.Time{}, false
+	}
+	return deadline, ok
+}
+
+// inventoryFor returns the event's remaining seats and outstanding grants
+// (uncapped when no inventory counter exists or Redis is unavailable)
+func (q *QueueHandler) inventoryFor(ctx context.Context, eventID string) *queue.Inventory {
+	inventory, err := q.inventory.Get(ctx, eventID)
+	if err != nil {
+		q.logger.WithError(err).WithField("event_id", eventID).Warn("Failed to load inventory, admission not capped")
+	}
+	return inventory
+}
+
+// policyFor returns the event's queue policy, using defaults if Redis is unavailable
+func (q *QueueHandler) policyFor(ctx context.Context, eventID string) *queue.QueuePolicy {
+	policy, err := q.policies.Get(ctx, eventID)
+	if err != nil {
+		q.logger.WithError(err).WithField("event_id", eventID).Warn("Failed to load queue policy, using defaults")
+	}
+	return policy
+}
+
+// controlFor returns the event's queue state, treating it as open if Redis is unavailable
+func (q *QueueHandler) controlFor(ctx context.Context, eventID string) *queue.QueueControl {
+	control, err := q.controls.Get(ctx, eventID)
+	if err != nil {
+		q.logger.WithError(err).WithField("event_id", eventID).Warn("Failed to load queue state, assuming open")
+	}
+	return control
+}
+
+// queueStateError rejects a request blocked by the queue state:
+// 503 QUEUE_PAUSED, 403 QUEUE_DRAINING or 410 QUEUE_CLOSED
+func (q *QueueHandler) queueStateError(c *fiber.Ctx, control *queue.QueueControl) error {
+	status, code, message := fiber.StatusServiceUnavailable, "QUEUE_PAUSED", "Admissions are paused"
+	switch control.State {
+	case queue.QueueStateDraining:
+		status, code, message = fiber.StatusForbidden, "QUEUE_DRAINING", "The queue is no longer accepting new users"
+	case queue.QueueStateClosed:
+		status, code, message = fiber.StatusGone, "QUEUE_CLOSED", "The queue has been closed"
+	}
+	if control.Reason != "" {
+		message = control.Reason
+	}
+
+	return c.Status(status).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":     code,
+			"message":  message,
+			"trace_id": c.Get("X-Request-ID"),
+		},
+	})
+}
+
 // Error response helpers
+// soldOutError answers requests for an event whose inventory reached zero
+func (q *QueueHandler) soldOutError(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusGone).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":     "SOLD_OUT",
+			"message":  soldOutMessage,
+			"trace_id": c.Get("X-Request-ID"),
+		},
+	})
+}
+
 func (q *QueueHandler) badRequestError(c *fiber.Ctx, code, message string) error {
 	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 		"error": fiber.Map{
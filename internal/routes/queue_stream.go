@@ -0,0 +1,292 @@
+package routes
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/queue"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// statusStreamInterval is how soon the stream retries after a Redis error
+	statusStreamInterval = 1 * time.Second
+
+	// statusStreamRefresh is the longest the stream waits before re-evaluating
+	// the status (and renewing the heartbeat) when the event did not change.
+	// Events are only written when something the client displays has changed.
+	statusStreamRefresh = 15 * time.Second
+
+	// statusStreamKeepAlive is the maximum silence before a comment frame is sent
+	// so that proxies and load balancers don't close an idle connection
+	statusStreamKeepAlive = 15 * time.Second
+
+	// statusStreamRetryMs tells EventSource clients how fast to reconnect
+	statusStreamRetryMs = 1000
+)
+
+// StatusStream handles queue status streaming via Server-Sent Events
+// @Summary Stream queue status
+// @Description Hold a Server-Sent Events connection that pushes a QueueStatusResponse whenever position, ETA or ready_for_entry changes.
+// @Description The heartbeat is renewed while the connection is open and stops being renewed once the client disconnects. The stream ends with an "admitted", "sold_out" or "expired" event
+// @Description (code QUEUE_CLOSED when an operator closes the queue).
+// @Tags Queue
+// @Produce text/event-stream
+// @Param token query string true "Waiting token"
+// @Success 200 {object} QueueStatusResponse "event: status"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Invalid waiting token signature"
+// @Failure 403 {object} map[string]interface{} "Waiting token belongs to another session"
+// @Failure 404 {object} map[string]interface{} "Token not found"
+// @Failure 500 {object} map[string]interface{} "Internal error"
+// @Router /queue/status/stream [get]
+func (q *QueueHandler) StatusStream(c *fiber.Ctx) error {
+	rawToken := c.Query("token")
+	if rawToken == "" {
+		return q.badRequestError(c, "MISSING_TOKEN", "waiting token is required")
+	}
+
+	claims, err := q.verifyWaitingToken(c, rawToken)
+	if err != nil {
+		return q.waitingTokenError(c, err)
+	}
+	waitingToken := claims.ID
+
+	ctx := c.Context()
+
+	// Validate up-front so clients get a regular JSON error instead of an empty stream
+	queueData, err := q.getQueueData(ctx, claims.EventID, waitingToken)
+	if err != nil {
+		if err == redis.Nil {
+			return q.notFoundError(c, "TOKEN_NOT_FOUND", "Waiting token not found or expired")
+		}
+		q.logger.WithError(err).Error("Failed to get queue data")
+		return q.internalError(c, "QUEUE_ERROR", "Failed to get queue status")
+	}
+
+	if queueData.Status != "ready" {
+		alive, err := q.checkHeartbeat(ctx, queueData, waitingToken)
+		if err != nil {
+			q.logger.WithError(err).Warn("Failed to check heartbeat")
+		} else if !alive {
+			return q.notFoundError(c, "TOKEN_EXPIRED", "Waiting token expired due to inactivity")
+		}
+	}
+
+	// fasthttp applies the server write timeout to the whole streamed body,
+	// so end the stream shortly before it and let EventSource reconnect.
+	maxDuration := time.Duration(0)
+	if writeTimeout := c.App().Config().WriteTimeout; writeTimeout > 0 {
+		maxDuration = writeTimeout - 5*time.Second
+		if maxDuration <= 0 {
+			maxDuration = writeTimeout
+		}
+	}
+
+	// Re-evaluate often enough to keep the heartbeat alive
+	refresh := statusStreamRefresh
+	if heartbeatTTL := q.policyFor(ctx, queueData.EventID).HeartbeatTTL(); heartbeatTTL/2 < refresh {
+		refresh = max(heartbeatTTL/2, statusStreamInterval)
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set("X-Accel-Buffering", "no") // Disable proxy buffering (nginx/ALB)
+
+	// Note: the fiber.Ctx is released once this handler returns,
+	// so the writer below must only use values captured here.
+	streamCtx, cancel := watchDisconnect(c.Context())
+	c.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+		q.streamStatus(streamCtx, w, queueData.EventID, waitingToken, refresh, maxDuration)
+	}))
+
+	return nil
+}
+
+// watchDisconnect returns a context cancelled once the client closes the
+// connection or the server shuts down. SSE clients send nothing after the
+// request, so a read returning means the client is gone; the connection is
+// closed after the response so no later request is read here.
+func watchDisconnect(requestCtx *fasthttp.RequestCtx) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	conn := requestCtx.Conn()
+	serverDone := requestCtx.Done()
+	requestCtx.SetConnectionClose()
+
+	go func() {
+		// Clear the request read deadline, which would end the stream early
+		_ = conn.SetReadDeadline(time.Time{})
+		_, _ = conn.Read(make([]byte, 1))
+		cancel()
+	}()
+	go func() {
+		select {
+		case <-serverDone:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// streamStatus pushes status events until the token is admitted, expires, the
+// client disconnects or maxDuration elapses. The status is re-evaluated when
+// the event watcher reports a change, and at least every refresh.
+func (q *QueueHandler) streamStatus(ctx context.Context, w *bufio.Writer, eventID, waitingToken string, refresh, maxDuration time.Duration) {
+	changes, unsubscribe := q.watcher.Subscribe(eventID)
+	defer unsubscribe()
+
+	lastWrite := time.Now()
+	var deadline <-chan time.Time
+	if maxDuration > 0 {
+		timer := time.NewTimer(maxDuration)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", statusStreamRetryMs); err != nil {
+		return
+	}
+
+	var last *QueueStatusResponse
+	for {
+		next := refresh
+		queueData, err := q.getQueueData(ctx, eventID, waitingToken)
+		switch {
+		case err == redis.Nil:
+			_ = writeSSEEvent(w, "expired", fiber.Map{
+				"code":    "TOKEN_NOT_FOUND",
+				"message": "Waiting token not found or expired",
+			})
+			return
+		case err != nil:
+			if ctx.Err() != nil {
+				return
+			}
+			// Transient Redis error: keep the connection, retry shortly
+			q.logger.WithError(err).WithField("waiting_token", waitingToken).Warn("Failed to get queue data for status stream")
+			next = statusStreamInterval
+		case queueData.Status == "ready":
+			// Enter already granted admission (heartbeat is gone by design)
+			status := q.buildStatus(ctx, queueData, waitingToken)
+			_ = writeSSEEvent(w, "admitted", status)
+			return
+		default:
+			alive, err := q.checkHeartbeat(ctx, queueData, waitingToken)
+			if err != nil {
+				q.logger.WithError(err).Warn("Failed to check heartbeat")
+			} else if !alive {
+				_ = writeSSEEvent(w, "expired", fiber.Map{
+					"code":    "TOKEN_EXPIRED",
+					"message": "Waiting token expired due to inactivity",
+				})
+				return
+			}
+
+			status := q.buildStatus(ctx, queueData, waitingToken)
+			if status.Status == "expired" {
+				// Closed by an operator or skipped by an admission wave
+				_ = writeSSEEvent(w, "expired", expiredPayload(&status))
+				return
+			}
+			if status.Status == "sold_out" {
+				_ = writeSSEEvent(w, "sold_out", status)
+				return
+			}
+			if status.Status == "lobby" {
+				// Re-evaluate right after opening, which moves the token into the queue
+				if opensIn := time.Duration(status.OpensInSec+1) * time.Second; opensIn < next {
+					next = opensIn
+				}
+			}
+			if status.Status == "waiting" && !status.ReadyForEntry && status.Position <= q.policyFor(ctx, eventID).AdmissionWindow {
+				// Inside the admission window, readiness also waits on the minimum wait time
+				next = statusStreamInterval
+			}
+			if last == nil || statusChanged(last, &status) {
+				if err := writeSSEEvent(w, "status", status); err != nil {
+					// Client disconnected
+					return
+				}
+				last = &status
+				lastWrite = time.Now()
+			}
+		}
+
+		if time.Since(lastWrite) >= statusStreamKeepAlive {
+			if _, err := w.WriteString(": keep-alive\n\n"); err != nil {
+				return
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+			lastWrite = time.Now()
+		}
+
+		if untilKeepAlive := statusStreamKeepAlive - time.Since(lastWrite); untilKeepAlive < next {
+			next = untilKeepAlive
+		}
+
+		timer := time.NewTimer(next)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-deadline:
+			timer.Stop()
+			q.logger.WithField("waiting_token", waitingToken).Debug("Status stream reached max duration, client will reconnect")
+			return
+		case <-changes:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// statusChanged reports whether any client-visible field of the status changed
+func statusChanged(prev, next *QueueStatusResponse) bool {
+	return prev.Status != next.Status ||
+		prev.Position != next.Position ||
+		prev.ETASeconds != next.ETASeconds ||
+		prev.ETAP90Seconds != next.ETAP90Seconds ||
+		prev.ReadyForEntry != next.ReadyForEntry ||
+		prev.OpensInSec != next.OpensInSec ||
+		prev.QueueState != next.QueueState
+}
+
+// expiredPayload is the expired payload sent to connected clients when the queue
+// is closed or the token missed its admission wave deadline
+func expiredPayload(status *QueueStatusResponse) fiber.Map {
+	if status.QueueState != string(queue.QueueStateClosed) {
+		return fiber.Map{"code": "TOKEN_EXPIRED", "message": status.Reason}
+	}
+
+	message := status.Reason
+	if message == "" {
+		message = "The queue has been closed"
+	}
+	return fiber.Map{"code": "QUEUE_CLOSED", "message": message}
+}
+
+// writeSSEEvent writes a single named SSE event with a JSON payload and flushes it
+func writeSSEEvent(w *bufio.Writer, event string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		logrus.WithError(err).WithField("event", event).Error("Failed to marshal SSE payload")
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
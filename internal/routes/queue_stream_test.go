@@ -0,0 +1,96 @@
+package routes
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/queue"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sseEvent struct {
+	name string
+	data string
+}
+
+// readSSE forwards the events of an SSE body until it ends
+func readSSE(body *bufio.Scanner, events chan<- sseEvent) {
+	defer close(events)
+	var event sseEvent
+	for body.Scan() {
+		line := body.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.data = strings.TrimPrefix(line, "data: ")
+		case line == "" && event.name != "":
+			events <- event
+			event = sseEvent{}
+		}
+	}
+}
+
+func nextStatus(t *testing.T, events <-chan sseEvent, timeout time.Duration) QueueStatusResponse {
+	select {
+	case event, ok := <-events:
+		require.True(t, ok, "stream ended")
+		require.Equal(t, "status", event.name)
+		var status QueueStatusResponse
+		require.NoError(t, json.Unmarshal([]byte(event.data), &status))
+		return status
+	case <-time.After(timeout):
+		t.Fatal("no status event")
+		return QueueStatusResponse{}
+	}
+}
+
+func TestStatusStream(t *testing.T) {
+	server := newQueueTestServer(t)
+	eventID := "test-sse-evt"
+	policy := queue.DefaultQueuePolicy(eventID)
+	policy.HeartbeatTTLSeconds = 2
+	server.setPolicy(t, policy)
+
+	first := server.join(t, eventID)
+	second := server.join(t, eventID)
+
+	resp := server.request(t, second, fiber.MethodGet, "/queue/status/stream?token="+second.token, nil)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get(fiber.HeaderContentType))
+	events := make(chan sseEvent, 8)
+	go readSSE(bufio.NewScanner(resp.Body), events)
+
+	status := nextStatus(t, events, 2*time.Second)
+	assert.Equal(t, "waiting", status.Status)
+	assert.Equal(t, 2, status.Position)
+	assert.Equal(t, 1, server.handler.watcher.Watching(eventID), "Streams share the event watcher")
+
+	// A change of the queue is pushed without the client asking
+	left := server.request(t, first, fiber.MethodDelete, "/queue/leave?token="+first.token, nil)
+	left.Body.Close()
+	require.Equal(t, fiber.StatusOK, left.StatusCode)
+
+	status = nextStatus(t, events, 3*time.Second)
+	assert.Equal(t, 1, status.Position)
+
+	// Once the client disconnects, the stream ends and stops renewing the heartbeat
+	resp.Body.Close()
+	assert.Eventually(t, func() bool {
+		return server.handler.watcher.Watching(eventID) == 0
+	}, 2*time.Second, 50*time.Millisecond)
+
+	claims, err := server.handler.tokens.Verify(second.token)
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		exists, err := server.redisClient.Exists(context.Background(), queue.HeartbeatKey(eventID, claims.ID)).Result()
+		return err == nil && exists == 0
+	}, 4*time.Second, 100*time.Millisecond, "Heartbeat expires after the client left")
+}
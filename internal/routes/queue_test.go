@@ -0,0 +1,178 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/middleware"
+	"github.com/traffic-tacos/gateway-api/internal/queue"
+	"github.com/traffic-tacos/gateway-api/internal/testutil"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// queueTestServer serves the queue routes on a local port
+type queueTestServer struct {
+	handler     *QueueHandler
+	redisClient redis.UniversalClient
+	address     string
+}
+
+func newQueueTestServer(t *testing.T) *queueTestServer {
+	redisClient := testutil.NewRedisClient(t)
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+
+	signer, err := queue.NewTokenSigner([]queue.SigningKey{{ID: "test", Secret: []byte("queue-test-secret")}})
+	require.NoError(t, err)
+	handler := NewQueueHandler(redisClient, queue.NewPolicyStore(redisClient, logger), queue.NewControlStore(redisClient, logger), signer, logger)
+
+	app := fiber.New()
+	app.Use(middleware.NewSessionMiddleware([]byte("session-test-secret"), false, logger).Handle())
+	app.Post("/queue/join", handler.Join)
+	app.Get("/queue/status/stream", handler.StatusStream)
+	app.Get("/queue/ws", handler.WebSocketUpgrade, websocket.New(handler.WebSocket))
+	app.Post("/queue/enter", handler.Enter)
+	app.Delete("/queue/leave", handler.Leave)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = app.Listener(listener) }()
+	t.Cleanup(func() { _ = app.Shutdown() })
+
+	return &queueTestServer{
+		handler:     handler,
+		redisClient: redisClient,
+		address:     listener.Addr().String(),
+	}
+}
+
+// setPolicy stores policy for the test and removes the event's keys afterwards
+func (s *queueTestServer) setPolicy(t *testing.T, policy *queue.QueuePolicy) {
+	ctx := context.Background()
+	cleanup := func() {
+		keys, _ := s.redisClient.Keys(ctx, "*{"+policy.EventID+"}*").Result()
+		if len(keys) > 0 {
+			s.redisClient.Del(ctx, keys...)
+		}
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+	require.NoError(t, s.handler.policies.Set(ctx, policy))
+}
+
+// queueTestCaller is a client with its own anonymous session
+type queueTestCaller struct {
+	session string
+	token   string
+}
+
+func (s *queueTestServer) join(t *testing.T, eventID string) *queueTestCaller {
+	resp, err := http.Post("http://"+s.address+"/queue/join", fiber.MIMEApplicationJSON, strings.NewReader(`{"event_id":"`+eventID+`"}`))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, fiber.StatusAccepted, resp.StatusCode)
+
+	var joined JoinQueueResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&joined))
+	return &queueTestCaller{session: resp.Header.Get(middleware.SessionHeader), token: joined.WaitingToken}
+}
+
+func (s *queueTestServer) request(t *testing.T, caller *queueTestCaller, method, path string, body []byte) *http.Response {
+	req, err := http.NewRequest(method, "http://"+s.address+path, bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set(middleware.SessionHeader, caller.session)
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	return resp
+}
+
+// bucketPolicy admits through the token bucket from the first position, with
+// one token that does not refill during the test
+func bucketPolicy(eventID string) *queue.QueuePolicy {
+	policy := queue.DefaultQueuePolicy(eventID)
+	policy.VIPBypassPositions = 0
+	policy.BucketCapacity = 1
+	policy.BucketRefillRate = 0.0001
+	return policy
+}
+
+// fillGrants makes outstanding grants cover the remaining seat. The handler's
+// inventory cache still holds the uncapped inventory it read at join, as it
+// would right after another admission.
+func (s *queueTestServer) fillGrants(t *testing.T, eventID string) {
+	ctx := context.Background()
+	require.NoError(t, s.redisClient.Set(ctx, queue.InventoryKey(eventID), 1, 0).Err())
+	require.NoError(t, s.redisClient.ZAdd(ctx, queue.GrantsKey(eventID), redis.Z{
+		Score:  float64(time.Now().Add(time.Minute).Unix()),
+		Member: "other-reservation",
+	}).Err())
+}
+
+func (s *queueTestServer) bucketTokens(t *testing.T, eventID string) string {
+	tokens, err := s.redisClient.HGet(context.Background(), "admission:bucket:"+eventID, "tokens").Result()
+	require.NoError(t, err)
+	return tokens
+}
+
+func TestEnter_FailedGrantRefundsBucketToken(t *testing.T) {
+	server := newQueueTestServer(t)
+	eventID := "test-enter-refund-evt"
+	server.setPolicy(t, bucketPolicy(eventID))
+	bucketKey := "admission:bucket:" + eventID
+	server.redisClient.Del(context.Background(), bucketKey)
+	t.Cleanup(func() { server.redisClient.Del(context.Background(), bucketKey) })
+
+	caller := server.join(t, eventID)
+	server.fillGrants(t, eventID)
+	enter := func() int {
+		body, _ := json.Marshal(EnterQueueRequest{WaitingToken: caller.token})
+		resp := server.request(t, caller, fiber.MethodPost, "/queue/enter", body)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// The grant fails after the eligibility check took the only bucket token
+	assert.Equal(t, fiber.StatusForbidden, enter())
+	assert.Equal(t, "1", server.bucketTokens(t, eventID), "Failed grant returns the bucket token")
+
+	// Once a seat frees up, the returned token admits the caller
+	require.NoError(t, server.redisClient.Del(context.Background(), queue.GrantsKey(eventID)).Err())
+	assert.Equal(t, fiber.StatusOK, enter())
+	assert.Equal(t, "0", server.bucketTokens(t, eventID))
+}
+
+func TestEnter_RecordsAdmissionPerReservationToken(t *testing.T) {
+	server := newQueueTestServer(t)
+	eventID := "test-enter-metrics-evt"
+	server.setPolicy(t, bucketPolicy(eventID))
+	ctx := context.Background()
+	metricsKey := "metrics:admission:" + eventID
+	bucketKey := "admission:bucket:" + eventID
+	server.redisClient.Del(ctx, metricsKey, bucketKey)
+	t.Cleanup(func() { server.redisClient.Del(ctx, metricsKey, bucketKey) })
+
+	caller := server.join(t, eventID)
+	body, _ := json.Marshal(EnterQueueRequest{WaitingToken: caller.token})
+	resp := server.request(t, caller, fiber.MethodPost, "/queue/enter", body)
+	defer resp.Body.Close()
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var entered EnterQueueResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&entered))
+	members, err := server.redisClient.ZRange(ctx, metricsKey, 0, -1).Result()
+	require.NoError(t, err)
+	assert.Equal(t, []string{entered.ReservationToken}, members)
+}
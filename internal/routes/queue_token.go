@@ -0,0 +1,102 @@
+package routes
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/config"
+	"github.com/traffic-tacos/gateway-api/internal/middleware"
+	"github.com/traffic-tacos/gateway-api/internal/queue"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// newWaitingTokenSigner builds the signer from QUEUE_TOKEN_SIGNING_KEYS, falling back
+// to a key derived from the JWT secret so existing deployments keep working
+func newWaitingTokenSigner(cfg *config.Config) (*queue.TokenSigner, error) {
+	keys, err := queue.ParseSigningKeys(cfg.Queue.TokenSigningKeys)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		derived := sha256.Sum256([]byte("waiting-token:" + cfg.JWT.Secret))
+		keys = []queue.SigningKey{{ID: "default", Secret: derived[:]}}
+	}
+	return queue.NewTokenSigner(keys)
+}
+
+// waitingTokenBinding derives the binding embedded in a waiting token from the
+// caller's anonymous session (see middleware.SessionMiddleware)
+func waitingTokenBinding(c *fiber.Ctx) string {
+	return queue.BindingFor("session:" + middleware.GetSessionID(c))
+}
+
+// issueWaitingToken signs a waiting token for the queue entry id, bound to the caller's session
+func (q *QueueHandler) issueWaitingToken(c *fiber.Ctx, id, eventID, userID string, joinedAt time.Time) (string, error) {
+	return q.tokens.Sign(queue.WaitingTokenClaims{
+		ID:       id,
+		EventID:  eventID,
+		UserID:   userID,
+		JoinedAt: joinedAt.Unix(),
+		Binding:  waitingTokenBinding(c),
+	})
+}
+
+// verifyWaitingToken checks the token signature and that it belongs to the caller,
+// without touching Redis. Returns the claims; claims.ID is the queue entry id.
+func (q *QueueHandler) verifyWaitingToken(c *fiber.Ctx, token string) (*queue.WaitingTokenClaims, error) {
+	claims, err := q.tokens.VerifyBinding(token, waitingTokenBinding(c))
+	if err != nil {
+		return nil, err
+	}
+
+	// Authenticated callers must also match the user the token was issued to. A
+	// token joined anonymously from this session stays valid after logging in.
+	if userID := middleware.GetUserID(c); userID != "" && claims.UserID != "" && userID != claims.UserID &&
+		claims.UserID != middleware.GetAnonymousID(c) {
+		return nil, queue.ErrWaitingTokenMismatch
+	}
+
+	return claims, nil
+}
+
+// upgradeSession hands the waiting tokens an anonymous session holds over to
+// the user it logged in as. Failures are logged: the tokens stay anonymous.
+func upgradeSession(ctx context.Context, executor *queue.LuaExecutor, policies *queue.PolicyStore, logger *logrus.Logger, anonymousID, userID string) {
+	if anonymousID == "" {
+		return
+	}
+	upgraded, err := executor.UpgradeSession(ctx, policies, anonymousID, userID)
+	if err != nil {
+		logger.WithError(err).WithField("user_id", userID).Warn("Failed to upgrade anonymous session")
+		return
+	}
+	if upgraded > 0 {
+		logger.WithFields(logrus.Fields{
+			"user_id":  userID,
+			"upgraded": upgraded,
+		}).Info("Upgraded anonymous waiting tokens to user")
+	}
+}
+
+// waitingTokenError maps a verification failure to its response
+func (q *QueueHandler) waitingTokenError(c *fiber.Ctx, err error) error {
+	q.logger.WithError(err).WithFields(logrus.Fields{
+		"client_ip": c.IP(),
+		"path":      c.Path(),
+	}).Warn("Rejected waiting token")
+
+	if errors.Is(err, queue.ErrWaitingTokenMismatch) {
+		return q.forbiddenError(c, "WAITING_TOKEN_MISMATCH", "Waiting token was issued to a different session")
+	}
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":     "INVALID_WAITING_TOKEN",
+			"message":  "Waiting token is malformed or its signature is invalid",
+			"trace_id": c.Get("X-Request-ID"),
+		},
+	})
+}
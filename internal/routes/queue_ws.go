@@ -0,0 +1,422 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/queue"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// queueWSWriteTimeout bounds a single push to a slow client
+const queueWSWriteTimeout = 10 * time.Second
+
+// Client → server message types
+const (
+	queueWSMsgHeartbeat = "heartbeat" // Renews the heartbeat TTL (replaces Status polling renewal)
+	queueWSMsgEnter     = "enter"     // Same as POST /queue/enter
+	queueWSMsgAutoEnter = "auto_enter"
+)
+
+// Server → client message types
+const (
+	queueWSEventPosition         = "position"
+	queueWSEventHeartbeatAck     = "heartbeat_ack"
+	queueWSEventAdmissionGranted = "admission_granted"
+	queueWSEventNotReady         = "not_ready"
+	queueWSEventExpired          = "expired"
+	queueWSEventSoldOut          = "sold_out"
+	queueWSEventEntered          = "entered"
+	queueWSEventError            = "error"
+)
+
+// QueueWSClientMessage is a frame sent by the client over the queue WebSocket
+type QueueWSClientMessage struct {
+	Type    string `json:"type"`              // heartbeat|enter|auto_enter
+	Enabled bool   `json:"enabled,omitempty"` // auto_enter only
+}
+
+// QueueWSServerMessage is a frame pushed by the server over the queue WebSocket
+type QueueWSServerMessage struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// WebSocketUpgrade validates the waiting token before upgrading to the queue WebSocket
+// @Summary Open queue WebSocket
+// @Description Upgrade to a WebSocket that replaces Status polling and the Enter call.
+// @Description Client frames: {"type":"heartbeat"}, {"type":"enter"}, {"type":"auto_enter","enabled":true}.
+// @Description Server frames: position, heartbeat_ack, admission_granted, not_ready, expired, sold_out, entered, error.
+// @Tags Queue
+// @Param token query string true "Waiting token"
+// @Param auto_enter query bool false "Push admission_granted as soon as the token is eligible"
+// @Success 101 {object} QueueWSServerMessage "Switching protocols"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Invalid waiting token signature"
+// @Failure 403 {object} map[string]interface{} "Waiting token belongs to another session"
+// @Failure 404 {object} map[string]interface{} "Token not found"
+// @Failure 409 {object} map[string]interface{} "Already entered"
+// @Failure 426 {object} map[string]interface{} "Upgrade required"
+// @Router /queue/ws [get]
+func (q *QueueHandler) WebSocketUpgrade(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return c.Status(fiber.StatusUpgradeRequired).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":     "UPGRADE_REQUIRED",
+				"message":  "WebSocket upgrade required",
+				"trace_id": c.Get("X-Request-ID"),
+			},
+		})
+	}
+
+	rawToken := c.Query("token")
+	if rawToken == "" {
+		return q.badRequestError(c, "MISSING_TOKEN", "waiting token is required")
+	}
+
+	claims, err := q.verifyWaitingToken(c, rawToken)
+	if err != nil {
+		return q.waitingTokenError(c, err)
+	}
+	waitingToken := claims.ID
+
+	ctx := c.Context()
+
+	queueData, err := q.getQueueData(ctx, claims.EventID, waitingToken)
+	if err != nil {
+		if err == redis.Nil {
+			return q.notFoundError(c, "TOKEN_NOT_FOUND", "Waiting token not found or expired")
+		}
+		q.logger.WithError(err).Error("Failed to get queue data")
+		return q.internalError(c, "QUEUE_ERROR", "Failed to get queue status")
+	}
+
+	if queueData.Status == "ready" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":     "ALREADY_ENTERED",
+				"message":  "Admission was already granted for this waiting token",
+				"trace_id": c.Get("X-Request-ID"),
+			},
+		})
+	}
+
+	// Connecting counts as the first heartbeat
+	alive, err := q.checkHeartbeat(ctx, queueData, waitingToken)
+	if err != nil {
+		q.logger.WithError(err).Warn("Failed to check heartbeat")
+	} else if !alive {
+		return q.notFoundError(c, "TOKEN_EXPIRED", "Waiting token expired due to inactivity")
+	}
+
+	c.Locals("waiting_token", waitingToken)
+	c.Locals("event_id", queueData.EventID)
+	c.Locals("auto_enter", c.QueryBool("auto_enter"))
+	return c.Next()
+}
+
+// WebSocket serves the upgraded queue connection.
+// The server pushes a position frame whenever the status changes and an
+// admission_granted frame with the reservation token once the client enters.
+func (q *QueueHandler) WebSocket(conn *websocket.Conn) {
+	waitingToken, _ := conn.Locals("waiting_token").(string)
+	eventID, _ := conn.Locals("event_id").(string)
+	autoEnter, _ := conn.Locals("auto_enter").(bool)
+
+	ctx := context.Background()
+	logger := q.logger.WithField("waiting_token", waitingToken)
+	policy := q.policyFor(ctx, eventID)
+
+	incoming := make(chan QueueWSClientMessage, 8)
+	stop := make(chan struct{})
+	closed := make(chan struct{})
+	// A client that stops sending frames expires the same way a polling one does
+	go q.readWSMessages(conn, policy.HeartbeatTTL(), incoming, stop, closed)
+
+	// The Conn is returned to a pool once this handler returns,
+	// so close it and wait for the reader before leaving.
+	defer func() {
+		close(stop)
+		_ = conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+			time.Now().Add(time.Second))
+		_ = conn.Close()
+		<-closed
+	}()
+
+	logger.WithField("auto_enter", autoEnter).Debug("Queue WebSocket connected")
+	defer logger.Debug("Queue WebSocket disconnected")
+
+	// Like the status stream, the status is re-evaluated when the event watcher
+	// reports a change, and at least every statusStreamRefresh
+	changes, unsubscribe := q.watcher.Subscribe(eventID)
+	defer unsubscribe()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	var last *QueueStatusResponse
+	evaluate := true // Evaluate immediately on connect
+	for {
+		if evaluate {
+			status, done := q.pushWSStatus(ctx, conn, eventID, waitingToken, last)
+			if done {
+				return
+			}
+			if status != nil {
+				last = status
+				if autoEnter && status.ReadyForEntry && q.tryWSEnter(ctx, conn, eventID, waitingToken, false) {
+					return
+				}
+			}
+			evaluate = false
+
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(q.nextWSEvaluation(ctx, eventID, status, autoEnter))
+		}
+
+		select {
+		case <-closed:
+			return
+		case <-changes:
+			evaluate = true
+		case <-timer.C:
+			evaluate = true
+		case msg := <-incoming:
+			switch msg.Type {
+			case queueWSMsgHeartbeat:
+				heartbeatTTL := q.policyFor(ctx, eventID).HeartbeatTTL()
+				renewed, err := q.redisClient.Expire(ctx, queue.HeartbeatKey(eventID, waitingToken), heartbeatTTL).Result()
+				if err != nil {
+					logger.WithError(err).Warn("Failed to renew heartbeat")
+				} else if !renewed {
+					q.cleanupAbandoned(ctx, eventID, waitingToken)
+					q.writeWSExpired(conn)
+					return
+				}
+				if err := q.writeWS(conn, QueueWSServerMessage{Type: queueWSEventHeartbeatAck}); err != nil {
+					return
+				}
+			case queueWSMsgEnter:
+				if q.tryWSEnter(ctx, conn, eventID, waitingToken, true) {
+					return
+				}
+			case queueWSMsgAutoEnter:
+				autoEnter = msg.Enabled
+				evaluate = autoEnter
+			default:
+				if err := q.writeWSError(conn, "UNKNOWN_MESSAGE", "Unsupported message type"); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// readWSMessages decodes client frames until the connection fails or the handler stops
+func (q *QueueHandler) readWSMessages(conn *websocket.Conn, readTimeout time.Duration, incoming chan<- QueueWSClientMessage, stop <-chan struct{}, closed chan<- struct{}) {
+	defer close(closed)
+
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(readTimeout))
+		_, payload, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				q.logger.WithError(err).Debug("Queue WebSocket read failed")
+			}
+			return
+		}
+
+		var msg QueueWSClientMessage
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			msg = QueueWSClientMessage{} // Reported as UNKNOWN_MESSAGE
+		}
+
+		select {
+		case incoming <- msg:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// nextWSEvaluation returns how long the connection waits for a change before
+// re-evaluating status anyway. Lobby opening, the minimum wait inside the
+// admission window and auto-enter retries are not signalled by the watcher.
+func (q *QueueHandler) nextWSEvaluation(ctx context.Context, eventID string, status *QueueStatusResponse, autoEnter bool) time.Duration {
+	next := statusStreamRefresh
+	if heartbeatTTL := q.policyFor(ctx, eventID).HeartbeatTTL(); heartbeatTTL/2 < next {
+		next = max(heartbeatTTL/2, statusStreamInterval)
+	}
+
+	switch {
+	case status == nil:
+		// Transient Redis error
+		next = statusStreamInterval
+	case status.Status == "lobby":
+		if opensIn := time.Duration(status.OpensInSec+1) * time.Second; opensIn < next {
+			next = opensIn
+		}
+	case status.Status == "waiting" && !status.ReadyForEntry && status.Position <= q.policyFor(ctx, eventID).AdmissionWindow:
+		next = statusStreamInterval
+	case autoEnter && status.ReadyForEntry:
+		next = statusStreamInterval
+	}
+	return next
+}
+
+// pushWSStatus sends a position frame if the status changed since last.
+// Returns done=true when the connection should be closed.
+func (q *QueueHandler) pushWSStatus(ctx context.Context, conn *websocket.Conn, eventID, waitingToken string, last *QueueStatusResponse) (*QueueStatusResponse, bool) {
+	queueData, err := q.getQueueData(ctx, eventID, waitingToken)
+	if err != nil {
+		if err == redis.Nil {
+			q.writeWSExpired(conn)
+			return nil, true
+		}
+		// Transient Redis error: keep the connection, retry shortly
+		q.logger.WithError(err).WithField("waiting_token", waitingToken).Warn("Failed to get queue data for WebSocket")
+		return nil, false
+	}
+
+	if queueData.Status == "ready" {
+		// Admitted through POST /queue/enter on another connection
+		_ = q.writeWS(conn, QueueWSServerMessage{Type: queueWSEventEntered})
+		return nil, true
+	}
+
+	// Heartbeats come from client frames, so only check here (no renewal)
+	exists, err := q.redisClient.Exists(ctx, queue.HeartbeatKey(eventID, waitingToken)).Result()
+	if err != nil {
+		q.logger.WithError(err).Warn("Failed to check heartbeat")
+	} else if exists == 0 {
+		q.logger.WithField("waiting_token", waitingToken).Info("Heartbeat expired - cleaning up abandoned user")
+		q.cleanupAbandoned(ctx, eventID, waitingToken)
+		q.writeWSExpired(conn)
+		return nil, true
+	}
+
+	status := q.buildStatus(ctx, queueData, waitingToken)
+	if status.Status == "expired" {
+		// Closed by an operator or skipped by an admission wave
+		_ = q.writeWS(conn, QueueWSServerMessage{Type: queueWSEventExpired, Data: expiredPayload(&status)})
+		return nil, true
+	}
+	if status.Status == "sold_out" {
+		_ = q.writeWS(conn, QueueWSServerMessage{Type: queueWSEventSoldOut, Data: status})
+		return nil, true
+	}
+	if last != nil && !statusChanged(last, &status) {
+		return last, false
+	}
+
+	if err := q.writeWS(conn, QueueWSServerMessage{Type: queueWSEventPosition, Data: status}); err != nil {
+		return nil, true
+	}
+
+	return &status, false
+}
+
+// tryWSEnter runs the Enter admission flow and pushes admission_granted on success.
+// Returns true when admission was granted (or the connection is unusable).
+func (q *QueueHandler) tryWSEnter(ctx context.Context, conn *websocket.Conn, eventID, waitingToken string, explicit bool) bool {
+	queueData, err := q.getQueueData(ctx, eventID, waitingToken)
+	if err != nil {
+		if err == redis.Nil {
+			q.writeWSExpired(conn)
+			return true
+		}
+		q.logger.WithError(err).Error("Failed to get queue data")
+		return q.writeWSError(conn, "QUEUE_ERROR", "Failed to validate waiting token") != nil
+	}
+
+	eligible, bucketTokenTaken := q.isEligibleForEntry(ctx, queueData, waitingToken)
+	if !eligible {
+		if !explicit {
+			// Auto-enter retries on the next evaluation
+			return false
+		}
+		code, message := "NOT_READY", "Your turn has not arrived yet"
+		if control := q.controlFor(ctx, queueData.EventID); control.State == queue.QueueStatePaused {
+			code, message = "QUEUE_PAUSED", "Admissions are paused"
+			if control.Reason != "" {
+				message = control.Reason
+			}
+		}
+		err := q.writeWS(conn, QueueWSServerMessage{
+			Type: queueWSEventNotReady,
+			Data: fiber.Map{"code": code, "message": message},
+		})
+		return err != nil
+	}
+
+	resp, err := q.grantAdmission(ctx, queueData, waitingToken)
+	if err != nil && bucketTokenTaken {
+		// Auto-enter retries every evaluation; a failed grant must not drain the bucket
+		q.refundBucketToken(ctx, queueData)
+	}
+	switch {
+	case err == redis.Nil || errors.Is(err, errNotQueued):
+		q.writeWSExpired(conn)
+		return true
+	case errors.Is(err, errAlreadyEntered):
+		_ = q.writeWS(conn, QueueWSServerMessage{Type: queueWSEventEntered})
+		return true
+	case errors.Is(err, errSoldOut):
+		_ = q.writeWS(conn, QueueWSServerMessage{
+			Type: queueWSEventSoldOut,
+			Data: fiber.Map{"code": "SOLD_OUT", "message": soldOutMessage},
+		})
+		return true
+	case errors.Is(err, errInventoryFull):
+		if !explicit {
+			return false
+		}
+		err := q.writeWS(conn, QueueWSServerMessage{
+			Type: queueWSEventNotReady,
+			Data: fiber.Map{"code": "NOT_READY", "message": "All remaining seats are being reserved, please wait"},
+		})
+		return err != nil
+	case err != nil:
+		q.logger.WithError(err).Error("Failed to grant admission")
+		return q.writeWSError(conn, "QUEUE_ERROR", "Failed to grant admission") != nil
+	}
+
+	q.logger.WithFields(logrus.Fields{
+		"waiting_token": waitingToken,
+		"auto_enter":    !explicit,
+	}).Info("Admission granted via WebSocket")
+
+	_ = q.writeWS(conn, QueueWSServerMessage{Type: queueWSEventAdmissionGranted, Data: resp})
+	return true
+}
+
+func (q *QueueHandler) writeWS(conn *websocket.Conn, msg QueueWSServerMessage) error {
+	_ = conn.SetWriteDeadline(time.Now().Add(queueWSWriteTimeout))
+	return conn.WriteJSON(msg)
+}
+
+func (q *QueueHandler) writeWSError(conn *websocket.Conn, code, message string) error {
+	return q.writeWS(conn, QueueWSServerMessage{
+		Type: queueWSEventError,
+		Data: fiber.Map{"code": code, "message": message},
+	})
+}
+
+func (q *QueueHandler) writeWSExpired(conn *websocket.Conn) {
+	_ = q.writeWS(conn, QueueWSServerMessage{
+		Type: queueWSEventExpired,
+		Data: fiber.Map{"code": "TOKEN_EXPIRED", "message": "Waiting token expired due to inactivity"},
+	})
+}
@@ -0,0 +1,104 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/middleware"
+	"github.com/traffic-tacos/gateway-api/internal/queue"
+
+	"github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (s *queueTestServer) dialWS(t *testing.T, caller *queueTestCaller, query string) *websocket.Conn {
+	header := http.Header{}
+	header.Set(middleware.SessionHeader, caller.session)
+	conn, resp, err := websocket.DefaultDialer.Dial("ws://"+s.address+"/queue/ws?token="+caller.token+query, header)
+	require.NoError(t, err)
+	resp.Body.Close()
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+// readWSUntil reads frames until one of type want arrives
+func readWSUntil(t *testing.T, conn *websocket.Conn, want string, timeout time.Duration) QueueWSServerMessage {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(timeout)))
+	for {
+		var msg QueueWSServerMessage
+		require.NoError(t, conn.ReadJSON(&msg), "waiting for %q", want)
+		if msg.Type == want {
+			return msg
+		}
+	}
+}
+
+func TestWebSocket_AutoEnterRefundsFailedGrants(t *testing.T) {
+	server := newQueueTestServer(t)
+	eventID := "test-ws-auto-enter-evt"
+	server.setPolicy(t, bucketPolicy(eventID))
+	bucketKey := "admission:bucket:" + eventID
+	server.redisClient.Del(context.Background(), bucketKey)
+	t.Cleanup(func() { server.redisClient.Del(context.Background(), bucketKey) })
+
+	caller := server.join(t, eventID)
+	server.fillGrants(t, eventID)
+	conn := server.dialWS(t, caller, "&auto_enter=true")
+
+	position := readWSUntil(t, conn, queueWSEventPosition, 2*time.Second)
+	assert.Equal(t, true, position.Data.(map[string]interface{})["ready_for_entry"])
+
+	// Auto-enter took the only bucket token; the failed grant returns it
+	assert.Eventually(t, func() bool {
+		entries, err := server.redisClient.XRange(context.Background(), queue.LifecycleKey(eventID), "-", "+").Result()
+		if err != nil {
+			return false
+		}
+		for _, entry := range entries {
+			if entry.Values["type"] == "eligible" {
+				return true
+			}
+		}
+		return false
+	}, 2*time.Second, 20*time.Millisecond, "Auto-enter attempted a grant")
+	assert.Eventually(t, func() bool {
+		return server.bucketTokens(t, eventID) == "1"
+	}, time.Second, 20*time.Millisecond, "Failed grant returns the bucket token")
+
+	// Retries on later evaluations admit the caller once a seat frees up
+	require.NoError(t, server.redisClient.Del(context.Background(), queue.GrantsKey(eventID)).Err())
+	granted := readWSUntil(t, conn, queueWSEventAdmissionGranted, 4*time.Second)
+	assert.NotEmpty(t, granted.Data.(map[string]interface{})["reservation_token"])
+	assert.Equal(t, "0", server.bucketTokens(t, eventID))
+}
+
+func TestWebSocket_PushesWatcherChanges(t *testing.T) {
+	server := newQueueTestServer(t)
+	eventID := "test-ws-watcher-evt"
+	server.setPolicy(t, queue.DefaultQueuePolicy(eventID))
+
+	first := server.join(t, eventID)
+	second := server.join(t, eventID)
+	conn := server.dialWS(t, second, "")
+
+	position := readWSUntil(t, conn, queueWSEventPosition, 2*time.Second)
+	assert.EqualValues(t, 2, position.Data.(map[string]interface{})["position"])
+	assert.Equal(t, 1, server.handler.watcher.Watching(eventID), "Connections share the event watcher")
+
+	// A change of the queue is pushed well before the safety refresh
+	left := server.request(t, first, fiber.MethodDelete, "/queue/leave?token="+first.token, nil)
+	left.Body.Close()
+	require.Equal(t, fiber.StatusOK, left.StatusCode)
+
+	position = readWSUntil(t, conn, queueWSEventPosition, 3*time.Second)
+	assert.EqualValues(t, 1, position.Data.(map[string]interface{})["position"])
+
+	require.NoError(t, conn.Close())
+	assert.Eventually(t, func() bool {
+		return server.handler.watcher.Watching(eventID) == 0
+	}, 2*time.Second, 50*time.Millisecond)
+}
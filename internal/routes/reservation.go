@@ -1,23 +1,33 @@
 package routes
 
 import (
+	"context"
+	"time"
+
 	"github.com/traffic-tacos/gateway-api/internal/clients"
 	"github.com/traffic-tacos/gateway-api/internal/middleware"
+	"github.com/traffic-tacos/gateway-api/internal/queue"
 	"github.com/traffic-tacos/gateway-api/internal/utils"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
 )
 
 type ReservationHandler struct {
-	client *clients.ReservationClient
-	logger *logrus.Logger
+	client      *clients.ReservationClient
+	redisClient redis.UniversalClient
+	luaExecutor *queue.LuaExecutor
+	logger      *logrus.Logger
 }
 
-func NewReservationHandler(client *clients.ReservationClient, logger *logrus.Logger) *ReservationHandler {
+func NewReservationHandler(client *clients.ReservationClient, redisClient redis.UniversalClient, logger *logrus.Logger) *ReservationHandler {
 	return &ReservationHandler{
-		client: client,
-		logger: logger,
+		client:      client,
+		redisClient: redisClient,
+		luaExecutor: queue.NewLuaExecutor(redisClient, logger),
+		logger:      logger,
 	}
 }
 
@@ -33,6 +43,7 @@ func NewReservationHandler(client *clients.ReservationClient, logger *logrus.Log
 // @Success 201 {object} ReservationResponse
 // @Failure 400 {object} map[string]interface{} "Bad request"
 // @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Missing or invalid queue admission"
 // @Failure 409 {object} map[string]interface{} "Conflict"
 // @Failure 500 {object} map[string]interface{} "Internal error"
 // @Router /reservations [post]
@@ -74,8 +85,32 @@ func (r *ReservationHandler) Create(c *fiber.Ctx) error {
 		return r.unauthorizedError(c, "MISSING_USER", "User authentication required")
 	}
 
+	// 🔴 Queue admission: the reservation token from /queue/enter must exist,
+	// match this event and user, and be unused. Consumed atomically before the backend call.
+	if req.ReservationToken == "" {
+		return r.forbiddenError(c, "ADMISSION_REQUIRED", "reservation_token from the waiting queue is required")
+	}
+
+	// The attempt ID lets only this request give the token back (and the seats
+	// it reserved from the caller's holds)
+	attemptID := uuid.New().String()
+	consumed, err := r.luaExecutor.ConsumeReservationToken(c.Context(), req.ReservationToken, req.EventID, userID, attemptID, req.SeatIDs)
+	if err != nil {
+		return r.internalError(c, "RESERVATION_ERROR", "Failed to validate reservation token")
+	}
+	if !consumed.Success {
+		r.logger.WithFields(logrus.Fields{
+			"event_id": req.EventID,
+			"user_id":  userID,
+			"reason":   consumed.Error,
+		}).Warn("Reservation token rejected")
+		return r.reservationTokenError(c, consumed.Error)
+	}
+
 	// Call reservation API via gRPC
+	started := time.Now()
 	reservation, err := r.client.CreateReservation(c.Context(), req.EventID, req.SeatIDs, req.Quantity, req.ReservationToken, userID)
+	r.recordWaveFeedback(req.EventID, time.Since(started), err)
 	if err != nil {
 		r.logger.WithError(err).WithFields(logrus.Fields{
 			"event_id": req.EventID,
@@ -83,9 +118,19 @@ func (r *ReservationHandler) Create(c *fiber.Ctx) error {
 			"quantity": req.Quantity,
 		}).Error("Failed to create reservation")
 
+		// Give the token and the held seats back so the user can retry within its TTL
+		if restored, restoreErr := r.luaExecutor.RestoreReservationToken(context.Background(), req.EventID, req.ReservationToken, attemptID); restoreErr != nil || !restored.Success {
+			r.logger.WithError(restoreErr).WithField("event_id", req.EventID).Warn("Failed to restore reservation token")
+		}
+
 		return r.handleClientError(c, err, "create reservation")
 	}
 
+	// The grant became a reservation; its seats now count against the inventory itself
+	if err := queue.ReleaseGrant(context.Background(), r.redisClient, req.EventID, req.ReservationToken); err != nil {
+		r.logger.WithError(err).WithField("event_id", req.EventID).Warn("Failed to release reservation grant")
+	}
+
 	// Convert gRPC response to API response
 	response := ReservationResponse{
 		ReservationID: reservation.ReservationId,
@@ -250,6 +295,34 @@ func (r *ReservationHandler) Cancel(c *fiber.Ctx) error {
 	})
 }
 
+// reservationTokenError maps a rejected reservation token to an API error
+func (r *ReservationHandler) reservationTokenError(c *fiber.Ctx, reason string) error {
+	switch reason {
+	case "ALREADY_USED":
+		return r.conflictError(c, "RESERVATION_TOKEN_USED", "Reservation token has already been used")
+	case "EVENT_MISMATCH", "USER_MISMATCH":
+		return r.forbiddenError(c, "RESERVATION_TOKEN_MISMATCH", "Reservation token was not issued for this event and user")
+	default:
+		return r.forbiddenError(c, "INVALID_RESERVATION_TOKEN", "Reservation token not found or expired")
+	}
+}
+
+// recordWaveFeedback reports the backend outcome used to size admission waves.
+// Client errors (not found, conflict, bad request) are not backend failures.
+func (r *ReservationHandler) recordWaveFeedback(eventID string, latency time.Duration, err error) {
+	failed := false
+	if err != nil {
+		errorMsg := err.Error()
+		failed = !utils.ContainsSubstring(errorMsg, "404") && !utils.ContainsSubstring(errorMsg, "not found") &&
+			!utils.ContainsSubstring(errorMsg, "409") && !utils.ContainsSubstring(errorMsg, "conflict") &&
+			!utils.ContainsSubstring(errorMsg, "400") && !utils.ContainsSubstring(errorMsg, "bad request")
+	}
+
+	if err := queue.RecordReservationOutcome(context.Background(), r.redisClient, eventID, latency, failed); err != nil {
+		r.logger.WithError(err).WithField("event_id", eventID).Debug("Failed to record wave feedback")
+	}
+}
+
 // handleClientError handles errors from backend client calls
 func (r *ReservationHandler) handleClientError(c *fiber.Ctx, err error, operation string) error {
 	// Map common client errors to appropriate HTTP status codes
@@ -4,18 +4,22 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/traffic-tacos/gateway-api/internal/auth"
 	"github.com/traffic-tacos/gateway-api/internal/clients"
 	"github.com/traffic-tacos/gateway-api/internal/config"
 	"github.com/traffic-tacos/gateway-api/internal/metrics"
 	"github.com/traffic-tacos/gateway-api/internal/middleware"
+	"github.com/traffic-tacos/gateway-api/internal/queue"
 
+	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/swagger"
 	"github.com/sirupsen/logrus"
 )
 
-// Setup configures all API routes
-func Setup(app *fiber.App, cfg *config.Config, logger *logrus.Logger, middlewareManager *middleware.Manager, dynamoClient *dynamodb.Client) {
+// Setup configures all API routes. The policy and control stores are shared
+// with the background workers so admin updates invalidate every cache.
+func Setup(app *fiber.App, cfg *config.Config, logger *logrus.Logger, middlewareManager *middleware.Manager, dynamoClient *dynamodb.Client, policyStore *queue.PolicyStore, controlStore *queue.ControlStore) {
 	// Initialize gRPC clients
 	reservationClient, err := clients.NewReservationClient(&cfg.Backend.ReservationAPI, logger)
 	if err != nil {
@@ -27,18 +31,32 @@ func Setup(app *fiber.App, cfg *config.Config, logger *logrus.Logger, middleware
 		logger.WithError(err).Fatal("Failed to create payment client")
 	}
 
+	// Waiting tokens are signed so a leaked or forged token cannot be used from another session
+	tokenSigner, err := newWaitingTokenSigner(cfg)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to create waiting token signer")
+	}
+
 	// Create route handlers
-	queueHandler := NewQueueHandler(middlewareManager.RedisClient, logger)
-	reservationHandler := NewReservationHandler(reservationClient, logger)
+	queueHandler := NewQueueHandler(middlewareManager.RedisClient, policyStore, controlStore, tokenSigner, logger)
+	reservationHandler := NewReservationHandler(reservationClient, middlewareManager.RedisClient, logger)
+	seatHandler := NewSeatHandler(middlewareManager.RedisClient, policyStore, logger)
 	paymentHandler := NewPaymentHandler(paymentClient, logger)
-	authHandler := NewAuthHandler(dynamoClient, cfg.DynamoDB.UsersTableName, cfg.JWT.Secret, logger)
-	adminHandler := NewAdminHandler(middlewareManager.RedisClient, logger)
+	sessionStore := auth.NewSessionStore(middlewareManager.RedisClient, &cfg.JWT, logger)
+	loginGuard := auth.NewLoginGuard(middlewareManager.RedisClient, &cfg.Login, logger)
+	authHandler := NewAuthHandler(dynamoClient, middlewareManager.RedisClient, policyStore, sessionStore, middlewareManager.SigningKeys, loginGuard, cfg.DynamoDB.UsersTableName, cfg.JWT.SelfIssuer, logger)
+	wellKnownHandler := NewWellKnownHandler(middlewareManager.SigningKeys, cfg.JWT.SelfIssuer, logger)
+	adminHandler := NewAdminHandler(middlewareManager.RedisClient, policyStore, controlStore, loginGuard, logger)
 
 	// Health check endpoints (no auth required)
 	app.Get("/healthz", healthCheck)
 	app.Get("/readyz", readinessCheck(middlewareManager))
 	app.Get("/version", versionHandler)
 
+	// Self-issued token keys and OIDC discovery (no auth required)
+	app.Get("/.well-known/jwks.json", wellKnownHandler.JWKS)
+	app.Get("/.well-known/openid-configuration", wellKnownHandler.OpenIDConfiguration)
+
 	// Metrics endpoint (no auth required)
 	app.Get(cfg.Observability.MetricsPath, metrics.PrometheusHandler())
 
@@ -48,27 +66,37 @@ func Setup(app *fiber.App, cfg *config.Config, logger *logrus.Logger, middleware
 	// API routes with middleware
 	api := app.Group("/api/v1")
 
-	// Admin routes (no middleware - for testing and monitoring)
-	adminRoutes := api.Group("/admin")
-	adminRoutes.Post("/flush-test-data", adminHandler.FlushTestData)
-	adminRoutes.Get("/health", adminHandler.HealthCheck)
-	adminRoutes.Get("/stats", adminHandler.GetStats)
+	// Admin routes (no rate limiting or idempotency)
+	setupAdminRoutes(api, middlewareManager, adminHandler)
 
 	// Apply global middleware to API routes (after admin routes)
 	api.Use(metrics.HTTPMetricsMiddleware())
+	api.Use(middlewareManager.Session.Handle()) // Anonymous identity for rate limiting and queue joins
 	api.Use(middlewareManager.RateLimit.Handle())
 	api.Use(middlewareManager.Idempotency.Handle())
 	api.Use(middlewareManager.Idempotency.ResponseCapture())
 
-	// Auth routes (public endpoints - no auth required)
+	// Auth routes (public endpoints - no auth required, except logging out)
 	authRoutes := api.Group("/auth")
 	authRoutes.Post("/login", authHandler.Login)
 	authRoutes.Post("/register", authHandler.Register)
+	authRoutes.Post("/refresh", authHandler.Refresh)
+	authRoutes.Post("/logout", middlewareManager.Auth.Authenticate(nil), authHandler.Logout)
+	authRoutes.Post("/logout-all", middlewareManager.Auth.Authenticate(nil), authHandler.LogoutAll)
+
+	// Test identity tokens (only when TEST_IDENTITY_ENABLED, development and loadtest environments)
+	if middlewareManager.TestIdentity != nil {
+		testIdentityHandler := NewTestIdentityHandler(middlewareManager.TestIdentity, logger)
+		authRoutes.Post("/test-tokens", testIdentityHandler.Mint)
+	}
 
-	// Queue management routes (public endpoints - no auth required)
+	// Queue management routes (public endpoints - auth optional, JWT claims pick the priority lane)
 	queueRoutes := api.Group("/queue")
+	queueRoutes.Use(middlewareManager.Auth.OptionalAuthenticate())
 	queueRoutes.Post("/join", queueHandler.Join)
 	queueRoutes.Get("/status", queueHandler.Status)
+	queueRoutes.Get("/status/stream", queueHandler.StatusStream)
+	queueRoutes.Get("/ws", queueHandler.WebSocketUpgrade, websocket.New(queueHandler.WebSocket))
 	queueRoutes.Post("/enter", queueHandler.Enter)
 	queueRoutes.Delete("/leave", queueHandler.Leave)
 
@@ -76,6 +104,7 @@ func Setup(app *fiber.App, cfg *config.Config, logger *logrus.Logger, middleware
 	// Auth 미들웨어를 보호된 라우트에만 적용
 	protected := api.Group("")
 	protected.Use(middlewareManager.Auth.Authenticate([]string{"/healthz", "/readyz", "/version", "/metrics", "/swagger"}))
+	protected.Use(middlewareManager.RBAC.Authorize(accessPolicies))
 
 	// Reservation routes
 	reservationRoutes := protected.Group("/reservations")
@@ -84,6 +113,13 @@ func Setup(app *fiber.App, cfg *config.Config, logger *logrus.Logger, middleware
 	reservationRoutes.Post("/:id/confirm", reservationHandler.Confirm)
 	reservationRoutes.Post("/:id/cancel", reservationHandler.Cancel)
 
+	// Seat map with a change feed, and seat holds (admitted users hold seats before reserving them)
+	seatRoutes := protected.Group("/events/:id/seats")
+	seatRoutes.Get("/", seatHandler.Map)
+	seatRoutes.Get("/changes", seatHandler.Changes)
+	seatRoutes.Post("/:seat/hold", seatHandler.Hold)
+	seatRoutes.Delete("/:seat/hold", seatHandler.Release)
+
 	// Payment routes
 	paymentRoutes := protected.Group("/payment")
 	paymentRoutes.Post("/intent", paymentHandler.CreateIntent)
@@ -94,6 +130,24 @@ func Setup(app *fiber.App, cfg *config.Config, logger *logrus.Logger, middleware
 	app.Use(notFoundHandler)
 }
 
+// setupAdminRoutes registers the admin routes on api, behind authentication
+// and the admin role (see accessPolicies)
+func setupAdminRoutes(api fiber.Router, middlewareManager *middleware.Manager, adminHandler *AdminHandler) {
+	adminRoutes := api.Group("/admin",
+		middlewareManager.Auth.Authenticate(nil),
+		middlewareManager.RBAC.Authorize(accessPolicies))
+	adminRoutes.Post("/flush-test-data", adminHandler.FlushTestData)
+	adminRoutes.Get("/health", adminHandler.HealthCheck)
+	adminRoutes.Get("/stats", adminHandler.GetStats)
+	adminRoutes.Get("/events/:id/policy", adminHandler.GetQueuePolicy)
+	adminRoutes.Put("/events/:id/policy", adminHandler.PutQueuePolicy)
+	adminRoutes.Delete("/events/:id/policy", adminHandler.DeleteQueuePolicy)
+	adminRoutes.Get("/events/:id/queue", adminHandler.GetQueueAnalytics)
+	adminRoutes.Get("/events/:id/queue/state", adminHandler.GetQueueState)
+	adminRoutes.Post("/events/:id/queue/:action", adminHandler.SetQueueState)
+	adminRoutes.Post("/users/:username/unlock", adminHandler.UnlockUser)
+}
+
 // healthCheck returns the health status of the service
 // @Summary Health check
 // @Description Check if the service is healthy
@@ -0,0 +1,354 @@
+package routes
+
+import (
+	"time"
+
+	"github.com/traffic-tacos/gateway-api/internal/metrics"
+	"github.com/traffic-tacos/gateway-api/internal/middleware"
+	"github.com/traffic-tacos/gateway-api/internal/queue"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// maxSeatIDLength bounds seat IDs taken from the path before they become Redis keys
+	maxSeatIDLength = 64
+
+	// Page size of the seat change feed
+	defaultSeatChangesLimit = 500
+	maxSeatChangesLimit     = 5000
+)
+
+type SeatHandler struct {
+	redisClient redis.UniversalClient
+	luaExecutor *queue.LuaExecutor
+	policies    *queue.PolicyStore
+	logger      *logrus.Logger
+}
+
+// SeatHoldResponse represents a seat hold or release
+type SeatHoldResponse struct {
+	EventID   string     `json:"event_id"`
+	SeatID    string     `json:"seat_id"`
+	Status    string     `json:"status"`               // held|released
+	Remaining int64      `json:"remaining"`            // Seats left in the event's inventory
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // When an unreserved hold is released
+}
+
+// SeatMapResponse represents an event's seat statuses
+type SeatMapResponse struct {
+	EventID string            `json:"event_id"`
+	Seats   map[string]string `json:"seats"`  // Seat ID -> AVAILABLE/HOLD/...
+	Cursor  string            `json:"cursor"` // Pass as since to /seats/changes
+}
+
+// SeatChangesResponse represents the seat changes after a cursor
+type SeatChangesResponse struct {
+	EventID string             `json:"event_id"`
+	Changes []queue.SeatChange `json:"changes"`
+	Cursor  string             `json:"cursor"` // Pass as since on the next poll
+	Reset   bool               `json:"reset"`  // The cursor expired; reload the seat map
+}
+
+func NewSeatHandler(redisClient redis.UniversalClient, policies *queue.PolicyStore, logger *logrus.Logger) *SeatHandler {
+	return &SeatHandler{
+		redisClient: redisClient,
+		luaExecutor: queue.NewLuaExecutor(redisClient, logger),
+		policies:    policies,
+		logger:      logger,
+	}
+}
+
+// Map handles seat map reads
+// @Summary Get the seat map
+// @Description Get the status of every seat of an event with a cursor for /seats/changes. Supports If-None-Match.
+// @Tags Seats
+// @Produce json
+// @Security Bearer
+// @Param id path string true "Event ID"
+// @Param If-None-Match header string false "ETag of a previously fetched seat map"
+// @Success 200 {object} SeatMapResponse
+// @Success 304 "Seat map unchanged"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 500 {object} map[string]interface{} "Internal error"
+// @Router /events/{id}/seats [get]
+func (s *SeatHandler) Map(c *fiber.Ctx) error {
+	eventID := c.Params("id")
+
+	seatMap, err := queue.LoadSeatMap(c.Context(), s.redisClient, eventID)
+	if err != nil {
+		s.logger.WithError(err).WithField("event_id", eventID).Error("Failed to load seat map")
+		return s.internalError(c, "SEAT_MAP_ERROR", "Failed to load seat map")
+	}
+
+	c.Set(fiber.HeaderETag, seatMap.ETag)
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	if c.Get(fiber.HeaderIfNoneMatch) == seatMap.ETag {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	return c.JSON(SeatMapResponse{
+		EventID: eventID,
+		Seats:   seatMap.Seats,
+		Cursor:  seatMap.Cursor,
+	})
+}
+
+// Changes handles the seat change feed
+// @Summary Get seat changes
+// @Description Get seat status changes recorded after a cursor from /seats or a previous poll. When reset is true the cursor expired and the seat map must be reloaded.
+// @Tags Seats
+// @Produce json
+// @Security Bearer
+// @Param id path string true "Event ID"
+// @Param since query string true "Cursor"
+// @Param limit query int false "Maximum changes to return (default 500, max 5000)"
+// @Success 200 {object} SeatChangesResponse
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 500 {object} map[string]interface{} "Internal error"
+// @Router /events/{id}/seats/changes [get]
+func (s *SeatHandler) Changes(c *fiber.Ctx) error {
+	eventID := c.Params("id")
+
+	since := c.Query("since")
+	if !queue.ValidSeatChangesCursor(since) {
+		return s.badRequestError(c, "INVALID_CURSOR", "since must be a cursor returned by the seat map or a previous poll")
+	}
+
+	limit := c.QueryInt("limit", defaultSeatChangesLimit)
+	if limit < 1 || limit > maxSeatChangesLimit {
+		return s.badRequestError(c, "INVALID_LIMIT", "limit must be between 1 and 5000")
+	}
+
+	feed, err := queue.SeatChanges(c.Context(), s.redisClient, eventID, since, int64(limit))
+	if err != nil {
+		s.logger.WithError(err).WithField("event_id", eventID).Error("Failed to read seat changes")
+		return s.internalError(c, "SEAT_MAP_ERROR", "Failed to read seat changes")
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	return c.JSON(SeatChangesResponse{
+		EventID: eventID,
+		Changes: feed.Changes,
+		Cursor:  feed.Cursor,
+		Reset:   feed.Reset,
+	})
+}
+
+// Hold handles seat holds
+// @Summary Hold a seat
+// @Description Hold a seat for the event's seat_hold_ttl_sec. Requires the reservation token granted by /queue/enter; at most max_holds_per_user seats may be held at once.
+// @Tags Seats
+// @Produce json
+// @Security Bearer
+// @Param id path string true "Event ID"
+// @Param seat path string true "Seat ID"
+// @Param X-Reservation-Token header string true "Reservation token from /queue/enter"
+// @Success 200 {object} SeatHoldResponse
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Missing or invalid queue admission"
+// @Failure 404 {object} map[string]interface{} "Unknown seat or event has no seat inventory"
+// @Failure 409 {object} map[string]interface{} "Seat unavailable or hold limit reached"
+// @Failure 410 {object} map[string]interface{} "Event sold out"
+// @Failure 500 {object} map[string]interface{} "Internal error"
+// @Router /events/{id}/seats/{seat}/hold [post]
+func (s *SeatHandler) Hold(c *fiber.Ctx) error {
+	eventID := c.Params("id")
+	seatID := c.Params("seat")
+	if eventID == "" || seatID == "" || len(seatID) > maxSeatIDLength {
+		return s.badRequestError(c, "INVALID_SEAT", "A valid event id and seat id are required")
+	}
+
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return s.unauthorizedError(c, "MISSING_USER", "User authentication required")
+	}
+
+	// 🔴 Queue admission: only users admitted by /queue/enter may hold seats.
+	// The token is checked, not consumed; POST /reservations consumes it.
+	reservationToken := c.Get("X-Reservation-Token")
+	if reservationToken == "" {
+		return s.forbiddenError(c, "ADMISSION_REQUIRED", "X-Reservation-Token from the waiting queue is required")
+	}
+
+	admission, err := s.luaExecutor.CheckReservationToken(c.Context(), reservationToken, eventID, userID)
+	if err != nil {
+		s.logger.WithError(err).WithField("event_id", eventID).Error("Failed to check reservation token")
+		return s.internalError(c, "SEAT_HOLD_ERROR", "Failed to validate reservation token")
+	}
+	if !admission.Success {
+		metrics.RecordSeatHolds("rejected", 1)
+		return s.reservationTokenError(c, admission.Error)
+	}
+
+	policy, err := s.policies.Get(c.Context(), eventID)
+	if err != nil {
+		s.logger.WithError(err).WithField("event_id", eventID).Warn("Failed to load queue policy, using defaults")
+	}
+
+	result, err := s.luaExecutor.HoldSeatAtomic(c.Context(), eventID, seatID, userID, policy.SeatHoldTTLSeconds, policy.MaxHoldsPerUser)
+	if err != nil {
+		return s.internalError(c, "SEAT_HOLD_ERROR", "Failed to hold seat")
+	}
+	if !result.Success {
+		metrics.RecordSeatHolds("rejected", 1)
+		switch result.Error {
+		case "HOLD_LIMIT":
+			return s.conflictError(c, "HOLD_LIMIT_REACHED", "You already hold the maximum number of seats for this event")
+		case "SOLD_OUT":
+			return s.soldOutError(c)
+		case "NO_INVENTORY":
+			return s.notFoundError(c, "INVENTORY_NOT_FOUND", "No seat inventory for this event")
+		case "UNKNOWN_SEAT":
+			return s.notFoundError(c, "SEAT_NOT_FOUND", "Seat does not exist for this event")
+		default:
+			return s.conflictError(c, "SEAT_UNAVAILABLE", "Seat is not available")
+		}
+	}
+	metrics.RecordSeatHolds("held", 1)
+
+	expiresAt := time.Now().Add(policy.SeatHoldTTL()).UTC()
+	return c.JSON(SeatHoldResponse{
+		EventID:   eventID,
+		SeatID:    seatID,
+		Status:    "held",
+		Remaining: result.Remaining,
+		ExpiresAt: &expiresAt,
+	})
+}
+
+// Release handles seat hold releases
+// @Summary Release a seat hold
+// @Description Release a seat held by the caller and return it to the event's inventory
+// @Tags Seats
+// @Produce json
+// @Security Bearer
+// @Param id path string true "Event ID"
+// @Param seat path string true "Seat ID"
+// @Success 200 {object} SeatHoldResponse
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Seat held by another user"
+// @Failure 404 {object} map[string]interface{} "Seat not held"
+// @Failure 500 {object} map[string]interface{} "Internal error"
+// @Router /events/{id}/seats/{seat}/hold [delete]
+func (s *SeatHandler) Release(c *fiber.Ctx) error {
+	eventID := c.Params("id")
+	seatID := c.Params("seat")
+	if eventID == "" || seatID == "" || len(seatID) > maxSeatIDLength {
+		return s.badRequestError(c, "INVALID_SEAT", "A valid event id and seat id are required")
+	}
+
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		return s.unauthorizedError(c, "MISSING_USER", "User authentication required")
+	}
+
+	// The holder was admitted when the hold was placed; the reservation token
+	// may have expired or been consumed since, so only ownership is checked here
+	result, err := s.luaExecutor.ReleaseSeatAtomic(c.Context(), eventID, seatID, userID)
+	if err != nil {
+		return s.internalError(c, "SEAT_HOLD_ERROR", "Failed to release seat")
+	}
+	if !result.Success {
+		if result.Error == "NOT_HOLDER" {
+			return s.forbiddenError(c, "NOT_SEAT_HOLDER", "Seat is held by another user")
+		}
+		return s.notFoundError(c, "SEAT_NOT_HELD", "Seat is not held")
+	}
+	metrics.RecordSeatHolds("released", 1)
+
+	return c.JSON(SeatHoldResponse{
+		EventID:   eventID,
+		SeatID:    seatID,
+		Status:    "released",
+		Remaining: result.Remaining,
+	})
+}
+
+// reservationTokenError maps a rejected reservation token to an API error
+func (s *SeatHandler) reservationTokenError(c *fiber.Ctx, reason string) error {
+	switch reason {
+	case "ALREADY_USED":
+		return s.conflictError(c, "RESERVATION_TOKEN_USED", "Reservation token has already been used")
+	case "EVENT_MISMATCH", "USER_MISMATCH":
+		return s.forbiddenError(c, "RESERVATION_TOKEN_MISMATCH", "Reservation token was not issued for this event and user")
+	default:
+		return s.forbiddenError(c, "INVALID_RESERVATION_TOKEN", "Reservation token not found or expired")
+	}
+}
+
+// Error response helpers
+func (s *SeatHandler) badRequestError(c *fiber.Ctx, code, message string) error {
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":     code,
+			"message":  message,
+			"trace_id": c.Get("X-Request-ID"),
+		},
+	})
+}
+
+func (s *SeatHandler) unauthorizedError(c *fiber.Ctx, code, message string) error {
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":     code,
+			"message":  message,
+			"trace_id": c.Get("X-Request-ID"),
+		},
+	})
+}
+
+func (s *SeatHandler) forbiddenError(c *fiber.Ctx, code, message string) error {
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":     code,
+			"message":  message,
+			"trace_id": c.Get("X-Request-ID"),
+		},
+	})
+}
+
+func (s *SeatHandler) notFoundError(c *fiber.Ctx, code, message string) error {
+	return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":     code,
+			"message":  message,
+			"trace_id": c.Get("X-Request-ID"),
+		},
+	})
+}
+
+func (s *SeatHandler) conflictError(c *fiber.Ctx, code, message string) error {
+	return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":     code,
+			"message":  message,
+			"trace_id": c.Get("X-Request-ID"),
+		},
+	})
+}
+
+func (s *SeatHandler) soldOutError(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusGone).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":     "SOLD_OUT",
+			"message":  soldOutMessage,
+			"trace_id": c.Get("X-Request-ID"),
+		},
+	})
+}
+
+func (s *SeatHandler) internalError(c *fiber.Ctx, code, message string) error {
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":     code,
+			"message":  message,
+			"trace_id": c.Get("X-Request-ID"),
+		},
+	})
+}
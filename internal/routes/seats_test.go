@@ -0,0 +1,70 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/traffic-tacos/gateway-api/internal/queue"
+	"github.com/traffic-tacos/gateway-api/internal/testutil"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeatHold_UnknownSeat(t *testing.T) {
+	redisClient := testutil.NewRedisClient(t)
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+	ctx := context.Background()
+
+	eventID := "test-seat-hold-unknown-evt"
+	reservationToken := "test-seat-hold-token"
+	keys := []string{
+		queue.SeatStatusKey(eventID), queue.InventoryKey(eventID), queue.ReservationTokenKey(eventID, reservationToken),
+		queue.SeatHoldKey(eventID, "A-1"), queue.UserHoldsKey(eventID, "user-1"), queue.HoldOwnersKey(eventID),
+		queue.HoldExpiryKey(eventID), queue.SeatChangesKey(eventID),
+	}
+	redisClient.Del(ctx, keys...)
+	t.Cleanup(func() {
+		redisClient.Del(ctx, keys...)
+		redisClient.ZRem(ctx, queue.HoldEventsKey, eventID)
+	})
+
+	require.NoError(t, redisClient.HSet(ctx, queue.SeatStatusKey(eventID), "A-1", "AVAILABLE").Err())
+	require.NoError(t, redisClient.Set(ctx, queue.InventoryKey(eventID), 1, 0).Err())
+	grant, err := json.Marshal(map[string]interface{}{"event_id": eventID, "user_id": "user-1", "used": false})
+	require.NoError(t, err)
+	require.NoError(t, redisClient.Set(ctx, queue.ReservationTokenKey(eventID, reservationToken), grant, 0).Err())
+
+	handler := NewSeatHandler(redisClient, queue.NewPolicyStore(redisClient, logger), logger)
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("user_id", "user-1")
+		return c.Next()
+	})
+	app.Post("/events/:id/seats/:seat/hold", handler.Hold)
+
+	hold := func(seatID string) int {
+		req := httptest.NewRequest(fiber.MethodPost, "/events/"+eventID+"/seats/"+seatID+"/hold", nil)
+		req.Header.Set("X-Reservation-Token", reservationToken)
+		resp, err := app.Test(req, -1)
+		require.NoError(t, err)
+		return resp.StatusCode
+	}
+
+	// An invented seat ID is refused and leaves inventory and the seat map alone
+	assert.Equal(t, fiber.StatusNotFound, hold("invented-seat"))
+	inventory, err := redisClient.Get(ctx, queue.InventoryKey(eventID)).Int64()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), inventory)
+	exists, err := redisClient.HExists(ctx, queue.SeatStatusKey(eventID), "invented-seat").Result()
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	// A seat of the seat map can still be held
+	assert.Equal(t, fiber.StatusOK, hold("A-1"))
+}
@@ -0,0 +1,97 @@
+package routes
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+
+	"github.com/traffic-tacos/gateway-api/internal/auth"
+	"github.com/traffic-tacos/gateway-api/internal/models"
+)
+
+// maxTestTokens bounds the tokens minted by one request
+const maxTestTokens = 1000
+
+// TestIdentityHandler mints test identity tokens. Its route is only registered
+// when the provider is enabled (development and loadtest environments).
+type TestIdentityHandler struct {
+	provider *auth.TestIdentityProvider
+	logger   *logrus.Logger
+}
+
+// NewTestIdentityHandler creates a new test identity handler
+func NewTestIdentityHandler(provider *auth.TestIdentityProvider, logger *logrus.Logger) *TestIdentityHandler {
+	return &TestIdentityHandler{
+		provider: provider,
+		logger:   logger,
+	}
+}
+
+// Mint handles test token requests
+// @Summary Mint test tokens
+// @Description Development and load tests only: mint signed access tokens for a configured subject, or for a range of load test user IDs. Disabled unless TEST_IDENTITY_ENABLED is set.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param request body models.TestTokenRequest true "Subject or user ID range, and role"
+// @Success 200 {object} map[string]interface{} "Minted tokens"
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 403 {object} map[string]interface{} "Subject, role or user IDs not allowed"
+// @Router /auth/test-tokens [post]
+func (h *TestIdentityHandler) Mint(c *fiber.Ctx) error {
+	var req models.TestTokenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return h.errorResponse(c, fiber.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+	}
+	if req.Role == "" {
+		req.Role = "user"
+	}
+
+	var tokens []auth.TestToken
+	var err error
+	if req.Subject != "" {
+		var token *auth.TestToken
+		token, err = h.provider.Mint(req.Subject, req.Role)
+		if token != nil {
+			tokens = []auth.TestToken{*token}
+		}
+	} else {
+		if req.Count == 0 {
+			req.Count = 1
+		}
+		if req.Count > maxTestTokens {
+			return h.errorResponse(c, fiber.StatusBadRequest, "INVALID_REQUEST", "count must not exceed 1000")
+		}
+		tokens, err = h.provider.MintRange(req.From, req.Count, req.Role)
+	}
+
+	switch {
+	case errors.Is(err, auth.ErrTestSubjectNotAllowed), errors.Is(err, auth.ErrTestRoleNotAllowed), errors.Is(err, auth.ErrTestUserIDRange):
+		return h.errorResponse(c, fiber.StatusForbidden, "TEST_IDENTITY_NOT_ALLOWED", err.Error())
+	case err != nil:
+		h.logger.WithError(err).Error("Failed to mint test tokens")
+		return h.errorResponse(c, fiber.StatusInternalServerError, "INTERNAL_ERROR", "Failed to mint test tokens")
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"subject": tokens[0].Subject,
+		"role":    req.Role,
+		"count":   len(tokens),
+	}).Info("Minted test identity tokens")
+
+	return c.JSON(fiber.Map{
+		"tokens": tokens,
+		"key_id": h.provider.KeyID(),
+	})
+}
+
+func (h *TestIdentityHandler) errorResponse(c *fiber.Ctx, status int, code, message string) error {
+	return c.Status(status).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":     code,
+			"message":  message,
+			"trace_id": c.Get("X-Request-ID"),
+		},
+	})
+}
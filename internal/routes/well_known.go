@@ -0,0 +1,98 @@
+package routes
+
+import (
+	"sort"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+
+	"github.com/traffic-tacos/gateway-api/internal/auth"
+)
+
+// jwksMaxAge is how long clients may cache the key set. New keys are published
+// well before they sign (see auth.KeyRing), so caching is safe.
+const jwksMaxAge = "public, max-age=300"
+
+// WellKnownHandler publishes the keys of self-issued tokens, so other services
+// verify them without holding a secret
+type WellKnownHandler struct {
+	signingKeys *auth.KeyRing
+	issuer      string
+	logger      *logrus.Logger
+}
+
+// NewWellKnownHandler creates a new well-known handler
+func NewWellKnownHandler(signingKeys *auth.KeyRing, issuer string, logger *logrus.Logger) *WellKnownHandler {
+	return &WellKnownHandler{
+		signingKeys: signingKeys,
+		issuer:      issuer,
+		logger:      logger,
+	}
+}
+
+// JWKS returns the public keys of self-issued tokens
+// @Summary JSON Web Key Set
+// @Description Public keys self-issued access tokens are signed with, by "kid". Includes the next key before it signs and retired keys until their tokens expire.
+// @Tags System
+// @Produce json
+// @Success 200 {object} map[string]interface{} "JWK set"
+// @Failure 503 {object} map[string]interface{} "Keys unavailable"
+// @Router /.well-known/jwks.json [get]
+func (h *WellKnownHandler) JWKS(c *fiber.Ctx) error {
+	set, err := h.signingKeys.PublicKeys(c.Context())
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to load signing keys")
+		return h.unavailableError(c)
+	}
+
+	c.Set(fiber.HeaderCacheControl, jwksMaxAge)
+	return c.JSON(set)
+}
+
+// OpenIDConfiguration returns the OIDC discovery document of self-issued tokens
+// @Summary OIDC discovery
+// @Description Issuer, JWKS location and signing algorithms of self-issued access tokens
+// @Tags System
+// @Produce json
+// @Success 200 {object} map[string]interface{} "Discovery document"
+// @Failure 503 {object} map[string]interface{} "Keys unavailable"
+// @Router /.well-known/openid-configuration [get]
+func (h *WellKnownHandler) OpenIDConfiguration(c *fiber.Ctx) error {
+	set, err := h.signingKeys.PublicKeys(c.Context())
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to load signing keys")
+		return h.unavailableError(c)
+	}
+
+	algorithms := make([]string, 0, 1)
+	seen := make(map[string]bool)
+	for i := 0; i < set.Len(); i++ {
+		key, _ := set.Key(i)
+		if alg := key.Algorithm().String(); alg != "" && !seen[alg] {
+			seen[alg] = true
+			algorithms = append(algorithms, alg)
+		}
+	}
+	sort.Strings(algorithms)
+
+	c.Set(fiber.HeaderCacheControl, jwksMaxAge)
+	return c.JSON(fiber.Map{
+		"issuer":                                h.issuer,
+		"jwks_uri":                              c.BaseURL() + "/.well-known/jwks.json",
+		"token_endpoint":                        c.BaseURL() + "/api/v1/auth/login",
+		"response_types_supported":              []string{"token"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": algorithms,
+		"claims_supported":                      []string{"sub", "iss", "aud", "exp", "iat", "jti", "sid", "role", "username"},
+	})
+}
+
+func (h *WellKnownHandler) unavailableError(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":     "KEYS_UNAVAILABLE",
+			"message":  "Signing keys are unavailable",
+			"trace_id": c.Get("X-Request-ID"),
+		},
+	})
+}
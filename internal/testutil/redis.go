@@ -0,0 +1,41 @@
+// Package testutil holds fixtures shared by package tests
+package testutil
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// defaultRedisAddress is the Redis tests run against unless REDIS_ADDRESS is set
+const defaultRedisAddress = "localhost:6379"
+
+// NewRedisClient connects to the Redis tests run against, closing it when the
+// test ends. The test is skipped when Redis is unreachable, except in CI (the
+// CI environment variable is set), where Redis is a service and must be up.
+func NewRedisClient(tb testing.TB) *redis.Client {
+	tb.Helper()
+
+	address := os.Getenv("REDIS_ADDRESS")
+	if address == "" {
+		address = defaultRedisAddress
+	}
+
+	redisClient := redis.NewClient(&redis.Options{
+		Addr: address,
+	})
+	tb.Cleanup(func() { redisClient.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := redisClient.Ping(ctx).Err(); err != nil {
+		if os.Getenv("CI") != "" {
+			tb.Fatalf("Redis unavailable at %s: %v", address, err)
+		}
+		tb.Skipf("Redis unavailable at %s: %v", address, err)
+	}
+	return redisClient
+}
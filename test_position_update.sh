@@ -6,6 +6,10 @@
 BASE_URL="https://api.traffictacos.store/api/v1"
 EVENT_ID="test-event-$(date +%s)"
 
+# Waiting tokens are bound to the queue_session cookie issued on join
+COOKIE_JAR=$(mktemp)
+trap 'rm -f "$COOKIE_JAR"' EXIT
+
 echo "=================================="
 echo "Position Update Test (v1.3.1)"
 echo "=================================="
@@ -24,7 +28,7 @@ TOKENS=()
 for i in {1..5}; do
   echo -n "  User $i joining... "
   
-  RESPONSE=$(curl -s -X POST "$BASE_URL/queue/join" \
+  RESPONSE=$(curl -s -b "$COOKIE_JAR" -c "$COOKIE_JAR" -X POST "$BASE_URL/queue/join" \
     -H "Content-Type: application/json" \
     -d "{\"event_id\": \"$EVENT_ID\", \"user_id\": \"user$i\"}")
   
@@ -51,7 +55,7 @@ echo ""
 echo "📊 Step 2: Checking User 5's initial position..."
 USER5_TOKEN="${TOKENS[4]}"
 
-RESPONSE=$(curl -s "$BASE_URL/queue/status?token=$USER5_TOKEN")
+RESPONSE=$(curl -s -b "$COOKIE_JAR" -c "$COOKIE_JAR" "$BASE_URL/queue/status?token=$USER5_TOKEN")
 INITIAL_POSITION=$(echo $RESPONSE | jq -r '.position')
 
 echo "  User 5 initial position: $INITIAL_POSITION"
@@ -61,7 +65,7 @@ echo ""
 echo "🚪 Step 3: User 1 entering..."
 sleep 5 # Wait minimum 5 seconds (eligibility requirement)
 
-ENTER_RESPONSE=$(curl -s -X POST "$BASE_URL/queue/enter" \
+ENTER_RESPONSE=$(curl -s -b "$COOKIE_JAR" -c "$COOKIE_JAR" -X POST "$BASE_URL/queue/enter" \
   -H "Content-Type: application/json" \
   -H "Idempotency-Key: $(uuidgen)" \
   -d "{\"waiting_token\": \"${TOKENS[0]}\"}")
@@ -80,7 +84,7 @@ echo ""
 
 # Step 4: Check User 5's position again
 echo "📊 Step 4: Checking User 5's position after User 1 entered..."
-RESPONSE=$(curl -s "$BASE_URL/queue/status?token=$USER5_TOKEN")
+RESPONSE=$(curl -s -b "$COOKIE_JAR" -c "$COOKIE_JAR" "$BASE_URL/queue/status?token=$USER5_TOKEN")
 AFTER_POSITION=$(echo $RESPONSE | jq -r '.position')
 
 echo "  User 5 position after User 1 entered: $AFTER_POSITION"
@@ -90,7 +94,7 @@ echo ""
 echo "🚪 Step 5: User 2 entering..."
 sleep 3
 
-ENTER_RESPONSE=$(curl -s -X POST "$BASE_URL/queue/enter" \
+ENTER_RESPONSE=$(curl -s -b "$COOKIE_JAR" -c "$COOKIE_JAR" -X POST "$BASE_URL/queue/enter" \
   -H "Content-Type: application/json" \
   -H "Idempotency-Key: $(uuidgen)" \
   -d "{\"waiting_token\": \"${TOKENS[1]}\"}")
@@ -108,7 +112,7 @@ echo ""
 
 # Step 6: Check User 5's position again
 echo "📊 Step 6: Checking User 5's position after User 2 entered..."
-RESPONSE=$(curl -s "$BASE_URL/queue/status?token=$USER5_TOKEN")
+RESPONSE=$(curl -s -b "$COOKIE_JAR" -c "$COOKIE_JAR" "$BASE_URL/queue/status?token=$USER5_TOKEN")
 FINAL_POSITION=$(echo $RESPONSE | jq -r '.position')
 
 echo "  User 5 position after User 2 entered: $FINAL_POSITION"
@@ -142,7 +146,7 @@ echo ""
 # Step 8: Cleanup (leave remaining users)
 echo "🧹 Cleaning up remaining users..."
 for i in {2..4}; do
-  curl -s -X DELETE "$BASE_URL/queue/leave?token=${TOKENS[$i]}" > /dev/null
+  curl -s -b "$COOKIE_JAR" -c "$COOKIE_JAR" -X DELETE "$BASE_URL/queue/leave?token=${TOKENS[$i]}" > /dev/null
   echo "  User $(($i + 1)) left"
 done
 